@@ -0,0 +1,86 @@
+/*
+ * Copyright (C) 2019-Present Pivotal Software, Inc. All rights reserved.
+ *
+ * This program and the accompanying materials are made available under the terms
+ * of the Apache License, Version 2.0 (the "License”); you may not use this file
+ * except in compliance with the License. You may obtain a copy of the License at:
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software distributed
+ * under the License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR
+ * CONDITIONS OF ANY KIND, either express or implied. See the License for the
+ * specific language governing permissions and limitations under the License.
+ */
+
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/bvinc/go-sqlite-lite/sqlite3"
+
+	"skenario/pkg/data"
+	"skenario/pkg/serve"
+)
+
+// compare prints a statistical comparison of two stored runs.
+func compare(args []string) int {
+	flags := flag.NewFlagSet("compare", flag.ContinueOnError)
+	dbFileName := flags.String("db", "skenario.db", "database file holding the runs")
+	format := flags.String("format", "table", "output format, either 'table' or 'json'")
+	interval := flags.Duration("interval", time.Second, "how often to sample replica counts for the timeline")
+	flags.Usage = func() {
+		fmt.Fprintln(flags.Output(), "usage: skenario compare [flags] <run id a> <run id b>")
+		flags.PrintDefaults()
+	}
+
+	err := flags.Parse(args)
+	if err != nil {
+		return 2
+	}
+	if flags.NArg() != 2 {
+		flags.Usage()
+		return 2
+	}
+
+	ids := make([]int64, 2)
+	for i := range ids {
+		ids[i], err = strconv.ParseInt(flags.Arg(i), 10, 64)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "invalid run ID '%s'\n", flags.Arg(i))
+			return 2
+		}
+	}
+
+	conn, err := sqlite3.Open(*dbFileName, sqlite3.OPEN_READONLY)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "could not open database file '%s': %s\n", *dbFileName, err.Error())
+		return 1
+	}
+	defer conn.Close()
+
+	comparison, err := data.CompareRuns(conn, ids[0], ids[1], *interval)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "could not compare runs: %s\n", err.Error())
+		return 1
+	}
+
+	switch *format {
+	case "json":
+		err = json.NewEncoder(os.Stdout).Encode(comparison)
+	default:
+		err = serve.WriteComparisonTable(os.Stdout, comparison)
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "could not write comparison: %s\n", err.Error())
+		return 1
+	}
+
+	return 0
+}
@@ -0,0 +1,125 @@
+/*
+ * Copyright (C) 2019-Present Pivotal Software, Inc. All rights reserved.
+ *
+ * This program and the accompanying materials are made available under the terms
+ * of the Apache License, Version 2.0 (the "License”); you may not use this file
+ * except in compliance with the License. You may obtain a copy of the License at:
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software distributed
+ * under the License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR
+ * CONDITIONS OF ANY KIND, either express or implied. See the License for the
+ * specific language governing permissions and limitations under the License.
+ */
+
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+
+	"github.com/bvinc/go-sqlite-lite/sqlite3"
+
+	"skenario/pkg/data"
+	"skenario/pkg/serve"
+)
+
+// export writes tables of a stored run as CSV or Parquet. A single table goes to standard output
+// unless -out names a file. With "-table all", every table is written into the -out directory.
+func export(args []string) int {
+	flags := flag.NewFlagSet("export", flag.ContinueOnError)
+	dbFileName := flags.String("db", "skenario.db", "database file holding the run")
+	format := flags.String("format", "csv", "output format, either 'csv' or 'parquet'")
+	table := flags.String("table", "summary", fmt.Sprintf("table to export, 'all' or one of %v", data.ExportTables))
+	out := flags.String("out", "", "file to write to, or directory when exporting all tables")
+	flags.Usage = func() {
+		fmt.Fprintln(flags.Output(), "usage: skenario export [flags] <run id>")
+		flags.PrintDefaults()
+	}
+
+	err := flags.Parse(args)
+	if err != nil {
+		return 2
+	}
+	if flags.NArg() != 1 {
+		flags.Usage()
+		return 2
+	}
+
+	scenarioRunId, err := strconv.ParseInt(flags.Arg(0), 10, 64)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "invalid run ID '%s'\n", flags.Arg(0))
+		return 2
+	}
+
+	write, err := serve.ExportWriter(*format)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err.Error())
+		return 2
+	}
+
+	tables := []string{*table}
+	if *table == "all" {
+		if *out == "" {
+			fmt.Fprintln(os.Stderr, "exporting all tables needs an -out directory")
+			return 2
+		}
+		err = os.MkdirAll(*out, 0755)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "could not create directory '%s': %s\n", *out, err.Error())
+			return 1
+		}
+		tables = data.ExportTables
+	}
+
+	conn, err := sqlite3.Open(*dbFileName, sqlite3.OPEN_READONLY)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "could not open database file '%s': %s\n", *dbFileName, err.Error())
+		return 1
+	}
+	defer conn.Close()
+
+	for _, name := range tables {
+		t, err := data.Export(conn, scenarioRunId, name)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "could not export '%s': %s\n", name, err.Error())
+			return 1
+		}
+
+		path := *out
+		if *table == "all" {
+			path = filepath.Join(*out, fmt.Sprintf("%s.%s", name, *format))
+		}
+
+		err = writeExport(path, t, write)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "could not write '%s': %s\n", name, err.Error())
+			return 1
+		}
+	}
+
+	return 0
+}
+
+func writeExport(path string, table data.Table, write func(io.Writer, data.Table) error) error {
+	if path == "" {
+		return write(os.Stdout, table)
+	}
+
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+
+	err = write(f, table)
+	if err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
@@ -16,13 +16,25 @@
 package main
 
 import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
 	"os"
 	"os/signal"
 
+	"github.com/bvinc/go-sqlite-lite/sqlite3"
+
+	"skenario/pkg/plugin"
 	"skenario/pkg/serve"
 )
 
 func main() {
+	if len(os.Args) > 1 {
+		os.Exit(runCommand(os.Args[1], os.Args[2:]))
+	}
+
 	sighup := make(chan os.Signal, 1)
 	signal.Notify(sighup, os.Interrupt)
 
@@ -32,3 +44,103 @@ func main() {
 	<-sighup
 	server.Shutdown()
 }
+
+// runCommand runs a subcommand to completion and returns the process exit code.
+func runCommand(name string, args []string) int {
+	defer plugin.Shutdown()
+
+	switch name {
+	case "sweep":
+		return sweep(args)
+	case "replicate":
+		return replicate(args)
+	case "optimize":
+		return optimize(args)
+	case "compare":
+		return compare(args)
+	case "export":
+		return export(args)
+	case "report":
+		return reportRun(args)
+	case "verify":
+		return verify(args)
+	default:
+		fmt.Fprintf(os.Stderr, "unknown command '%s'\n", name)
+		return 2
+	}
+}
+
+func decodeFile(path string, v interface{}) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	return json.NewDecoder(f).Decode(v)
+}
+
+// tableResult is the result of a run which can be printed as a table.
+type tableResult interface {
+	WriteTable(w io.Writer) error
+}
+
+// runFromFile is the body of the subcommands which read what to run from one JSON file, such as
+// sweep. It decodes the file into input, opens the database named by -db, calls run and prints
+// the result under the heading run gives, or as JSON. what names the input in messages.
+func runFromFile(
+	name, what, dbUsage string,
+	args []string,
+	input interface{},
+	run func(ctx context.Context, conn *sqlite3.Conn) (result tableResult, heading string, err error),
+) int {
+	flags := flag.NewFlagSet(name, flag.ContinueOnError)
+	dbFileName := flags.String("db", "skenario.db", dbUsage)
+	format := flags.String("format", "table", "output format, either 'table' or 'json'")
+	flags.Usage = func() {
+		fmt.Fprintf(flags.Output(), "usage: skenario %s [flags] <%s.json>\n", name, what)
+		flags.PrintDefaults()
+	}
+
+	err := flags.Parse(args)
+	if err != nil {
+		return 2
+	}
+	if flags.NArg() != 1 {
+		flags.Usage()
+		return 2
+	}
+
+	err = decodeFile(flags.Arg(0), input)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "could not read %s: %s\n", what, err.Error())
+		return 1
+	}
+
+	conn, err := sqlite3.Open(*dbFileName)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "could not open database file '%s': %s\n", *dbFileName, err.Error())
+		return 1
+	}
+	defer conn.Close()
+
+	result, heading, err := run(context.Background(), conn)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "could not run %s: %s\n", what, err.Error())
+		return 1
+	}
+
+	switch *format {
+	case "json":
+		err = json.NewEncoder(os.Stdout).Encode(result)
+	default:
+		fmt.Println(heading)
+		err = result.WriteTable(os.Stdout)
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "could not write results: %s\n", err.Error())
+		return 1
+	}
+
+	return 0
+}
@@ -0,0 +1,39 @@
+/*
+ * Copyright (C) 2019-Present Pivotal Software, Inc. All rights reserved.
+ *
+ * This program and the accompanying materials are made available under the terms
+ * of the Apache License, Version 2.0 (the "License”); you may not use this file
+ * except in compliance with the License. You may obtain a copy of the License at:
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software distributed
+ * under the License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR
+ * CONDITIONS OF ANY KIND, either express or implied. See the License for the
+ * specific language governing permissions and limitations under the License.
+ */
+
+package main
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/bvinc/go-sqlite-lite/sqlite3"
+
+	"skenario/pkg/serve"
+)
+
+// replicate runs a scenario several times with different seeds, read from a JSON file,
+// and prints the means and confidence intervals of its summary metrics.
+func replicate(args []string) int {
+	replication := &serve.Replication{}
+	return runFromFile("replicate", "replication", "database file to record the replications in", args, replication,
+		func(ctx context.Context, conn *sqlite3.Conn) (tableResult, string, error) {
+			result, err := serve.RunReplication(ctx, conn, replication)
+			if err != nil {
+				return nil, "", err
+			}
+			return result, fmt.Sprintf("experiment %d: %s, seeds %v", result.ExperimentId, result.Name, result.Seeds), nil
+		})
+}
@@ -0,0 +1,114 @@
+/*
+ * Copyright (C) 2019-Present Pivotal Software, Inc. All rights reserved.
+ *
+ * This program and the accompanying materials are made available under the terms
+ * of the Apache License, Version 2.0 (the "License”); you may not use this file
+ * except in compliance with the License. You may obtain a copy of the License at:
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software distributed
+ * under the License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR
+ * CONDITIONS OF ANY KIND, either express or implied. See the License for the
+ * specific language governing permissions and limitations under the License.
+ */
+
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/bvinc/go-sqlite-lite/sqlite3"
+
+	"skenario/pkg/report"
+)
+
+// reportRun renders a static HTML or Markdown report of a stored run. Markdown written to a
+// file gets its charts saved as SVG files alongside it, otherwise they are embedded.
+func reportRun(args []string) int {
+	flags := flag.NewFlagSet("report", flag.ContinueOnError)
+	dbFileName := flags.String("db", "skenario.db", "database file holding the run")
+	format := flags.String("format", "html", "output format, either 'html' or 'markdown'")
+	out := flags.String("out", "", "file to write the report to, instead of standard output")
+	flags.Usage = func() {
+		fmt.Fprintln(flags.Output(), "usage: skenario report [flags] <run id>")
+		flags.PrintDefaults()
+	}
+
+	err := flags.Parse(args)
+	if err != nil {
+		return 2
+	}
+	if flags.NArg() != 1 {
+		flags.Usage()
+		return 2
+	}
+	if *format != "html" && *format != "markdown" {
+		fmt.Fprintf(os.Stderr, "unknown report format '%s', expected 'html' or 'markdown'\n", *format)
+		return 2
+	}
+
+	scenarioRunId, err := strconv.ParseInt(flags.Arg(0), 10, 64)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "invalid run ID '%s'\n", flags.Arg(0))
+		return 2
+	}
+
+	conn, err := sqlite3.Open(*dbFileName, sqlite3.OPEN_READONLY)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "could not open database file '%s': %s\n", *dbFileName, err.Error())
+		return 1
+	}
+	defer conn.Close()
+
+	r, err := report.Build(conn, scenarioRunId)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "could not build report: %s\n", err.Error())
+		return 1
+	}
+
+	var w io.Writer = os.Stdout
+	if *out != "" {
+		f, err := os.Create(*out)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "could not create '%s': %s\n", *out, err.Error())
+			return 1
+		}
+		defer f.Close()
+		w = f
+	}
+
+	if *format == "html" {
+		err = r.WriteHTML(w)
+	} else {
+		image := report.DataURI
+		if *out != "" {
+			image = saveChart(*out)
+		}
+		err = r.WriteMarkdown(w, image)
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "could not write report: %s\n", err.Error())
+		return 1
+	}
+
+	return 0
+}
+
+// saveChart writes each chart next to the report as "{report}-{chart}.svg" and links to it.
+func saveChart(reportPath string) func(report.Chart) (string, error) {
+	base := strings.TrimSuffix(reportPath, filepath.Ext(reportPath))
+
+	return func(c report.Chart) (string, error) {
+		path := fmt.Sprintf("%s-%s.svg", base, c.Slug)
+		err := ioutil.WriteFile(path, []byte(c.SVG()), 0644)
+		return filepath.Base(path), err
+	}
+}
@@ -0,0 +1,103 @@
+/*
+ * Copyright (C) 2019-Present Pivotal Software, Inc. All rights reserved.
+ *
+ * This program and the accompanying materials are made available under the terms
+ * of the Apache License, Version 2.0 (the "License”); you may not use this file
+ * except in compliance with the License. You may obtain a copy of the License at:
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software distributed
+ * under the License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR
+ * CONDITIONS OF ANY KIND, either express or implied. See the License for the
+ * specific language governing permissions and limitations under the License.
+ */
+
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/bvinc/go-sqlite-lite/sqlite3"
+
+	"skenario/pkg/serve"
+)
+
+// verify runs each scenario file given and checks its expectations. It exits non-zero if any
+// expectation is missed, so that it can gate a CI pipeline.
+func verify(args []string) int {
+	flags := flag.NewFlagSet("verify", flag.ContinueOnError)
+	dbFileName := flags.String("db", "skenario.db", "database file to record the runs in")
+	format := flags.String("format", "report", "output format, either 'report' or 'json'")
+	flags.Usage = func() {
+		fmt.Fprintln(flags.Output(), "usage: skenario verify [flags] <scenario.json>...")
+		flags.PrintDefaults()
+	}
+
+	err := flags.Parse(args)
+	if err != nil {
+		return 2
+	}
+	if flags.NArg() < 1 {
+		flags.Usage()
+		return 2
+	}
+
+	conn, err := sqlite3.Open(*dbFileName)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "could not open database file '%s': %s\n", *dbFileName, err.Error())
+		return 1
+	}
+	defer conn.Close()
+
+	failed := 0
+	results := make([]serve.VerifyResult, 0, flags.NArg())
+	for _, path := range flags.Args() {
+		file := &serve.ScenarioFile{}
+		err = decodeFile(path, file)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "could not read scenario file '%s': %s\n", path, err.Error())
+			return 1
+		}
+		if file.Name == "" {
+			file.Name = path
+		}
+
+		result, err := serve.Verify(context.Background(), conn, file)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "could not verify '%s': %s\n", path, err.Error())
+			return 1
+		}
+		if !result.Passed {
+			failed++
+		}
+
+		if *format != "json" {
+			err = result.WriteReport(os.Stdout)
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "could not write report: %s\n", err.Error())
+				return 1
+			}
+		}
+		results = append(results, result)
+	}
+
+	if *format == "json" {
+		err = json.NewEncoder(os.Stdout).Encode(results)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "could not write results: %s\n", err.Error())
+			return 1
+		}
+	} else {
+		fmt.Printf("\n%d of %d scenarios passed\n", len(results)-failed, len(results))
+	}
+
+	if failed > 0 {
+		return 1
+	}
+	return 0
+}
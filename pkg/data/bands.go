@@ -0,0 +1,127 @@
+/*
+ * Copyright (C) 2019-Present Pivotal Software, Inc. All rights reserved.
+ *
+ * This program and the accompanying materials are made available under the terms
+ * of the Apache License, Version 2.0 (the "License”); you may not use this file
+ * except in compliance with the License. You may obtain a copy of the License at:
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software distributed
+ * under the License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR
+ * CONDITIONS OF ANY KIND, either express or implied. See the License for the
+ * specific language governing permissions and limitations under the License.
+ */
+
+package data
+
+import (
+	"time"
+
+	"github.com/bvinc/go-sqlite-lite/sqlite3"
+)
+
+// Band summarises the spread of a value across several scenario runs at one point in
+// simulated time.
+type Band struct {
+	At     int64   `json:"at"`
+	P5     float64 `json:"p5"`
+	P25    float64 `json:"p25"`
+	Median float64 `json:"median"`
+	P75    float64 `json:"p75"`
+	P95    float64 `json:"p95"`
+}
+
+// ReplicaBands samples the number of active replicas in each run every interval, and
+// gives the spread of those samples across runs.
+func ReplicaBands(conn *sqlite3.Conn, scenarioRunIds []int64, runFor time.Duration, interval time.Duration) ([]Band, error) {
+	samples := make([][]float64, bucketCount(runFor, interval))
+
+	for _, id := range scenarioRunIds {
+		steps, err := StockSteps(conn, id, "ReplicasActive")
+		if err != nil {
+			return nil, err
+		}
+
+		for b, count := range sampleSteps(steps, interval, len(samples)) {
+			samples[b] = append(samples[b], float64(count))
+		}
+	}
+
+	return bands(samples, interval), nil
+}
+
+// LatencyBands takes the median response time of requests arriving in each interval of
+// each run, and gives the spread of those medians across runs. Runs without any
+// successful requests in an interval do not contribute to it.
+func LatencyBands(conn *sqlite3.Conn, scenarioRunIds []int64, runFor time.Duration, interval time.Duration) ([]Band, error) {
+	samples := make([][]float64, bucketCount(runFor, interval))
+
+	for _, id := range scenarioRunIds {
+		responseTimes, err := CompletedResponseTimes(conn, id)
+		if err != nil {
+			return nil, err
+		}
+
+		perBucket := make([][]float64, len(samples))
+		for _, rt := range responseTimes {
+			b := int(rt.ArrivedAt / int64(interval))
+			if b < 0 || b >= len(perBucket) {
+				continue
+			}
+			perBucket[b] = append(perBucket[b], float64(rt.ResponseTime))
+		}
+
+		for b, times := range perBucket {
+			if len(times) > 0 {
+				samples[b] = append(samples[b], Quantile(times, 0.5))
+			}
+		}
+	}
+
+	return bands(samples, interval), nil
+}
+
+// sampleSteps gives the count of a stock at the start of each of the first buckets intervals.
+func sampleSteps(steps []StockStep, interval time.Duration, buckets int) []int64 {
+	samples := make([]int64, buckets)
+
+	var count int64
+	s := 0
+	for b := range samples {
+		at := int64(b) * int64(interval)
+		for ; s < len(steps) && steps[s].OccursAt <= at; s++ {
+			count = steps[s].Count
+		}
+		samples[b] = count
+	}
+
+	return samples
+}
+
+func bucketCount(runFor time.Duration, interval time.Duration) int {
+	if interval <= 0 {
+		return 0
+	}
+	return int(runFor/interval) + 1
+}
+
+func bands(samples [][]float64, interval time.Duration) []Band {
+	bands := make([]Band, 0, len(samples))
+	for b, values := range samples {
+		if len(values) == 0 {
+			continue
+		}
+
+		bands = append(bands, Band{
+			At:     int64(b) * int64(interval),
+			P5:     Quantile(values, 0.05),
+			P25:    Quantile(values, 0.25),
+			Median: Quantile(values, 0.5),
+			P75:    Quantile(values, 0.75),
+			P95:    Quantile(values, 0.95),
+		})
+	}
+
+	return bands
+}
@@ -0,0 +1,132 @@
+/*
+ * Copyright (C) 2019-Present Pivotal Software, Inc. All rights reserved.
+ *
+ * This program and the accompanying materials are made available under the terms
+ * of the Apache License, Version 2.0 (the "License”); you may not use this file
+ * except in compliance with the License. You may obtain a copy of the License at:
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software distributed
+ * under the License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR
+ * CONDITIONS OF ANY KIND, either express or implied. See the License for the
+ * specific language governing permissions and limitations under the License.
+ */
+
+package data
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/bvinc/go-sqlite-lite/sqlite3"
+	"github.com/sclevine/spec"
+	"github.com/sclevine/spec/report"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"skenario/pkg/model"
+	"skenario/pkg/simulator"
+)
+
+func TestBands(t *testing.T) {
+	spec.Run(t, "Bands", testBands, spec.Report(report.Terminal{}))
+}
+
+func testBands(t *testing.T, describe spec.G, it spec.S) {
+	var conn *sqlite3.Conn
+	var runIds []int64
+	var err error
+
+	storeRun := func(replicasAt []time.Duration, arriveAt, completeAt time.Duration) int64 {
+		store, err := NewStreamingRunStore(conn, model.ClusterConfig{}, model.KnativeAutoscalerConfig{}, "test_origin", "test_pattern", 10*time.Second)
+		require.NoError(t, err)
+
+		id := store.ScenarioRunId()
+		at := func(d time.Duration) time.Time { return time.Unix(0, 0).Add(d) }
+		launching := simulator.NewThroughStock("ReplicasLaunching", "Replica")
+		active := simulator.NewThroughStock("ReplicasActive", "Replica")
+		routing := simulator.NewThroughStock("RequestsRouting", "Request")
+		complete := simulator.NewThroughStock("RequestsComplete [1]", "Request")
+
+		completed := make([]simulator.CompletedMovement, 0)
+		for i, r := range replicasAt {
+			completed = append(completed, simulator.CompletedMovement{
+				Movement: simulator.NewMovement("finish_launching", at(r), launching, active),
+				Moved:    simulator.NewEntity(simulator.EntityName(fmt.Sprintf("replica-%d-%d", id, i)), "Replica"),
+			})
+		}
+
+		request := simulator.NewEntity(simulator.EntityName(fmt.Sprintf("request-%d", id)), "Request")
+		completed = append(completed,
+			simulator.CompletedMovement{Movement: simulator.NewMovement("arrive_at_routing_stock", at(arriveAt), routing, routing), Moved: request},
+			simulator.CompletedMovement{Movement: simulator.NewMovement("complete_request", at(completeAt), routing, complete), Moved: request},
+		)
+
+		err = store.Flush(completed, nil)
+		require.NoError(t, err)
+
+		return id
+	}
+
+	it.Before(func() {
+		var dir string
+		dir, err = os.Getwd()
+		require.NoError(t, err)
+		dbPath := filepath.Join(dir, "skenario_test.db")
+
+		os.Remove(dbPath)
+
+		conn, err = sqlite3.Open(dbPath)
+		require.NoError(t, err)
+
+		runIds = []int64{
+			storeRun([]time.Duration{0, 5 * time.Second}, 1*time.Second, 1200*time.Millisecond),
+			storeRun([]time.Duration{0}, 2*time.Second, 2600*time.Millisecond),
+		}
+	})
+
+	describe("ReplicaBands()", func() {
+		var bands []Band
+
+		it.Before(func() {
+			bands, err = ReplicaBands(conn, runIds, 10*time.Second, 5*time.Second)
+			require.NoError(t, err)
+		})
+
+		it("samples every interval, including the end of the run", func() {
+			require.Len(t, bands, 3)
+			assert.Equal(t, int64(0), bands[0].At)
+			assert.Equal(t, int64(5*time.Second), bands[1].At)
+			assert.Equal(t, int64(10*time.Second), bands[2].At)
+		})
+
+		it("gives the spread of replica counts across runs", func() {
+			assert.Equal(t, 1.0, bands[0].Median)
+			assert.Equal(t, 1.5, bands[1].Median)
+			assert.Equal(t, 1.05, bands[1].P5)
+			assert.Equal(t, 1.95, bands[1].P95)
+		})
+	})
+
+	describe("LatencyBands()", func() {
+		var bands []Band
+
+		it.Before(func() {
+			bands, err = LatencyBands(conn, runIds, 10*time.Second, 5*time.Second)
+			require.NoError(t, err)
+		})
+
+		it("skips intervals without any completed requests", func() {
+			require.Len(t, bands, 1)
+			assert.Equal(t, int64(0), bands[0].At)
+		})
+
+		it("gives the spread of median response times across runs", func() {
+			assert.Equal(t, float64(400*time.Millisecond), bands[0].Median)
+		})
+	})
+}
@@ -0,0 +1,394 @@
+/*
+ * Copyright (C) 2019-Present Pivotal Software, Inc. All rights reserved.
+ *
+ * This program and the accompanying materials are made available under the terms
+ * of the Apache License, Version 2.0 (the "License”); you may not use this file
+ * except in compliance with the License. You may obtain a copy of the License at:
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software distributed
+ * under the License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR
+ * CONDITIONS OF ANY KIND, either express or implied. See the License for the
+ * specific language governing permissions and limitations under the License.
+ */
+
+package data
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"sort"
+	"time"
+
+	"github.com/bvinc/go-sqlite-lite/sqlite3"
+)
+
+// RunComparison sets two stored scenario runs side by side, aligned on simulated time.
+// Deltas are always B minus A.
+type RunComparison struct {
+	A int64 `json:"a"`
+	B int64 `json:"b"`
+
+	Latency        LatencyComparison  `json:"latency"`
+	Failures       FailureComparison  `json:"failures"`
+	ReplicaSeconds Delta              `json:"replica_seconds"`
+	PeakReplicas   Delta              `json:"peak_replicas"`
+	ScalingEvents  ScalingComparison  `json:"scaling_events"`
+	ConfigDiff     []ConfigDifference `json:"config_diff"`
+	Timeline       []AlignedReplicas  `json:"timeline"`
+}
+
+type Delta struct {
+	A     float64 `json:"a"`
+	B     float64 `json:"b"`
+	Delta float64 `json:"delta"`
+}
+
+type LatencyComparison struct {
+	P50  Delta `json:"p50"`
+	P90  Delta `json:"p90"`
+	P99  Delta `json:"p99"`
+	P999 Delta `json:"p999"`
+
+	// KS is a two-sample Kolmogorov-Smirnov test of whether the response times of
+	// successful requests in both runs come from the same distribution.
+	KS KSTest `json:"ks"`
+}
+
+type KSTest struct {
+	Statistic float64 `json:"statistic"`
+	PValue    float64 `json:"p_value"`
+}
+
+type FailureComparison struct {
+	Failed   Delta            `json:"failed"`
+	Rate     Delta            `json:"rate"`
+	ByReason map[string]Delta `json:"by_reason"`
+}
+
+// ScalingComparison counts the changes in desired replicas made by the autoscaler.
+type ScalingComparison struct {
+	ScaleUps   Delta `json:"scale_ups"`
+	ScaleDowns Delta `json:"scale_downs"`
+}
+
+type ConfigDifference struct {
+	Parameter string `json:"parameter"`
+	A         string `json:"a"`
+	B         string `json:"b"`
+}
+
+type AlignedReplicas struct {
+	At       int64 `json:"at"`
+	ActiveA  int64 `json:"active_a"`
+	ActiveB  int64 `json:"active_b"`
+	DesiredA int64 `json:"desired_a"`
+	DesiredB int64 `json:"desired_b"`
+}
+
+// CompareRuns compares runs a and b, sampling their replica counts every interval.
+func CompareRuns(conn *sqlite3.Conn, a, b int64, interval time.Duration) (RunComparison, error) {
+	comparison := RunComparison{A: a, B: b}
+
+	summaryA, err := Summarize(conn, a)
+	if err != nil {
+		return comparison, err
+	}
+	summaryB, err := Summarize(conn, b)
+	if err != nil {
+		return comparison, err
+	}
+
+	comparison.Latency.P50 = delta(float64(summaryA.LatencyP50), float64(summaryB.LatencyP50))
+	comparison.Latency.P90 = delta(float64(summaryA.LatencyP90), float64(summaryB.LatencyP90))
+	comparison.Latency.P99 = delta(float64(summaryA.LatencyP99), float64(summaryB.LatencyP99))
+	comparison.Latency.P999 = delta(float64(summaryA.LatencyP999), float64(summaryB.LatencyP999))
+
+	comparison.Failures.Failed = delta(float64(summaryA.FailedRequests), float64(summaryB.FailedRequests))
+	comparison.Failures.Rate = delta(summaryA.FailureRate, summaryB.FailureRate)
+	comparison.Failures.ByReason = make(map[string]Delta)
+	for reason := range summaryA.FailuresByReason {
+		comparison.Failures.ByReason[reason] = delta(float64(summaryA.FailuresByReason[reason]), float64(summaryB.FailuresByReason[reason]))
+	}
+	for reason := range summaryB.FailuresByReason {
+		comparison.Failures.ByReason[reason] = delta(float64(summaryA.FailuresByReason[reason]), float64(summaryB.FailuresByReason[reason]))
+	}
+
+	comparison.ReplicaSeconds = delta(summaryA.ReplicaSeconds, summaryB.ReplicaSeconds)
+	comparison.PeakReplicas = delta(float64(summaryA.PeakReplicas), float64(summaryB.PeakReplicas))
+
+	responseTimesA, err := CompletedResponseTimes(conn, a)
+	if err != nil {
+		return comparison, err
+	}
+	responseTimesB, err := CompletedResponseTimes(conn, b)
+	if err != nil {
+		return comparison, err
+	}
+	comparison.Latency.KS = KolmogorovSmirnov(responseTimeValues(responseTimesA), responseTimeValues(responseTimesB))
+
+	desiredA, err := StockSteps(conn, a, "ReplicasDesired")
+	if err != nil {
+		return comparison, err
+	}
+	desiredB, err := StockSteps(conn, b, "ReplicasDesired")
+	if err != nil {
+		return comparison, err
+	}
+	upsA, downsA := scalingEvents(desiredA)
+	upsB, downsB := scalingEvents(desiredB)
+	comparison.ScalingEvents.ScaleUps = delta(float64(upsA), float64(upsB))
+	comparison.ScalingEvents.ScaleDowns = delta(float64(downsA), float64(downsB))
+
+	comparison.ConfigDiff, err = configDiff(conn, a, b)
+	if err != nil {
+		return comparison, err
+	}
+
+	activeA, err := StockSteps(conn, a, "ReplicasActive")
+	if err != nil {
+		return comparison, err
+	}
+	activeB, err := StockSteps(conn, b, "ReplicasActive")
+	if err != nil {
+		return comparison, err
+	}
+
+	durationA, err := simulatedDuration(conn, a)
+	if err != nil {
+		return comparison, err
+	}
+	durationB, err := simulatedDuration(conn, b)
+	if err != nil {
+		return comparison, err
+	}
+	buckets := bucketCount(time.Duration(math.Max(float64(durationA), float64(durationB))), interval)
+
+	sampledActiveA := sampleSteps(activeA, interval, buckets)
+	sampledActiveB := sampleSteps(activeB, interval, buckets)
+	sampledDesiredA := sampleSteps(desiredA, interval, buckets)
+	sampledDesiredB := sampleSteps(desiredB, interval, buckets)
+	comparison.Timeline = make([]AlignedReplicas, buckets)
+	for i := range comparison.Timeline {
+		comparison.Timeline[i] = AlignedReplicas{
+			At:       int64(i) * int64(interval),
+			ActiveA:  sampledActiveA[i],
+			ActiveB:  sampledActiveB[i],
+			DesiredA: sampledDesiredA[i],
+			DesiredB: sampledDesiredB[i],
+		}
+	}
+
+	return comparison, nil
+}
+
+// KolmogorovSmirnov performs a two-sample KS test, using the asymptotic distribution of
+// the statistic for its p-value.
+func KolmogorovSmirnov(a, b []float64) KSTest {
+	if len(a) == 0 || len(b) == 0 {
+		return KSTest{PValue: 1}
+	}
+
+	sortedA := make([]float64, len(a))
+	copy(sortedA, a)
+	sort.Float64s(sortedA)
+	sortedB := make([]float64, len(b))
+	copy(sortedB, b)
+	sort.Float64s(sortedB)
+
+	var d float64
+	i, j := 0, 0
+	for i < len(sortedA) && j < len(sortedB) {
+		x := math.Min(sortedA[i], sortedB[j])
+		for i < len(sortedA) && sortedA[i] <= x {
+			i++
+		}
+		for j < len(sortedB) && sortedB[j] <= x {
+			j++
+		}
+		d = math.Max(d, math.Abs(float64(i)/float64(len(sortedA))-float64(j)/float64(len(sortedB))))
+	}
+
+	n := float64(len(a)) * float64(len(b)) / float64(len(a)+len(b))
+	lambda := (math.Sqrt(n) + 0.12 + 0.11/math.Sqrt(n)) * d
+
+	return KSTest{Statistic: d, PValue: kolmogorovQ(lambda)}
+}
+
+// kolmogorovQ is the complementary CDF of the Kolmogorov distribution.
+func kolmogorovQ(lambda float64) float64 {
+	if lambda < 0.2 {
+		return 1
+	}
+
+	var sum float64
+	sign := 1.0
+	for j := 1.0; j <= 100; j++ {
+		term := sign * math.Exp(-2*j*j*lambda*lambda)
+		sum += term
+		if math.Abs(term) < 1e-12 {
+			break
+		}
+		sign = -sign
+	}
+
+	return math.Max(0, math.Min(1, 2*sum))
+}
+
+func delta(a, b float64) Delta {
+	return Delta{A: a, B: b, Delta: b - a}
+}
+
+func responseTimeValues(responseTimes []CompletedResponseTime) []float64 {
+	values := make([]float64, len(responseTimes))
+	for i, rt := range responseTimes {
+		values[i] = float64(rt.ResponseTime)
+	}
+	return values
+}
+
+func scalingEvents(desired []StockStep) (ups int, downs int) {
+	var last int64
+	for _, step := range desired {
+		if step.Count > last {
+			ups++
+		} else if step.Count < last {
+			downs++
+		}
+		last = step.Count
+	}
+	return ups, downs
+}
+
+func simulatedDuration(conn *sqlite3.Conn, scenarioRunId int64) (int64, error) {
+	var duration int64
+	found := false
+	err := queryRows(conn, simulatedDurationQuery, []interface{}{scenarioRunId}, func(stmt *sqlite3.Stmt) error {
+		found = true
+		return stmt.Scan(&duration)
+	})
+	if err == nil && !found {
+		err = fmt.Errorf("no scenario run with id %d", scenarioRunId)
+	}
+	return duration, err
+}
+
+// configDiff lists the parameters that differ between two runs. When both runs have their
+// full configuration recorded that is compared, otherwise the columns of scenario_runs are.
+func configDiff(conn *sqlite3.Conn, a, b int64) ([]ConfigDifference, error) {
+	configA, err := runConfiguration(conn, a)
+	if err != nil {
+		return nil, err
+	}
+	configB, err := runConfiguration(conn, b)
+	if err != nil {
+		return nil, err
+	}
+
+	if configA == nil || configB == nil {
+		configA, err = scenarioRunColumns(conn, a)
+		if err != nil {
+			return nil, err
+		}
+		configB, err = scenarioRunColumns(conn, b)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	keys := make(map[string]bool)
+	for k := range configA {
+		keys[k] = true
+	}
+	for k := range configB {
+		keys[k] = true
+	}
+
+	diff := make([]ConfigDifference, 0)
+	for k := range keys {
+		if configA[k] != configB[k] {
+			diff = append(diff, ConfigDifference{Parameter: k, A: configA[k], B: configB[k]})
+		}
+	}
+	sort.Slice(diff, func(i, j int) bool { return diff[i].Parameter < diff[j].Parameter })
+
+	return diff, nil
+}
+
+// RunConfiguration gives the configuration a run was made with, flattened into dotted keys with
+// JSON-encoded values. Runs stored without their full run request fall back to the plain
+// scenario_runs columns.
+func RunConfiguration(conn *sqlite3.Conn, scenarioRunId int64) (map[string]string, error) {
+	configuration, err := runConfiguration(conn, scenarioRunId)
+	if err != nil || configuration != nil {
+		return configuration, err
+	}
+	return scenarioRunColumns(conn, scenarioRunId)
+}
+
+func runConfiguration(conn *sqlite3.Conn, scenarioRunId int64) (map[string]string, error) {
+	// databases written before configurations were recorded don't have the table
+	var tables int
+	err := queryRows(conn, `select count(1) from sqlite_master where type = 'table' and name = 'scenario_run_configurations'`, nil, func(stmt *sqlite3.Stmt) error {
+		return stmt.Scan(&tables)
+	})
+	if err != nil || tables == 0 {
+		return nil, err
+	}
+
+	var raw string
+	err = queryRows(conn, `select configuration from scenario_run_configurations where scenario_run_id = ?`, []interface{}{scenarioRunId}, func(stmt *sqlite3.Stmt) error {
+		return stmt.Scan(&raw)
+	})
+	if err != nil || raw == "" {
+		return nil, err
+	}
+
+	var configuration map[string]interface{}
+	err = json.Unmarshal([]byte(raw), &configuration)
+	if err != nil {
+		return nil, fmt.Errorf("could not parse configuration of scenario run %d: %s", scenarioRunId, err.Error())
+	}
+
+	flattened := make(map[string]string)
+	flatten("", configuration, flattened)
+	return flattened, nil
+}
+
+func flatten(prefix string, value interface{}, into map[string]string) {
+	switch v := value.(type) {
+	case map[string]interface{}:
+		for k, nested := range v {
+			key := k
+			if prefix != "" {
+				key = prefix + "." + k
+			}
+			flatten(key, nested, into)
+		}
+	default:
+		raw, _ := json.Marshal(v)
+		into[prefix] = string(raw)
+	}
+}
+
+func scenarioRunColumns(conn *sqlite3.Conn, scenarioRunId int64) (map[string]string, error) {
+	columns := make(map[string]string)
+	err := queryRows(conn, `select * from scenario_runs where id = ?`, []interface{}{scenarioRunId}, func(stmt *sqlite3.Stmt) error {
+		for i, name := range stmt.ColumnNames() {
+			if name == "id" || name == "recorded" {
+				continue
+			}
+
+			text, _, err := stmt.ColumnText(i)
+			if err != nil {
+				return err
+			}
+			columns[name] = text
+		}
+		return nil
+	})
+
+	return columns, err
+}
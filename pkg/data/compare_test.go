@@ -0,0 +1,173 @@
+/*
+ * Copyright (C) 2019-Present Pivotal Software, Inc. All rights reserved.
+ *
+ * This program and the accompanying materials are made available under the terms
+ * of the Apache License, Version 2.0 (the "License”); you may not use this file
+ * except in compliance with the License. You may obtain a copy of the License at:
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software distributed
+ * under the License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR
+ * CONDITIONS OF ANY KIND, either express or implied. See the License for the
+ * specific language governing permissions and limitations under the License.
+ */
+
+package data
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/bvinc/go-sqlite-lite/sqlite3"
+	"github.com/sclevine/spec"
+	"github.com/sclevine/spec/report"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"skenario/pkg/model"
+	"skenario/pkg/simulator"
+)
+
+func TestCompare(t *testing.T) {
+	spec.Run(t, "Compare", testCompare, spec.Report(report.Terminal{}))
+}
+
+func testCompare(t *testing.T, describe spec.G, it spec.S) {
+	describe("KolmogorovSmirnov()", func() {
+		it("finds no difference between identical samples", func() {
+			ks := KolmogorovSmirnov([]float64{1, 2, 3, 4}, []float64{4, 3, 2, 1})
+			assert.Equal(t, 0.0, ks.Statistic)
+			assert.Equal(t, 1.0, ks.PValue)
+		})
+
+		it("finds the largest gap between the empirical distributions", func() {
+			ks := KolmogorovSmirnov([]float64{1, 2, 3, 4}, []float64{3, 4, 5, 6})
+			assert.Equal(t, 0.5, ks.Statistic)
+		})
+
+		it("gives a small p-value for clearly different samples", func() {
+			a := make([]float64, 50)
+			b := make([]float64, 50)
+			for i := range a {
+				a[i] = float64(i)
+				b[i] = float64(i + 100)
+			}
+
+			ks := KolmogorovSmirnov(a, b)
+			assert.Equal(t, 1.0, ks.Statistic)
+			assert.True(t, ks.PValue < 0.001)
+		})
+	})
+
+	describe("CompareRuns()", func() {
+		var conn *sqlite3.Conn
+		var comparison RunComparison
+		var err error
+
+		storeRun := func(kpaConf model.KnativeAutoscalerConfig, configuration string, desiredAt []time.Duration, responseTime time.Duration) int64 {
+			store, err := NewStreamingRunStore(conn, model.ClusterConfig{}, kpaConf, "test_origin", "test_pattern", 10*time.Second)
+			require.NoError(t, err)
+			id := store.ScenarioRunId()
+
+			at := func(d time.Duration) time.Time { return time.Unix(0, 0).Add(d) }
+			desiredSource := simulator.NewThroughStock("DesiredSource", "Desired")
+			desired := simulator.NewThroughStock("ReplicasDesired", "Desired")
+			routing := simulator.NewThroughStock("RequestsRouting", "Request")
+			complete := simulator.NewThroughStock("RequestsComplete [1]", "Request")
+
+			completed := make([]simulator.CompletedMovement, 0)
+			for i, d := range desiredAt {
+				completed = append(completed, simulator.CompletedMovement{
+					Movement: simulator.NewMovement("increase_desired", at(d), desiredSource, desired),
+					Moved:    simulator.NewEntity(simulator.EntityName(fmt.Sprintf("desired-%d-%d", id, i)), "Desired"),
+				})
+			}
+			for i := 0; i < 5; i++ {
+				request := simulator.NewEntity(simulator.EntityName(fmt.Sprintf("request-%d-%d", id, i)), "Request")
+				arrive := time.Duration(i) * time.Second
+				completed = append(completed,
+					simulator.CompletedMovement{Movement: simulator.NewMovement("arrive_at_routing_stock", at(arrive), routing, routing), Moved: request},
+					simulator.CompletedMovement{Movement: simulator.NewMovement("complete_request", at(arrive+responseTime), routing, complete), Moved: request},
+				)
+			}
+
+			err = store.Flush(completed, nil)
+			require.NoError(t, err)
+
+			if configuration != "" {
+				err = StoreRunConfiguration(conn, id, configuration)
+				require.NoError(t, err)
+			}
+
+			return id
+		}
+
+		it.Before(func() {
+			var dir string
+			dir, err = os.Getwd()
+			require.NoError(t, err)
+			dbPath := filepath.Join(dir, "skenario_test.db")
+
+			os.Remove(dbPath)
+
+			conn, err = sqlite3.Open(dbPath)
+			require.NoError(t, err)
+		})
+
+		describe("when both runs have their configuration recorded", func() {
+			it.Before(func() {
+				a := storeRun(model.KnativeAutoscalerConfig{}, `{"stable_window": 1, "uniform_config": {"number_of_requests": 5}}`, []time.Duration{0}, 100*time.Millisecond)
+				b := storeRun(model.KnativeAutoscalerConfig{}, `{"stable_window": 2, "uniform_config": {"number_of_requests": 5}}`, []time.Duration{0, 2 * time.Second, 4 * time.Second}, 300*time.Millisecond)
+
+				comparison, err = CompareRuns(conn, a, b, 5*time.Second)
+				require.NoError(t, err)
+			})
+
+			it("gives latency deltas as B minus A", func() {
+				assert.Equal(t, Delta{A: float64(100 * time.Millisecond), B: float64(300 * time.Millisecond), Delta: float64(200 * time.Millisecond)}, comparison.Latency.P50)
+			})
+
+			it("tests whether the latency distributions differ", func() {
+				assert.Equal(t, 1.0, comparison.Latency.KS.Statistic)
+			})
+
+			it("counts scaling events", func() {
+				assert.Equal(t, Delta{A: 1, B: 3, Delta: 2}, comparison.ScalingEvents.ScaleUps)
+			})
+
+			it("lists only the configuration that differs", func() {
+				assert.Equal(t, []ConfigDifference{{Parameter: "stable_window", A: "1", B: "2"}}, comparison.ConfigDiff)
+			})
+
+			it("aligns desired replicas on simulated time", func() {
+				require.Len(t, comparison.Timeline, 3)
+				assert.Equal(t, AlignedReplicas{At: int64(5 * time.Second), DesiredA: 1, DesiredB: 3}, comparison.Timeline[1])
+			})
+		})
+
+		describe("when a run has no configuration recorded", func() {
+			it.Before(func() {
+				a := storeRun(model.KnativeAutoscalerConfig{TargetConcurrency: 1}, "", []time.Duration{0}, 100*time.Millisecond)
+				b := storeRun(model.KnativeAutoscalerConfig{TargetConcurrency: 2}, `{"target_concurrency": 2}`, []time.Duration{0}, 100*time.Millisecond)
+
+				comparison, err = CompareRuns(conn, a, b, 5*time.Second)
+				require.NoError(t, err)
+			})
+
+			it("compares the parameters kept for every run", func() {
+				assert.Equal(t, []ConfigDifference{{Parameter: "autoscaler_target_concurrency", A: "1.0", B: "2.0"}}, comparison.ConfigDiff)
+			})
+		})
+
+		describe("when a run doesn't exist", func() {
+			it("returns an error", func() {
+				_, err = CompareRuns(conn, 1, 99, time.Second)
+				assert.Error(t, err)
+			})
+		})
+	})
+}
@@ -0,0 +1,71 @@
+/*
+ * Copyright (C) 2019-Present Pivotal Software, Inc. All rights reserved.
+ *
+ * This program and the accompanying materials are made available under the terms
+ * of the Apache License, Version 2.0 (the "License”); you may not use this file
+ * except in compliance with the License. You may obtain a copy of the License at:
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software distributed
+ * under the License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR
+ * CONDITIONS OF ANY KIND, either express or implied. See the License for the
+ * specific language governing permissions and limitations under the License.
+ */
+
+package data
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/bvinc/go-sqlite-lite/sqlite3"
+)
+
+// ExperimentStore groups scenario runs that were made as part of a single experiment,
+// such as a parameter sweep.
+type ExperimentStore interface {
+	Begin(name string, definition string) (experimentId int64, err error)
+	AddRun(experimentId int64, scenarioRunId int64, parameters string) error
+}
+
+type experimentStorer struct {
+	conn *sqlite3.Conn
+}
+
+func (es *experimentStorer) Begin(name string, definition string) (experimentId int64, err error) {
+	err = es.conn.Exec(`insert into experiments(recorded, name, definition) values (?, ?, ?)`,
+		time.Now().Format(time.RFC3339),
+		name,
+		definition,
+	)
+	if err != nil {
+		return -1, fmt.Errorf("could not insert experiment: %s", err.Error())
+	}
+
+	return es.conn.LastInsertRowID(), nil
+}
+
+func (es *experimentStorer) AddRun(experimentId int64, scenarioRunId int64, parameters string) error {
+	err := es.conn.Exec(`insert into experiment_runs(experiment_id, scenario_run_id, parameters) values (?, ?, ?)`,
+		experimentId,
+		scenarioRunId,
+		parameters,
+	)
+	if err != nil {
+		return fmt.Errorf("could not insert experiment run: %s", err.Error())
+	}
+
+	return nil
+}
+
+func NewExperimentStore(conn *sqlite3.Conn) ExperimentStore {
+	err := conn.Exec(Schema)
+	if err != nil {
+		panic(fmt.Errorf("could not apply skenario schema: %s", err.Error()))
+	}
+
+	return &experimentStorer{
+		conn: conn,
+	}
+}
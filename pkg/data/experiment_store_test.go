@@ -0,0 +1,95 @@
+/*
+ * Copyright (C) 2019-Present Pivotal Software, Inc. All rights reserved.
+ *
+ * This program and the accompanying materials are made available under the terms
+ * of the Apache License, Version 2.0 (the "License”); you may not use this file
+ * except in compliance with the License. You may obtain a copy of the License at:
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software distributed
+ * under the License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR
+ * CONDITIONS OF ANY KIND, either express or implied. See the License for the
+ * specific language governing permissions and limitations under the License.
+ */
+
+package data
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/bvinc/go-sqlite-lite/sqlite3"
+	"github.com/sclevine/spec"
+	"github.com/sclevine/spec/report"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestExperimentStore(t *testing.T) {
+	spec.Run(t, "ExperimentStore", testExperimentStore, spec.Report(report.Terminal{}))
+}
+
+func testExperimentStore(t *testing.T, describe spec.G, it spec.S) {
+	var subject ExperimentStore
+	var conn *sqlite3.Conn
+	var experimentId int64
+	var err error
+
+	it.Before(func() {
+		var dir string
+		dir, err = os.Getwd()
+		require.NoError(t, err)
+		dbPath := filepath.Join(dir, "skenario_test.db")
+
+		os.Remove(dbPath)
+
+		conn, err = sqlite3.Open(dbPath)
+		require.NoError(t, err)
+
+		subject = NewExperimentStore(conn)
+		experimentId, err = subject.Begin("test experiment", `{"axes": []}`)
+		require.NoError(t, err)
+	})
+
+	describe("Begin()", func() {
+		var name, definition string
+
+		it.Before(func() {
+			singleQuery(t, conn, `select name, definition from experiments where id = 1`, &name, &definition)
+		})
+
+		it("returns the experiment ID", func() {
+			assert.Equal(t, int64(1), experimentId)
+		})
+
+		it("records the name", func() {
+			assert.Equal(t, "test experiment", name)
+		})
+
+		it("records the definition", func() {
+			assert.Equal(t, `{"axes": []}`, definition)
+		})
+	})
+
+	describe("AddRun()", func() {
+		var scenarioRunId int64
+		var parameters string
+
+		it.Before(func() {
+			err = subject.AddRun(experimentId, 42, `{"stable_window": "60s"}`)
+			require.NoError(t, err)
+
+			singleQuery(t, conn, `select scenario_run_id, parameters from experiment_runs where experiment_id = 1`, &scenarioRunId, &parameters)
+		})
+
+		it("links the scenario run to the experiment", func() {
+			assert.Equal(t, int64(42), scenarioRunId)
+		})
+
+		it("records the parameters used for the run", func() {
+			assert.Equal(t, `{"stable_window": "60s"}`, parameters)
+		})
+	})
+}
@@ -0,0 +1,225 @@
+/*
+ * Copyright (C) 2019-Present Pivotal Software, Inc. All rights reserved.
+ *
+ * This program and the accompanying materials are made available under the terms
+ * of the Apache License, Version 2.0 (the "License”); you may not use this file
+ * except in compliance with the License. You may obtain a copy of the License at:
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software distributed
+ * under the License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR
+ * CONDITIONS OF ANY KIND, either express or implied. See the License for the
+ * specific language governing permissions and limitations under the License.
+ */
+
+package data
+
+import (
+	"encoding/csv"
+	"fmt"
+	"io"
+	"strconv"
+
+	"github.com/bvinc/go-sqlite-lite/sqlite3"
+)
+
+type ColumnType int
+
+const (
+	Int64Column ColumnType = iota
+	Float64Column
+	StringColumn
+)
+
+type Column struct {
+	Name string
+	Type ColumnType
+}
+
+// Table is a flat, typed extract of run data. Each row holds int64, float64 or string values
+// in the order of the columns.
+type Table struct {
+	Name    string
+	Columns []Column
+	Rows    [][]interface{}
+}
+
+// ExportTables names the tables that can be extracted from a run with Export.
+var ExportTables = []string{
+	"completed_movements",
+	"ignored_movements",
+	"tally_lines",
+	"response_times",
+	"cpu_utilizations",
+	"summary",
+}
+
+// language=sql
+var exportCompletedMovementsQuery = `
+select cm.occurs_at
+     , cm.kind
+     , e.name
+     , e.kind
+     , fs.name
+     , ts.name
+from completed_movements cm
+         join entities e on cm.moved = e.id
+         join stocks fs on cm.from_stock = fs.id
+         join stocks ts on cm.to_stock = ts.id
+where cm.scenario_run_id = ?
+order by cm.occurs_at, cm.id
+;
+`
+
+// language=sql
+var exportIgnoredMovementsQuery = `
+select im.occurs_at
+     , im.kind
+     , fs.name
+     , ts.name
+     , im.reason
+from ignored_movements im
+         join stocks fs on im.from_stock = fs.id
+         join stocks ts on im.to_stock = ts.id
+where im.scenario_run_id = ?
+order by im.occurs_at, im.id
+;
+`
+
+// Export extracts one of the ExportTables for a scenario run. Times are nanoseconds since the
+// start of the run.
+func Export(conn *sqlite3.Conn, scenarioRunId int64, table string) (Table, error) {
+	id := []interface{}{scenarioRunId}
+
+	switch table {
+	case "completed_movements":
+		return exportQuery(conn, table, exportCompletedMovementsQuery, id, []Column{
+			{"occurs_at", Int64Column},
+			{"kind", StringColumn},
+			{"moved", StringColumn},
+			{"moved_kind", StringColumn},
+			{"from_stock", StringColumn},
+			{"to_stock", StringColumn},
+		})
+	case "ignored_movements":
+		return exportQuery(conn, table, exportIgnoredMovementsQuery, id, []Column{
+			{"occurs_at", Int64Column},
+			{"kind", StringColumn},
+			{"from_stock", StringColumn},
+			{"to_stock", StringColumn},
+			{"reason", StringColumn},
+		})
+	case "tally_lines":
+		return exportQuery(conn, table, RunningTallyQuery, []interface{}{scenarioRunId, scenarioRunId}, []Column{
+			{"occurs_at", Int64Column},
+			{"stock_name", StringColumn},
+			{"kind_stocked", StringColumn},
+			{"tally", Int64Column},
+		})
+	case "response_times":
+		return exportQuery(conn, table, ResponseTimesQuery, id, []Column{
+			{"arrived_at", Int64Column},
+			{"completed_at", Int64Column},
+			{"response_time", Int64Column},
+		})
+	case "cpu_utilizations":
+		return exportQuery(conn, table, CPUUtilizationQuery, id, []Column{
+			{"cpu_utilization", Float64Column},
+			{"calculated_at", Int64Column},
+		})
+	case "summary":
+		return exportSummary(conn, scenarioRunId)
+	default:
+		return Table{}, fmt.Errorf("unknown table '%s', expected one of %v", table, ExportTables)
+	}
+}
+
+func exportQuery(conn *sqlite3.Conn, name, query string, args []interface{}, columns []Column) (Table, error) {
+	table := Table{Name: name, Columns: columns, Rows: make([][]interface{}, 0)}
+
+	err := queryRows(conn, query, args, func(stmt *sqlite3.Stmt) error {
+		row := make([]interface{}, len(columns))
+		for i, c := range columns {
+			var err error
+			switch c.Type {
+			case Int64Column:
+				var v int64
+				v, _, err = stmt.ColumnInt64(i)
+				row[i] = v
+			case Float64Column:
+				var v float64
+				v, _, err = stmt.ColumnDouble(i)
+				row[i] = v
+			case StringColumn:
+				var v string
+				v, _, err = stmt.ColumnText(i)
+				row[i] = v
+			}
+			if err != nil {
+				return err
+			}
+		}
+		table.Rows = append(table.Rows, row)
+		return nil
+	})
+
+	return table, err
+}
+
+func exportSummary(conn *sqlite3.Conn, scenarioRunId int64) (Table, error) {
+	table := Table{
+		Name:    "summary",
+		Columns: []Column{{"metric", StringColumn}, {"value", Float64Column}},
+		Rows:    make([][]interface{}, 0),
+	}
+
+	summary, err := Summarize(conn, scenarioRunId)
+	if err != nil {
+		return table, err
+	}
+
+	for _, metric := range summary.MetricNames() {
+		value, err := summary.Metric(metric)
+		if err != nil {
+			return table, err
+		}
+		table.Rows = append(table.Rows, []interface{}{metric, value})
+	}
+
+	return table, nil
+}
+
+// WriteCSV writes a table as CSV, with a header line of column names.
+func WriteCSV(w io.Writer, table Table) error {
+	cw := csv.NewWriter(w)
+
+	record := make([]string, len(table.Columns))
+	for i, c := range table.Columns {
+		record[i] = c.Name
+	}
+	err := cw.Write(record)
+	if err != nil {
+		return err
+	}
+
+	for _, row := range table.Rows {
+		for i, v := range row {
+			switch v := v.(type) {
+			case int64:
+				record[i] = strconv.FormatInt(v, 10)
+			case float64:
+				record[i] = strconv.FormatFloat(v, 'g', -1, 64)
+			default:
+				record[i] = fmt.Sprintf("%v", v)
+			}
+		}
+		err = cw.Write(record)
+		if err != nil {
+			return err
+		}
+	}
+
+	cw.Flush()
+	return cw.Error()
+}
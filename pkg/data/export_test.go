@@ -0,0 +1,157 @@
+/*
+ * Copyright (C) 2019-Present Pivotal Software, Inc. All rights reserved.
+ *
+ * This program and the accompanying materials are made available under the terms
+ * of the Apache License, Version 2.0 (the "License”); you may not use this file
+ * except in compliance with the License. You may obtain a copy of the License at:
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software distributed
+ * under the License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR
+ * CONDITIONS OF ANY KIND, either express or implied. See the License for the
+ * specific language governing permissions and limitations under the License.
+ */
+
+package data
+
+import (
+	"bytes"
+	"encoding/binary"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/bvinc/go-sqlite-lite/sqlite3"
+	"github.com/sclevine/spec"
+	"github.com/sclevine/spec/report"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"skenario/pkg/model"
+	"skenario/pkg/simulator"
+)
+
+func TestExport(t *testing.T) {
+	spec.Run(t, "Export", testExport, spec.Report(report.Terminal{}))
+}
+
+func testExport(t *testing.T, describe spec.G, it spec.S) {
+	var conn *sqlite3.Conn
+	var scenarioRunId int64
+	var table Table
+	var err error
+
+	it.Before(func() {
+		var dir string
+		dir, err = os.Getwd()
+		require.NoError(t, err)
+		dbPath := filepath.Join(dir, "skenario_test.db")
+
+		os.Remove(dbPath)
+
+		conn, err = sqlite3.Open(dbPath)
+		require.NoError(t, err)
+
+		store, err := NewStreamingRunStore(conn, model.ClusterConfig{}, model.KnativeAutoscalerConfig{}, "test_origin", "test_pattern", 10*time.Second)
+		require.NoError(t, err)
+		scenarioRunId = store.ScenarioRunId()
+
+		at := func(d time.Duration) time.Time { return time.Unix(0, 0).Add(d) }
+		routing := simulator.NewThroughStock("RequestsRouting", "Request")
+		complete := simulator.NewThroughStock("RequestsComplete [1]", "Request")
+		failed := simulator.NewThroughStock("RequestsFailed", "Request")
+		request := simulator.NewEntity("request-1", "Request")
+
+		err = store.Flush(
+			[]simulator.CompletedMovement{
+				{Movement: simulator.NewMovement("arrive_at_routing_stock", at(time.Second), routing, routing), Moved: request},
+				{Movement: simulator.NewMovement("complete_request", at(1500*time.Millisecond), routing, complete), Moved: request},
+			},
+			[]simulator.IgnoredMovement{
+				{Reason: "ScheduledToOccurAfterHalt", Movement: simulator.NewMovement("request_failed", at(11*time.Second), routing, failed), Moved: request},
+			},
+		)
+		require.NoError(t, err)
+	})
+
+	describe("Export()", func() {
+		it("names entities and stocks in completed movements", func() {
+			table, err = Export(conn, scenarioRunId, "completed_movements")
+			require.NoError(t, err)
+
+			assert.Equal(t, "completed_movements", table.Name)
+			assert.Len(t, table.Rows, 2)
+			assert.Equal(t, []interface{}{int64(time.Second), "arrive_at_routing_stock", "request-1", "Request", "RequestsRouting", "RequestsRouting"}, table.Rows[0])
+		})
+
+		it("exports ignored movements with their reasons", func() {
+			table, err = Export(conn, scenarioRunId, "ignored_movements")
+			require.NoError(t, err)
+
+			assert.Equal(t, [][]interface{}{{int64(11 * time.Second), "request_failed", "RequestsRouting", "RequestsFailed", "ScheduledToOccurAfterHalt"}}, table.Rows)
+		})
+
+		it("exports response times", func() {
+			table, err = Export(conn, scenarioRunId, "response_times")
+			require.NoError(t, err)
+
+			assert.Equal(t, [][]interface{}{{int64(time.Second), int64(1500 * time.Millisecond), int64(500 * time.Millisecond)}}, table.Rows)
+		})
+
+		it("exports summary metrics one per row", func() {
+			table, err = Export(conn, scenarioRunId, "summary")
+			require.NoError(t, err)
+
+			assert.Equal(t, []interface{}{"requests", 1.0}, table.Rows[0])
+			assert.Len(t, table.Rows, len(reportedMetrics))
+		})
+
+		it("rejects unknown tables", func() {
+			_, err = Export(conn, scenarioRunId, "nonsense")
+			assert.Error(t, err)
+		})
+	})
+
+	describe("WriteCSV()", func() {
+		it("writes a header and a line per row", func() {
+			table, err = Export(conn, scenarioRunId, "response_times")
+			require.NoError(t, err)
+
+			buf := new(bytes.Buffer)
+			err = WriteCSV(buf, table)
+			require.NoError(t, err)
+			assert.Equal(t, "arrived_at,completed_at,response_time\n1000000000,1500000000,500000000\n", buf.String())
+		})
+	})
+
+	describe("WriteParquet()", func() {
+		var file []byte
+
+		it.Before(func() {
+			table, err = Export(conn, scenarioRunId, "completed_movements")
+			require.NoError(t, err)
+
+			buf := new(bytes.Buffer)
+			err = WriteParquet(buf, table)
+			require.NoError(t, err)
+			file = buf.Bytes()
+		})
+
+		it("begins and ends with the parquet magic number", func() {
+			assert.Equal(t, []byte("PAR1"), file[:4])
+			assert.Equal(t, []byte("PAR1"), file[len(file)-4:])
+		})
+
+		it("ends with the length of the file metadata", func() {
+			length := binary.LittleEndian.Uint32(file[len(file)-8 : len(file)-4])
+			assert.True(t, int(length) < len(file)-12)
+			assert.Contains(t, string(file[len(file)-8-int(length):]), "from_stock")
+		})
+
+		it("writes strings with a length prefix", func() {
+			assert.Contains(t, string(file), "\x17\x00\x00\x00arrive_at_routing_stock")
+		})
+	})
+}
@@ -0,0 +1,280 @@
+/*
+ * Copyright (C) 2019-Present Pivotal Software, Inc. All rights reserved.
+ *
+ * This program and the accompanying materials are made available under the terms
+ * of the Apache License, Version 2.0 (the "License”); you may not use this file
+ * except in compliance with the License. You may obtain a copy of the License at:
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software distributed
+ * under the License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR
+ * CONDITIONS OF ANY KIND, either express or implied. See the License for the
+ * specific language governing permissions and limitations under the License.
+ */
+
+package data
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"math"
+)
+
+// Parquet physical types, repetitions, encodings and page types, as numbered in parquet.thrift.
+const (
+	parquetInt64     = 2
+	parquetDouble    = 5
+	parquetByteArray = 6
+
+	parquetRequired      = 0
+	parquetConvertedUTF8 = 0
+
+	parquetPlain = 0
+	parquetRLE   = 3
+
+	parquetDataPage     = 0
+	parquetUncompressed = 0
+)
+
+var parquetMagic = []byte("PAR1")
+
+// WriteParquet writes a table as a Parquet file with a single row group. Every column is
+// required and plainly encoded, in one uncompressed data page.
+func WriteParquet(w io.Writer, table Table) error {
+	file := new(bytes.Buffer)
+	file.Write(parquetMagic)
+
+	chunks := make([]parquetChunk, len(table.Columns))
+	for i, column := range table.Columns {
+		values, err := parquetValues(table, i)
+		if err != nil {
+			return err
+		}
+
+		header := new(thriftCompact)
+		header.i32(1, parquetDataPage)
+		header.i32(2, int32(len(values)))
+		header.i32(3, int32(len(values)))
+		header.structBegin(5)
+		header.i32(1, int32(len(table.Rows)))
+		header.i32(2, parquetPlain)
+		header.i32(3, parquetRLE)
+		header.i32(4, parquetRLE)
+		header.structEnd()
+		header.stop()
+
+		chunks[i] = parquetChunk{
+			column: column,
+			offset: int64(file.Len()),
+			size:   int64(header.buf.Len() + len(values)),
+		}
+		file.Write(header.buf.Bytes())
+		file.Write(values)
+	}
+
+	metadata := parquetFileMetaData(table, chunks)
+	file.Write(metadata)
+	binary.Write(file, binary.LittleEndian, int32(len(metadata)))
+	file.Write(parquetMagic)
+
+	_, err := w.Write(file.Bytes())
+	return err
+}
+
+type parquetChunk struct {
+	column Column
+	offset int64
+	size   int64
+}
+
+func parquetValues(table Table, column int) ([]byte, error) {
+	values := new(bytes.Buffer)
+
+	for _, row := range table.Rows {
+		switch v := row[column].(type) {
+		case int64:
+			binary.Write(values, binary.LittleEndian, v)
+		case float64:
+			binary.Write(values, binary.LittleEndian, math.Float64bits(v))
+		case string:
+			binary.Write(values, binary.LittleEndian, int32(len(v)))
+			values.WriteString(v)
+		default:
+			return nil, fmt.Errorf("cannot write %T to parquet column '%s'", v, table.Columns[column].Name)
+		}
+	}
+
+	return values.Bytes(), nil
+}
+
+func parquetType(column Column) int32 {
+	switch column.Type {
+	case Int64Column:
+		return parquetInt64
+	case Float64Column:
+		return parquetDouble
+	default:
+		return parquetByteArray
+	}
+}
+
+func parquetFileMetaData(table Table, chunks []parquetChunk) []byte {
+	var totalSize int64
+	for _, c := range chunks {
+		totalSize += c.size
+	}
+
+	fm := new(thriftCompact)
+	fm.i32(1, 1)
+
+	fm.listBegin(2, thriftStruct, len(chunks)+1)
+	fm.elementBegin()
+	fm.binary(4, "schema")
+	fm.i32(5, int32(len(chunks)))
+	fm.elementEnd()
+	for _, c := range chunks {
+		fm.elementBegin()
+		fm.i32(1, parquetType(c.column))
+		fm.i32(3, parquetRequired)
+		fm.binary(4, c.column.Name)
+		if c.column.Type == StringColumn {
+			fm.i32(6, parquetConvertedUTF8)
+		}
+		fm.elementEnd()
+	}
+
+	fm.i64(3, int64(len(table.Rows)))
+
+	fm.listBegin(4, thriftStruct, 1)
+	fm.elementBegin()
+	fm.listBegin(1, thriftStruct, len(chunks))
+	for _, c := range chunks {
+		fm.elementBegin()
+		fm.i64(2, c.offset)
+		fm.structBegin(3)
+		fm.i32(1, parquetType(c.column))
+		fm.listBegin(2, thriftI32, 1)
+		fm.varint(parquetPlain)
+		fm.listBegin(3, thriftBinary, 1)
+		fm.string(c.column.Name)
+		fm.i32(4, parquetUncompressed)
+		fm.i64(5, int64(len(table.Rows)))
+		fm.i64(6, c.size)
+		fm.i64(7, c.size)
+		fm.i64(9, c.offset)
+		fm.structEnd()
+		fm.elementEnd()
+	}
+	fm.i64(2, totalSize)
+	fm.i64(3, int64(len(table.Rows)))
+	fm.elementEnd()
+
+	fm.binary(6, "skenario")
+	fm.stop()
+
+	return fm.buf.Bytes()
+}
+
+// Thrift compact protocol types.
+const (
+	thriftI32    = 5
+	thriftI64    = 6
+	thriftBinary = 8
+	thriftList   = 9
+	thriftStruct = 12
+)
+
+// thriftCompact writes the subset of the Thrift compact protocol used by Parquet metadata.
+type thriftCompact struct {
+	buf       bytes.Buffer
+	lastField int16
+	outer     []int16
+}
+
+func (t *thriftCompact) field(id int16, fieldType byte) {
+	delta := id - t.lastField
+	if delta > 0 && delta <= 15 {
+		t.buf.WriteByte(byte(delta)<<4 | fieldType)
+	} else {
+		t.buf.WriteByte(fieldType)
+		t.varint(int64(id))
+	}
+	t.lastField = id
+}
+
+func (t *thriftCompact) varint(v int64) {
+	zigzag := uint64((v << 1) ^ (v >> 63))
+	for zigzag >= 0x80 {
+		t.buf.WriteByte(byte(zigzag) | 0x80)
+		zigzag >>= 7
+	}
+	t.buf.WriteByte(byte(zigzag))
+}
+
+func (t *thriftCompact) length(n int) {
+	u := uint64(n)
+	for u >= 0x80 {
+		t.buf.WriteByte(byte(u) | 0x80)
+		u >>= 7
+	}
+	t.buf.WriteByte(byte(u))
+}
+
+func (t *thriftCompact) string(s string) {
+	t.length(len(s))
+	t.buf.WriteString(s)
+}
+
+func (t *thriftCompact) i32(id int16, v int32) {
+	t.field(id, thriftI32)
+	t.varint(int64(v))
+}
+
+func (t *thriftCompact) i64(id int16, v int64) {
+	t.field(id, thriftI64)
+	t.varint(v)
+}
+
+func (t *thriftCompact) binary(id int16, s string) {
+	t.field(id, thriftBinary)
+	t.string(s)
+}
+
+func (t *thriftCompact) structBegin(id int16) {
+	t.field(id, thriftStruct)
+	t.elementBegin()
+}
+
+func (t *thriftCompact) structEnd() {
+	t.elementEnd()
+}
+
+// listBegin starts a list field. Its elements follow, written with varint, string or, for
+// structs, between elementBegin and elementEnd.
+func (t *thriftCompact) listBegin(id int16, elementType byte, size int) {
+	t.field(id, thriftList)
+	if size < 15 {
+		t.buf.WriteByte(byte(size)<<4 | elementType)
+	} else {
+		t.buf.WriteByte(0xf0 | elementType)
+		t.length(size)
+	}
+}
+
+func (t *thriftCompact) elementBegin() {
+	t.outer = append(t.outer, t.lastField)
+	t.lastField = 0
+}
+
+func (t *thriftCompact) elementEnd() {
+	t.stop()
+	t.lastField = t.outer[len(t.outer)-1]
+	t.outer = t.outer[:len(t.outer)-1]
+}
+
+func (t *thriftCompact) stop() {
+	t.buf.WriteByte(0)
+}
@@ -0,0 +1,319 @@
+/*
+ * Copyright (C) 2019-Present Pivotal Software, Inc. All rights reserved.
+ *
+ * This program and the accompanying materials are made available under the terms
+ * of the Apache License, Version 2.0 (the "License”); you may not use this file
+ * except in compliance with the License. You may obtain a copy of the License at:
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software distributed
+ * under the License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR
+ * CONDITIONS OF ANY KIND, either express or implied. See the License for the
+ * specific language governing permissions and limitations under the License.
+ */
+
+package data
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"math"
+	"testing"
+
+	"github.com/sclevine/spec"
+	"github.com/sclevine/spec/report"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParquet(t *testing.T) {
+	spec.Run(t, "Parquet", testParquet, spec.Report(report.Terminal{}))
+}
+
+func testParquet(t *testing.T, describe spec.G, it spec.S) {
+	var table Table
+	var file []byte
+	var metadata map[int16]interface{}
+
+	write := func() {
+		buf := new(bytes.Buffer)
+		err := WriteParquet(buf, table)
+		require.NoError(t, err)
+		file = buf.Bytes()
+
+		require.True(t, len(file) > 12)
+		require.Equal(t, []byte("PAR1"), file[:4])
+		require.Equal(t, []byte("PAR1"), file[len(file)-4:])
+
+		length := int(binary.LittleEndian.Uint32(file[len(file)-8 : len(file)-4]))
+		start := len(file) - 8 - length
+		require.True(t, start >= 4)
+
+		footer := &thriftReader{buf: file[start : len(file)-8]}
+		metadata = footer.readStruct()
+		require.Equal(t, length, footer.pos, "the file metadata should take up all of its length")
+	}
+
+	describe("a table of each type of column", func() {
+		it.Before(func() {
+			table = Table{
+				Name: "mixed",
+				Columns: []Column{
+					{"occurs_at", Int64Column},
+					{"utilization", Float64Column},
+					{"stock", StringColumn},
+				},
+				Rows: [][]interface{}{
+					{int64(1000000000), 0.5, "RequestsRouting"},
+					{int64(-7), math.Inf(1), ""},
+					{int64(math.MaxInt64), -0.125, "RequestsProcessing [café]"},
+				},
+			}
+			write()
+		})
+
+		it("describes the file in its metadata", func() {
+			assert.Equal(t, int64(1), metadata[1])
+			assert.Equal(t, int64(3), metadata[3], "num_rows")
+			assert.Equal(t, "skenario", metadata[6], "created_by")
+		})
+
+		it("has a schema of the table's columns", func() {
+			schema := metadata[2].([]interface{})
+			require.Len(t, schema, 4)
+
+			root := schema[0].(map[int16]interface{})
+			assert.Equal(t, "schema", root[4])
+			assert.Equal(t, int64(3), root[5], "num_children")
+
+			expected := []struct {
+				name      string
+				typ       int64
+				converted interface{}
+			}{
+				{"occurs_at", 2, nil},
+				{"utilization", 5, nil},
+				{"stock", 6, int64(0)},
+			}
+			for i, e := range expected {
+				element := schema[i+1].(map[int16]interface{})
+				assert.Equal(t, e.name, element[4])
+				assert.Equal(t, e.typ, element[1], "type of %s", e.name)
+				assert.Equal(t, int64(0), element[3], "%s should be required", e.name)
+				assert.Equal(t, e.converted, element[6], "converted type of %s", e.name)
+			}
+		})
+
+		it("has one row group with a column chunk per column", func() {
+			rowGroups := metadata[4].([]interface{})
+			require.Len(t, rowGroups, 1)
+
+			rowGroup := rowGroups[0].(map[int16]interface{})
+			assert.Equal(t, int64(3), rowGroup[3], "num_rows")
+
+			chunks := rowGroup[1].([]interface{})
+			require.Len(t, chunks, 3)
+
+			var totalSize int64
+			offset := int64(4)
+			for i, c := range chunks {
+				chunk := c.(map[int16]interface{})
+				meta := chunk[3].(map[int16]interface{})
+
+				assert.Equal(t, offset, chunk[2], "chunks should follow one another")
+				assert.Equal(t, offset, meta[9], "data_page_offset")
+				assert.Equal(t, []interface{}{int64(0)}, meta[2], "plain encoding")
+				assert.Equal(t, []interface{}{table.Columns[i].Name}, meta[3], "path_in_schema")
+				assert.Equal(t, int64(0), meta[4], "uncompressed")
+				assert.Equal(t, int64(3), meta[5], "num_values")
+				assert.Equal(t, meta[6], meta[7])
+
+				offset += meta[7].(int64)
+				totalSize += meta[7].(int64)
+			}
+			assert.Equal(t, totalSize, rowGroup[2], "total_byte_size")
+
+			length := int64(binary.LittleEndian.Uint32(file[len(file)-8 : len(file)-4]))
+			assert.Equal(t, int64(len(file))-8-length, offset, "the metadata should follow the last chunk")
+		})
+
+		it("reads back the values of each column", func() {
+			assert.Equal(t, table.Rows, readParquetRows(t, file, metadata))
+		})
+	})
+
+	describe("a table with more than fourteen columns", func() {
+		it.Before(func() {
+			table = Table{Name: "wide"}
+			row := make([]interface{}, 0, 20)
+			for i := 0; i < 20; i++ {
+				table.Columns = append(table.Columns, Column{fmt.Sprintf("c%d", i), Int64Column})
+				row = append(row, int64(i*i))
+			}
+			table.Rows = [][]interface{}{row, row}
+			write()
+		})
+
+		it("lists every column in the schema and the row group", func() {
+			assert.Len(t, metadata[2].([]interface{}), 21)
+
+			rowGroup := metadata[4].([]interface{})[0].(map[int16]interface{})
+			assert.Len(t, rowGroup[1].([]interface{}), 20)
+		})
+
+		it("reads back the values of each column", func() {
+			assert.Equal(t, table.Rows, readParquetRows(t, file, metadata))
+		})
+	})
+
+	describe("a table with values of another type", func() {
+		it("returns an error", func() {
+			table = Table{
+				Columns: []Column{{"tally", Int64Column}},
+				Rows:    [][]interface{}{{int32(1)}},
+			}
+			err := WriteParquet(new(bytes.Buffer), table)
+			assert.Error(t, err)
+		})
+	})
+}
+
+// readParquetRows reads the rows of a file written by WriteParquet, from the data page of each
+// of its column chunks.
+func readParquetRows(t *testing.T, file []byte, metadata map[int16]interface{}) [][]interface{} {
+	numRows := int(metadata[3].(int64))
+	schema := metadata[2].([]interface{})[1:]
+	chunks := metadata[4].([]interface{})[0].(map[int16]interface{})[1].([]interface{})
+
+	rows := make([][]interface{}, numRows)
+	for i := range rows {
+		rows[i] = make([]interface{}, len(chunks))
+	}
+
+	for col, c := range chunks {
+		meta := c.(map[int16]interface{})[3].(map[int16]interface{})
+		typ := schema[col].(map[int16]interface{})[1].(int64)
+		require.Equal(t, typ, meta[1], "the chunk and schema types should agree")
+
+		offset := int(meta[9].(int64))
+		reader := &thriftReader{buf: file[offset : offset+int(meta[7].(int64))]}
+		header := reader.readStruct()
+		require.Equal(t, int64(0), header[1], "data page")
+		require.Equal(t, header[2], header[3])
+
+		dataPage := header[5].(map[int16]interface{})
+		require.Equal(t, int64(numRows), dataPage[1], "num_values")
+		require.Equal(t, int64(0), dataPage[2], "plain encoding")
+
+		values := reader.buf[reader.pos:]
+		require.Equal(t, int(header[3].(int64)), len(values), "the page should fill the rest of the chunk")
+
+		for row := 0; row < numRows; row++ {
+			switch typ {
+			case 2:
+				rows[row][col] = int64(binary.LittleEndian.Uint64(values))
+				values = values[8:]
+			case 5:
+				rows[row][col] = math.Float64frombits(binary.LittleEndian.Uint64(values))
+				values = values[8:]
+			case 6:
+				length := int(binary.LittleEndian.Uint32(values))
+				rows[row][col] = string(values[4 : 4+length])
+				values = values[4+length:]
+			default:
+				t.Fatalf("unexpected type %d", typ)
+			}
+		}
+		assert.Empty(t, values)
+	}
+
+	return rows
+}
+
+// thriftReader reads the Thrift compact protocol into maps of field ids to values, lists of
+// values, int64s, float64s, bools and strings.
+type thriftReader struct {
+	buf []byte
+	pos int
+}
+
+func (r *thriftReader) byte() byte {
+	b := r.buf[r.pos]
+	r.pos++
+	return b
+}
+
+func (r *thriftReader) uvarint() uint64 {
+	v, n := binary.Uvarint(r.buf[r.pos:])
+	if n <= 0 {
+		panic("bad varint")
+	}
+	r.pos += n
+	return v
+}
+
+func (r *thriftReader) zigzag() int64 {
+	u := r.uvarint()
+	return int64(u>>1) ^ -int64(u&1)
+}
+
+func (r *thriftReader) readStruct() map[int16]interface{} {
+	fields := make(map[int16]interface{})
+	var last int16
+	for {
+		b := r.byte()
+		if b == 0 {
+			return fields
+		}
+
+		id := last + int16(b>>4)
+		if b>>4 == 0 {
+			id = int16(r.zigzag())
+		}
+		last = id
+
+		switch fieldType := b & 0x0f; fieldType {
+		case 1, 2:
+			fields[id] = fieldType == 1
+		default:
+			fields[id] = r.value(fieldType)
+		}
+	}
+}
+
+func (r *thriftReader) value(valueType byte) interface{} {
+	switch valueType {
+	case 1, 2:
+		return r.byte() == 1
+	case 3:
+		return int64(int8(r.byte()))
+	case 4, 5, 6:
+		return r.zigzag()
+	case 7:
+		v := math.Float64frombits(binary.LittleEndian.Uint64(r.buf[r.pos:]))
+		r.pos += 8
+		return v
+	case 8:
+		length := int(r.uvarint())
+		s := string(r.buf[r.pos : r.pos+length])
+		r.pos += length
+		return s
+	case 9, 10:
+		header := r.byte()
+		size := int(header >> 4)
+		if size == 15 {
+			size = int(r.uvarint())
+		}
+		list := make([]interface{}, size)
+		for i := range list {
+			list[i] = r.value(header & 0x0f)
+		}
+		return list
+	case 12:
+		return r.readStruct()
+	default:
+		panic(fmt.Sprintf("unsupported thrift type %d", valueType))
+	}
+}
@@ -28,10 +28,10 @@ select
 		   when to_stock = sa.id then 1
 		 end)
 	  over summation as tally
-	from completed_movements join stock_aggregate sa on sa.id in (from_stock, to_stock)
+	from completed_movements cm join stock_aggregate sa on sa.id in (from_stock, to_stock)
 	where kind not in ('start_to_running', 'autoscaler_tick', 'running_to_halted')
 	and scenario_run_id = ?
-    window summation as (partition by sa.name order by occurs_at asc rows unbounded preceding)
+    window summation as (partition by sa.name order by occurs_at asc, cm.id asc rows unbounded preceding)
 )
 select occurs_at
      , stock_name
@@ -38,6 +38,14 @@ type RunStore interface {
 	) (scenarioRunId int64, err error)
 }
 
+// StreamingRunStore records a scenario run whose movements are flushed to it in batches
+// by a running Environment, rather than being handed over all at once after Run().
+type StreamingRunStore interface {
+	simulator.MovementSink
+	ScenarioRunId() int64
+	Finish(cpuUtilizations []*simulator.CPUUtilization) error
+}
+
 type storer struct {
 	conn            *sqlite3.Conn
 	clusterConf     model.ClusterConfig
@@ -69,7 +77,12 @@ func (s *storer) Store(completed []simulator.CompletedMovement, ignored []simula
 	}
 
 	err = s.conn.WithTx(func() error {
-		return s.scenarioData(scenarioRunId)
+		err := s.movementData(scenarioRunId, s.completed, s.ignored)
+		if err != nil {
+			return err
+		}
+
+		return s.cpuUtilizationData(scenarioRunId, s.cpuUtilizations)
 	})
 	if err != nil {
 		return scenarioRunId, err
@@ -122,7 +135,7 @@ func (s *storer) scenarioRun() (scenarioRunId int64, err error) {
 	return lastId, nil
 }
 
-func (s *storer) scenarioData(scenarioRunId int64) error {
+func (s *storer) movementData(scenarioRunId int64, completed []simulator.CompletedMovement, ignored []simulator.IgnoredMovement) error {
 	entityStmt, err := s.conn.Prepare(`insert into entities(name, kind) values (?, ?) on conflict do nothing`)
 	if err != nil {
 		return err
@@ -155,7 +168,7 @@ func (s *storer) scenarioData(scenarioRunId int64) error {
 	}
 	defer movementStmt.Close()
 
-	for _, mv := range s.completed {
+	for _, mv := range completed {
 		from := mv.Movement.From()
 		to := mv.Movement.To()
 
@@ -210,7 +223,7 @@ func (s *storer) scenarioData(scenarioRunId int64) error {
 	}
 	defer ignoredStmt.Close()
 
-	for _, mv := range s.ignored {
+	for _, mv := range ignored {
 		from := mv.Movement.From()
 		to := mv.Movement.To()
 
@@ -239,6 +252,10 @@ func (s *storer) scenarioData(scenarioRunId int64) error {
 		}
 	}
 
+	return nil
+}
+
+func (s *storer) cpuUtilizationData(scenarioRunId int64, cpuUtilizations []*simulator.CPUUtilization) error {
 	cpuUtilizationStmt, err := s.conn.Prepare(`insert into cpu_utilizations(
 		cpu_utilization
 	  , calculated_at
@@ -248,8 +265,12 @@ func (s *storer) scenarioData(scenarioRunId int64) error {
 	   , ?
 	   , ?)
 	`)
+	if err != nil {
+		return err
+	}
+	defer cpuUtilizationStmt.Close()
 
-	for _, mv := range s.cpuUtilizations {
+	for _, mv := range cpuUtilizations {
 
 		err = cpuUtilizationStmt.Exec(
 			mv.CPUUtilization,
@@ -264,6 +285,27 @@ func (s *storer) scenarioData(scenarioRunId int64) error {
 	return nil
 }
 
+type streamingStorer struct {
+	storer
+	scenarioRunId int64
+}
+
+func (ss *streamingStorer) ScenarioRunId() int64 {
+	return ss.scenarioRunId
+}
+
+func (ss *streamingStorer) Flush(completed []simulator.CompletedMovement, ignored []simulator.IgnoredMovement) error {
+	return ss.conn.WithTx(func() error {
+		return ss.movementData(ss.scenarioRunId, completed, ignored)
+	})
+}
+
+func (ss *streamingStorer) Finish(cpuUtilizations []*simulator.CPUUtilization) error {
+	return ss.conn.WithTx(func() error {
+		return ss.cpuUtilizationData(ss.scenarioRunId, cpuUtilizations)
+	})
+}
+
 func NewRunStore(conn *sqlite3.Conn) RunStore {
 	err := conn.Exec(Schema)
 	if err != nil {
@@ -274,3 +316,43 @@ func NewRunStore(conn *sqlite3.Conn) RunStore {
 		conn: conn,
 	}
 }
+
+func NewStreamingRunStore(conn *sqlite3.Conn, clusterConf model.ClusterConfig, kpaConf model.KnativeAutoscalerConfig, origin string,
+	trafficPattern string, ranFor time.Duration) (StreamingRunStore, error) {
+	err := conn.Exec(Schema)
+	if err != nil {
+		return nil, fmt.Errorf("could not apply skenario schema: %s", err.Error())
+	}
+
+	ss := &streamingStorer{
+		storer: storer{
+			conn:           conn,
+			clusterConf:    clusterConf,
+			kpaConf:        kpaConf,
+			origin:         origin,
+			trafficPattern: trafficPattern,
+			ranFor:         ranFor,
+		},
+	}
+
+	ss.scenarioRunId, err = ss.scenarioRun()
+	if err != nil {
+		return nil, err
+	}
+
+	return ss, nil
+}
+
+// StoreRunConfiguration records the full configuration that a scenario run was made with,
+// as JSON, alongside the parameters kept in scenario_runs.
+func StoreRunConfiguration(conn *sqlite3.Conn, scenarioRunId int64, configuration string) error {
+	err := conn.Exec(`insert or replace into scenario_run_configurations(scenario_run_id, configuration) values (?, ?)`,
+		scenarioRunId,
+		configuration,
+	)
+	if err != nil {
+		return fmt.Errorf("could not insert scenario run configuration: %s", err.Error())
+	}
+
+	return nil
+}
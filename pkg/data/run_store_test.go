@@ -17,8 +17,11 @@ package data
 
 import (
 	"context"
+	"fmt"
+	"io/ioutil"
 	"os"
 	"path/filepath"
+	"runtime/debug"
 	"testing"
 	"time"
 
@@ -291,6 +294,201 @@ func testStorer(t *testing.T, describe spec.G, it spec.S) {
 	})
 }
 
+func TestStreamingRunStore(t *testing.T) {
+	spec.Run(t, "StreamingRunStore", testStreamingStorer, spec.Report(report.Terminal{}))
+}
+
+func testStreamingStorer(t *testing.T, describe spec.G, it spec.S) {
+	var subject StreamingRunStore
+	var conn *sqlite3.Conn
+	var env simulator.Environment
+	var startAt time.Time
+	var err error
+
+	it.Before(func() {
+		var dir string
+		dir, err = os.Getwd()
+		require.NoError(t, err)
+		dbPath := filepath.Join(dir, "skenario_test.db")
+
+		os.Remove(dbPath)
+
+		conn, err = sqlite3.Open(dbPath)
+		require.NoError(t, err)
+
+		startAt = time.Unix(0, 123456789)
+		subject, err = NewStreamingRunStore(conn, model.ClusterConfig{}, model.KnativeAutoscalerConfig{}, "test_origin", "test_pattern", 10*time.Minute)
+		require.NoError(t, err)
+
+		env = simulator.NewEnvironmentWithConfig(context.Background(), simulator.EnvironmentConfig{
+			StartAt:      startAt,
+			RunFor:       10 * time.Minute,
+			MovementSink: subject,
+			FlushEvery:   2,
+		})
+
+		stock1 := simulator.NewThroughStock("stock 1", "test entity")
+		stock2 := simulator.NewThroughStock("stock 2", "test entity")
+		env.AddToSchedule(simulator.NewMovement("stock 1 -> stock 2", startAt.Add(111*time.Second), stock1, stock2))
+		env.AddToSchedule(simulator.NewMovement("Ignored", env.HaltTime().Add(10*time.Second), simulator.NewSourceStock("Source", "Entity"), simulator.NewSinkStock("Sink", "Entity")))
+
+		_, _, err = env.Run()
+		require.NoError(t, err)
+
+		err = subject.Finish([]*simulator.CPUUtilization{{CPUUtilization: 12.5, CalculatedAt: startAt}})
+		require.NoError(t, err)
+	})
+
+	describe("ScenarioRunId()", func() {
+		it("returns the scenario_run ID recorded at creation", func() {
+			assert.Equal(t, int64(1), subject.ScenarioRunId())
+		})
+	})
+
+	describe("Flush()", func() {
+		var movementsCount, ignoredCount int
+
+		it.Before(func() {
+			singleQuery(t, conn, `select count(1) from completed_movements where scenario_run_id = 1`, &movementsCount)
+			singleQuery(t, conn, `select count(1) from ignored_movements where scenario_run_id = 1`, &ignoredCount)
+		})
+
+		it("inserts every completed movement", func() {
+			assert.Equal(t, 2, movementsCount)
+		})
+
+		it("inserts every ignored movement", func() {
+			assert.Equal(t, 2, ignoredCount)
+		})
+	})
+
+	describe("Finish()", func() {
+		var cpuUtilization float64
+
+		it.Before(func() {
+			singleQuery(t, conn, `select cpu_utilization from cpu_utilizations where scenario_run_id = 1`, &cpuUtilization)
+		})
+
+		it("inserts the CPU utilizations", func() {
+			assert.Equal(t, 12.5, cpuUtilization)
+		})
+	})
+}
+
+func TestStreamingRunStoreMemory(t *testing.T) {
+	spec.Run(t, "StreamingRunStore memory", testStreamingStorerMemory, spec.Report(report.Terminal{}))
+}
+
+func testStreamingStorerMemory(t *testing.T, describe spec.G, it spec.S) {
+	describe("streaming to a database file", func() {
+		var shortRunGrowth, longRunGrowth int64
+
+		it.Before(func() {
+			if _, err := os.Stat("/proc/self/statm"); err != nil {
+				t.Skip("resident memory can only be read from /proc")
+			}
+
+			shortRunGrowth = streamTicks(t, 20000*time.Second)
+			longRunGrowth = streamTicks(t, 400000*time.Second)
+		})
+
+		it("keeps resident memory flat as the run grows longer", func() {
+			assert.InDelta(t, shortRunGrowth, longRunGrowth, 8*1024*1024)
+		})
+	})
+}
+
+// streamTicks streams a movement every second for runFor into a fresh database file and
+// returns how far resident memory grew meanwhile.
+func streamTicks(t *testing.T, runFor time.Duration) int64 {
+	dir, err := os.Getwd()
+	require.NoError(t, err)
+	dbPath := filepath.Join(dir, "skenario_memory_test.db")
+	os.Remove(dbPath)
+	defer os.Remove(dbPath)
+
+	conn, err := sqlite3.Open(dbPath)
+	require.NoError(t, err)
+	defer conn.Close()
+
+	before := residentMemory(t)
+
+	store, err := NewStreamingRunStore(conn, model.ClusterConfig{}, model.KnativeAutoscalerConfig{}, "test_origin", "test_pattern", runFor)
+	require.NoError(t, err)
+
+	startAt := time.Unix(0, 0)
+	env := simulator.NewEnvironmentWithConfig(context.Background(), simulator.EnvironmentConfig{
+		StartAt:      startAt,
+		RunFor:       runFor,
+		MovementSink: store,
+		FlushEvery:   10000,
+	})
+	ticker := &tickingStock{env: env}
+	source := simulator.NewThroughStock("Source", "Tick")
+	err = source.Add(simulator.NewEntity("tick", "Tick"))
+	require.NoError(t, err)
+	env.AddToSchedule(simulator.NewMovement("tick", startAt.Add(time.Second), source, ticker))
+
+	_, _, err = env.Run()
+	require.NoError(t, err)
+	err = store.Finish(nil)
+	require.NoError(t, err)
+
+	return residentMemory(t) - before
+}
+
+func residentMemory(t *testing.T) int64 {
+	debug.FreeOSMemory()
+
+	statm, err := ioutil.ReadFile("/proc/self/statm")
+	require.NoError(t, err)
+	var size, resident int64
+	_, err = fmt.Sscan(string(statm), &size, &resident)
+	require.NoError(t, err)
+
+	return resident * int64(os.Getpagesize())
+}
+
+// tickingStock holds one entity at a time, and moves it back into itself a second after it arrives.
+type tickingStock struct {
+	env    simulator.Environment
+	entity simulator.Entity
+}
+
+func (ts *tickingStock) Name() simulator.StockName {
+	return "Ticking"
+}
+
+func (ts *tickingStock) KindStocked() simulator.EntityKind {
+	return "Tick"
+}
+
+func (ts *tickingStock) Count() uint64 {
+	if ts.entity == nil {
+		return 0
+	}
+	return 1
+}
+
+func (ts *tickingStock) EntitiesInStock() []*simulator.Entity {
+	if ts.entity == nil {
+		return []*simulator.Entity{}
+	}
+	return []*simulator.Entity{&ts.entity}
+}
+
+func (ts *tickingStock) Remove() simulator.Entity {
+	entity := ts.entity
+	ts.entity = nil
+	return entity
+}
+
+func (ts *tickingStock) Add(entity simulator.Entity) error {
+	ts.entity = entity
+	ts.env.AddToSchedule(simulator.NewMovement("tick", ts.env.CurrentMovementTime().Add(time.Second), ts, ts))
+	return nil
+}
+
 func singleQuery(t *testing.T, conn *sqlite3.Conn, sql string, scanDst ...interface{}) {
 	selectStmt, err := conn.Prepare(sql)
 	require.NoError(t, err)
@@ -78,7 +78,9 @@ create table if not exists cpu_utilizations
 	scenario_run_id 	integer not null references scenario_runs (id)
 );
 
-create unique index if not exists move_once_per_run on completed_movements (occurs_at, scenario_run_id);
+-- movements at the same instant are allowed, so these are no longer unique
+drop index if exists move_once_per_run;
+create index if not exists completed_movements_occurs_at on completed_movements (occurs_at, scenario_run_id);
 
 create table if not exists ignored_movements
 (
@@ -92,7 +94,31 @@ create table if not exists ignored_movements
 
     scenario_run_id integer not null references scenario_runs (id)
 );
-create unique index if not exists ignore_once_per_run on ignored_movements (occurs_at, scenario_run_id);
+drop index if exists ignore_once_per_run;
+create index if not exists ignored_movements_occurs_at on ignored_movements (occurs_at, scenario_run_id);
+
+create table if not exists scenario_run_configurations
+(
+    scenario_run_id integer primary key references scenario_runs (id),
+    configuration   text not null -- the full run request, as JSON
+);
+
+create table if not exists experiments
+(
+    id         integer primary key, -- aliases to rowid
+    recorded   text not null,
+    name       text not null,
+    definition text not null        -- the experiment definition, as JSON
+);
+
+create table if not exists experiment_runs
+(
+    id              integer primary key, -- aliases to rowid
+    experiment_id   integer not null references experiments (id),
+    scenario_run_id integer not null references scenario_runs (id),
+    parameters      text    not null     -- the values this run took along each axis, as JSON
+);
+create index if not exists experiment_runs_experiment on experiment_runs (experiment_id);
 
 create view if not exists stock_aggregate as
 select id
@@ -106,7 +132,10 @@ select id
     end) as kind_stocked
 from stocks
 where kind_stocked in ('Request', 'Desired', 'Replica')
-  and name not in ('TrafficSource', 'ReplicaSource', 'DesiredSource', 'DesiredSink', 'ReplicasLaunching', 'ReplicasTerminating', 'ReplicasTerminated')
+  and (case
+           when name like '% [%]' then substr(name, 1, instr(name, ' [') - 1)
+           else name
+    end) not in ('TrafficSource', 'ReplicaSource', 'CallSource', 'DesiredSource', 'DesiredSink', 'ReplicasLaunching', 'ReplicasTerminating', 'ReplicasTerminated', 'ReplicasKilled')
   and name not like 'RequestsComplete%'
 ;
 `
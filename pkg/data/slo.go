@@ -0,0 +1,175 @@
+/*
+ * Copyright (C) 2019-Present Pivotal Software, Inc. All rights reserved.
+ *
+ * This program and the accompanying materials are made available under the terms
+ * of the Apache License, Version 2.0 (the "License”); you may not use this file
+ * except in compliance with the License. You may obtain a copy of the License at:
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software distributed
+ * under the License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR
+ * CONDITIONS OF ANY KIND, either express or implied. See the License for the
+ * specific language governing permissions and limitations under the License.
+ */
+
+package data
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Objective is a single comparison of a summary metric against a target value,
+// such as "p99 < 500ms".
+type Objective struct {
+	Metric     string  `json:"metric"`
+	Comparison string  `json:"comparison"`
+	Target     float64 `json:"target"`
+	Expression string  `json:"expression"`
+}
+
+// ObjectiveResult records how a run fared against a single Objective.
+type ObjectiveResult struct {
+	Objective Objective `json:"objective"`
+	Actual    float64   `json:"actual"`
+	Passed    bool      `json:"passed"`
+}
+
+// SLOResult is the outcome of evaluating an SLO expression against a RunSummary.
+// The SLO passes only if every objective passes.
+type SLOResult struct {
+	Expression string            `json:"expression"`
+	Passed     bool              `json:"passed"`
+	Objectives []ObjectiveResult `json:"objectives"`
+}
+
+var comparisons = []string{"<=", ">=", "==", "!=", "<", ">"}
+
+// ParseSLO parses an expression made of objectives joined by "and", eg.
+// "p99 < 500ms and failures < 0.1%". Targets may be durations, percentages or plain numbers.
+func ParseSLO(expression string) ([]Objective, error) {
+	objectives := make([]Objective, 0)
+
+	for _, clause := range strings.Split(expression, " and ") {
+		clause = strings.TrimSpace(clause)
+		if clause == "" {
+			return nil, fmt.Errorf("empty objective in SLO '%s'", expression)
+		}
+
+		objective, err := parseObjective(clause)
+		if err != nil {
+			return nil, err
+		}
+		objectives = append(objectives, objective)
+	}
+
+	return objectives, nil
+}
+
+func parseObjective(clause string) (Objective, error) {
+	for _, cmp := range comparisons {
+		idx := strings.Index(clause, cmp)
+		if idx < 0 {
+			continue
+		}
+
+		metric := strings.TrimSpace(clause[:idx])
+		if metric == "" {
+			return Objective{}, fmt.Errorf("objective '%s' has no metric", clause)
+		}
+		if err := ValidateMetric(metric); err != nil {
+			return Objective{}, err
+		}
+
+		target, err := parseTarget(metric, strings.TrimSpace(clause[idx+len(cmp):]))
+		if err != nil {
+			return Objective{}, fmt.Errorf("objective '%s': %s", clause, err.Error())
+		}
+
+		return Objective{
+			Metric:     metric,
+			Comparison: cmp,
+			Target:     target,
+			Expression: clause,
+		}, nil
+	}
+
+	return Objective{}, fmt.Errorf("objective '%s' has no comparison, expected one of %v", clause, comparisons)
+}
+
+func parseTarget(metric, value string) (float64, error) {
+	if value == "" {
+		return 0, fmt.Errorf("no target value")
+	}
+
+	if IsDurationMetric(metric) {
+		d, err := time.ParseDuration(value)
+		if err != nil {
+			return 0, fmt.Errorf("target for '%s' must be a duration: %s", metric, err.Error())
+		}
+		return float64(d), nil
+	}
+
+	if strings.HasSuffix(value, "%") {
+		pct, err := strconv.ParseFloat(strings.TrimSuffix(value, "%"), 64)
+		if err != nil {
+			return 0, err
+		}
+		return pct / 100, nil
+	}
+
+	return strconv.ParseFloat(value, 64)
+}
+
+// EvaluateSLO checks each objective of an SLO expression against a RunSummary.
+func EvaluateSLO(expression string, summary RunSummary) (SLOResult, error) {
+	objectives, err := ParseSLO(expression)
+	if err != nil {
+		return SLOResult{}, err
+	}
+
+	result := SLOResult{
+		Expression: expression,
+		Passed:     true,
+		Objectives: make([]ObjectiveResult, 0, len(objectives)),
+	}
+
+	for _, obj := range objectives {
+		actual, err := summary.Metric(obj.Metric)
+		if err != nil {
+			return SLOResult{}, err
+		}
+
+		passed := compare(actual, obj.Comparison, obj.Target)
+		result.Passed = result.Passed && passed
+		result.Objectives = append(result.Objectives, ObjectiveResult{
+			Objective: obj,
+			Actual:    actual,
+			Passed:    passed,
+		})
+	}
+
+	return result, nil
+}
+
+func compare(actual float64, cmp string, target float64) bool {
+	switch cmp {
+	case "<":
+		return actual < target
+	case "<=":
+		return actual <= target
+	case ">":
+		return actual > target
+	case ">=":
+		return actual >= target
+	case "==":
+		return actual == target
+	case "!=":
+		return actual != target
+	default:
+		panic(fmt.Errorf("unknown comparison '%s'", cmp))
+	}
+}
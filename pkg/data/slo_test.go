@@ -0,0 +1,152 @@
+/*
+ * Copyright (C) 2019-Present Pivotal Software, Inc. All rights reserved.
+ *
+ * This program and the accompanying materials are made available under the terms
+ * of the Apache License, Version 2.0 (the "License”); you may not use this file
+ * except in compliance with the License. You may obtain a copy of the License at:
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software distributed
+ * under the License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR
+ * CONDITIONS OF ANY KIND, either express or implied. See the License for the
+ * specific language governing permissions and limitations under the License.
+ */
+
+package data
+
+import (
+	"testing"
+	"time"
+
+	"github.com/sclevine/spec"
+	"github.com/sclevine/spec/report"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSLO(t *testing.T) {
+	spec.Run(t, "SLO", testSLO, spec.Report(report.Terminal{}))
+}
+
+func testSLO(t *testing.T, describe spec.G, it spec.S) {
+	describe("ParseSLO()", func() {
+		var objectives []Objective
+		var err error
+
+		describe("a valid expression", func() {
+			it.Before(func() {
+				objectives, err = ParseSLO("p99 < 500ms and failures <= 0.1% and peak_replicas != 3")
+				require.NoError(t, err)
+			})
+
+			it("parses each clause", func() {
+				assert.Len(t, objectives, 3)
+			})
+
+			it("parses duration targets into nanoseconds", func() {
+				assert.Equal(t, Objective{Metric: "p99", Comparison: "<", Target: float64(500 * time.Millisecond), Expression: "p99 < 500ms"}, objectives[0])
+			})
+
+			it("parses percentage targets into fractions", func() {
+				assert.Equal(t, "<=", objectives[1].Comparison)
+				assert.InDelta(t, 0.001, objectives[1].Target, 0.0000001)
+			})
+
+			it("parses plain numbers", func() {
+				assert.Equal(t, 3.0, objectives[2].Target)
+			})
+		})
+
+		describe("invalid expressions", func() {
+			it("rejects unknown metrics", func() {
+				_, err = ParseSLO("p42 < 10ms")
+				assert.Error(t, err)
+			})
+
+			it("rejects failure reasons the model does not have", func() {
+				_, err = ParseSLO("failures.timout < 0.1%")
+				assert.Error(t, err)
+
+				_, err = ParseSLO("reports:failures.timout < 0.1%")
+				assert.Error(t, err)
+
+				_, err = ParseSLO("failures.timeout < 0.1% and reports:failures.no_active_replicas < 1%")
+				assert.NoError(t, err)
+			})
+
+			it("accepts any class, revision or service, which are only known once the run is summarized", func() {
+				_, err = ParseSLO("checkout:p99 < 1s and revision:v3:failure_rate < 1% and service:payments:p50 < 10ms")
+				assert.NoError(t, err)
+			})
+
+			it("rejects clauses without a comparison", func() {
+				_, err = ParseSLO("p99 500ms")
+				assert.Error(t, err)
+			})
+
+			it("rejects non-duration targets for duration metrics", func() {
+				_, err = ParseSLO("p99 < 500")
+				assert.Error(t, err)
+			})
+
+			it("rejects empty clauses", func() {
+				_, err = ParseSLO("p99 < 500ms and ")
+				assert.Error(t, err)
+			})
+		})
+	})
+
+	describe("EvaluateSLO()", func() {
+		var summary RunSummary
+		var result SLOResult
+		var err error
+
+		it.Before(func() {
+			summary = RunSummary{
+				LatencyP99:          400 * time.Millisecond,
+				FailureRate:         0.002,
+				FailureRateByReason: map[string]float64{"timeout": 0.002},
+			}
+		})
+
+		describe("when every objective is met", func() {
+			it.Before(func() {
+				result, err = EvaluateSLO("p99 < 500ms and failures < 1%", summary)
+				require.NoError(t, err)
+			})
+
+			it("passes", func() {
+				assert.True(t, result.Passed)
+			})
+
+			it("records the actual values", func() {
+				assert.Equal(t, float64(400*time.Millisecond), result.Objectives[0].Actual)
+				assert.Equal(t, 0.002, result.Objectives[1].Actual)
+			})
+		})
+
+		describe("when any objective is missed", func() {
+			it.Before(func() {
+				result, err = EvaluateSLO("p99 < 500ms and failures.timeout < 0.1%", summary)
+				require.NoError(t, err)
+			})
+
+			it("fails", func() {
+				assert.False(t, result.Passed)
+			})
+
+			it("marks which objectives were missed", func() {
+				assert.True(t, result.Objectives[0].Passed)
+				assert.False(t, result.Objectives[1].Passed)
+			})
+		})
+
+		describe("when an objective names a class the run did not have", func() {
+			it("returns an error rather than a zero", func() {
+				_, err = EvaluateSLO("checkout:p99 < 500ms", summary)
+				assert.EqualError(t, err, "unknown request class 'checkout', expected one of []")
+			})
+		})
+	})
+}
@@ -0,0 +1,190 @@
+/*
+ * Copyright (C) 2019-Present Pivotal Software, Inc. All rights reserved.
+ *
+ * This program and the accompanying materials are made available under the terms
+ * of the Apache License, Version 2.0 (the "License”); you may not use this file
+ * except in compliance with the License. You may obtain a copy of the License at:
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software distributed
+ * under the License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR
+ * CONDITIONS OF ANY KIND, either express or implied. See the License for the
+ * specific language governing permissions and limitations under the License.
+ */
+
+package data
+
+import (
+	"math"
+	"sort"
+)
+
+// Estimate is the mean of a sample with a confidence interval for the true mean.
+type Estimate struct {
+	N          int     `json:"n"`
+	Mean       float64 `json:"mean"`
+	StdDev     float64 `json:"std_dev"`
+	Lower      float64 `json:"lower"`
+	Upper      float64 `json:"upper"`
+	Confidence float64 `json:"confidence"`
+}
+
+// EstimateMean gives the sample mean with a Student's t confidence interval. With
+// fewer than two values the interval collapses onto the mean.
+func EstimateMean(values []float64, confidence float64) Estimate {
+	est := Estimate{N: len(values), Confidence: confidence}
+	if len(values) == 0 {
+		return est
+	}
+
+	var sum float64
+	for _, v := range values {
+		sum += v
+	}
+	est.Mean = sum / float64(len(values))
+	est.Lower = est.Mean
+	est.Upper = est.Mean
+
+	if len(values) < 2 {
+		return est
+	}
+
+	var squares float64
+	for _, v := range values {
+		squares += (v - est.Mean) * (v - est.Mean)
+	}
+	est.StdDev = math.Sqrt(squares / float64(len(values)-1))
+
+	halfWidth := StudentTQuantile(1-(1-confidence)/2, float64(len(values)-1)) * est.StdDev / math.Sqrt(float64(len(values)))
+	est.Lower = est.Mean - halfWidth
+	est.Upper = est.Mean + halfWidth
+
+	return est
+}
+
+// Quantile gives the p-th quantile (0 <= p <= 1) of values, interpolating linearly
+// between the closest ranks.
+func Quantile(values []float64, p float64) float64 {
+	if len(values) == 0 {
+		return math.NaN()
+	}
+
+	sorted := make([]float64, len(values))
+	copy(sorted, values)
+	sort.Float64s(sorted)
+
+	pos := p * float64(len(sorted)-1)
+	lower := int(math.Floor(pos))
+	upper := int(math.Ceil(pos))
+	if lower < 0 {
+		return sorted[0]
+	}
+	if upper >= len(sorted) {
+		return sorted[len(sorted)-1]
+	}
+
+	return sorted[lower] + (sorted[upper]-sorted[lower])*(pos-float64(lower))
+}
+
+// StudentTQuantile inverts the cumulative distribution function of Student's t
+// distribution with df degrees of freedom, by bisection.
+func StudentTQuantile(p float64, df float64) float64 {
+	if p == 0.5 {
+		return 0
+	}
+	if p < 0.5 {
+		return -StudentTQuantile(1-p, df)
+	}
+
+	lo, hi := 0.0, 1.0
+	for StudentTCDF(hi, df) < p {
+		hi *= 2
+	}
+	for i := 0; i < 100; i++ {
+		mid := (lo + hi) / 2
+		if StudentTCDF(mid, df) < p {
+			lo = mid
+		} else {
+			hi = mid
+		}
+	}
+
+	return (lo + hi) / 2
+}
+
+// StudentTCDF is the cumulative distribution function of Student's t distribution.
+func StudentTCDF(t float64, df float64) float64 {
+	tail := 0.5 * regularizedIncompleteBeta(df/2, 0.5, df/(df+t*t))
+	if t > 0 {
+		return 1 - tail
+	}
+	return tail
+}
+
+// regularizedIncompleteBeta computes I_x(a, b) using the continued fraction from
+// Numerical Recipes.
+func regularizedIncompleteBeta(a, b, x float64) float64 {
+	if x <= 0 {
+		return 0
+	}
+	if x >= 1 {
+		return 1
+	}
+
+	lga, _ := math.Lgamma(a)
+	lgb, _ := math.Lgamma(b)
+	lgab, _ := math.Lgamma(a + b)
+	front := math.Exp(lgab - lga - lgb + a*math.Log(x) + b*math.Log(1-x))
+
+	if x < (a+1)/(a+b+2) {
+		return front * betaContinuedFraction(a, b, x) / a
+	}
+	return 1 - front*betaContinuedFraction(b, a, 1-x)/b
+}
+
+func betaContinuedFraction(a, b, x float64) float64 {
+	const tiny = 1e-300
+	const epsilon = 1e-14
+
+	c := 1.0
+	d := 1 - (a+b)*x/(a+1)
+	if math.Abs(d) < tiny {
+		d = tiny
+	}
+	d = 1 / d
+	h := d
+
+	for m := 1.0; m <= 300; m++ {
+		numerator := m * (b - m) * x / ((a + 2*m - 1) * (a + 2*m))
+		d = 1 + numerator*d
+		if math.Abs(d) < tiny {
+			d = tiny
+		}
+		c = 1 + numerator/c
+		if math.Abs(c) < tiny {
+			c = tiny
+		}
+		d = 1 / d
+		h *= d * c
+
+		numerator = -(a + m) * (a + b + m) * x / ((a + 2*m) * (a + 2*m + 1))
+		d = 1 + numerator*d
+		if math.Abs(d) < tiny {
+			d = tiny
+		}
+		c = 1 + numerator/c
+		if math.Abs(c) < tiny {
+			c = tiny
+		}
+		d = 1 / d
+		delta := d * c
+		h *= delta
+
+		if math.Abs(delta-1) < epsilon {
+			break
+		}
+	}
+
+	return h
+}
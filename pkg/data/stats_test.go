@@ -0,0 +1,69 @@
+/*
+ * Copyright (C) 2019-Present Pivotal Software, Inc. All rights reserved.
+ *
+ * This program and the accompanying materials are made available under the terms
+ * of the Apache License, Version 2.0 (the "License”); you may not use this file
+ * except in compliance with the License. You may obtain a copy of the License at:
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software distributed
+ * under the License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR
+ * CONDITIONS OF ANY KIND, either express or implied. See the License for the
+ * specific language governing permissions and limitations under the License.
+ */
+
+package data
+
+import (
+	"testing"
+
+	"github.com/sclevine/spec"
+	"github.com/sclevine/spec/report"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestStats(t *testing.T) {
+	spec.Run(t, "Stats", testStats, spec.Report(report.Terminal{}))
+}
+
+func testStats(t *testing.T, describe spec.G, it spec.S) {
+	describe("StudentTQuantile()", func() {
+		it("matches published critical values", func() {
+			assert.InDelta(t, 12.706, StudentTQuantile(0.975, 1), 0.001)
+			assert.InDelta(t, 2.262, StudentTQuantile(0.975, 9), 0.001)
+			assert.InDelta(t, 2.539, StudentTQuantile(0.99, 19), 0.001)
+			assert.InDelta(t, 1.984, StudentTQuantile(0.975, 100), 0.001)
+		})
+
+		it("is symmetric about zero", func() {
+			assert.InDelta(t, -StudentTQuantile(0.975, 9), StudentTQuantile(0.025, 9), 0.000001)
+		})
+	})
+
+	describe("EstimateMean()", func() {
+		it("gives the mean and a t interval", func() {
+			est := EstimateMean([]float64{1, 2, 3, 4, 5, 6, 7, 8, 9, 10}, 0.95)
+			assert.Equal(t, 10, est.N)
+			assert.Equal(t, 5.5, est.Mean)
+			assert.InDelta(t, 3.0277, est.StdDev, 0.0001)
+			assert.InDelta(t, 3.3341, est.Lower, 0.0001)
+			assert.InDelta(t, 7.6659, est.Upper, 0.0001)
+		})
+
+		it("collapses the interval for a single value", func() {
+			est := EstimateMean([]float64{3}, 0.95)
+			assert.Equal(t, Estimate{N: 1, Mean: 3, Lower: 3, Upper: 3, Confidence: 0.95}, est)
+		})
+	})
+
+	describe("Quantile()", func() {
+		it("interpolates between ranks", func() {
+			values := []float64{4, 1, 3, 2}
+			assert.Equal(t, 1.0, Quantile(values, 0))
+			assert.Equal(t, 2.5, Quantile(values, 0.5))
+			assert.Equal(t, 4.0, Quantile(values, 1))
+			assert.InDelta(t, 1.3, Quantile(values, 0.1), 0.000001)
+		})
+	})
+}
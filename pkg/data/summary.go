@@ -0,0 +1,998 @@
+/*
+ * Copyright (C) 2019-Present Pivotal Software, Inc. All rights reserved.
+ *
+ * This program and the accompanying materials are made available under the terms
+ * of the Apache License, Version 2.0 (the "License”); you may not use this file
+ * except in compliance with the License. You may obtain a copy of the License at:
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software distributed
+ * under the License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR
+ * CONDITIONS OF ANY KIND, either express or implied. See the License for the
+ * specific language governing permissions and limitations under the License.
+ */
+
+package data
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/bvinc/go-sqlite-lite/sqlite3"
+)
+
+// RunSummary holds the headline numbers computed for a stored scenario run.
+type RunSummary struct {
+	ScenarioRunId int64 `json:"scenario_run_id"`
+
+	Requests            int64              `json:"requests"`
+	CompletedRequests   int64              `json:"completed_requests"`
+	FailedRequests      int64              `json:"failed_requests"`
+	FailureRate         float64            `json:"failure_rate"`
+	FailuresByReason    map[string]int64   `json:"failures_by_reason"`
+	FailureRateByReason map[string]float64 `json:"failure_rate_by_reason"`
+	Retries             int64              `json:"retries"`
+
+	LatencyP50  time.Duration `json:"latency_p50"`
+	LatencyP90  time.Duration `json:"latency_p90"`
+	LatencyP99  time.Duration `json:"latency_p99"`
+	LatencyP999 time.Duration `json:"latency_p999"`
+
+	ReplicaSeconds      float64       `json:"replica_seconds"`
+	PeakReplicas        int64         `json:"peak_replicas"`
+	MeanReplicas        float64       `json:"mean_replicas"`
+	OverProvisioned     time.Duration `json:"over_provisioned"`
+	UnderProvisioned    time.Duration `json:"under_provisioned"`
+	ScaleUpReactionTime time.Duration `json:"scale_up_reaction_time"`
+
+	// BoundViolations counts the autoscaler recommendations which were outside the min and max
+	// replicas, and so were clamped by the cluster.
+	BoundViolations int64 `json:"bound_violations"`
+
+	// Classes breaks the request metrics down by request class, when the run had a workload mix.
+	Classes map[string]RunSummary `json:"classes,omitempty"`
+
+	// Revisions breaks the request and replica metrics down by revision, when the run split
+	// traffic between revisions.
+	Revisions map[string]RunSummary `json:"revisions,omitempty"`
+
+	// Services breaks the request and replica metrics down by service, when requests passed
+	// through several services. The requests of a service are the calls made to it.
+	Services map[string]RunSummary `json:"services,omitempty"`
+}
+
+// Metric looks up a summary value by the name used in SLO expressions. Durations are
+// given in nanoseconds and rates as fractions. A metric of one request class is named
+// after the class, as in "reports:p99", a metric of one revision after the revision, as in
+// "revision:canary:p99", and a metric of one service after the service, as in
+// "service:checkout:p99". A class, revision or service which is not in the summary is an error.
+func (rs RunSummary) Metric(name string) (float64, error) {
+	if prefix, scope, metric, ok := splitScopedMetric(name); ok {
+		if err := validateScopedMetric(prefix, metric); err != nil {
+			return 0, err
+		}
+		scopes := rs.Revisions
+		if prefix == serviceMetricPrefix {
+			scopes = rs.Services
+		}
+		scoped, ok := scopes[scope]
+		if !ok {
+			return 0, fmt.Errorf("unknown %s '%s', expected one of %v", strings.TrimSuffix(prefix, ":"), scope, summaryKeys(scopes))
+		}
+		return scoped.Metric(metric)
+	}
+	if class, metric, ok := splitClassMetric(name); ok {
+		if err := validateClassMetric(metric); err != nil {
+			return 0, err
+		}
+		classSummary, ok := rs.Classes[class]
+		if !ok {
+			return 0, fmt.Errorf("unknown request class '%s', expected one of %v", class, summaryKeys(rs.Classes))
+		}
+		return classSummary.Metric(metric)
+	}
+
+	switch name {
+	case "requests":
+		return float64(rs.Requests), nil
+	case "completed":
+		return float64(rs.CompletedRequests), nil
+	case "failed":
+		return float64(rs.FailedRequests), nil
+	case "failures", "failure_rate":
+		return rs.FailureRate, nil
+	case "retries":
+		return float64(rs.Retries), nil
+	case "p50":
+		return float64(rs.LatencyP50), nil
+	case "p90":
+		return float64(rs.LatencyP90), nil
+	case "p99":
+		return float64(rs.LatencyP99), nil
+	case "p99.9", "p999":
+		return float64(rs.LatencyP999), nil
+	case "replica_seconds":
+		return rs.ReplicaSeconds, nil
+	case "peak_replicas", "max_replicas":
+		return float64(rs.PeakReplicas), nil
+	case "mean_replicas":
+		return rs.MeanReplicas, nil
+	case "over_provisioned":
+		return float64(rs.OverProvisioned), nil
+	case "under_provisioned":
+		return float64(rs.UnderProvisioned), nil
+	case "scale_up_reaction_time":
+		return float64(rs.ScaleUpReactionTime), nil
+	case "bound_violations":
+		return float64(rs.BoundViolations), nil
+	}
+
+	if reason, ok := failureReason(name); ok {
+		if rate, ok := rs.FailureRateByReason[reason]; ok || isFailureReason(reason) {
+			return rate, nil
+		}
+		return 0, fmt.Errorf("unknown failure reason '%s', expected one of %v", reason, failureReasons)
+	}
+
+	return 0, fmt.Errorf("unknown summary metric '%s'", name)
+}
+
+// ValidateMetric returns an error when name is not a metric which SLO expressions may use.
+// It needs no summary, so any class, revision or service is accepted.
+func ValidateMetric(name string) error {
+	if prefix, _, metric, ok := splitScopedMetric(name); ok {
+		return validateScopedMetric(prefix, metric)
+	}
+	if _, metric, ok := splitClassMetric(name); ok {
+		return validateClassMetric(metric)
+	}
+	_, err := RunSummary{}.Metric(name)
+	return err
+}
+
+func validateScopedMetric(prefix, metric string) error {
+	if !isScopedMetric(metric) {
+		return fmt.Errorf("unknown %s metric '%s'", strings.TrimSuffix(prefix, ":"), metric)
+	}
+	return nil
+}
+
+func validateClassMetric(metric string) error {
+	if !isClassMetric(metric) {
+		return fmt.Errorf("unknown request class metric '%s'", metric)
+	}
+	return nil
+}
+
+// summaryKeys are the sorted names of the classes, revisions or services of a summary.
+func summaryKeys(summaries map[string]RunSummary) []string {
+	keys := make([]string, 0, len(summaries))
+	for key := range summaries {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// IsDurationMetric reports whether a metric named in an SLO expression is a duration.
+func IsDurationMetric(name string) bool {
+	name = baseMetric(name)
+
+	switch name {
+	case "p50", "p90", "p99", "p99.9", "p999", "over_provisioned", "under_provisioned", "scale_up_reaction_time":
+		return true
+	}
+	return false
+}
+
+// reportedMetrics are the metrics of every summary, in the order they are usually reported.
+var reportedMetrics = []string{
+	"requests",
+	"completed",
+	"failed",
+	"failure_rate",
+	"retries",
+	"p50",
+	"p90",
+	"p99",
+	"p99.9",
+	"replica_seconds",
+	"peak_replicas",
+	"mean_replicas",
+	"over_provisioned",
+	"under_provisioned",
+	"scale_up_reaction_time",
+	"bound_violations",
+}
+
+// classMetrics are the metrics reported for each request class.
+var classMetrics = []string{
+	"requests",
+	"completed",
+	"failed",
+	"failure_rate",
+	"p50",
+	"p90",
+	"p99",
+	"p99.9",
+}
+
+// failureReasons are the reasons a request can fail for in the model, which give the metrics
+// "failures.<reason>".
+var failureReasons = []string{
+	"call_failed",
+	"no_active_replicas",
+	"oom_killed",
+	"replica_killed",
+	"retry_budget_exhausted",
+	"timeout",
+}
+
+func isFailureReason(reason string) bool {
+	for _, r := range failureReasons {
+		if r == reason {
+			return true
+		}
+	}
+	return false
+}
+
+// failureReason is the reason in a metric name such as "failures.timeout".
+func failureReason(name string) (string, bool) {
+	if len(name) > len("failures.") && strings.HasPrefix(name, "failures.") {
+		return name[len("failures."):], true
+	}
+	return "", false
+}
+
+// scopedMetrics are the metrics reported for each revision and each service.
+var scopedMetrics = append(append([]string{}, classMetrics...),
+	"replica_seconds",
+	"peak_replicas",
+	"mean_replicas",
+	"over_provisioned",
+	"under_provisioned",
+	"scale_up_reaction_time",
+	"bound_violations",
+)
+
+func isScopedMetric(name string) bool {
+	for _, m := range scopedMetrics {
+		if m == name {
+			return true
+		}
+	}
+	reason, ok := failureReason(name)
+	return ok && isFailureReason(reason)
+}
+
+// These prefixes start the name of a metric of one revision or one service.
+const (
+	revisionMetricPrefix = "revision:"
+	serviceMetricPrefix  = "service:"
+)
+
+// splitScopedMetric splits a metric name such as "revision:canary:p99" into its prefix, the
+// revision or service it is for and the metric.
+func splitScopedMetric(name string) (prefix, scope, metric string, ok bool) {
+	for _, prefix := range []string{revisionMetricPrefix, serviceMetricPrefix} {
+		if strings.HasPrefix(name, prefix) {
+			scope, metric, ok := splitClassMetric(name[len(prefix):])
+			return prefix, scope, metric, ok
+		}
+	}
+	return "", "", name, false
+}
+
+// baseMetric is the name of a metric without the class, revision or service it is for.
+func baseMetric(name string) string {
+	if _, _, metric, ok := splitScopedMetric(name); ok {
+		return metric
+	}
+	if _, metric, ok := splitClassMetric(name); ok {
+		return metric
+	}
+	return name
+}
+
+func isClassMetric(name string) bool {
+	for _, m := range classMetrics {
+		if m == name {
+			return true
+		}
+	}
+	reason, ok := failureReason(name)
+	return ok && isFailureReason(reason)
+}
+
+// splitClassMetric splits a metric name such as "reports:p99" into its class and metric.
+func splitClassMetric(name string) (class, metric string, ok bool) {
+	idx := strings.Index(name, ":")
+	if idx < 0 {
+		return "", name, false
+	}
+	return name[:idx], name[idx+1:], true
+}
+
+// MetricNames lists the metrics of a summary in the order they are usually reported, followed
+// by the failure rate for each reason that requests failed, the metrics of each request class,
+// the metrics of each revision and then the metrics of each service.
+func (rs RunSummary) MetricNames() []string {
+	names := append([]string{}, reportedMetrics...)
+	names = append(names, failureReasonMetrics(rs.FailuresByReason)...)
+
+	for _, class := range summaryKeys(rs.Classes) {
+		for _, metric := range classMetrics {
+			names = append(names, class+":"+metric)
+		}
+		for _, metric := range failureReasonMetrics(rs.Classes[class].FailuresByReason) {
+			names = append(names, class+":"+metric)
+		}
+	}
+
+	names = append(names, scopedMetricNames(revisionMetricPrefix, rs.Revisions)...)
+	names = append(names, scopedMetricNames(serviceMetricPrefix, rs.Services)...)
+
+	return names
+}
+
+// scopedMetricNames lists the metrics of each revision or service, named with a prefix.
+func scopedMetricNames(prefix string, summaries map[string]RunSummary) []string {
+	names := make([]string, 0)
+	for _, scope := range summaryKeys(summaries) {
+		for _, metric := range scopedMetrics {
+			names = append(names, prefix+scope+":"+metric)
+		}
+		for _, metric := range failureReasonMetrics(summaries[scope].FailuresByReason) {
+			names = append(names, prefix+scope+":"+metric)
+		}
+	}
+	return names
+}
+
+func failureReasonMetrics(failuresByReason map[string]int64) []string {
+	reasons := make([]string, 0, len(failuresByReason))
+	for reason := range failuresByReason {
+		reasons = append(reasons, "failures."+reason)
+	}
+	sort.Strings(reasons)
+	return reasons
+}
+
+// FormatMetric gives a metric value in a form for people to read: durations as durations,
+// rates as percentages and anything else as a number.
+func FormatMetric(name string, value float64) string {
+	switch {
+	case IsDurationMetric(name):
+		return time.Duration(value).Round(time.Microsecond).String()
+	case isRateMetric(name):
+		return fmt.Sprintf("%.2f%%", value*100)
+	default:
+		return strconv.FormatFloat(value, 'g', 6, 64)
+	}
+}
+
+func isRateMetric(name string) bool {
+	name = baseMetric(name)
+	return name == "failures" || name == "failure_rate" || strings.HasPrefix(name, "failures.")
+}
+
+// The request queries below are completed with fmt.Sprintf, by a condition on the moved request
+// which picks out the requests of a class, revision or service.
+
+// language=sql
+var requestCountQuery = `
+select count(distinct moved)
+from completed_movements
+where kind in ('arrive_at_routing_stock', 'call_service')
+  and scenario_run_id = ?
+  and occurs_at between ? and ?
+  and %s
+;
+`
+
+// language=sql
+var retryCountQuery = `
+select count(1)
+from completed_movements
+where kind = 'retry_request'
+  and scenario_run_id = ?
+  and occurs_at between ? and ?
+  and %s
+;
+`
+
+// language=sql
+var completedResponseTimesQuery = `
+select min(occurs_at) as arrived_at
+     , max(occurs_at) - min(occurs_at) as response_time
+from completed_movements
+where moved in (select id from entities where entities.kind = 'Request')
+  and scenario_run_id = ?
+  and %s
+group by moved
+having sum(case when to_stock in (select id from stocks where name like 'RequestsComplete%%') then 1 else 0 end) > 0
+order by response_time
+;
+`
+
+// language=sql
+var failuresByReasonQuery = `
+select
+    case
+        when cm.kind != 'request_failed' then cm.kind
+        when fs.name like 'RequestsRouting%%' then 'no_active_replicas'
+        when fs.name like 'RequestsProcessing%%' then 'timeout'
+        else fs.name
+    end as reason
+  , count(1)
+from completed_movements cm
+    join stocks fs on fs.id = cm.from_stock
+    join stocks ts on ts.id = cm.to_stock
+where ts.name like 'RequestsFailed%%'
+  and cm.scenario_run_id = ?
+  and cm.occurs_at between ? and ?
+  and %s
+group by reason
+order by reason
+;
+`
+
+// language=sql
+var stockChangesQuery = `
+with counted as (select id from stocks where name = ? or name like ? escape '\')
+select
+    cm.occurs_at
+  , (cm.to_stock in (select id from counted)) - (cm.from_stock in (select id from counted)) as change
+from completed_movements cm
+where (cm.from_stock in (select id from counted) or cm.to_stock in (select id from counted))
+  and cm.from_stock != cm.to_stock
+  and cm.scenario_run_id = ?
+order by cm.occurs_at, cm.id
+;
+`
+
+// language=sql
+var boundViolationCountQuery = `
+select count(1)
+from completed_movements
+where kind in ('clamp_to_min_scale', 'clamp_to_max_scale')
+  and to_stock in (select id from stocks where name = ? or name like ? escape '\')
+  and scenario_run_id = ?
+  and occurs_at between ? and ?
+;
+`
+
+// language=sql
+var revisionRoutingStocksQuery = `
+select distinct ts.name
+from completed_movements cm
+    join stocks ts on ts.id = cm.to_stock
+where cm.kind = 'split_traffic'
+  and cm.scenario_run_id = ?
+;
+`
+
+// language=sql
+var serviceRoutingStocksQuery = `
+select distinct ts.name
+from completed_movements cm
+    join stocks ts on ts.id = cm.to_stock
+where cm.kind in ('arrive_at_routing_stock', 'call_service')
+  and ts.name like 'RequestsRouting [%]'
+  and cm.scenario_run_id = ?
+;
+`
+
+// language=sql
+var requestClassesQuery = `
+select distinct substr(e.name, instr(e.name, ' [') + 2, length(e.name) - instr(e.name, ' [') - 2)
+from completed_movements cm
+    join entities e on e.id = cm.moved
+where cm.kind = 'arrive_at_routing_stock'
+  and e.name like '% [%]'
+  and cm.scenario_run_id = ?
+;
+`
+
+// language=sql
+var simulatedDurationQuery = `
+select simulated_duration
+from scenario_runs
+where id = ?
+;
+`
+
+// StockStep is the count of a stock from OccursAt until the next step.
+type StockStep struct {
+	OccursAt int64
+	Count    int64
+}
+
+// Summarize computes the RunSummary of a stored scenario run.
+func Summarize(conn *sqlite3.Conn, scenarioRunId int64) (RunSummary, error) {
+	return SummarizeWindow(conn, scenarioRunId, 0, 0)
+}
+
+// SummarizeWindow computes the RunSummary of part of a stored scenario run, from simulated
+// time from until to. When to is 0 the window lasts until the end of the run. Requests are
+// counted by when they arrive and failures by when they fail.
+func SummarizeWindow(conn *sqlite3.Conn, scenarioRunId int64, from, to time.Duration) (RunSummary, error) {
+	summary := RunSummary{
+		ScenarioRunId:       scenarioRunId,
+		FailuresByReason:    make(map[string]int64),
+		FailureRateByReason: make(map[string]float64),
+	}
+
+	duration, err := simulatedDuration(conn, scenarioRunId)
+	if err != nil {
+		return summary, err
+	}
+	if to <= 0 || int64(to) > duration {
+		to = time.Duration(duration)
+	}
+	if from > to {
+		return summary, fmt.Errorf("window starts at %s, after it ends at %s", from, to)
+	}
+
+	err = summarizeRequests(conn, &summary, arrivingRequests(scenarioRunId), from, to)
+	if err != nil {
+		return summary, err
+	}
+
+	classes, err := requestClasses(conn, scenarioRunId)
+	if err != nil {
+		return summary, err
+	}
+	for _, class := range classes {
+		classSummary := RunSummary{
+			ScenarioRunId:       scenarioRunId,
+			FailuresByReason:    make(map[string]int64),
+			FailureRateByReason: make(map[string]float64),
+		}
+		err = summarizeRequests(conn, &classSummary, classRequests(class), from, to)
+		if err != nil {
+			return summary, err
+		}
+
+		if summary.Classes == nil {
+			summary.Classes = make(map[string]RunSummary)
+		}
+		summary.Classes[class] = classSummary
+	}
+
+	active, err := StockSteps(conn, scenarioRunId, "ReplicasActive")
+	if err != nil {
+		return summary, err
+	}
+	desired, err := StockSteps(conn, scenarioRunId, "ReplicasDesired")
+	if err != nil {
+		return summary, err
+	}
+
+	summarizeReplicas(&summary, active, desired, int64(from), int64(to))
+
+	summary.BoundViolations, err = boundViolations(conn, scenarioRunId, "BoundViolations", from, to)
+	if err != nil {
+		return summary, err
+	}
+
+	revisions, err := splitRevisions(conn, scenarioRunId)
+	if err != nil {
+		return summary, err
+	}
+	for _, revision := range revisions {
+		revisionSummary, err := summarizeCluster(conn, scenarioRunId, revision, revisionRequests(scenarioRunId, revision), from, to)
+		if err != nil {
+			return summary, err
+		}
+
+		if summary.Revisions == nil {
+			summary.Revisions = make(map[string]RunSummary)
+		}
+		summary.Revisions[revision] = revisionSummary
+	}
+
+	services, err := calledServices(conn, scenarioRunId)
+	if err != nil {
+		return summary, err
+	}
+	for _, service := range services {
+		serviceSummary, err := summarizeCluster(conn, scenarioRunId, service, serviceRequests(scenarioRunId, service), from, to)
+		if err != nil {
+			return summary, err
+		}
+
+		if summary.Services == nil {
+			summary.Services = make(map[string]RunSummary)
+		}
+		summary.Services[service] = serviceSummary
+	}
+
+	return summary, nil
+}
+
+// summarizeCluster summarizes the requests and replicas of one revision or service.
+func summarizeCluster(conn *sqlite3.Conn, scenarioRunId int64, qualifier string, requests requestSet, from, to time.Duration) (RunSummary, error) {
+	summary := RunSummary{
+		ScenarioRunId:       scenarioRunId,
+		FailuresByReason:    make(map[string]int64),
+		FailureRateByReason: make(map[string]float64),
+	}
+	err := summarizeRequests(conn, &summary, requests, from, to)
+	if err != nil {
+		return summary, err
+	}
+
+	active, err := StockSteps(conn, scenarioRunId, revisionStock("ReplicasActive", qualifier))
+	if err != nil {
+		return summary, err
+	}
+	desired, err := StockSteps(conn, scenarioRunId, revisionStock("ReplicasDesired", qualifier))
+	if err != nil {
+		return summary, err
+	}
+	summarizeReplicas(&summary, active, desired, int64(from), int64(to))
+
+	summary.BoundViolations, err = boundViolations(conn, scenarioRunId, revisionStock("BoundViolations", qualifier), from, to)
+	return summary, err
+}
+
+// requestSet is a condition on the requests moved, with its arguments, which picks out some of
+// the requests of a run.
+type requestSet struct {
+	condition string
+	args      []interface{}
+}
+
+// arrivingRequests is every request which arrived from outside, as opposed to the calls made
+// by services to each other.
+func arrivingRequests(scenarioRunId int64) requestSet {
+	return requestSet{
+		condition: `moved in (select moved from completed_movements where kind = 'arrive_at_routing_stock' and scenario_run_id = ?)`,
+		args:      []interface{}{scenarioRunId},
+	}
+}
+
+// requestsNamed is the requests whose names match a pattern.
+func requestsNamed(pattern string) requestSet {
+	return requestSet{
+		condition: `moved in (select id from entities where name like ? escape '\')`,
+		args:      []interface{}{pattern},
+	}
+}
+
+// classRequests is the requests of a class, whose names are such as "request-12 [reports]".
+func classRequests(class string) requestSet {
+	return requestsNamed("% [" + escapeLike(class) + "]")
+}
+
+// revisionRequests is the requests sent to a revision. A request retried on another revision
+// is one of the requests of both.
+func revisionRequests(scenarioRunId int64, revision string) requestSet {
+	return requestSet{
+		condition: `moved in (select moved from completed_movements where kind = 'split_traffic' and scenario_run_id = ? and to_stock in (select id from stocks where name = ?))`,
+		args:      []interface{}{scenarioRunId, revisionStock("RequestsRouting", revision)},
+	}
+}
+
+// serviceRequests is the requests sent to a service: the requests arriving from outside, for
+// the first service, and the calls made to it by other services.
+func serviceRequests(scenarioRunId int64, service string) requestSet {
+	return requestSet{
+		condition: `moved in (select moved from completed_movements where kind in ('arrive_at_routing_stock', 'call_service') and scenario_run_id = ? and to_stock in (select id from stocks where name = ?))`,
+		args:      []interface{}{scenarioRunId, revisionStock("RequestsRouting", service)},
+	}
+}
+
+// revisionStock is the name of a stock of a revision or service, such as
+// "ReplicasActive [canary]".
+func revisionStock(stockName, revision string) string {
+	return stockName + " [" + revision + "]"
+}
+
+func escapeLike(s string) string {
+	return strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`).Replace(s)
+}
+
+// summarizeRequests fills in the request metrics of a summary, for a set of requests.
+func summarizeRequests(conn *sqlite3.Conn, summary *RunSummary, requests requestSet, from, to time.Duration) error {
+	window := append([]interface{}{summary.ScenarioRunId, int64(from), int64(to)}, requests.args...)
+
+	err := queryRows(conn, fmt.Sprintf(requestCountQuery, requests.condition), window, func(stmt *sqlite3.Stmt) error {
+		return stmt.Scan(&summary.Requests)
+	})
+	if err != nil {
+		return err
+	}
+
+	err = queryRows(conn, fmt.Sprintf(retryCountQuery, requests.condition), window, func(stmt *sqlite3.Stmt) error {
+		return stmt.Scan(&summary.Retries)
+	})
+	if err != nil {
+		return err
+	}
+
+	responseTimes, err := completedResponseTimes(conn, summary.ScenarioRunId, requests)
+	if err != nil {
+		return err
+	}
+	latencies := make([]time.Duration, 0, len(responseTimes))
+	for _, rt := range responseTimes {
+		if rt.ArrivedAt >= int64(from) && rt.ArrivedAt <= int64(to) {
+			latencies = append(latencies, rt.ResponseTime)
+		}
+	}
+	summary.CompletedRequests = int64(len(latencies))
+	summary.LatencyP50 = Percentile(latencies, 50)
+	summary.LatencyP90 = Percentile(latencies, 90)
+	summary.LatencyP99 = Percentile(latencies, 99)
+	summary.LatencyP999 = Percentile(latencies, 99.9)
+
+	err = queryRows(conn, fmt.Sprintf(failuresByReasonQuery, requests.condition), window, func(stmt *sqlite3.Stmt) error {
+		var reason string
+		var count int64
+		err := stmt.Scan(&reason, &count)
+		summary.FailuresByReason[reason] = count
+		summary.FailedRequests += count
+		return err
+	})
+	if err != nil {
+		return err
+	}
+	if summary.Requests > 0 {
+		summary.FailureRate = float64(summary.FailedRequests) / float64(summary.Requests)
+		for reason, count := range summary.FailuresByReason {
+			summary.FailureRateByReason[reason] = float64(count) / float64(summary.Requests)
+		}
+	}
+
+	return nil
+}
+
+// requestClasses gives the names of the request classes in a run, if it had a workload mix.
+func requestClasses(conn *sqlite3.Conn, scenarioRunId int64) ([]string, error) {
+	classes := make([]string, 0)
+	err := queryRows(conn, requestClassesQuery, []interface{}{scenarioRunId}, func(stmt *sqlite3.Stmt) error {
+		var class string
+		err := stmt.Scan(&class)
+		classes = append(classes, class)
+		return err
+	})
+	sort.Strings(classes)
+
+	return classes, err
+}
+
+// splitRevisions gives the names of the revisions which were sent requests in a run, if it
+// split traffic between revisions.
+func splitRevisions(conn *sqlite3.Conn, scenarioRunId int64) ([]string, error) {
+	return routedQualifiers(conn, revisionRoutingStocksQuery, scenarioRunId)
+}
+
+// calledServices gives the names of the services which were sent requests in a run, if
+// requests passed through several services.
+func calledServices(conn *sqlite3.Conn, scenarioRunId int64) ([]string, error) {
+	return routedQualifiers(conn, serviceRoutingStocksQuery, scenarioRunId)
+}
+
+// routedQualifiers gives the revisions or services named by the routing stocks a query finds,
+// such as "RequestsRouting [canary]".
+func routedQualifiers(conn *sqlite3.Conn, query string, scenarioRunId int64) ([]string, error) {
+	qualifiers := make([]string, 0)
+	err := queryRows(conn, query, []interface{}{scenarioRunId}, func(stmt *sqlite3.Stmt) error {
+		var stockName string
+		err := stmt.Scan(&stockName)
+		if open := strings.Index(stockName, " ["); open >= 0 && strings.HasSuffix(stockName, "]") {
+			qualifiers = append(qualifiers, stockName[open+2:len(stockName)-1])
+		}
+		return err
+	})
+	sort.Strings(qualifiers)
+
+	return qualifiers, err
+}
+
+// CompletedResponseTime is how long a request which completed successfully took.
+type CompletedResponseTime struct {
+	ArrivedAt    int64
+	ResponseTime time.Duration
+}
+
+// CompletedResponseTimes gives the response times of successful requests, fastest first.
+func CompletedResponseTimes(conn *sqlite3.Conn, scenarioRunId int64) ([]CompletedResponseTime, error) {
+	return completedResponseTimes(conn, scenarioRunId, arrivingRequests(scenarioRunId))
+}
+
+func completedResponseTimes(conn *sqlite3.Conn, scenarioRunId int64, requests requestSet) ([]CompletedResponseTime, error) {
+	responseTimes := make([]CompletedResponseTime, 0)
+	args := append([]interface{}{scenarioRunId}, requests.args...)
+	err := queryRows(conn, fmt.Sprintf(completedResponseTimesQuery, requests.condition), args, func(stmt *sqlite3.Stmt) error {
+		var arrivedAt, responseTime int64
+		err := stmt.Scan(&arrivedAt, &responseTime)
+		responseTimes = append(responseTimes, CompletedResponseTime{ArrivedAt: arrivedAt, ResponseTime: time.Duration(responseTime)})
+		return err
+	})
+
+	return responseTimes, err
+}
+
+// StockSteps gives the count of a named stock over a scenario run as a step function.
+// The count starts at zero, before the first step. When traffic was split between revisions, or
+// requests passed through several services, the count is of the stock of every revision or
+// service together.
+func StockSteps(conn *sqlite3.Conn, scenarioRunId int64, stockName string) ([]StockStep, error) {
+	steps := make([]StockStep, 0)
+	var count int64
+
+	err := queryRows(conn, stockChangesQuery, []interface{}{stockName, revisionStock(escapeLike(stockName), "%"), scenarioRunId}, func(stmt *sqlite3.Stmt) error {
+		var occursAt, change int64
+		err := stmt.Scan(&occursAt, &change)
+		count += change
+
+		if len(steps) > 0 && steps[len(steps)-1].OccursAt == occursAt {
+			steps[len(steps)-1].Count = count
+		} else {
+			steps = append(steps, StockStep{OccursAt: occursAt, Count: count})
+		}
+		return err
+	})
+
+	return steps, err
+}
+
+// boundViolations counts the autoscaler recommendations clamped between from and to, which were
+// moved into the given stock, or into the stocks of that name of every revision or service.
+func boundViolations(conn *sqlite3.Conn, scenarioRunId int64, stockName string, from, to time.Duration) (int64, error) {
+	var count int64
+	args := []interface{}{stockName, revisionStock(escapeLike(stockName), "%"), scenarioRunId, int64(from), int64(to)}
+	err := queryRows(conn, boundViolationCountQuery, args, func(stmt *sqlite3.Stmt) error {
+		return stmt.Scan(&count)
+	})
+
+	return count, err
+}
+
+func summarizeReplicas(summary *RunSummary, active, desired []StockStep, from, to int64) {
+	var activeCount, desiredCount int64
+	var replicaNanos, overNanos, underNanos float64
+	var reactionTotal time.Duration
+	var reactions int64
+
+	// desired levels that active replicas have yet to reach, with the time they were desired
+	pending := make([]StockStep, 0)
+
+	var last int64
+	advance := func(next int64) {
+		start, end := last, next
+		if start < from {
+			start = from
+		}
+		if end > to {
+			end = to
+		}
+
+		if end > start {
+			elapsed := float64(end - start)
+			replicaNanos += elapsed * float64(activeCount)
+			if activeCount > desiredCount {
+				overNanos += elapsed
+			} else if activeCount < desiredCount {
+				underNanos += elapsed
+			}
+			if activeCount > summary.PeakReplicas {
+				summary.PeakReplicas = activeCount
+			}
+		}
+		last = next
+	}
+
+	ai, di := 0, 0
+	for ai < len(active) || di < len(desired) {
+		next := to + 1
+		if ai < len(active) && active[ai].OccursAt < next {
+			next = active[ai].OccursAt
+		}
+		if di < len(desired) && desired[di].OccursAt < next {
+			next = desired[di].OccursAt
+		}
+		if next > to {
+			break
+		}
+
+		advance(next)
+
+		for ; di < len(desired) && desired[di].OccursAt == next; di++ {
+			if desired[di].Count > desiredCount {
+				pending = append(pending, desired[di])
+			}
+			desiredCount = desired[di].Count
+
+			stillPending := pending[:0]
+			for _, p := range pending {
+				if p.Count <= desiredCount {
+					stillPending = append(stillPending, p)
+				}
+			}
+			pending = stillPending
+		}
+
+		for ; ai < len(active) && active[ai].OccursAt == next; ai++ {
+			activeCount = active[ai].Count
+
+			stillPending := pending[:0]
+			for _, p := range pending {
+				if p.Count <= activeCount {
+					if next >= from {
+						reactionTotal += time.Duration(next - p.OccursAt)
+						reactions++
+					}
+				} else {
+					stillPending = append(stillPending, p)
+				}
+			}
+			pending = stillPending
+		}
+	}
+	advance(to)
+
+	summary.ReplicaSeconds = replicaNanos / float64(time.Second)
+	if to > from {
+		summary.MeanReplicas = replicaNanos / float64(to-from)
+	}
+	summary.OverProvisioned = time.Duration(overNanos)
+	summary.UnderProvisioned = time.Duration(underNanos)
+	if reactions > 0 {
+		summary.ScaleUpReactionTime = reactionTotal / time.Duration(reactions)
+	}
+}
+
+// Percentile returns the nearest-rank percentile of a set of durations.
+func Percentile(durations []time.Duration, percentile float64) time.Duration {
+	if len(durations) == 0 {
+		return 0
+	}
+
+	sorted := make([]time.Duration, len(durations))
+	copy(sorted, durations)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i] < sorted[j] })
+
+	rank := int(math.Ceil(percentile / 100 * float64(len(sorted))))
+	if rank < 1 {
+		rank = 1
+	}
+	if rank > len(sorted) {
+		rank = len(sorted)
+	}
+
+	return sorted[rank-1]
+}
+
+func queryRows(conn *sqlite3.Conn, query string, args []interface{}, scan func(stmt *sqlite3.Stmt) error) error {
+	stmt, err := conn.Prepare(query, args...)
+	if err != nil {
+		return fmt.Errorf("could not prepare query: %s", err.Error())
+	}
+	defer stmt.Close()
+
+	for {
+		hasRow, err := stmt.Step()
+		if err != nil {
+			return fmt.Errorf("could not step: %s", err.Error())
+		}
+
+		if !hasRow {
+			return nil
+		}
+
+		err = scan(stmt)
+		if err != nil {
+			return fmt.Errorf("could not scan: %s", err.Error())
+		}
+	}
+}
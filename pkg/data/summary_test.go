@@ -0,0 +1,438 @@
+/*
+ * Copyright (C) 2019-Present Pivotal Software, Inc. All rights reserved.
+ *
+ * This program and the accompanying materials are made available under the terms
+ * of the Apache License, Version 2.0 (the "License”); you may not use this file
+ * except in compliance with the License. You may obtain a copy of the License at:
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software distributed
+ * under the License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR
+ * CONDITIONS OF ANY KIND, either express or implied. See the License for the
+ * specific language governing permissions and limitations under the License.
+ */
+
+package data
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/bvinc/go-sqlite-lite/sqlite3"
+	"github.com/sclevine/spec"
+	"github.com/sclevine/spec/report"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"skenario/pkg/model"
+	"skenario/pkg/simulator"
+)
+
+func TestSummary(t *testing.T) {
+	spec.Run(t, "Summary", testSummary, spec.Report(report.Terminal{}))
+}
+
+func testSummary(t *testing.T, describe spec.G, it spec.S) {
+	var conn *sqlite3.Conn
+	var subject RunSummary
+	var err error
+
+	it.Before(func() {
+		var dir string
+		dir, err = os.Getwd()
+		require.NoError(t, err)
+		dbPath := filepath.Join(dir, "skenario_test.db")
+
+		os.Remove(dbPath)
+
+		conn, err = sqlite3.Open(dbPath)
+		require.NoError(t, err)
+
+		store, err := NewStreamingRunStore(conn, model.ClusterConfig{}, model.KnativeAutoscalerConfig{}, "test_origin", "test_pattern", 100*time.Second)
+		require.NoError(t, err)
+
+		at := func(d time.Duration) time.Time { return time.Unix(0, 0).Add(d) }
+		completed := make([]simulator.CompletedMovement, 0)
+		move := func(kind simulator.MovementKind, occursAt time.Duration, from, to simulator.ThroughStock, entity simulator.Entity) {
+			completed = append(completed, simulator.CompletedMovement{
+				Movement: simulator.NewMovement(kind, at(occursAt), from, to),
+				Moved:    entity,
+			})
+		}
+
+		requestsSource := simulator.NewThroughStock("RequestsSource", "Request")
+		requestsRouting := simulator.NewThroughStock("RequestsRouting", "Request")
+		requestsProcessing := simulator.NewThroughStock("RequestsProcessing [1]", "Request")
+		requestsComplete := simulator.NewThroughStock("RequestsComplete [1]", "Request")
+		requestsFailed := simulator.NewThroughStock("RequestsFailed", "Request")
+
+		req1 := simulator.NewEntity("request-1", "Request")
+		move("arrive_at_routing_stock", 1*time.Second, requestsSource, requestsRouting, req1)
+		move("send_to_replica", 1*time.Second, requestsRouting, requestsProcessing, req1)
+		move("complete_request", 1100*time.Millisecond, requestsProcessing, requestsComplete, req1)
+
+		req2 := simulator.NewEntity("request-2", "Request")
+		move("arrive_at_routing_stock", 2*time.Second, requestsSource, requestsRouting, req2)
+		move("request_failed", 2*time.Second, requestsRouting, requestsFailed, req2)
+
+		req3 := simulator.NewEntity("request-3", "Request")
+		move("arrive_at_routing_stock", 3*time.Second, requestsSource, requestsRouting, req3)
+		move("send_to_replica", 3*time.Second, requestsRouting, requestsProcessing, req3)
+		move("complete_request", 3500*time.Millisecond, requestsProcessing, requestsComplete, req3)
+
+		req4 := simulator.NewEntity("request-4", "Request")
+		move("arrive_at_routing_stock", 4*time.Second, requestsSource, requestsRouting, req4)
+		move("send_to_replica", 4*time.Second, requestsRouting, requestsProcessing, req4)
+		move("request_failed", 9*time.Second, requestsProcessing, requestsFailed, req4)
+
+		desiredSource := simulator.NewThroughStock("DesiredSource", "Desired")
+		desiredSink := simulator.NewThroughStock("DesiredSink", "Desired")
+		replicasDesired := simulator.NewThroughStock("ReplicasDesired", "Desired")
+		replicasLaunching := simulator.NewThroughStock("ReplicasLaunching", "Replica")
+		replicasActive := simulator.NewThroughStock("ReplicasActive", "Replica")
+
+		desired1 := simulator.NewEntity("desired-1", "Desired")
+		desired2 := simulator.NewEntity("desired-2", "Desired")
+		move("increase_desired", 0, desiredSource, replicasDesired, desired1)
+		move("increase_desired", 10*time.Second, desiredSource, replicasDesired, desired2)
+		move("reduce_desired", 80*time.Second, replicasDesired, desiredSink, desired2)
+
+		replica1 := simulator.NewEntity("replica-1", "Replica")
+		replica2 := simulator.NewEntity("replica-2", "Replica")
+		move("finish_launching", 5*time.Second, replicasLaunching, replicasActive, replica1)
+		move("finish_launching", 30*time.Second, replicasLaunching, replicasActive, replica2)
+
+		err = store.Flush(completed, nil)
+		require.NoError(t, err)
+
+		subject, err = Summarize(conn, store.ScenarioRunId())
+		require.NoError(t, err)
+	})
+
+	describe("requests", func() {
+		it("counts arrivals", func() {
+			assert.Equal(t, int64(4), subject.Requests)
+		})
+
+		it("counts completed requests", func() {
+			assert.Equal(t, int64(2), subject.CompletedRequests)
+		})
+
+		it("computes latency percentiles over completed requests", func() {
+			assert.Equal(t, 100*time.Millisecond, subject.LatencyP50)
+			assert.Equal(t, 500*time.Millisecond, subject.LatencyP90)
+			assert.Equal(t, 500*time.Millisecond, subject.LatencyP99)
+			assert.Equal(t, 500*time.Millisecond, subject.LatencyP999)
+		})
+
+		it("computes the failure rate", func() {
+			assert.Equal(t, int64(2), subject.FailedRequests)
+			assert.Equal(t, 0.5, subject.FailureRate)
+		})
+
+		it("splits failures by reason", func() {
+			assert.Equal(t, map[string]int64{"no_active_replicas": 1, "timeout": 1}, subject.FailuresByReason)
+			assert.Equal(t, 0.25, subject.FailureRateByReason["timeout"])
+		})
+	})
+
+	describe("replicas", func() {
+		it("computes replica-seconds", func() {
+			assert.InDelta(t, 165.0, subject.ReplicaSeconds, 0.0001)
+		})
+
+		it("finds the peak replica count", func() {
+			assert.Equal(t, int64(2), subject.PeakReplicas)
+		})
+
+		it("computes the time-weighted mean replica count", func() {
+			assert.InDelta(t, 1.65, subject.MeanReplicas, 0.0001)
+		})
+
+		it("computes the time spent with fewer active replicas than desired", func() {
+			assert.Equal(t, 25*time.Second, subject.UnderProvisioned)
+		})
+
+		it("computes the time spent with more active replicas than desired", func() {
+			assert.Equal(t, 20*time.Second, subject.OverProvisioned)
+		})
+
+		it("computes the mean time for active replicas to reach a desired increase", func() {
+			assert.Equal(t, 12500*time.Millisecond, subject.ScaleUpReactionTime)
+		})
+	})
+
+	describe("a window of the run", func() {
+		var window RunSummary
+
+		it.Before(func() {
+			window, err = SummarizeWindow(conn, subject.ScenarioRunId, 2*time.Second, 20*time.Second)
+			require.NoError(t, err)
+		})
+
+		it("only counts requests arriving in the window", func() {
+			assert.Equal(t, int64(3), window.Requests)
+			assert.Equal(t, int64(1), window.CompletedRequests)
+			assert.Equal(t, 500*time.Millisecond, window.LatencyP50)
+		})
+
+		it("only counts failures in the window", func() {
+			assert.Equal(t, int64(2), window.FailedRequests)
+		})
+
+		it("only integrates replicas over the window", func() {
+			assert.InDelta(t, 15.0, window.ReplicaSeconds, 0.0001)
+			assert.Equal(t, int64(1), window.PeakReplicas)
+			assert.Equal(t, 13*time.Second, window.UnderProvisioned)
+			assert.Equal(t, 5*time.Second, window.ScaleUpReactionTime)
+		})
+
+		it("rejects a window which ends before it starts", func() {
+			_, err = SummarizeWindow(conn, subject.ScenarioRunId, 30*time.Second, 20*time.Second)
+			assert.Error(t, err)
+		})
+	})
+
+	describe("a run with request classes", func() {
+		var classes RunSummary
+
+		it.Before(func() {
+			store, err := NewStreamingRunStore(conn, model.ClusterConfig{}, model.KnativeAutoscalerConfig{}, "test_origin", "test_pattern", 100*time.Second)
+			require.NoError(t, err)
+
+			requestsSource := simulator.NewThroughStock("RequestsSource", "Request")
+			requestsRouting := simulator.NewThroughStock("RequestsRouting", "Request")
+			requestsRetrying := simulator.NewThroughStock("RequestsRetrying", "Request")
+			requestsComplete := simulator.NewThroughStock("RequestsComplete [1]", "Request")
+			requestsFailed := simulator.NewThroughStock("RequestsFailed", "Request")
+
+			completed := make([]simulator.CompletedMovement, 0)
+			move := func(kind simulator.MovementKind, occursAt time.Duration, from, to simulator.ThroughStock, name simulator.EntityName) {
+				completed = append(completed, simulator.CompletedMovement{
+					Movement: simulator.NewMovement(kind, time.Unix(0, 0).Add(occursAt), from, to),
+					Moved:    simulator.NewEntity(name, "Request"),
+				})
+			}
+
+			move("arrive_at_routing_stock", 1*time.Second, requestsSource, requestsRouting, "request-101 [health]")
+			move("complete_request", 1010*time.Millisecond, requestsRouting, requestsComplete, "request-101 [health]")
+			move("arrive_at_routing_stock", 2*time.Second, requestsSource, requestsRouting, "request-102 [big_reports]")
+			move("request_failed", 2*time.Second, requestsRouting, requestsRetrying, "request-102 [big_reports]")
+			move("retry_request", 3*time.Second, requestsRetrying, requestsRouting, "request-102 [big_reports]")
+			move("complete_request", 5*time.Second, requestsRouting, requestsComplete, "request-102 [big_reports]")
+			move("arrive_at_routing_stock", 3*time.Second, requestsSource, requestsRouting, "request-103 [big_reports]")
+			move("request_failed", 3*time.Second, requestsRouting, requestsFailed, "request-103 [big_reports]")
+
+			require.NoError(t, store.Flush(completed, nil))
+
+			classes, err = Summarize(conn, store.ScenarioRunId())
+			require.NoError(t, err)
+		})
+
+		it("summarizes the run as a whole", func() {
+			assert.Equal(t, int64(3), classes.Requests)
+			assert.Equal(t, int64(1), classes.FailedRequests)
+			assert.Equal(t, int64(1), classes.Retries)
+		})
+
+		it("breaks requests down by class", func() {
+			require.Len(t, classes.Classes, 2)
+			assert.Equal(t, int64(1), classes.Classes["health"].Requests)
+			assert.Equal(t, 10*time.Millisecond, classes.Classes["health"].LatencyP50)
+			assert.Equal(t, int64(2), classes.Classes["big_reports"].Requests)
+			assert.Equal(t, 3*time.Second, classes.Classes["big_reports"].LatencyP50)
+			assert.Equal(t, 0.5, classes.Classes["big_reports"].FailureRate)
+		})
+
+		it("names the metrics of each class after it", func() {
+			p50, err := classes.Metric("health:p50")
+			require.NoError(t, err)
+			assert.Equal(t, float64(10*time.Millisecond), p50)
+			assert.Contains(t, classes.MetricNames(), "big_reports:failures.no_active_replicas")
+			assert.True(t, IsDurationMetric("health:p99"))
+		})
+
+		it("rejects metrics which are not kept for classes", func() {
+			_, err := classes.Metric("health:peak_replicas")
+			assert.Error(t, err)
+		})
+	})
+
+	describe("a run which split traffic between revisions", func() {
+		var revisions RunSummary
+
+		it.Before(func() {
+			store, err := NewStreamingRunStore(conn, model.ClusterConfig{}, model.KnativeAutoscalerConfig{}, "test_origin", "test_pattern", 100*time.Second)
+			require.NoError(t, err)
+
+			requestsSource := simulator.NewThroughStock("RequestsSource", "Request")
+			requestsRouting := simulator.NewThroughStock("RequestsRouting", "Request")
+			stableRouting := simulator.NewThroughStock("RequestsRouting [stable]", "Request")
+			canaryRouting := simulator.NewThroughStock("RequestsRouting [canary]", "Request")
+			requestsComplete := simulator.NewThroughStock("RequestsComplete [1]", "Request")
+			canaryFailed := simulator.NewThroughStock("RequestsFailed [canary]", "Request")
+			stableLaunching := simulator.NewThroughStock("ReplicasLaunching [stable]", "Replica")
+			stableActive := simulator.NewThroughStock("ReplicasActive [stable]", "Replica")
+			canaryLaunching := simulator.NewThroughStock("ReplicasLaunching [canary]", "Replica")
+			canaryActive := simulator.NewThroughStock("ReplicasActive [canary]", "Replica")
+			stableRecommendations := simulator.NewThroughStock("ScaleRecommendations [stable]", "BoundViolation")
+			stableViolations := simulator.NewThroughStock("BoundViolations [stable]", "BoundViolation")
+			canaryRecommendations := simulator.NewThroughStock("ScaleRecommendations [canary]", "BoundViolation")
+			canaryViolations := simulator.NewThroughStock("BoundViolations [canary]", "BoundViolation")
+
+			completed := make([]simulator.CompletedMovement, 0)
+			move := func(kind simulator.MovementKind, occursAt time.Duration, from, to simulator.ThroughStock, name simulator.EntityName, entityKind simulator.EntityKind) {
+				completed = append(completed, simulator.CompletedMovement{
+					Movement: simulator.NewMovement(kind, time.Unix(0, 0).Add(occursAt), from, to),
+					Moved:    simulator.NewEntity(name, entityKind),
+				})
+			}
+
+			move("finish_launching", 0, stableLaunching, stableActive, "replica-1", "Replica")
+			move("finish_launching", 0, stableLaunching, stableActive, "replica-2", "Replica")
+			move("finish_launching", 50*time.Second, canaryLaunching, canaryActive, "replica-3", "Replica")
+
+			move("arrive_at_routing_stock", 1*time.Second, requestsSource, requestsRouting, "request-201", "Request")
+			move("split_traffic", 1*time.Second, requestsRouting, stableRouting, "request-201", "Request")
+			move("send_to_replica", 1*time.Second, stableRouting, requestsComplete, "request-201", "Request")
+			move("arrive_at_routing_stock", 2*time.Second, requestsSource, requestsRouting, "request-202", "Request")
+			move("split_traffic", 2*time.Second, requestsRouting, canaryRouting, "request-202", "Request")
+			move("request_failed", 2*time.Second, canaryRouting, canaryFailed, "request-202", "Request")
+
+			move("clamp_to_max_scale", 10*time.Second, stableRecommendations, stableViolations, "bound-violation-1 (recommended 12)", "BoundViolation")
+			move("clamp_to_min_scale", 10*time.Second, canaryRecommendations, canaryViolations, "bound-violation-1 (recommended 0)", "BoundViolation")
+			move("clamp_to_min_scale", 20*time.Second, canaryRecommendations, canaryViolations, "bound-violation-2 (recommended 0)", "BoundViolation")
+
+			require.NoError(t, store.Flush(completed, nil))
+
+			revisions, err = Summarize(conn, store.ScenarioRunId())
+			require.NoError(t, err)
+		})
+
+		it("summarizes the replicas of every revision together", func() {
+			assert.Equal(t, int64(3), revisions.PeakReplicas)
+			assert.Equal(t, 250.0, revisions.ReplicaSeconds)
+		})
+
+		it("counts failures on any revision", func() {
+			assert.Equal(t, int64(1), revisions.FailuresByReason["no_active_replicas"])
+		})
+
+		it("breaks requests and replicas down by revision", func() {
+			require.Len(t, revisions.Revisions, 2)
+			assert.Equal(t, int64(1), revisions.Revisions["stable"].CompletedRequests)
+			assert.Equal(t, 200.0, revisions.Revisions["stable"].ReplicaSeconds)
+			assert.Equal(t, int64(1), revisions.Revisions["canary"].FailedRequests)
+			assert.Equal(t, int64(1), revisions.Revisions["canary"].PeakReplicas)
+		})
+
+		it("counts the recommendations clamped to the bounds of every revision and of each", func() {
+			assert.Equal(t, int64(3), revisions.BoundViolations)
+			assert.Equal(t, int64(1), revisions.Revisions["stable"].BoundViolations)
+			assert.Equal(t, int64(2), revisions.Revisions["canary"].BoundViolations)
+		})
+
+		it("names the metrics of each revision after it", func() {
+			failureRate, err := revisions.Metric("revision:canary:failure_rate")
+			require.NoError(t, err)
+			assert.Equal(t, 1.0, failureRate)
+			assert.Contains(t, revisions.MetricNames(), "revision:stable:replica_seconds")
+			assert.True(t, IsDurationMetric("revision:canary:p99"))
+		})
+	})
+
+	describe("a run whose requests passed through several services", func() {
+		var services RunSummary
+
+		it.Before(func() {
+			store, err := NewStreamingRunStore(conn, model.ClusterConfig{}, model.KnativeAutoscalerConfig{}, "test_origin", "test_pattern", 100*time.Second)
+			require.NoError(t, err)
+
+			requestsSource := simulator.NewThroughStock("RequestsSource", "Request")
+			callSource := simulator.NewThroughStock("CallSource [frontend]", "Request")
+			frontendRouting := simulator.NewThroughStock("RequestsRouting [frontend]", "Request")
+			backendRouting := simulator.NewThroughStock("RequestsRouting [backend]", "Request")
+			frontendProcessing := simulator.NewThroughStock("RequestsProcessing [1]", "Request")
+			backendProcessing := simulator.NewThroughStock("RequestsProcessing [2]", "Request")
+			frontendComplete := simulator.NewThroughStock("RequestsComplete [1]", "Request")
+			backendComplete := simulator.NewThroughStock("RequestsComplete [2]", "Request")
+			frontendFailed := simulator.NewThroughStock("RequestsFailed [frontend]", "Request")
+			backendFailed := simulator.NewThroughStock("RequestsFailed [backend]", "Request")
+			frontendLaunching := simulator.NewThroughStock("ReplicasLaunching [frontend]", "Replica")
+			frontendActive := simulator.NewThroughStock("ReplicasActive [frontend]", "Replica")
+
+			completed := make([]simulator.CompletedMovement, 0)
+			move := func(kind simulator.MovementKind, occursAt time.Duration, from, to simulator.ThroughStock, name simulator.EntityName, entityKind simulator.EntityKind) {
+				completed = append(completed, simulator.CompletedMovement{
+					Movement: simulator.NewMovement(kind, time.Unix(0, 0).Add(occursAt), from, to),
+					Moved:    simulator.NewEntity(name, entityKind),
+				})
+			}
+
+			move("finish_launching", 0, frontendLaunching, frontendActive, "replica-1", "Replica")
+
+			move("arrive_at_routing_stock", 1*time.Second, requestsSource, frontendRouting, "request-301", "Request")
+			move("send_to_replica", 1*time.Second, frontendRouting, frontendProcessing, "request-301", "Request")
+			move("call_service", 1*time.Second, callSource, backendRouting, "request-302", "Request")
+			move("send_to_replica", 1*time.Second, backendRouting, backendProcessing, "request-302", "Request")
+			move("complete_request", 1500*time.Millisecond, backendProcessing, backendComplete, "request-302", "Request")
+			move("complete_request", 2*time.Second, frontendProcessing, frontendComplete, "request-301", "Request")
+
+			move("arrive_at_routing_stock", 3*time.Second, requestsSource, frontendRouting, "request-303", "Request")
+			move("send_to_replica", 3*time.Second, frontendRouting, frontendProcessing, "request-303", "Request")
+			move("call_service", 3*time.Second, callSource, backendRouting, "request-304", "Request")
+			move("request_failed", 3*time.Second, backendRouting, backendFailed, "request-304", "Request")
+			move("call_failed", 3*time.Second, frontendProcessing, frontendFailed, "request-303", "Request")
+
+			require.NoError(t, store.Flush(completed, nil))
+
+			services, err = Summarize(conn, store.ScenarioRunId())
+			require.NoError(t, err)
+		})
+
+		it("summarizes requests from end to end", func() {
+			assert.Equal(t, int64(2), services.Requests)
+			assert.Equal(t, int64(1), services.CompletedRequests)
+			assert.Equal(t, time.Second, services.LatencyP50)
+			assert.Equal(t, map[string]int64{"call_failed": 1}, services.FailuresByReason)
+		})
+
+		it("breaks requests down by the service they were sent to", func() {
+			require.Len(t, services.Services, 2)
+			assert.Equal(t, int64(2), services.Services["frontend"].Requests)
+			assert.Equal(t, int64(1), services.Services["frontend"].PeakReplicas)
+			assert.Equal(t, int64(2), services.Services["backend"].Requests)
+			assert.Equal(t, 500*time.Millisecond, services.Services["backend"].LatencyP50)
+			assert.Equal(t, int64(1), services.Services["backend"].FailuresByReason["no_active_replicas"])
+		})
+
+		it("names the metrics of each service after it", func() {
+			p50, err := services.Metric("service:backend:p50")
+			require.NoError(t, err)
+			assert.Equal(t, float64(500*time.Millisecond), p50)
+			assert.Contains(t, services.MetricNames(), "service:frontend:failures.call_failed")
+			assert.True(t, IsDurationMetric("service:backend:p99"))
+		})
+	})
+}
+
+func TestPercentile(t *testing.T) {
+	spec.Run(t, "Percentile()", testPercentile, spec.Report(report.Terminal{}))
+}
+
+func testPercentile(t *testing.T, describe spec.G, it spec.S) {
+	it("returns 0 for no durations", func() {
+		assert.Equal(t, time.Duration(0), Percentile(nil, 99))
+	})
+
+	it("uses the nearest rank", func() {
+		durations := []time.Duration{4, 1, 3, 2, 5, 6, 7, 8, 9, 10}
+		assert.Equal(t, time.Duration(5), Percentile(durations, 50))
+		assert.Equal(t, time.Duration(9), Percentile(durations, 90))
+		assert.Equal(t, time.Duration(10), Percentile(durations, 99))
+		assert.Equal(t, time.Duration(1), Percentile(durations, 0))
+	})
+}
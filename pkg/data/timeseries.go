@@ -0,0 +1,83 @@
+/*
+ * Copyright (C) 2019-Present Pivotal Software, Inc. All rights reserved.
+ *
+ * This program and the accompanying materials are made available under the terms
+ * of the Apache License, Version 2.0 (the "License”); you may not use this file
+ * except in compliance with the License. You may obtain a copy of the License at:
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software distributed
+ * under the License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR
+ * CONDITIONS OF ANY KIND, either express or implied. See the License for the
+ * specific language governing permissions and limitations under the License.
+ */
+
+package data
+
+import (
+	"github.com/bvinc/go-sqlite-lite/sqlite3"
+)
+
+// SecondCount is how many times something happened during one second of simulated time.
+type SecondCount struct {
+	Second int64 `json:"second"`
+	Count  int64 `json:"count"`
+}
+
+// CPUUtilization is the highest replica CPU utilization seen by an autoscaler tick.
+type CPUUtilization struct {
+	CalculatedAt int64   `json:"calculated_at"`
+	Utilization  float64 `json:"utilization"`
+}
+
+// language=sql
+var failuresPerSecondQuery = `
+select
+    cm.occurs_at / 1000000000 as occurs_at_second
+  , count(1)                  as failures
+from completed_movements cm
+    join stocks ts on ts.id = cm.to_stock
+where ts.name = 'RequestsFailed'
+  and cm.scenario_run_id = ?
+group by occurs_at_second
+order by occurs_at_second
+;
+`
+
+// ArrivalsPerSecond counts the requests arriving in each second of a run. Seconds without
+// arrivals are left out.
+func ArrivalsPerSecond(conn *sqlite3.Conn, scenarioRunId int64) ([]SecondCount, error) {
+	return secondCounts(conn, RequestsPerSecondQuery, scenarioRunId)
+}
+
+// FailuresPerSecond counts the requests failing in each second of a run. Seconds without
+// failures are left out.
+func FailuresPerSecond(conn *sqlite3.Conn, scenarioRunId int64) ([]SecondCount, error) {
+	return secondCounts(conn, failuresPerSecondQuery, scenarioRunId)
+}
+
+func secondCounts(conn *sqlite3.Conn, query string, scenarioRunId int64) ([]SecondCount, error) {
+	counts := make([]SecondCount, 0)
+	err := queryRows(conn, query, []interface{}{scenarioRunId}, func(stmt *sqlite3.Stmt) error {
+		var sc SecondCount
+		err := stmt.Scan(&sc.Second, &sc.Count)
+		counts = append(counts, sc)
+		return err
+	})
+
+	return counts, err
+}
+
+// CPUUtilizations gives the CPU utilizations recorded during a run, in order.
+func CPUUtilizations(conn *sqlite3.Conn, scenarioRunId int64) ([]CPUUtilization, error) {
+	utilizations := make([]CPUUtilization, 0)
+	err := queryRows(conn, CPUUtilizationQuery, []interface{}{scenarioRunId}, func(stmt *sqlite3.Stmt) error {
+		var cu CPUUtilization
+		err := stmt.Scan(&cu.Utilization, &cu.CalculatedAt)
+		utilizations = append(utilizations, cu)
+		return err
+	})
+
+	return utilizations, err
+}
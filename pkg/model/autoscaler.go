@@ -16,6 +16,7 @@
 package model
 
 import (
+	"fmt"
 	"log"
 	"time"
 
@@ -40,6 +41,69 @@ type KnativeAutoscalerConfig struct {
 	ScaleToZeroGracePeriod time.Duration
 	TargetConcurrency      float64
 	MaxScaleUpRate         float64
+
+	HPA HPAConfig
+}
+
+// HPAConfig holds the parameters of the HorizontalPodAutoscaler handed to the plugin.
+// Zero values fall back to the defaults below. The cluster keeps its replicas between
+// MinReplicas and MaxReplicas whatever the plugin recommends.
+type HPAConfig struct {
+	MinReplicas       int32
+	MaxReplicas       int32
+	TargetUtilization int32
+}
+
+const (
+	defaultHPAMinReplicas       = 1
+	defaultHPAMaxReplicas       = 10
+	defaultHPATargetUtilization = 50
+)
+
+func (hc HPAConfig) Validate() error {
+	if hc.MinReplicas < 0 || hc.MaxReplicas < 0 || hc.TargetUtilization < 0 {
+		return fmt.Errorf("HPA parameters must not be negative")
+	}
+	if hc = hc.withDefaults(); hc.MinReplicas > hc.MaxReplicas {
+		return fmt.Errorf("HPA min replicas of %d is above its max replicas of %d", hc.MinReplicas, hc.MaxReplicas)
+	}
+
+	return nil
+}
+
+// withDefaults fills in defaults for unset parameters.
+func (hc HPAConfig) withDefaults() HPAConfig {
+	if hc.MinReplicas == 0 {
+		hc.MinReplicas = defaultHPAMinReplicas
+	}
+	if hc.MaxReplicas == 0 {
+		hc.MaxReplicas = defaultHPAMaxReplicas
+	}
+	if hc.TargetUtilization == 0 {
+		hc.TargetUtilization = defaultHPATargetUtilization
+	}
+
+	return hc
+}
+
+// clamp brings a number of replicas within MinReplicas and MaxReplicas. Should the minimum be
+// above the maximum, the maximum wins.
+func (hc HPAConfig) clamp(replicas int32) int32 {
+	hc = hc.withDefaults()
+	if replicas < hc.MinReplicas {
+		replicas = hc.MinReplicas
+	}
+	if replicas > hc.MaxReplicas {
+		replicas = hc.MaxReplicas
+	}
+
+	return replicas
+}
+
+// Yaml renders the HorizontalPodAutoscaler, filling in defaults for unset parameters.
+func (hc HPAConfig) Yaml() string {
+	hc = hc.withDefaults()
+	return fmt.Sprintf(hpaYaml, hc.MaxReplicas, hc.TargetUtilization, hc.MinReplicas)
 }
 
 type KnativeAutoscalerModel interface {
@@ -66,29 +130,27 @@ func NewAutoscaler(env simulator.Environment, startAt time.Time, cluster Cluster
 
 	autoscalerEntity := simulator.NewEntity("Autoscaler", "Autoscaler")
 
-	err := env.Plugin().Event(startAt.UnixNano(), proto.EventType_CREATE, &skplug.Autoscaler{
+	err := cluster.Plugin().Event(startAt.UnixNano(), proto.EventType_CREATE, &skplug.Autoscaler{
 		// TODO: select type and plugin based on the scenario.
 		Type: "hpa.v2beta2.autoscaling.k8s.io",
-		Yaml: hpaYaml,
+		Yaml: config.HPA.Yaml(),
 	})
 	if err != nil {
 		panic(err)
 	}
 	log.Printf("Created autoscaler.")
 
-	// TODO: create initial replicas config.
-	// Create the first pod since HPA can't scale from zero.
 	cm := cluster.(*clusterModel)
-	err = cm.replicasActive.Add(cm.replicaSource.Remove())
-	if err != nil {
-		panic(err)
-	}
+	cm.hpa = config.HPA
 
 	kas := &knativeAutoscaler{
 		env:      env,
 		tickTock: NewAutoscalerTicktockStock(env, autoscalerEntity, cluster),
 	}
 
+	// HPA can't scale from zero, so the cluster starts with its initial replicas already running.
+	bootstrap(env, startAt, cm, kas.tickTock.(*autoscalerTicktockStock).desiredSource)
+
 	for theTime := startAt.Add(config.TickInterval).Add(1 * time.Nanosecond); theTime.Before(env.HaltTime()); theTime = theTime.Add(config.TickInterval) {
 		kas.env.AddToSchedule(simulator.NewMovement(
 			"autoscaler_tick",
@@ -101,6 +163,29 @@ func NewAutoscaler(env simulator.Environment, startAt time.Time, cluster Cluster
 	return kas
 }
 
+// bootstrap brings a cluster up to its initial scale just after startAt. The initial replicas
+// are desired and active from the start, without being launched. When nodes are modelled they
+// need a node like any other replica, so they are scheduled and launched instead.
+func bootstrap(env simulator.Environment, startAt time.Time, cm *clusterModel, desiredSource simulator.ThroughStock) {
+	bootstrapAt := startAt.Add(1 * time.Nanosecond)
+	bootstrapped := &bootstrappedDesiredStock{desired: cm.replicasDesired.(*replicasDesiredStock)}
+
+	var replicasInto simulator.SinkStock = cm.replicasActive
+	if cm.scheduler != nil {
+		replicasInto = cm.launchInto()
+	}
+
+	for i := int32(0); i < cm.initialScale(); i++ {
+		err := desiredSource.Add(simulator.NewEntity("Desired", "Desired"))
+		if err != nil {
+			panic(err)
+		}
+
+		env.AddToSchedule(simulator.NewMovement("bootstrap_desired", bootstrapAt, desiredSource, bootstrapped))
+		env.AddToSchedule(simulator.NewMovement("bootstrap_replica", bootstrapAt, cm.replicaSource, replicasInto))
+	}
+}
+
 const hpaYaml = `
 apiVersion: autoscaling/v2beta2
 kind: HorizontalPodAutoscaler
@@ -108,15 +193,15 @@ metadata:
   name: hpa
   namespace: default
 spec:
-  maxReplicas: 10
+  maxReplicas: %d
   metrics:
   - resource:
       name: cpu
       target:
-        averageUtilization: 50
+        averageUtilization: %d
         type: Utilization
     type: Resource
-  minReplicas: 1
+  minReplicas: %d
   scaleTargetRef:
     apiVersion: extensions/v1beta1
     kind: Deployment
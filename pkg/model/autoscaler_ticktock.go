@@ -32,10 +32,13 @@ type autoscalerTicktockStock struct {
 	autoscalerEntity simulator.Entity
 	desiredSource    simulator.ThroughStock
 	desiredSink      simulator.ThroughStock
+	recommendations  simulator.ThroughStock
+	boundViolations  simulator.SinkStock
+	violationCount   int
 }
 
 func (asts *autoscalerTicktockStock) Name() simulator.StockName {
-	return "Autoscaler Ticktock"
+	return asts.cluster.stockName("Autoscaler Ticktock")
 }
 
 func (asts *autoscalerTicktockStock) KindStocked() simulator.EntityKind {
@@ -62,43 +65,93 @@ func (asts *autoscalerTicktockStock) Add(entity simulator.Entity) error {
 	currentTime := asts.env.CurrentMovementTime()
 
 	asts.cluster.RecordToAutoscaler(&currentTime)
-	autoscalerDesired, err := asts.env.Plugin().Scale(currentTime.UnixNano())
+	recommended, err := asts.cluster.Plugin().Scale(currentTime.UnixNano())
 	if err != nil {
 		panic(err)
 	}
 
-	delta := autoscalerDesired - int32(asts.cluster.Desired().Count())
+	autoscalerDesired, err := asts.enforceScaleBounds(recommended)
+	if err != nil {
+		return err
+	}
+
+	err = scaleDesired(asts.env, asts.cluster, asts.desiredSource, asts.desiredSink, autoscalerDesired)
+	if err != nil {
+		return err
+	}
+
+	//calculate CPU utilization
+	asts.calculateCPUUtilization()
+
+	return nil
+}
+
+// enforceScaleBounds keeps the replicas recommended by the autoscaler within the min and max
+// replicas of the cluster. A recommendation outside them is recorded as a BoundViolation, which
+// moves from ScaleRecommendations into BoundViolations, named with what was recommended.
+func (asts *autoscalerTicktockStock) enforceScaleBounds(recommended int32) (int32, error) {
+	bounded := asts.cluster.(*clusterModel).hpa.clamp(recommended)
+	if bounded == recommended {
+		return bounded, nil
+	}
+
+	asts.violationCount++
+	violation := simulator.NewEntity(
+		simulator.EntityName(fmt.Sprintf("bound-violation-%d (recommended %d)", asts.violationCount, recommended)),
+		"BoundViolation",
+	)
+	err := asts.recommendations.Add(violation)
+	if err != nil {
+		return 0, err
+	}
+
+	kind := simulator.MovementKind("clamp_to_max_scale")
+	if bounded > recommended {
+		kind = "clamp_to_min_scale"
+	}
+	asts.env.AddToSchedule(simulator.NewMovement(
+		kind,
+		asts.env.CurrentMovementTime().Add(1*time.Nanosecond),
+		asts.recommendations,
+		asts.boundViolations,
+	))
+
+	return bounded, nil
+}
+
+// scaleDesired schedules the movements which bring the desired replicas of a cluster to desired,
+// from desiredSource or into desiredSink.
+func scaleDesired(env simulator.Environment, cluster ClusterModel, desiredSource, desiredSink simulator.ThroughStock, desired int32) error {
+	currentTime := env.CurrentMovementTime()
+	delta := desired - int32(cluster.Desired().Count())
 
 	if delta > 0 {
 		for i := int32(0); i < delta; i++ {
-			err := asts.desiredSource.Add(simulator.NewEntity("Desired", "Desired"))
+			err := desiredSource.Add(simulator.NewEntity("Desired", "Desired"))
 			if err != nil {
 				return err
 			}
 
-			asts.env.AddToSchedule(simulator.NewMovement(
+			env.AddToSchedule(simulator.NewMovement(
 				"increase_desired",
 				currentTime.Add(1*time.Nanosecond),
-				asts.desiredSource,
-				asts.cluster.Desired(),
+				desiredSource,
+				cluster.Desired(),
 			))
 		}
 	} else if delta < 0 {
 		for i := delta; i < 0; i++ {
-			asts.env.AddToSchedule(simulator.NewMovement(
+			env.AddToSchedule(simulator.NewMovement(
 				"reduce_desired",
 				currentTime.Add(1*time.Nanosecond),
-				asts.cluster.Desired(),
-				asts.desiredSink,
+				cluster.Desired(),
+				desiredSink,
 			))
 		}
 	} else {
 		// do nothing
 	}
 
-	//calculate CPU utilization
-	asts.calculateCPUUtilization()
-
 	return nil
 }
 
@@ -123,7 +176,9 @@ func NewAutoscalerTicktockStock(env simulator.Environment, scalerEntity simulato
 		env:              env,
 		cluster:          cluster,
 		autoscalerEntity: scalerEntity,
-		desiredSource:    simulator.NewThroughStock("DesiredSource", "Desired"),
-		desiredSink:      simulator.NewThroughStock("DesiredSink", "Desired"),
+		desiredSource:    simulator.NewThroughStock(cluster.stockName("DesiredSource"), "Desired"),
+		desiredSink:      simulator.NewThroughStock(cluster.stockName("DesiredSink"), "Desired"),
+		recommendations:  simulator.NewThroughStock(cluster.stockName("ScaleRecommendations"), "BoundViolation"),
+		boundViolations:  simulator.NewSinkStock(cluster.stockName("BoundViolations"), "BoundViolation"),
 	}
 }
@@ -47,7 +47,7 @@ func testAutoscalerTicktock(t *testing.T, describe spec.G, it spec.S) {
 			scaleTimes: make([]time.Time, 0),
 		}
 
-		replicasConfig = ReplicasConfig{time.Second, time.Second, 100}
+		replicasConfig = ReplicasConfig{LaunchDelay: time.Second, TerminateDelay: time.Second, MaxRPS: 100}
 		cluster = NewCluster(envFake, ClusterConfig{}, replicasConfig)
 		subject = NewAutoscalerTicktockStock(envFake, simulator.NewEntity("Autoscaler", "KnativeAutoscaler"), autoscalerFake, cluster)
 		rawSubject = subject.(*autoscalerTicktockStock)
@@ -0,0 +1,315 @@
+/*
+ * Copyright (C) 2019-Present Pivotal Software, Inc. All rights reserved.
+ *
+ * This program and the accompanying materials are made available under the terms
+ * of the Apache License, Version 2.0 (the "License”); you may not use this file
+ * except in compliance with the License. You may obtain a copy of the License at:
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software distributed
+ * under the License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR
+ * CONDITIONS OF ANY KIND, either express or implied. See the License for the
+ * specific language governing permissions and limitations under the License.
+ */
+
+package model
+
+import (
+	"fmt"
+	"math"
+	"time"
+
+	"skenario/pkg/simulator"
+)
+
+type FaultKind string
+
+const (
+	// KillFault crashes replicas. Their in-flight requests fail and replacements are launched.
+	KillFault FaultKind = "kill"
+	// SlowFault reduces the CPU capacity of replicas to CPUFactor of what it was.
+	SlowFault FaultKind = "slow"
+	// UnreadyFault fails the readiness probes of replicas, taking them out of ReplicasActive.
+	// Requests they are already processing carry on.
+	UnreadyFault FaultKind = "unready"
+	// PartitionFault cuts replicas off from routing. They stay active and keep reporting to the
+	// autoscaler, but receive no new requests.
+	PartitionFault FaultKind = "partition"
+)
+
+// Fault is something that goes wrong with replicas during a run. It happens once, At after the
+// start of the run, or if MTBF is set, at random from then on. MTBF is the mean time between
+// failures of each replica, so faults come more often as the number of active replicas grows.
+//
+// Each occurrence affects Fraction of the active replicas, or a single replica if Fraction is
+// zero. Slow, unready and partition faults last for Duration, or for the rest of the run if
+// Duration is zero.
+type Fault struct {
+	Kind      FaultKind     `json:"kind"`
+	At        time.Duration `json:"at,omitempty"`
+	MTBF      time.Duration `json:"mtbf,omitempty"`
+	Fraction  float64       `json:"fraction,omitempty"`
+	Duration  time.Duration `json:"duration,omitempty"`
+	CPUFactor float64       `json:"cpu_factor,omitempty"`
+}
+
+func (f Fault) Validate() error {
+	switch f.Kind {
+	case KillFault, UnreadyFault, PartitionFault:
+	case SlowFault:
+		if f.CPUFactor <= 0 || f.CPUFactor > 1 {
+			return fmt.Errorf("slow fault needs a cpu_factor greater than 0 and at most 1, but it was %g", f.CPUFactor)
+		}
+	default:
+		return fmt.Errorf("unknown fault kind '%s'", f.Kind)
+	}
+
+	if f.At < 0 || f.MTBF < 0 || f.Duration < 0 {
+		return fmt.Errorf("%s fault has a negative duration", f.Kind)
+	}
+	if f.Fraction < 0 || f.Fraction > 1 {
+		return fmt.Errorf("%s fault has a fraction of %g, which is not between 0 and 1", f.Kind, f.Fraction)
+	}
+
+	return nil
+}
+
+type faultEntity struct {
+	number   int
+	fault    Fault
+	affected []simulator.Entity
+}
+
+func (fe *faultEntity) Name() simulator.EntityName {
+	return simulator.EntityName(fmt.Sprintf("fault-%d", fe.number))
+}
+
+func (fe *faultEntity) Kind() simulator.EntityKind {
+	return "Fault"
+}
+
+// chaos injects faults into a cluster. Each occurrence of a fault is an entity which moves from
+// FaultsScheduled to FaultsInEffect when it is injected, and on to FaultsCleared once it is over.
+type chaos struct {
+	env             simulator.Environment
+	cluster         *clusterModel
+	scheduled       *entityStock
+	inEffect        *faultsInEffectStock
+	cleared         simulator.SinkStock
+	replicasActive  takingStock
+	replicasUnready *entityStock
+	replicasKilled  *replicasKilledStock
+	faultCount      int
+}
+
+func (c *chaos) schedule(fault Fault, at time.Time) {
+	c.faultCount++
+	fe := &faultEntity{number: c.faultCount, fault: fault}
+
+	err := c.scheduled.Add(fe)
+	if err != nil {
+		panic(err)
+	}
+
+	c.env.AddToSchedule(simulator.NewMovement("inject_fault", at, departureOf(c.scheduled, fe), c.inEffect))
+}
+
+// untilNext samples the time to the next random occurrence of a fault across all active replicas.
+func (c *chaos) untilNext(fault Fault) time.Duration {
+	replicas := c.replicasActive.Count()
+	if replicas == 0 {
+		replicas = 1
+	}
+
+	return time.Duration(c.env.Rand().ExpFloat64() * float64(fault.MTBF) / float64(replicas))
+}
+
+// choose picks the active replicas a fault will affect.
+func (c *chaos) choose(fraction float64) []simulator.Entity {
+	active := c.replicasActive.EntitiesInStock()
+	if len(active) == 0 {
+		return nil
+	}
+
+	count := 1
+	if fraction > 0 {
+		count = int(math.Ceil(fraction * float64(len(active))))
+	}
+	if count > len(active) {
+		count = len(active)
+	}
+
+	chosen := make([]simulator.Entity, 0, count)
+	for _, i := range c.env.Rand().Perm(len(active))[:count] {
+		chosen = append(chosen, *active[i])
+	}
+	return chosen
+}
+
+func (c *chaos) inject(fe *faultEntity) {
+	now := c.env.CurrentMovementTime()
+	if fe.fault.MTBF > 0 {
+		c.schedule(fe.fault, now.Add(c.untilNext(fe.fault)))
+	}
+
+	fe.affected = c.choose(fe.fault.Fraction)
+	for _, replica := range fe.affected {
+		switch fe.fault.Kind {
+		case KillFault:
+			c.env.AddToSchedule(simulator.NewMovement("kill_replica", now.Add(1*time.Nanosecond), departureOf(c.replicasActive, replica), c.replicasKilled))
+		case SlowFault:
+			replica.(*replicaEntity).slowDown(fe.fault.CPUFactor)
+		case UnreadyFault:
+			c.env.AddToSchedule(simulator.NewMovement("fail_readiness", now.Add(1*time.Nanosecond), departureOf(c.replicasActive, replica), c.replicasUnready))
+		case PartitionFault:
+			c.cluster.requestsInRouting.(*requestsRoutingStock).partitioned[replica]++
+		}
+	}
+
+	// kills are over as soon as they happen; other faults last until cleared
+	duration := fe.fault.Duration
+	if fe.fault.Kind == KillFault {
+		duration = 1 * time.Nanosecond
+	} else if duration == 0 {
+		return
+	} else if duration < 2*time.Nanosecond {
+		duration = 2 * time.Nanosecond
+	}
+
+	c.env.AddToSchedule(simulator.NewMovement("clear_fault", now.Add(duration), departureOf(c.inEffect, fe), c.cleared))
+}
+
+func (c *chaos) clear(fe *faultEntity) {
+	now := c.env.CurrentMovementTime()
+	for _, replica := range fe.affected {
+		switch fe.fault.Kind {
+		case SlowFault:
+			replica.(*replicaEntity).speedUp(fe.fault.CPUFactor)
+		case UnreadyFault:
+			c.env.AddToSchedule(simulator.NewMovement("pass_readiness", now.Add(1*time.Nanosecond), departureOf(c.replicasUnready, replica), c.replicasActive))
+		case PartitionFault:
+			partitioned := c.cluster.requestsInRouting.(*requestsRoutingStock).partitioned
+			partitioned[replica]--
+			if partitioned[replica] <= 0 {
+				delete(partitioned, replica)
+			}
+		}
+	}
+}
+
+// NewChaos schedules faults for a cluster, relative to startAt.
+func NewChaos(env simulator.Environment, startAt time.Time, cluster ClusterModel, faults []Fault) {
+	cm := cluster.(*clusterModel)
+	c := &chaos{
+		env:             env,
+		cluster:         cm,
+		scheduled:       newEntityStock(cm.stockName("FaultsScheduled"), "Fault"),
+		cleared:         simulator.NewSinkStock(cm.stockName("FaultsCleared"), "Fault"),
+		replicasActive:  cm.replicasActive.(takingStock),
+		replicasUnready: newEntityStock(cm.stockName("ReplicasUnready"), "Replica"),
+	}
+	c.inEffect = &faultsInEffectStock{delegate: newEntityStock(cm.stockName("FaultsInEffect"), "Fault"), chaos: c}
+	c.replicasKilled = &replicasKilledStock{delegate: simulator.NewSinkStock(cm.stockName("ReplicasKilled"), "Replica"), cluster: cm}
+
+	for _, fault := range faults {
+		at := startAt.Add(fault.At)
+		if fault.MTBF > 0 {
+			at = at.Add(c.untilNext(fault))
+		}
+		c.schedule(fault, at)
+	}
+}
+
+type faultsInEffectStock struct {
+	delegate *entityStock
+	chaos    *chaos
+}
+
+func (fs *faultsInEffectStock) Name() simulator.StockName {
+	return fs.delegate.Name()
+}
+
+func (fs *faultsInEffectStock) KindStocked() simulator.EntityKind {
+	return fs.delegate.KindStocked()
+}
+
+func (fs *faultsInEffectStock) Count() uint64 {
+	return fs.delegate.Count()
+}
+
+func (fs *faultsInEffectStock) EntitiesInStock() []*simulator.Entity {
+	return fs.delegate.EntitiesInStock()
+}
+
+func (fs *faultsInEffectStock) Remove() simulator.Entity {
+	if fs.delegate.Count() == 0 {
+		return nil
+	}
+
+	return fs.take(*fs.delegate.EntitiesInStock()[0])
+}
+
+func (fs *faultsInEffectStock) take(entity simulator.Entity) simulator.Entity {
+	taken := fs.delegate.take(entity)
+	if taken != nil {
+		fs.chaos.clear(taken.(*faultEntity))
+	}
+
+	return taken
+}
+
+func (fs *faultsInEffectStock) Add(entity simulator.Entity) error {
+	err := fs.delegate.Add(entity)
+	if err != nil {
+		return err
+	}
+
+	fs.chaos.inject(entity.(*faultEntity))
+	return nil
+}
+
+// replicasKilledStock is where crashed replicas end up. Their in-flight requests fail, and the
+// cluster launches replacements, as a ReplicaSet would.
+type replicasKilledStock struct {
+	delegate simulator.SinkStock
+	cluster  *clusterModel
+}
+
+func (rks *replicasKilledStock) Name() simulator.StockName {
+	return rks.delegate.Name()
+}
+
+func (rks *replicasKilledStock) KindStocked() simulator.EntityKind {
+	return rks.delegate.KindStocked()
+}
+
+func (rks *replicasKilledStock) Count() uint64 {
+	return rks.delegate.Count()
+}
+
+func (rks *replicasKilledStock) EntitiesInStock() []*simulator.Entity {
+	return rks.delegate.EntitiesInStock()
+}
+
+func (rks *replicasKilledStock) Add(entity simulator.Entity) error {
+	err := rks.delegate.Add(entity)
+	if err != nil {
+		return err
+	}
+
+	entity.(Replica).RequestsProcessing().FailAll()
+	if rks.cluster.scheduler != nil {
+		rks.cluster.scheduler.release(entity)
+	}
+
+	env := rks.cluster.env
+	env.AddToSchedule(simulator.NewMovement(
+		"replace_replica",
+		env.CurrentMovementTime().Add(1*time.Nanosecond),
+		rks.cluster.replicaSource,
+		rks.cluster.launchInto(),
+	))
+
+	return nil
+}
@@ -0,0 +1,303 @@
+/*
+ * Copyright (C) 2019-Present Pivotal Software, Inc. All rights reserved.
+ *
+ * This program and the accompanying materials are made available under the terms
+ * of the Apache License, Version 2.0 (the "License”); you may not use this file
+ * except in compliance with the License. You may obtain a copy of the License at:
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software distributed
+ * under the License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR
+ * CONDITIONS OF ANY KIND, either express or implied. See the License for the
+ * specific language governing permissions and limitations under the License.
+ */
+
+package model
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/sclevine/spec"
+	"github.com/sclevine/spec/report"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"skenario/pkg/simulator"
+)
+
+func TestChaos(t *testing.T) {
+	spec.Run(t, "Chaos", testChaos, spec.Report(report.Terminal{}))
+}
+
+func testChaos(t *testing.T, describe spec.G, it spec.S) {
+	var envFake *FakeEnvironment
+	var cluster *clusterModel
+	var active *entityStock
+	var routing *requestsRoutingStock
+	var failedSink simulator.SinkStock
+	var replicas []ReplicaEntity
+
+	// perform carries out the first scheduled movement of the given kind
+	perform := func(kind simulator.MovementKind) simulator.Movement {
+		for i, m := range envFake.Movements {
+			if m.Kind() != kind {
+				continue
+			}
+
+			envFake.Movements = append(envFake.Movements[:i:i], envFake.Movements[i+1:]...)
+			envFake.TheTime = m.OccursAt()
+			moved := m.From().Remove()
+			require.NotNil(t, moved, "nothing to move for '%s'", kind)
+			require.NoError(t, m.To().Add(moved))
+			return m
+		}
+
+		require.Failf(t, "no movement scheduled", "kind '%s'", kind)
+		return nil
+	}
+
+	kinds := func() []simulator.MovementKind {
+		kinds := make([]simulator.MovementKind, 0)
+		for _, m := range envFake.Movements {
+			kinds = append(kinds, m.Kind())
+		}
+		return kinds
+	}
+
+	it.Before(func() {
+		envFake = &FakeEnvironment{Movements: make([]simulator.Movement, 0), TheTime: time.Unix(0, 0)}
+		active = newEntityStock("ReplicasActive", "Replica")
+		failedSink = simulator.NewSinkStock("RequestsFailed", "Request")
+		routing = NewRequestsRoutingStock(envFake, active, failedSink).(*requestsRoutingStock)
+		cluster = &clusterModel{
+			env:               envFake,
+			replicasActive:    active,
+			replicasLaunching: NewReplicasLaunchingStock(envFake, ReplicasConfig{}, active),
+			requestsInRouting: routing,
+		}
+
+		replicas = nil
+		for i := 0; i < 4; i++ {
+			replica := NewReplicaEntity(envFake, nil, nil, fmt.Sprintf("11.11.11.%d", i), &failedSink)
+			replicas = append(replicas, replica)
+			require.NoError(t, active.Add(replica))
+		}
+	})
+
+	describe("NewChaos()", func() {
+		it("schedules each fault relative to the start of the run", func() {
+			NewChaos(envFake, time.Unix(0, 0), cluster, []Fault{{Kind: KillFault, At: 10 * time.Second}})
+
+			require.Len(t, envFake.Movements, 1)
+			assert.Equal(t, simulator.MovementKind("inject_fault"), envFake.Movements[0].Kind())
+			assert.Equal(t, time.Unix(10, 0), envFake.Movements[0].OccursAt())
+		})
+
+		it("schedules random faults after a random delay", func() {
+			NewChaos(envFake, time.Unix(0, 0), cluster, []Fault{{Kind: KillFault, MTBF: 100 * time.Second}})
+
+			require.Len(t, envFake.Movements, 1)
+			assert.True(t, envFake.Movements[0].OccursAt().After(time.Unix(0, 0)))
+		})
+	})
+
+	describe("random faults", func() {
+		it.Before(func() {
+			NewChaos(envFake, time.Unix(0, 0), cluster, []Fault{{Kind: PartitionFault, MTBF: 100 * time.Second}})
+			perform("inject_fault")
+		})
+
+		it("schedule their next occurrence when injected", func() {
+			assert.Equal(t, []simulator.MovementKind{"inject_fault"}, kinds())
+			assert.True(t, envFake.Movements[0].OccursAt().After(envFake.TheTime))
+		})
+	})
+
+	describe("kill faults", func() {
+		var victim ReplicaEntity
+		var outcome *FakeScheduledMovement
+
+		it.Before(func() {
+			NewChaos(envFake, time.Unix(0, 0), cluster, []Fault{{Kind: KillFault, At: 10 * time.Second}})
+			perform("inject_fault")
+
+			victim = envFake.Movements[0].From().(*departure).entity.(ReplicaEntity)
+			bufferStock := NewRequestsRoutingStock(envFake, active, failedSink)
+			request := NewRequestEntity(envFake, bufferStock, RequestConfig{CPUTimeMillis: 100, IOTimeMillis: 100, Timeout: 10 * time.Second})
+			require.NoError(t, victim.RequestsProcessing().Add(request))
+			outcome = victim.RequestsProcessing().(*requestsProcessingStock).outcomes[request].(*FakeScheduledMovement)
+		})
+
+		it("kill a replica and are then over", func() {
+			assert.Equal(t, []simulator.MovementKind{"kill_replica", "clear_fault", "complete_request"}, kinds())
+		})
+
+		describe("once the replica is killed", func() {
+			it.Before(func() {
+				perform("kill_replica")
+			})
+
+			it("takes the replica out of ReplicasActive", func() {
+				assert.Equal(t, uint64(3), active.Count())
+				for _, e := range active.EntitiesInStock() {
+					assert.NotEqual(t, victim, *e)
+				}
+			})
+
+			it("fails its in-flight requests", func() {
+				assert.True(t, outcome.Cancelled)
+
+				perform("replica_killed")
+				assert.Equal(t, uint64(1), failedSink.Count())
+			})
+
+			it("launches a replacement", func() {
+				replace := envFake.Movements[len(envFake.Movements)-1]
+				assert.Equal(t, simulator.MovementKind("replace_replica"), replace.Kind())
+				assert.Equal(t, cluster.replicasLaunching, replace.To())
+			})
+		})
+	})
+
+	describe("slow faults", func() {
+		it.Before(func() {
+			NewChaos(envFake, time.Unix(0, 0), cluster, []Fault{{Kind: SlowFault, Fraction: 1, CPUFactor: 0.25, Duration: 5 * time.Second}})
+			perform("inject_fault")
+		})
+
+		it("reduce the CPU capacity of the replicas", func() {
+			for _, r := range replicas {
+				assert.Equal(t, 25.0, r.(*replicaEntity).totalCPUCapacityMillisPerSecond)
+			}
+		})
+
+		it("restore it when cleared", func() {
+			clear := perform("clear_fault")
+			assert.Equal(t, time.Unix(5, 0), clear.OccursAt())
+
+			for _, r := range replicas {
+				assert.Equal(t, 100.0, r.(*replicaEntity).totalCPUCapacityMillisPerSecond)
+			}
+		})
+	})
+
+	describe("overlapping slow faults", func() {
+		capacities := func() []float64 {
+			c := make([]float64, 0, len(replicas))
+			for _, r := range replicas {
+				c = append(c, r.(*replicaEntity).totalCPUCapacityMillisPerSecond)
+			}
+			return c
+		}
+
+		it.Before(func() {
+			NewChaos(envFake, time.Unix(0, 0), cluster, []Fault{
+				{Kind: SlowFault, Fraction: 1, CPUFactor: 0.5, Duration: 5 * time.Second},
+				{Kind: SlowFault, Fraction: 1, CPUFactor: 0.25, At: 1 * time.Second, Duration: 10 * time.Second},
+			})
+			perform("inject_fault")
+			perform("inject_fault")
+		})
+
+		it("compound while both are in effect", func() {
+			assert.Equal(t, []float64{12.5, 12.5, 12.5, 12.5}, capacities())
+		})
+
+		it("leave the other in effect when one is cleared", func() {
+			perform("clear_fault")
+			assert.Equal(t, []float64{25, 25, 25, 25}, capacities())
+
+			perform("clear_fault")
+			assert.Equal(t, []float64{100, 100, 100, 100}, capacities())
+		})
+
+		it("slow down a replica which is resized while they are in effect", func() {
+			replicas[0].(*replicaEntity).resize(replicaSize{cpuRequestMillis: 2000, cpuLimitMillis: 2000})
+			assert.Equal(t, 250.0, capacities()[0])
+
+			perform("clear_fault")
+			perform("clear_fault")
+			assert.Equal(t, 2000.0, capacities()[0])
+		})
+	})
+
+	describe("unready faults", func() {
+		it.Before(func() {
+			NewChaos(envFake, time.Unix(0, 0), cluster, []Fault{{Kind: UnreadyFault, Fraction: 0.5, Duration: 5 * time.Second}})
+			perform("inject_fault")
+			perform("fail_readiness")
+			perform("fail_readiness")
+		})
+
+		it("take replicas out of ReplicasActive", func() {
+			assert.Equal(t, uint64(2), active.Count())
+		})
+
+		it("return them when cleared", func() {
+			perform("clear_fault")
+			perform("pass_readiness")
+			perform("pass_readiness")
+
+			assert.Equal(t, uint64(4), active.Count())
+		})
+	})
+
+	describe("partition faults", func() {
+		it.Before(func() {
+			NewChaos(envFake, time.Unix(0, 0), cluster, []Fault{{Kind: PartitionFault, Fraction: 1, Duration: 5 * time.Second}})
+			perform("inject_fault")
+		})
+
+		it("cut replicas off from routing", func() {
+			assert.Empty(t, routing.reachableReplicas())
+			assert.Equal(t, uint64(4), active.Count())
+		})
+
+		it("reconnect them when cleared", func() {
+			perform("clear_fault")
+			assert.Len(t, routing.reachableReplicas(), 4)
+		})
+	})
+
+	describe("overlapping partition faults", func() {
+		it.Before(func() {
+			NewChaos(envFake, time.Unix(0, 0), cluster, []Fault{
+				{Kind: PartitionFault, Fraction: 1, Duration: 5 * time.Second},
+				{Kind: PartitionFault, Fraction: 1, At: 1 * time.Second, Duration: 10 * time.Second},
+			})
+			perform("inject_fault")
+			perform("inject_fault")
+		})
+
+		it("keep replicas cut off until the last is cleared", func() {
+			perform("clear_fault")
+			assert.Empty(t, routing.reachableReplicas())
+
+			perform("clear_fault")
+			assert.Len(t, routing.reachableReplicas(), 4)
+		})
+	})
+
+	describe("Fault.Validate()", func() {
+		it("accepts known faults", func() {
+			assert.NoError(t, Fault{Kind: KillFault, MTBF: time.Minute}.Validate())
+			assert.NoError(t, Fault{Kind: SlowFault, CPUFactor: 0.5}.Validate())
+		})
+
+		it("rejects unknown kinds", func() {
+			assert.Error(t, Fault{Kind: "meteor"}.Validate())
+		})
+
+		it("rejects slow faults that do not slow anything", func() {
+			assert.Error(t, Fault{Kind: SlowFault}.Validate())
+			assert.Error(t, Fault{Kind: SlowFault, CPUFactor: 2}.Validate())
+		})
+
+		it("rejects fractions above 1", func() {
+			assert.Error(t, Fault{Kind: PartitionFault, Fraction: 1.5}.Validate())
+		})
+	})
+}
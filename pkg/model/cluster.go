@@ -16,6 +16,8 @@
 package model
 
 import (
+	"fmt"
+	"math"
 	"time"
 
 	"github.com/josephburnett/sk-plugin/pkg/skplug/proto"
@@ -26,6 +28,7 @@ import (
 	"k8s.io/client-go/kubernetes"
 	k8sfakes "k8s.io/client-go/kubernetes/fake"
 
+	"skenario/pkg/plugin"
 	"skenario/pkg/simulator"
 )
 
@@ -33,7 +36,26 @@ type ClusterConfig struct {
 	LaunchDelay             time.Duration
 	TerminateDelay          time.Duration
 	NumberOfRequests        uint
-	InitialNumberOfReplicas uint
+	InitialNumberOfReplicas uint // kept within the HPA's min and max replicas
+	Nodes                   NodeConfig
+
+	// Revision names the revision of a service that the cluster runs, when a service has more
+	// than one. A named revision has its own autoscaler in the plugin, and its stocks are named
+	// after it, as in "ReplicasActive [canary]".
+	Revision string
+
+	// Service names the service that the cluster runs, when requests pass through several
+	// services. Like a named revision, a named service has its own autoscaler and its stocks
+	// are named after it.
+	Service string
+}
+
+// qualifier is what the stocks of the cluster are named after: its service or its revision.
+func (cc ClusterConfig) qualifier() string {
+	if cc.Service != "" {
+		return cc.Service
+	}
+	return cc.Revision
 }
 
 type ClusterModel interface {
@@ -41,9 +63,15 @@ type ClusterModel interface {
 	Desired() ReplicasDesiredStock
 	CurrentLaunching() uint64
 	CurrentActive() uint64
+	CurrentPending() uint64
+	Nodes() []NodeEntity
 	RecordToAutoscaler(atTime *time.Time)
 	RoutingStock() RequestsRoutingStock
 	ActiveStock() simulator.ThroughStock
+	Revision() string
+	Service() string
+	Plugin() *plugin.PluginPartition
+	stockName(name simulator.StockName) simulator.StockName
 }
 
 type EndpointInformerSource interface {
@@ -56,14 +84,20 @@ type clusterModel struct {
 	replicasConfig      ReplicasConfig
 	replicasDesired     ReplicasDesiredStock
 	replicaSource       ReplicaSource
-	replicasLaunching   simulator.ThroughStock
+	replicasLaunching   ReplicasLaunchingStock
 	replicasActive      simulator.ThroughStock
 	replicasTerminating ReplicasTerminatingStock
 	replicasTerminated  simulator.SinkStock
 	requestsInRouting   simulator.ThroughStock
 	requestsFailed      simulator.SinkStock
+	replicasRestarting  *replicasRestartingStock
+	verticalAutoscaler  VerticalAutoscaler
 	kubernetesClient    kubernetes.Interface
 	endpointsInformer   corev1informers.EndpointsInformer
+	scheduler           *scheduler
+	plugin              *plugin.PluginPartition
+	// hpa is the configuration the autoscaler plugin was last given.
+	hpa HPAConfig
 }
 
 func (cm *clusterModel) Env() simulator.Environment {
@@ -81,6 +115,27 @@ func (cm *clusterModel) CurrentActive() uint64 {
 	return cm.replicasActive.Count()
 }
 
+// CurrentPending is the number of replicas waiting for a node. It is always zero when the
+// cluster has unlimited capacity.
+func (cm *clusterModel) CurrentPending() uint64 {
+	if cm.scheduler == nil {
+		return 0
+	}
+	return cm.scheduler.pending.Count()
+}
+
+func (cm *clusterModel) Nodes() []NodeEntity {
+	nodes := make([]NodeEntity, 0)
+	if cm.scheduler == nil {
+		return nodes
+	}
+
+	for _, e := range cm.scheduler.nodes.EntitiesInStock() {
+		nodes = append(nodes, (*e).(NodeEntity))
+	}
+	return nodes
+}
+
 func (cm *clusterModel) RecordToAutoscaler(atTime *time.Time) {
 	// first report for the buffer
 	stats := make([]*proto.Stat, 0)
@@ -97,10 +152,14 @@ func (cm *clusterModel) RecordToAutoscaler(atTime *time.Time) {
 		r := (*e).(ReplicaEntity)
 		stats = append(stats, r.Stats()...)
 	}
-	err := cm.env.Plugin().Stat(stats)
+	err := cm.plugin.Stat(stats)
 	if err != nil {
 		panic(err)
 	}
+
+	if cm.verticalAutoscaler != nil {
+		cm.verticalAutoscaler.Stat(stats)
+	}
 }
 
 func (cm *clusterModel) EPInformer() corev1informers.EndpointsInformer {
@@ -115,6 +174,67 @@ func (cm *clusterModel) ActiveStock() simulator.ThroughStock {
 	return cm.replicasActive
 }
 
+func (cm *clusterModel) Revision() string {
+	return cm.config.Revision
+}
+
+func (cm *clusterModel) Service() string {
+	return cm.config.Service
+}
+
+// Plugin is the partition of the autoscaler plugin which scales the cluster's replicas.
+func (cm *clusterModel) Plugin() *plugin.PluginPartition {
+	return cm.plugin
+}
+
+// initialScale is how many replicas the cluster starts with.
+func (cm *clusterModel) initialScale() int32 {
+	initial := int32(math.MaxInt32)
+	if cm.config.InitialNumberOfReplicas < math.MaxInt32 {
+		initial = int32(cm.config.InitialNumberOfReplicas)
+	}
+
+	return cm.hpa.clamp(initial)
+}
+
+// qualifiedStockName names a stock of a revision or service. The stocks of a cluster which is
+// neither keep their plain names.
+func qualifiedStockName(qualifier string, name simulator.StockName) simulator.StockName {
+	if qualifier == "" {
+		return name
+	}
+	return simulator.StockName(fmt.Sprintf("%s [%s]", name, qualifier))
+}
+
+func (cm *clusterModel) stockName(name simulator.StockName) simulator.StockName {
+	return qualifiedStockName(cm.config.qualifier(), name)
+}
+
+// launchInto is where a new replica begins launching: ReplicasLaunching, or ReplicasPending when
+// it has to wait for a node.
+func (cm *clusterModel) launchInto() simulator.SinkStock {
+	if cm.scheduler != nil {
+		return cm.scheduler.pending
+	}
+	return cm.replicasLaunching
+}
+
+// restartingStock is where replicas wait while they restart. They are slow to restart as they
+// are to launch.
+func (cm *clusterModel) restartingStock() *replicasRestartingStock {
+	if cm.replicasRestarting == nil {
+		cm.replicasRestarting = newReplicasRestartingStock(cm.env, cm.replicasActive, func() time.Duration {
+			var delay time.Duration
+			for _, phase := range cm.replicasConfig.launchPhases() {
+				delay += phase.Delay.Sample(cm.env.Rand())
+			}
+			return delay
+		})
+		cm.replicasRestarting.delegate.name = cm.stockName(cm.replicasRestarting.delegate.name)
+	}
+	return cm.replicasRestarting
+}
+
 func NewCluster(env simulator.Environment, config ClusterConfig, replicasConfig ReplicasConfig) ClusterModel {
 	fakeClient := k8sfakes.NewSimpleClientset()
 	informerFactory := informers.NewSharedInformerFactory(fakeClient, 0)
@@ -133,16 +253,16 @@ func NewCluster(env simulator.Environment, config ClusterConfig, replicasConfig
 	endpointsInformer.Informer().GetIndexer().Add(newEndpoints)
 
 	replicasActive := NewReplicasActiveStock(env)
-	requestsFailed := simulator.NewSinkStock("RequestsFailed", "Request")
+	requestsFailed := simulator.NewSinkStock(qualifiedStockName(config.qualifier(), "RequestsFailed"), "Request")
 	routingStock := NewRequestsRoutingStock(env, replicasActive, requestsFailed)
-	replicasTerminated := simulator.NewSinkStock("ReplicasTerminated", simulator.EntityKind("Replica"))
+	replicasTerminated := simulator.NewSinkStock(qualifiedStockName(config.qualifier(), "ReplicasTerminated"), simulator.EntityKind("Replica"))
 
 	cm := &clusterModel{
 		env:                 env,
 		config:              config,
 		replicasConfig:      replicasConfig,
 		replicaSource:       NewReplicaSource(env, fakeClient, endpointsInformer, replicasConfig.MaxRPS),
-		replicasLaunching:   simulator.NewThroughStock("ReplicasLaunching", simulator.EntityKind("Replica")),
+		replicasLaunching:   NewReplicasLaunchingStock(env, replicasConfig, replicasActive),
 		replicasActive:      replicasActive,
 		replicasTerminating: NewReplicasTerminatingStock(env, replicasConfig, replicasTerminated),
 		replicasTerminated:  replicasTerminated,
@@ -150,6 +270,11 @@ func NewCluster(env simulator.Environment, config ClusterConfig, replicasConfig
 		requestsFailed:      requestsFailed,
 		kubernetesClient:    fakeClient,
 		endpointsInformer:   endpointsInformer,
+		plugin:              env.Plugin(),
+	}
+	if config.qualifier() != "" {
+		cm.plugin = plugin.NewPluginPartition()
+		replicasActive.(*replicasActiveStock).plugin = cm.plugin
 	}
 
 	desiredConf := ReplicasConfig{
@@ -157,7 +282,44 @@ func NewCluster(env simulator.Environment, config ClusterConfig, replicasConfig
 		TerminateDelay: config.TerminateDelay,
 	}
 
+	cm.replicaSource.(*replicaSource).size = replicasConfig.size()
+	cm.replicaSource.(*replicaSource).cpu = replicasConfig.CPU
+	if replicasConfig.Memory.modelled() {
+		cm.replicaSource.(*replicaSource).memory = replicasConfig.Memory
+		cm.replicaSource.(*replicaSource).oomKiller = newOOMKiller(env, replicasActive.(takingStock), cm.restartingStock())
+	}
+
+	if config.Nodes.Enabled() {
+		cm.scheduler = newScheduler(env, config.Nodes, replicasConfig, cm.replicasLaunching.(*replicasLaunchingStock))
+		cm.replicasTerminating.(*replicasTerminatingStock).scheduler = cm.scheduler
+	}
+
 	cm.replicasDesired = NewReplicasDesiredStock(env, desiredConf, cm.replicaSource, cm.replicasLaunching, cm.replicasActive, cm.replicasTerminating)
+	if cm.scheduler != nil {
+		cm.replicasDesired.(*replicasDesiredStock).scheduler = cm.scheduler
+	}
+
+	if config.qualifier() != "" {
+		cm.nameStocks()
+	}
 
 	return cm
 }
+
+// nameStocks names the stocks of the cluster after its revision or service, so that the stocks
+// of each can be told apart.
+func (cm *clusterModel) nameStocks() {
+	delegates := []*entityStock{
+		cm.replicasActive.(*replicasActiveStock).delegate,
+		cm.replicasLaunching.(*replicasLaunchingStock).delegate,
+		cm.replicasTerminating.(*replicasTerminatingStock).delegate,
+		cm.requestsInRouting.(*requestsRoutingStock).delegate,
+	}
+	for _, delegate := range delegates {
+		delegate.name = cm.stockName(delegate.name)
+	}
+
+	cm.replicasDesired.(*replicasDesiredStock).delegate = simulator.NewThroughStock(cm.stockName("ReplicasDesired"), "Desired")
+	cm.replicaSource.(*replicaSource).qualifier = cm.config.qualifier()
+	cm.replicaSource.(*replicaSource).failedSink = cm.requestsFailed
+}
@@ -46,7 +46,7 @@ func testCluster(t *testing.T, describe spec.G, it spec.S) {
 	it.Before(func() {
 		config = ClusterConfig{}
 		config.NumberOfRequests = 10
-		replicasConfig = ReplicasConfig{time.Second, time.Second, 100}
+		replicasConfig = ReplicasConfig{LaunchDelay: time.Second, TerminateDelay: time.Second, MaxRPS: 100}
 		subject = NewCluster(envFake, config, replicasConfig)
 		assert.NotNil(t, subject)
 
@@ -191,7 +191,7 @@ func testEPInformer(t *testing.T, describe spec.G, it spec.S) {
 
 	it.Before(func() {
 		config = ClusterConfig{}
-		replicasConfig = ReplicasConfig{time.Second, time.Second, 100}
+		replicasConfig = ReplicasConfig{LaunchDelay: time.Second, TerminateDelay: time.Second, MaxRPS: 100}
 		cluster = NewCluster(envFake, config, replicasConfig)
 		assert.NotNil(t, cluster)
 		subject = cluster.(EndpointInformerSource)
@@ -0,0 +1,219 @@
+/*
+ * Copyright (C) 2019-Present Pivotal Software, Inc. All rights reserved.
+ *
+ * This program and the accompanying materials are made available under the terms
+ * of the Apache License, Version 2.0 (the "License”); you may not use this file
+ * except in compliance with the License. You may obtain a copy of the License at:
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software distributed
+ * under the License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR
+ * CONDITIONS OF ANY KIND, either express or implied. See the License for the
+ * specific language governing permissions and limitations under the License.
+ */
+
+package model
+
+import (
+	"fmt"
+	"math"
+	"time"
+
+	"skenario/pkg/simulator"
+)
+
+type CPUModel string
+
+const (
+	// ApproximateCPU fixes the processing time of each request when it arrives, from the CPU
+	// free at that moment and Sakasegawa's approximation of queueing delay.
+	ApproximateCPU CPUModel = "approximate"
+	// ProcessorSharingCPU shares the CPU equally between the requests using it, so requests slow
+	// down as others arrive and speed up as others finish.
+	ProcessorSharingCPU CPUModel = "processor_sharing"
+	// FIFOCoresCPU runs requests on a fixed number of cores, which take requests from a single
+	// run queue in the order they arrived. Each core has an equal share of the CPU.
+	FIFOCoresCPU CPUModel = "fifo_cores"
+)
+
+// CPUConfig is how the requests on a replica share its CPU. With the shared models, a request
+// uses the CPU until its CPU time is done, then waits for its IO time.
+type CPUConfig struct {
+	Model CPUModel `json:"model"`
+	Cores int      `json:"cores,omitempty"`
+}
+
+func (cc CPUConfig) Validate() error {
+	switch cc.Model {
+	case "", ApproximateCPU, ProcessorSharingCPU:
+	case FIFOCoresCPU:
+		if cc.Cores < 1 {
+			return fmt.Errorf("fifo_cores CPU model needs at least 1 core, but has %d", cc.Cores)
+		}
+	default:
+		return fmt.Errorf("unknown CPU model '%s'", cc.Model)
+	}
+
+	return nil
+}
+
+func (cc CPUConfig) shared() bool {
+	return cc.Model == ProcessorSharingCPU || cc.Model == FIFOCoresCPU
+}
+
+type cpuTask struct {
+	request *requestEntity
+	// work is the CPU time the request still needs, in nanoseconds of a whole CPU.
+	work      float64
+	cpuDoneAt time.Time
+	deadline  time.Time
+
+	outcomeKind simulator.MovementKind
+	outcomeAt   time.Time
+}
+
+// sharedCPU keeps track of the CPU time each request on a replica still needs. It is brought up
+// to date whenever requests arrive or leave or the capacity of the replica changes, and from
+// then on predicts when each request will be done, assuming nothing else changes.
+type sharedCPU struct {
+	config    CPUConfig
+	tasks     []*cpuTask
+	updatedAt time.Time
+}
+
+// cpuWorkDone is the work below which a task counts as done, to allow for rounding.
+const cpuWorkDone = 0.5
+
+// rates gives the share of the CPU, in millis per second, of each task still using it.
+func (sc *sharedCPU) rates(tasks []*cpuTask, work []float64, capacityMillisPerSecond float64) []float64 {
+	rates := make([]float64, len(tasks))
+
+	using := 0
+	for i := range tasks {
+		if work[i] > cpuWorkDone {
+			using++
+		}
+	}
+	if using == 0 {
+		return rates
+	}
+
+	share := capacityMillisPerSecond / float64(using)
+	slots := using
+	if sc.config.Model == FIFOCoresCPU {
+		share = capacityMillisPerSecond / float64(sc.config.Cores)
+		slots = sc.config.Cores
+	}
+
+	for i := range tasks {
+		if work[i] > cpuWorkDone && slots > 0 {
+			rates[i] = share
+			slots--
+		}
+	}
+	return rates
+}
+
+// run works the tasks from `from` until `until`, or until all of their work is done, and
+// gives the work left and when each task was done.
+func (sc *sharedCPU) run(from, until time.Time, capacityMillisPerSecond float64) ([]float64, []time.Time) {
+	work := make([]float64, len(sc.tasks))
+	doneAt := make([]time.Time, len(sc.tasks))
+	for i, t := range sc.tasks {
+		work[i] = t.work
+		doneAt[i] = t.cpuDoneAt
+	}
+
+	at := from
+	for at.Before(until) {
+		rates := sc.rates(sc.tasks, work, capacityMillisPerSecond)
+		if !hasRate(rates) {
+			break
+		}
+
+		// step to the next task to finish, or to the end
+		step := float64(until.Sub(at))
+		for i, rate := range rates {
+			if rate > 0 {
+				step = math.Min(step, work[i]*1000/rate)
+			}
+		}
+
+		stepped := time.Duration(math.Ceil(step))
+		at = at.Add(stepped)
+		for i, rate := range rates {
+			if rate == 0 {
+				continue
+			}
+			work[i] -= step * rate / 1000
+			if work[i] <= cpuWorkDone {
+				work[i] = 0
+				doneAt[i] = at
+			}
+		}
+	}
+
+	return work, doneAt
+}
+
+func hasRate(rates []float64) bool {
+	for _, rate := range rates {
+		if rate > 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// advance brings the work left by each task up to now.
+func (sc *sharedCPU) advance(now time.Time, capacityMillisPerSecond float64) {
+	work, doneAt := sc.run(sc.updatedAt, now, capacityMillisPerSecond)
+	for i, t := range sc.tasks {
+		t.work = work[i]
+		t.cpuDoneAt = doneAt[i]
+	}
+	sc.updatedAt = now
+}
+
+// predict gives when each task will be done with the CPU, if nothing changes.
+func (sc *sharedCPU) predict(capacityMillisPerSecond float64) []time.Time {
+	never := sc.updatedAt.Add(time.Duration(math.MaxInt64 / 2))
+	_, doneAt := sc.run(sc.updatedAt, never, capacityMillisPerSecond)
+	return doneAt
+}
+
+func (sc *sharedCPU) add(task *cpuTask) {
+	if task.work <= cpuWorkDone {
+		task.work = 0
+		task.cpuDoneAt = sc.updatedAt
+	}
+	sc.tasks = append(sc.tasks, task)
+}
+
+func (sc *sharedCPU) remove(request *requestEntity) {
+	for i, t := range sc.tasks {
+		if t.request == request {
+			sc.tasks = append(sc.tasks[:i], sc.tasks[i+1:]...)
+			return
+		}
+	}
+}
+
+// utilization is the CPU in use, in millis per second.
+func (sc *sharedCPU) utilization(capacityMillisPerSecond float64) float64 {
+	work := make([]float64, len(sc.tasks))
+	for i, t := range sc.tasks {
+		work[i] = t.work
+	}
+
+	used := 0.0
+	for _, rate := range sc.rates(sc.tasks, work, capacityMillisPerSecond) {
+		used += rate
+	}
+	return used
+}
+
+func newSharedCPU(config CPUConfig, now time.Time) *sharedCPU {
+	return &sharedCPU{config: config, updatedAt: now}
+}
@@ -0,0 +1,193 @@
+/*
+ * Copyright (C) 2019-Present Pivotal Software, Inc. All rights reserved.
+ *
+ * This program and the accompanying materials are made available under the terms
+ * of the Apache License, Version 2.0 (the "License”); you may not use this file
+ * except in compliance with the License. You may obtain a copy of the License at:
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software distributed
+ * under the License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR
+ * CONDITIONS OF ANY KIND, either express or implied. See the License for the
+ * specific language governing permissions and limitations under the License.
+ */
+
+package model
+
+import (
+	"testing"
+	"time"
+
+	"github.com/sclevine/spec"
+	"github.com/sclevine/spec/report"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"skenario/pkg/simulator"
+)
+
+func TestCPUSharing(t *testing.T) {
+	spec.Run(t, "Shared CPU models", testCPUSharing, spec.Report(report.Terminal{}))
+}
+
+func testCPUSharing(t *testing.T, describe spec.G, it spec.S) {
+	var envFake *FakeEnvironment
+	var subject *requestsProcessingStock
+	var failed simulator.SinkStock
+	var totalCPU, occupiedCPU float64
+
+	share := func(config CPUConfig) {
+		subject.cpu = newSharedCPU(config, envFake.TheTime)
+	}
+
+	arrive := func(at time.Duration, config RequestConfig) *requestEntity {
+		envFake.TheTime = time.Unix(0, 0).Add(at)
+		request := NewRequestEntity(envFake, nil, config).(*requestEntity)
+		require.NoError(t, subject.Add(request))
+		return request
+	}
+
+	leave := func(request *requestEntity) {
+		for _, task := range subject.cpu.tasks {
+			if task.request == request {
+				envFake.TheTime = task.outcomeAt
+			}
+		}
+		require.Equal(t, request, subject.take(request))
+	}
+
+	planned := func(request *requestEntity) (simulator.MovementKind, time.Duration) {
+		for _, task := range subject.cpu.tasks {
+			if task.request == request {
+				return task.outcomeKind, task.outcomeAt.Sub(time.Unix(0, 0))
+			}
+		}
+		require.Fail(t, "request is not on the CPU")
+		return "", 0
+	}
+
+	it.Before(func() {
+		envFake = &FakeEnvironment{Movements: make([]simulator.Movement, 0), TheTime: time.Unix(0, 0)}
+		failed = simulator.NewSinkStock("RequestsFailed", "Request")
+		totalCPU, occupiedCPU = 100, 0
+		subject = NewRequestsProcessingStock(envFake, 1, simulator.NewSinkStock("RequestsComplete", "Request"), &failed, &totalCPU, &occupiedCPU).(*requestsProcessingStock)
+	})
+
+	describe("processor sharing", func() {
+		var first, second *requestEntity
+
+		it.Before(func() {
+			share(CPUConfig{Model: ProcessorSharingCPU})
+			first = arrive(0, RequestConfig{CPUTimeMillis: 100, Timeout: 10 * time.Second})
+		})
+
+		it("gives a lone request the whole CPU", func() {
+			kind, at := planned(first)
+			assert.Equal(t, simulator.MovementKind("complete_request"), kind)
+			assert.Equal(t, time.Second, at)
+			assert.Equal(t, 100.0, occupiedCPU)
+		})
+
+		describe("when another request arrives", func() {
+			it.Before(func() {
+				second = arrive(500*time.Millisecond, RequestConfig{CPUTimeMillis: 100, Timeout: 10 * time.Second})
+			})
+
+			it("slows down the first", func() {
+				_, at := planned(first)
+				assert.Equal(t, 1500*time.Millisecond, at)
+				assert.Equal(t, time.Unix(1, 500000000), subject.outcomes[first].(*FakeScheduledMovement).RescheduledTo)
+			})
+
+			it("expects the second to speed up once the first is done", func() {
+				_, at := planned(second)
+				assert.Equal(t, 2*time.Second, at)
+
+				leave(first)
+				_, at = planned(second)
+				assert.Equal(t, 2*time.Second, at)
+			})
+		})
+
+		describe("when a request leaves early", func() {
+			it.Before(func() {
+				second = arrive(0, RequestConfig{CPUTimeMillis: 100, Timeout: 10 * time.Second})
+				envFake.TheTime = time.Unix(1, 0)
+				subject.take(second)
+			})
+
+			it("speeds up the rest", func() {
+				_, at := planned(first)
+				assert.Equal(t, 1500*time.Millisecond, at)
+			})
+		})
+	})
+
+	describe("requests with IO time", func() {
+		it("wait for their IO once they are done with the CPU", func() {
+			share(CPUConfig{Model: ProcessorSharingCPU})
+			request := arrive(0, RequestConfig{CPUTimeMillis: 100, IOTimeMillis: 300, Timeout: 10 * time.Second})
+
+			_, at := planned(request)
+			assert.Equal(t, 1300*time.Millisecond, at)
+		})
+	})
+
+	describe("requests which would take too long", func() {
+		it("fail at their timeout", func() {
+			share(CPUConfig{Model: ProcessorSharingCPU})
+			request := arrive(0, RequestConfig{CPUTimeMillis: 1000, Timeout: 2 * time.Second})
+
+			kind, at := planned(request)
+			assert.Equal(t, simulator.MovementKind("request_failed"), kind)
+			assert.Equal(t, 2*time.Second, at)
+		})
+	})
+
+	describe("FIFO cores", func() {
+		var first, second *requestEntity
+
+		it.Before(func() {
+			share(CPUConfig{Model: FIFOCoresCPU, Cores: 1})
+			first = arrive(0, RequestConfig{CPUTimeMillis: 100, Timeout: 10 * time.Second})
+			second = arrive(0, RequestConfig{CPUTimeMillis: 100, Timeout: 10 * time.Second})
+		})
+
+		it("run requests one after another", func() {
+			_, at := planned(first)
+			assert.Equal(t, time.Second, at)
+			_, at = planned(second)
+			assert.Equal(t, 2*time.Second, at)
+		})
+	})
+
+	describe("changes of CPU capacity", func() {
+		it("slow down requests sharing the CPU", func() {
+			share(CPUConfig{Model: ProcessorSharingCPU})
+			request := arrive(0, RequestConfig{CPUTimeMillis: 100, Timeout: 10 * time.Second})
+
+			envFake.TheTime = time.Unix(0, 500000000)
+			subject.setCPUCapacity(50)
+
+			_, at := planned(request)
+			assert.Equal(t, 1500*time.Millisecond, at)
+		})
+	})
+
+	describe("CPUConfig.Validate()", func() {
+		it("accepts known models", func() {
+			assert.NoError(t, CPUConfig{}.Validate())
+			assert.NoError(t, CPUConfig{Model: ProcessorSharingCPU}.Validate())
+			assert.NoError(t, CPUConfig{Model: FIFOCoresCPU, Cores: 2}.Validate())
+		})
+
+		it("needs cores for fifo_cores", func() {
+			assert.Error(t, CPUConfig{Model: FIFOCoresCPU}.Validate())
+		})
+
+		it("rejects unknown models", func() {
+			assert.Error(t, CPUConfig{Model: "quantum"}.Validate())
+		})
+	})
+}
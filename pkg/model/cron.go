@@ -0,0 +1,196 @@
+/*
+ * Copyright (C) 2019-Present Pivotal Software, Inc. All rights reserved.
+ *
+ * This program and the accompanying materials are made available under the terms
+ * of the Apache License, Version 2.0 (the "License”); you may not use this file
+ * except in compliance with the License. You may obtain a copy of the License at:
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software distributed
+ * under the License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR
+ * CONDITIONS OF ANY KIND, either express or implied. See the License for the
+ * specific language governing permissions and limitations under the License.
+ */
+
+package model
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// CronSchedule is when something recurs, given as a cron expression. Times are read on the
+// simulated clock in UTC.
+type CronSchedule struct {
+	// every is set for "@every" schedules, which recur at a fixed interval instead.
+	every time.Duration
+
+	minute, hour, dayOfMonth, month, dayOfWeek uint64
+	// when both days are restricted, either may match, as in cron
+	anyDayOfMonth, anyDayOfWeek bool
+}
+
+var cronMacros = map[string]string{
+	"@hourly":   "0 * * * *",
+	"@daily":    "0 0 * * *",
+	"@midnight": "0 0 * * *",
+	"@weekly":   "0 0 * * 0",
+	"@monthly":  "0 0 1 * *",
+	"@yearly":   "0 0 1 1 *",
+	"@annually": "0 0 1 1 *",
+}
+
+// cronSearchLimit is how far ahead Next() looks before deciding a schedule never recurs.
+const cronSearchLimit = 5 * 366 * 24 * time.Hour
+
+// ParseCron parses a cron expression of five fields: minute, hour, day of month, month and day
+// of week. Fields may be '*', numbers, ranges such as '1-5', steps such as '*/15' or '0-30/10',
+// and lists of these separated by commas. The macros '@hourly', '@daily', '@weekly',
+// '@monthly' and '@yearly' are understood, as is '@every <duration>', such as '@every 90s'.
+func ParseCron(spec string) (*CronSchedule, error) {
+	spec = strings.TrimSpace(spec)
+
+	if strings.HasPrefix(spec, "@every ") {
+		every, err := time.ParseDuration(strings.TrimSpace(strings.TrimPrefix(spec, "@every ")))
+		if err != nil {
+			return nil, fmt.Errorf("could not parse cron '%s': %s", spec, err.Error())
+		}
+		if every <= 0 {
+			return nil, fmt.Errorf("could not parse cron '%s': the interval must be greater than zero", spec)
+		}
+		return &CronSchedule{every: every}, nil
+	}
+	if macro, ok := cronMacros[spec]; ok {
+		spec = macro
+	}
+
+	fields := strings.Fields(spec)
+	if len(fields) != 5 {
+		return nil, fmt.Errorf("could not parse cron '%s': expected 5 fields but there were %d", spec, len(fields))
+	}
+
+	cs := &CronSchedule{
+		anyDayOfMonth: fields[2] == "*",
+		anyDayOfWeek:  fields[4] == "*",
+	}
+	bounds := []struct {
+		into     *uint64
+		min, max int
+		name     string
+	}{
+		{&cs.minute, 0, 59, "minute"},
+		{&cs.hour, 0, 23, "hour"},
+		{&cs.dayOfMonth, 1, 31, "day of month"},
+		{&cs.month, 1, 12, "month"},
+		{&cs.dayOfWeek, 0, 7, "day of week"},
+	}
+	for i, b := range bounds {
+		bits, err := parseCronField(fields[i], b.min, b.max)
+		if err != nil {
+			return nil, fmt.Errorf("could not parse cron '%s': %s %s", spec, b.name, err.Error())
+		}
+		*b.into = bits
+	}
+
+	// Sunday is both 0 and 7
+	if cs.dayOfWeek&(1<<7) != 0 {
+		cs.dayOfWeek |= 1
+	}
+
+	return cs, nil
+}
+
+func parseCronField(field string, min, max int) (uint64, error) {
+	var bits uint64
+	for _, part := range strings.Split(field, ",") {
+		rng, step := part, 1
+		if i := strings.Index(part, "/"); i >= 0 {
+			var err error
+			rng = part[:i]
+			step, err = strconv.Atoi(part[i+1:])
+			if err != nil || step <= 0 {
+				return 0, fmt.Errorf("'%s' has a bad step", part)
+			}
+		}
+
+		from, to := min, max
+		if rng != "*" {
+			var err error
+			bounds := strings.SplitN(rng, "-", 2)
+			from, err = strconv.Atoi(bounds[0])
+			if err != nil {
+				return 0, fmt.Errorf("'%s' is not a number or range", part)
+			}
+			to = from
+			if len(bounds) == 2 {
+				to, err = strconv.Atoi(bounds[1])
+				if err != nil {
+					return 0, fmt.Errorf("'%s' is not a number or range", part)
+				}
+			} else if step > 1 {
+				// '5/15' means from 5 onwards
+				to = max
+			}
+		}
+		if from < min || to > max || from > to {
+			return 0, fmt.Errorf("'%s' is not between %d and %d", part, min, max)
+		}
+
+		for v := from; v <= to; v += step {
+			bits |= 1 << uint(v)
+		}
+	}
+
+	return bits, nil
+}
+
+// Next is the first time the schedule comes round after t, or the zero time if it does not
+// within the next five years. Schedules made with '@every' count their intervals from t.
+func (cs *CronSchedule) Next(t time.Time) time.Time {
+	if cs.every > 0 {
+		return t.Add(cs.every)
+	}
+
+	limit := t.Add(cronSearchLimit)
+	next := t.UTC().Truncate(time.Minute).Add(time.Minute)
+
+	for next.Before(limit) {
+		if !cs.matchesDay(next) {
+			next = time.Date(next.Year(), next.Month(), next.Day()+1, 0, 0, 0, 0, time.UTC)
+			continue
+		}
+		if cs.hour&(1<<uint(next.Hour())) == 0 {
+			next = next.Truncate(time.Hour).Add(time.Hour)
+			continue
+		}
+		if cs.minute&(1<<uint(next.Minute())) == 0 {
+			next = next.Add(time.Minute)
+			continue
+		}
+		return next.In(t.Location())
+	}
+
+	return time.Time{}
+}
+
+func (cs *CronSchedule) matchesDay(t time.Time) bool {
+	if cs.month&(1<<uint(t.Month())) == 0 {
+		return false
+	}
+
+	dayOfMonth := cs.dayOfMonth&(1<<uint(t.Day())) != 0
+	dayOfWeek := cs.dayOfWeek&(1<<uint(t.Weekday())) != 0
+	switch {
+	case cs.anyDayOfMonth && cs.anyDayOfWeek:
+		return true
+	case cs.anyDayOfMonth:
+		return dayOfWeek
+	case cs.anyDayOfWeek:
+		return dayOfMonth
+	default:
+		return dayOfMonth || dayOfWeek
+	}
+}
@@ -0,0 +1,77 @@
+/*
+ * Copyright (C) 2019-Present Pivotal Software, Inc. All rights reserved.
+ *
+ * This program and the accompanying materials are made available under the terms
+ * of the Apache License, Version 2.0 (the "License”); you may not use this file
+ * except in compliance with the License. You may obtain a copy of the License at:
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software distributed
+ * under the License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR
+ * CONDITIONS OF ANY KIND, either express or implied. See the License for the
+ * specific language governing permissions and limitations under the License.
+ */
+
+package model
+
+import (
+	"testing"
+	"time"
+
+	"github.com/sclevine/spec"
+	"github.com/sclevine/spec/report"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCron(t *testing.T) {
+	spec.Run(t, "Cron", testCron, spec.Report(report.Terminal{}))
+}
+
+func testCron(t *testing.T, describe spec.G, it spec.S) {
+	// the simulated clock starts on Thursday the 1st of January 1970
+	at := func(day, hour, minute int) time.Time {
+		return time.Date(1970, time.January, day, hour, minute, 0, 0, time.UTC)
+	}
+
+	next := func(spec string, after time.Time) time.Time {
+		cron, err := ParseCron(spec)
+		require.NoError(t, err)
+		return cron.Next(after)
+	}
+
+	describe("Next()", func() {
+		it("comes round on the next matching minute", func() {
+			assert.Equal(t, at(1, 0, 15), next("*/15 * * * *", at(1, 0, 7)))
+			assert.Equal(t, at(1, 0, 30), next("*/15 * * * *", at(1, 0, 15)))
+		})
+
+		it("skips hours and days which do not match", func() {
+			assert.Equal(t, at(1, 9, 0), next("0 9 * * 1-5", at(1, 0, 0)))
+			assert.Equal(t, at(5, 9, 0), next("0 9 * * 1-5", at(2, 10, 0)))
+		})
+
+		it("matches either day when both are restricted", func() {
+			assert.Equal(t, at(2, 0, 0), next("0 0 13 * 5", at(1, 0, 0)))
+		})
+
+		it("understands macros", func() {
+			assert.Equal(t, at(1, 1, 0), next("@hourly", at(1, 0, 0)))
+			assert.Equal(t, at(1, 0, 1).Add(30*time.Second), next("@every 90s", at(1, 0, 0)))
+		})
+
+		it("gives the zero time for schedules which never come round", func() {
+			assert.True(t, next("0 0 31 2 *", at(1, 0, 0)).IsZero())
+		})
+	})
+
+	describe("ParseCron()", func() {
+		it("rejects malformed expressions", func() {
+			for _, spec := range []string{"* * * *", "60 * * * *", "*/0 * * * *", "5-1 * * * *", "a * * * *", "@every -1s", "@every soon"} {
+				_, err := ParseCron(spec)
+				assert.Error(t, err, spec)
+			}
+		})
+	})
+}
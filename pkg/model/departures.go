@@ -0,0 +1,121 @@
+/*
+ * Copyright (C) 2019-Present Pivotal Software, Inc. All rights reserved.
+ *
+ * This program and the accompanying materials are made available under the terms
+ * of the Apache License, Version 2.0 (the "License”); you may not use this file
+ * except in compliance with the License. You may obtain a copy of the License at:
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software distributed
+ * under the License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR
+ * CONDITIONS OF ANY KIND, either express or implied. See the License for the
+ * specific language governing permissions and limitations under the License.
+ */
+
+package model
+
+import (
+	"fmt"
+
+	"skenario/pkg/simulator"
+)
+
+// entityStock is a ThroughStock from which a particular entity can be taken, for stocks whose
+// entities each leave at their own time rather than in the order they arrived.
+type entityStock struct {
+	name     simulator.StockName
+	kind     simulator.EntityKind
+	entities []*simulator.Entity
+}
+
+func (es *entityStock) Name() simulator.StockName {
+	return es.name
+}
+
+func (es *entityStock) KindStocked() simulator.EntityKind {
+	return es.kind
+}
+
+func (es *entityStock) Count() uint64 {
+	return uint64(len(es.entities))
+}
+
+func (es *entityStock) EntitiesInStock() []*simulator.Entity {
+	return es.entities
+}
+
+func (es *entityStock) Add(entity simulator.Entity) error {
+	if entity == nil {
+		return fmt.Errorf("could not add Entity, as it was nil")
+	}
+
+	if entity.Kind() != es.kind {
+		return fmt.Errorf("stock '%s' could not stock entity '%s'; stock accepts '%s' but kind is '%s'", es.name, entity.Name(), es.kind, entity.Kind())
+	}
+
+	es.entities = append(es.entities, &entity)
+	return nil
+}
+
+func (es *entityStock) Remove() simulator.Entity {
+	if len(es.entities) == 0 {
+		return nil
+	}
+
+	var e *simulator.Entity
+	e, es.entities = es.entities[0], es.entities[1:]
+	return *e
+}
+
+// take removes the given entity, or returns nil if it is not in stock.
+func (es *entityStock) take(entity simulator.Entity) simulator.Entity {
+	for i, e := range es.entities {
+		if *e == entity {
+			es.entities = append(es.entities[:i:i], es.entities[i+1:]...)
+			return entity
+		}
+	}
+
+	return nil
+}
+
+func newEntityStock(name simulator.StockName, kind simulator.EntityKind) *entityStock {
+	return &entityStock{name: name, kind: kind}
+}
+
+type takingStock interface {
+	simulator.ThroughStock
+	take(entity simulator.Entity) simulator.Entity
+}
+
+// departure is the source of a movement scheduled for one particular entity. It stands in for
+// the stock holding the entity, but gives up that entity rather than whichever is next in line.
+type departure struct {
+	from   takingStock
+	entity simulator.Entity
+}
+
+func (d *departure) Name() simulator.StockName {
+	return d.from.Name()
+}
+
+func (d *departure) KindStocked() simulator.EntityKind {
+	return d.from.KindStocked()
+}
+
+func (d *departure) Count() uint64 {
+	return d.from.Count()
+}
+
+func (d *departure) EntitiesInStock() []*simulator.Entity {
+	return d.from.EntitiesInStock()
+}
+
+func (d *departure) Remove() simulator.Entity {
+	return d.from.take(d.entity)
+}
+
+func departureOf(from takingStock, entity simulator.Entity) simulator.SourceStock {
+	return &departure{from: from, entity: entity}
+}
@@ -0,0 +1,98 @@
+/*
+ * Copyright (C) 2019-Present Pivotal Software, Inc. All rights reserved.
+ *
+ * This program and the accompanying materials are made available under the terms
+ * of the Apache License, Version 2.0 (the "License”); you may not use this file
+ * except in compliance with the License. You may obtain a copy of the License at:
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software distributed
+ * under the License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR
+ * CONDITIONS OF ANY KIND, either express or implied. See the License for the
+ * specific language governing permissions and limitations under the License.
+ */
+
+package distributions
+
+import (
+	"fmt"
+	"time"
+)
+
+// Config describes a Distribution in a run request. Durations are in nanoseconds.
+//
+//	{"type": "constant", "value": 1000000000}
+//	{"type": "exponential", "mean": 1000000000}
+//	{"type": "normal", "mean": 1000000000, "stddev": 200000000}
+//	{"type": "lognormal", "mean": 1000000000, "stddev": 200000000}
+//	{"type": "gamma", "mean": 1000000000, "stddev": 200000000}
+//	{"type": "empirical", "buckets": [{"up_to": 1000000000, "weight": 3}, ...]}
+//	{"type": "empirical", "file": "histogram.csv"}
+//	{"type": "bimodal", "components": [{"weight": 9, "type": "constant", ...}, {"weight": 1, ...}]}
+//
+// A bimodal distribution has two components; a "mixture" may have any number.
+type Config struct {
+	Type       string            `json:"type"`
+	Value      time.Duration     `json:"value,omitempty"`
+	Mean       time.Duration     `json:"mean,omitempty"`
+	StdDev     time.Duration     `json:"stddev,omitempty"`
+	Buckets    []Bucket          `json:"buckets,omitempty"`
+	File       string            `json:"file,omitempty"`
+	Components []ComponentConfig `json:"components,omitempty"`
+}
+
+// ComponentConfig is one of the distributions making up a bimodal distribution or mixture.
+type ComponentConfig struct {
+	Weight float64 `json:"weight"`
+	Config
+}
+
+func New(config Config) (Distribution, error) {
+	if config.Value < 0 || config.Mean < 0 || config.StdDev < 0 {
+		return nil, fmt.Errorf("%s distribution has a negative duration", config.Type)
+	}
+
+	switch config.Type {
+	case "constant", "":
+		return NewConstant(config.Value), nil
+	case "exponential":
+		return NewExponential(config.Mean), nil
+	case "normal":
+		return NewNormal(config.Mean, config.StdDev), nil
+	case "lognormal":
+		if config.Mean == 0 {
+			return nil, fmt.Errorf("lognormal distribution needs a mean greater than zero")
+		}
+		return NewLogNormal(config.Mean, config.StdDev), nil
+	case "gamma":
+		if config.Mean == 0 || config.StdDev == 0 {
+			return nil, fmt.Errorf("gamma distribution needs a mean and stddev greater than zero")
+		}
+		return NewGamma(config.Mean, config.StdDev), nil
+	case "empirical":
+		if config.File == "" {
+			return NewEmpirical(config.Buckets)
+		}
+		buckets, err := ReadHistogram(config.File)
+		if err != nil {
+			return nil, fmt.Errorf("could not read histogram: %s", err.Error())
+		}
+		return NewEmpirical(buckets)
+	case "bimodal", "mixture":
+		if config.Type == "bimodal" && len(config.Components) != 2 {
+			return nil, fmt.Errorf("bimodal distribution needs 2 components, but has %d", len(config.Components))
+		}
+		components := make([]Component, 0, len(config.Components))
+		for _, cc := range config.Components {
+			d, err := New(cc.Config)
+			if err != nil {
+				return nil, err
+			}
+			components = append(components, Component{Weight: cc.Weight, Distribution: d})
+		}
+		return NewMixture(components)
+	default:
+		return nil, fmt.Errorf("unknown distribution type '%s'", config.Type)
+	}
+}
@@ -0,0 +1,331 @@
+/*
+ * Copyright (C) 2019-Present Pivotal Software, Inc. All rights reserved.
+ *
+ * This program and the accompanying materials are made available under the terms
+ * of the Apache License, Version 2.0 (the "License”); you may not use this file
+ * except in compliance with the License. You may obtain a copy of the License at:
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software distributed
+ * under the License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR
+ * CONDITIONS OF ANY KIND, either express or implied. See the License for the
+ * specific language governing permissions and limitations under the License.
+ */
+
+package distributions
+
+import (
+	"fmt"
+	"math"
+	"math/rand"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Distribution gives durations which vary from one sample to the next. Samples are never negative.
+type Distribution interface {
+	Sample(rng *rand.Rand) time.Duration
+	Mean() time.Duration
+	String() string
+}
+
+type constant struct {
+	value time.Duration
+}
+
+func (c *constant) Sample(*rand.Rand) time.Duration {
+	return c.value
+}
+
+func (c *constant) Mean() time.Duration {
+	return c.value
+}
+
+func (c *constant) String() string {
+	return c.value.String()
+}
+
+func NewConstant(value time.Duration) Distribution {
+	if value < 0 {
+		value = 0
+	}
+	return &constant{value: value}
+}
+
+// normal is truncated at zero, so its samples have a slightly higher mean than configured when
+// the standard deviation is large compared to the mean.
+type normal struct {
+	mean   time.Duration
+	stdDev time.Duration
+}
+
+func (n *normal) Sample(rng *rand.Rand) time.Duration {
+	sample := time.Duration(rng.NormFloat64()*float64(n.stdDev)) + n.mean
+	if sample < 0 {
+		return 0
+	}
+	return sample
+}
+
+func (n *normal) Mean() time.Duration {
+	return n.mean
+}
+
+func (n *normal) String() string {
+	return fmt.Sprintf("normal(mean %s, stddev %s)", n.mean, n.stdDev)
+}
+
+func NewNormal(mean, stdDev time.Duration) Distribution {
+	return &normal{mean: mean, stdDev: stdDev}
+}
+
+// logNormal is configured by the mean and standard deviation of its samples, rather than of
+// their logarithms, as those are what gets measured.
+type logNormal struct {
+	mean   time.Duration
+	stdDev time.Duration
+	mu     float64
+	sigma  float64
+}
+
+func (ln *logNormal) Sample(rng *rand.Rand) time.Duration {
+	return time.Duration(math.Exp(ln.mu + ln.sigma*rng.NormFloat64()))
+}
+
+func (ln *logNormal) Mean() time.Duration {
+	return ln.mean
+}
+
+func (ln *logNormal) String() string {
+	return fmt.Sprintf("lognormal(mean %s, stddev %s)", ln.mean, ln.stdDev)
+}
+
+func NewLogNormal(mean, stdDev time.Duration) Distribution {
+	if mean <= 0 {
+		return NewConstant(0)
+	}
+
+	m := float64(mean)
+	variance := math.Log(1 + float64(stdDev)*float64(stdDev)/(m*m))
+
+	return &logNormal{
+		mean:   mean,
+		stdDev: stdDev,
+		mu:     math.Log(m) - variance/2,
+		sigma:  math.Sqrt(variance),
+	}
+}
+
+// Bucket is one bar of a histogram, covering the durations from the previous bucket's UpTo
+// (or zero, for the first bucket) up to its own.
+type Bucket struct {
+	UpTo   time.Duration `json:"up_to"`
+	Weight float64       `json:"weight"`
+}
+
+// empirical samples a histogram of observed durations. A bucket is picked in proportion to its
+// weight, then a duration is picked uniformly from within it.
+type empirical struct {
+	buckets     []Bucket
+	cumulative  []float64
+	totalWeight float64
+}
+
+func (e *empirical) Sample(rng *rand.Rand) time.Duration {
+	target := rng.Float64() * e.totalWeight
+	i := sort.Search(len(e.cumulative), func(i int) bool { return e.cumulative[i] > target })
+	if i == len(e.buckets) {
+		i--
+	}
+
+	from := time.Duration(0)
+	if i > 0 {
+		from = e.buckets[i-1].UpTo
+	}
+	width := e.buckets[i].UpTo - from
+	if width <= 0 {
+		return from
+	}
+
+	return from + time.Duration(rng.Int63n(int64(width)))
+}
+
+func (e *empirical) Mean() time.Duration {
+	mean := 0.0
+	from := time.Duration(0)
+	for _, b := range e.buckets {
+		mean += float64(from+b.UpTo) / 2 * b.Weight / e.totalWeight
+		from = b.UpTo
+	}
+	return time.Duration(mean)
+}
+
+func (e *empirical) String() string {
+	return fmt.Sprintf("empirical(%d buckets, mean %s)", len(e.buckets), e.Mean())
+}
+
+func NewEmpirical(buckets []Bucket) (Distribution, error) {
+	if len(buckets) == 0 {
+		return nil, fmt.Errorf("an empirical distribution needs at least one bucket")
+	}
+
+	e := &empirical{buckets: buckets}
+	from := time.Duration(0)
+	for i, b := range buckets {
+		if b.UpTo < from {
+			return nil, fmt.Errorf("bucket %d ends at %s, before the previous bucket", i, b.UpTo)
+		}
+		if b.Weight < 0 {
+			return nil, fmt.Errorf("bucket %d has a negative weight", i)
+		}
+
+		e.totalWeight += b.Weight
+		e.cumulative = append(e.cumulative, e.totalWeight)
+		from = b.UpTo
+	}
+
+	if e.totalWeight <= 0 {
+		return nil, fmt.Errorf("an empirical distribution needs a bucket with some weight")
+	}
+
+	return e, nil
+}
+
+type exponential struct {
+	mean time.Duration
+}
+
+func (e *exponential) Sample(rng *rand.Rand) time.Duration {
+	return time.Duration(rng.ExpFloat64() * float64(e.mean))
+}
+
+func (e *exponential) Mean() time.Duration {
+	return e.mean
+}
+
+func (e *exponential) String() string {
+	return fmt.Sprintf("exponential(mean %s)", e.mean)
+}
+
+func NewExponential(mean time.Duration) Distribution {
+	return &exponential{mean: mean}
+}
+
+// gamma is configured by the mean and standard deviation of its samples, from which its shape
+// and scale are worked out. It is sampled with the method of Marsaglia and Tsang.
+type gamma struct {
+	mean   time.Duration
+	stdDev time.Duration
+	shape  float64
+	scale  float64
+}
+
+func (g *gamma) Sample(rng *rand.Rand) time.Duration {
+	return time.Duration(sampleGamma(rng, g.shape) * g.scale)
+}
+
+func sampleGamma(rng *rand.Rand, shape float64) float64 {
+	if shape < 1 {
+		// boost the shape above 1, then scale the sample back down
+		return sampleGamma(rng, shape+1) * math.Pow(rng.Float64(), 1/shape)
+	}
+
+	d := shape - 1.0/3
+	c := 1 / math.Sqrt(9*d)
+	for {
+		x := rng.NormFloat64()
+		v := 1 + c*x
+		if v <= 0 {
+			continue
+		}
+		v = v * v * v
+		u := rng.Float64()
+		if u < 1-0.0331*x*x*x*x || math.Log(u) < x*x/2+d*(1-v+math.Log(v)) {
+			return d * v
+		}
+	}
+}
+
+func (g *gamma) Mean() time.Duration {
+	return g.mean
+}
+
+func (g *gamma) String() string {
+	return fmt.Sprintf("gamma(mean %s, stddev %s)", g.mean, g.stdDev)
+}
+
+func NewGamma(mean, stdDev time.Duration) Distribution {
+	if mean <= 0 || stdDev <= 0 {
+		return NewConstant(mean)
+	}
+
+	m, s := float64(mean), float64(stdDev)
+	return &gamma{
+		mean:   mean,
+		stdDev: stdDev,
+		shape:  m * m / (s * s),
+		scale:  s * s / m,
+	}
+}
+
+// Component is one of the distributions making up a mixture, picked in proportion to its weight.
+type Component struct {
+	Weight       float64
+	Distribution Distribution
+}
+
+// mixture samples one of several distributions, such as the fast and slow paths of a service
+// with a cache.
+type mixture struct {
+	components  []Component
+	totalWeight float64
+}
+
+func (m *mixture) Sample(rng *rand.Rand) time.Duration {
+	pick := rng.Float64() * m.totalWeight
+	for _, c := range m.components {
+		pick -= c.Weight
+		if pick < 0 {
+			return c.Distribution.Sample(rng)
+		}
+	}
+	return m.components[len(m.components)-1].Distribution.Sample(rng)
+}
+
+func (m *mixture) Mean() time.Duration {
+	mean := 0.0
+	for _, c := range m.components {
+		mean += float64(c.Distribution.Mean()) * c.Weight / m.totalWeight
+	}
+	return time.Duration(mean)
+}
+
+func (m *mixture) String() string {
+	parts := make([]string, 0, len(m.components))
+	for _, c := range m.components {
+		parts = append(parts, fmt.Sprintf("%g×%s", c.Weight/m.totalWeight, c.Distribution))
+	}
+	return fmt.Sprintf("mixture(%s)", strings.Join(parts, ", "))
+}
+
+func NewMixture(components []Component) (Distribution, error) {
+	if len(components) == 0 {
+		return nil, fmt.Errorf("a mixture needs at least one component")
+	}
+
+	m := &mixture{components: components}
+	for i, c := range components {
+		if c.Weight < 0 {
+			return nil, fmt.Errorf("component %d has a negative weight", i)
+		}
+		m.totalWeight += c.Weight
+	}
+
+	if m.totalWeight <= 0 {
+		return nil, fmt.Errorf("a mixture needs a component with some weight")
+	}
+
+	return m, nil
+}
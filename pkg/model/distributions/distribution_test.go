@@ -0,0 +1,205 @@
+/*
+ * Copyright (C) 2019-Present Pivotal Software, Inc. All rights reserved.
+ *
+ * This program and the accompanying materials are made available under the terms
+ * of the Apache License, Version 2.0 (the "License”); you may not use this file
+ * except in compliance with the License. You may obtain a copy of the License at:
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software distributed
+ * under the License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR
+ * CONDITIONS OF ANY KIND, either express or implied. See the License for the
+ * specific language governing permissions and limitations under the License.
+ */
+
+package distributions
+
+import (
+	"math/rand"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/sclevine/spec"
+	"github.com/sclevine/spec/report"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDistributions(t *testing.T) {
+	spec.Run(t, "Distributions", testDistributions, spec.Report(report.Terminal{}))
+}
+
+func testDistributions(t *testing.T, describe spec.G, it spec.S) {
+	var rng *rand.Rand
+
+	sampleMean := func(d Distribution, n int) (mean, min, max time.Duration) {
+		total := 0.0
+		min = time.Duration(1<<63 - 1)
+		for i := 0; i < n; i++ {
+			s := d.Sample(rng)
+			total += float64(s)
+			if s < min {
+				min = s
+			}
+			if s > max {
+				max = s
+			}
+		}
+		return time.Duration(total / float64(n)), min, max
+	}
+
+	it.Before(func() {
+		rng = rand.New(rand.NewSource(1))
+	})
+
+	describe("NewConstant()", func() {
+		it("always gives the same duration", func() {
+			d := NewConstant(3 * time.Second)
+			assert.Equal(t, 3*time.Second, d.Sample(rng))
+			assert.Equal(t, 3*time.Second, d.Sample(rng))
+			assert.Equal(t, 3*time.Second, d.Mean())
+		})
+	})
+
+	describe("NewNormal()", func() {
+		it("gives samples around the mean", func() {
+			mean, _, _ := sampleMean(NewNormal(10*time.Second, time.Second), 10000)
+			assert.InDelta(t, float64(10*time.Second), float64(mean), float64(50*time.Millisecond))
+		})
+
+		it("never gives negative samples", func() {
+			_, min, _ := sampleMean(NewNormal(time.Second, 5*time.Second), 1000)
+			assert.True(t, min >= 0)
+		})
+	})
+
+	describe("NewLogNormal()", func() {
+		it("gives samples with the configured mean", func() {
+			mean, min, _ := sampleMean(NewLogNormal(10*time.Second, 5*time.Second), 20000)
+			assert.InDelta(t, float64(10*time.Second), float64(mean), float64(200*time.Millisecond))
+			assert.True(t, min > 0)
+		})
+	})
+
+	describe("NewExponential()", func() {
+		it("gives samples with the configured mean", func() {
+			mean, min, _ := sampleMean(NewExponential(time.Second), 20000)
+			assert.InDelta(t, float64(time.Second), float64(mean), float64(30*time.Millisecond))
+			assert.True(t, min >= 0)
+		})
+	})
+
+	describe("NewGamma()", func() {
+		it("gives samples with the configured mean", func() {
+			mean, min, _ := sampleMean(NewGamma(time.Second, 2*time.Second), 20000)
+			assert.InDelta(t, float64(time.Second), float64(mean), float64(60*time.Millisecond))
+			assert.True(t, min >= 0)
+		})
+
+		it("handles shapes above 1", func() {
+			mean, _, _ := sampleMean(NewGamma(time.Second, 100*time.Millisecond), 20000)
+			assert.InDelta(t, float64(time.Second), float64(mean), float64(10*time.Millisecond))
+		})
+	})
+
+	describe("NewMixture()", func() {
+		it("samples each component in proportion to its weight", func() {
+			d, err := NewMixture([]Component{
+				{Weight: 3, Distribution: NewConstant(time.Millisecond)},
+				{Weight: 1, Distribution: NewConstant(time.Second)},
+			})
+			require.NoError(t, err)
+
+			slow := 0
+			for i := 0; i < 10000; i++ {
+				if d.Sample(rng) == time.Second {
+					slow++
+				}
+			}
+			assert.InDelta(t, 2500, slow, 150)
+			assert.Equal(t, 250750*time.Microsecond, d.Mean())
+		})
+
+		it("rejects mixtures without weight", func() {
+			_, err := NewMixture([]Component{{Distribution: NewConstant(time.Second)}})
+			assert.Error(t, err)
+		})
+	})
+
+	describe("NewEmpirical()", func() {
+		it("gives samples from the weighted buckets", func() {
+			d, err := NewEmpirical([]Bucket{
+				{UpTo: time.Second, Weight: 0},
+				{UpTo: 2 * time.Second, Weight: 1},
+				{UpTo: 4 * time.Second, Weight: 1},
+			})
+			require.NoError(t, err)
+
+			mean, min, max := sampleMean(d, 10000)
+			assert.True(t, min >= time.Second)
+			assert.True(t, max < 4*time.Second)
+			assert.InDelta(t, float64(2250*time.Millisecond), float64(mean), float64(50*time.Millisecond))
+			assert.Equal(t, 2250*time.Millisecond, d.Mean())
+		})
+
+		it("rejects buckets out of order", func() {
+			_, err := NewEmpirical([]Bucket{{UpTo: 2 * time.Second, Weight: 1}, {UpTo: time.Second, Weight: 1}})
+			assert.Error(t, err)
+		})
+
+		it("rejects histograms without weight", func() {
+			_, err := NewEmpirical([]Bucket{{UpTo: time.Second}})
+			assert.Error(t, err)
+		})
+	})
+
+	describe("New()", func() {
+		it("builds the configured type", func() {
+			d, err := New(Config{Type: "lognormal", Mean: time.Second, StdDev: time.Second})
+			require.NoError(t, err)
+			assert.Equal(t, "lognormal(mean 1s, stddev 1s)", d.String())
+		})
+
+		it("treats a missing type as constant", func() {
+			d, err := New(Config{Value: time.Second})
+			require.NoError(t, err)
+			assert.Equal(t, time.Second, d.Mean())
+		})
+
+		it("rejects unknown types", func() {
+			_, err := New(Config{Type: "pareto"})
+			assert.Error(t, err)
+		})
+
+		it("builds bimodal distributions from two components", func() {
+			d, err := New(Config{Type: "bimodal", Components: []ComponentConfig{
+				{Weight: 1, Config: Config{Value: time.Millisecond}},
+				{Weight: 1, Config: Config{Type: "exponential", Mean: time.Second}},
+			}})
+			require.NoError(t, err)
+			assert.Equal(t, 500500*time.Microsecond, d.Mean())
+
+			_, err = New(Config{Type: "bimodal", Components: []ComponentConfig{{Weight: 1}}})
+			assert.Error(t, err)
+		})
+	})
+
+	describe("parseHistogram()", func() {
+		it("reads buckets with an optional header", func() {
+			buckets, err := parseHistogram(strings.NewReader("up_to,weight\n10ms,120\n50ms, 45\n250000000,3\n"))
+			require.NoError(t, err)
+			assert.Equal(t, []Bucket{
+				{UpTo: 10 * time.Millisecond, Weight: 120},
+				{UpTo: 50 * time.Millisecond, Weight: 45},
+				{UpTo: 250 * time.Millisecond, Weight: 3},
+			}, buckets)
+		})
+
+		it("rejects rows it cannot read", func() {
+			_, err := parseHistogram(strings.NewReader("soon,1\n"))
+			assert.Error(t, err)
+		})
+	})
+}
@@ -0,0 +1,84 @@
+/*
+ * Copyright (C) 2019-Present Pivotal Software, Inc. All rights reserved.
+ *
+ * This program and the accompanying materials are made available under the terms
+ * of the Apache License, Version 2.0 (the "License”); you may not use this file
+ * except in compliance with the License. You may obtain a copy of the License at:
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software distributed
+ * under the License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR
+ * CONDITIONS OF ANY KIND, either express or implied. See the License for the
+ * specific language governing permissions and limitations under the License.
+ */
+
+package distributions
+
+import (
+	"encoding/csv"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ReadHistogram reads the buckets of an empirical distribution from a CSV file with a row for
+// each bucket, giving where it ends and its weight:
+//
+//	up_to,weight
+//	10ms,120
+//	50ms,45
+//	250ms,3
+//
+// Ends are durations, or plain numbers of nanoseconds. The header row is optional.
+func ReadHistogram(path string) ([]Bucket, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	return parseHistogram(file)
+}
+
+func parseHistogram(r io.Reader) ([]Bucket, error) {
+	reader := csv.NewReader(r)
+	reader.FieldsPerRecord = 2
+	reader.TrimLeadingSpace = true
+
+	records, err := reader.ReadAll()
+	if err != nil {
+		return nil, err
+	}
+
+	buckets := make([]Bucket, 0, len(records))
+	for i, record := range records {
+		if i == 0 && strings.TrimSpace(record[0]) == "up_to" {
+			continue
+		}
+
+		upTo, err := parseDuration(record[0])
+		if err != nil {
+			return nil, fmt.Errorf("row %d: %s", i+1, err.Error())
+		}
+		weight, err := strconv.ParseFloat(strings.TrimSpace(record[1]), 64)
+		if err != nil {
+			return nil, fmt.Errorf("row %d: %s", i+1, err.Error())
+		}
+
+		buckets = append(buckets, Bucket{UpTo: upTo, Weight: weight})
+	}
+
+	return buckets, nil
+}
+
+func parseDuration(s string) (time.Duration, error) {
+	s = strings.TrimSpace(s)
+	if nanos, err := strconv.ParseInt(s, 10, 64); err == nil {
+		return time.Duration(nanos), nil
+	}
+	return time.ParseDuration(s)
+}
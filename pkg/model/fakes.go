@@ -17,8 +17,10 @@ package model
 
 import (
 	"context"
+	"math/rand"
 	"time"
 
+	"github.com/josephburnett/sk-plugin/pkg/skplug/proto"
 	"github.com/knative/serving/pkg/autoscaler"
 
 	"skenario/pkg/plugin"
@@ -30,6 +32,8 @@ type FakeEnvironment struct {
 	TheTime            time.Time
 	TheHaltTime        time.Time
 	TheCPUUtilizations []*simulator.CPUUtilization
+	TheInvariants      []simulator.Invariant
+	TheRand            *rand.Rand
 }
 
 func (fe *FakeEnvironment) Plugin() *plugin.PluginPartition {
@@ -41,6 +45,11 @@ func (fe *FakeEnvironment) AddToSchedule(movement simulator.Movement) (added boo
 	return true
 }
 
+func (fe *FakeEnvironment) ScheduleMovement(movement simulator.Movement) (scheduled simulator.ScheduledMovement, added bool) {
+	fe.Movements = append(fe.Movements, movement)
+	return &FakeScheduledMovement{TheMovement: movement, Pending: true}, true
+}
+
 func (fe *FakeEnvironment) Run() (completed []simulator.CompletedMovement, ignored []simulator.IgnoredMovement, err error) {
 	return nil, nil, nil
 }
@@ -65,6 +74,55 @@ func (fe *FakeEnvironment) AppendCPUUtilization(cpu *simulator.CPUUtilization) {
 	fe.TheCPUUtilizations = append(fe.TheCPUUtilizations, cpu)
 }
 
+func (fe *FakeEnvironment) AddInvariant(invariant simulator.Invariant) {
+	fe.TheInvariants = append(fe.TheInvariants, invariant)
+}
+
+func (fe *FakeEnvironment) InvariantViolations() []simulator.InvariantViolation {
+	return nil
+}
+
+func (fe *FakeEnvironment) Rand() *rand.Rand {
+	if fe.TheRand == nil {
+		fe.TheRand = rand.New(rand.NewSource(1))
+	}
+	return fe.TheRand
+}
+
+type FakeScheduledMovement struct {
+	TheMovement   simulator.Movement
+	Pending       bool
+	Cancelled     bool
+	RescheduledTo time.Time
+}
+
+func (fsm *FakeScheduledMovement) Movement() simulator.Movement {
+	return fsm.TheMovement
+}
+
+func (fsm *FakeScheduledMovement) IsPending() bool {
+	return fsm.Pending
+}
+
+func (fsm *FakeScheduledMovement) Cancel() (cancelled bool) {
+	if !fsm.Pending {
+		return false
+	}
+
+	fsm.Pending = false
+	fsm.Cancelled = true
+	return true
+}
+
+func (fsm *FakeScheduledMovement) Reschedule(occursAt time.Time) (rescheduled bool) {
+	if !fsm.Pending {
+		return false
+	}
+
+	fsm.RescheduledTo = occursAt
+	return true
+}
+
 type FakeReplica struct {
 	ActivateCalled           bool
 	DeactivateCalled         bool
@@ -107,3 +165,12 @@ func (fr *FakeReplica) Stat() autoscaler.Stat {
 	fr.StatCalled = true
 	return autoscaler.Stat{}
 }
+
+func (fr *FakeReplica) CPURequestMillis() int64 {
+	return defaultCPUMillis
+}
+
+func (fr *FakeReplica) Stats() []*proto.Stat {
+	fr.StatCalled = true
+	return []*proto.Stat{}
+}
@@ -0,0 +1,147 @@
+/*
+ * Copyright (C) 2019-Present Pivotal Software, Inc. All rights reserved.
+ *
+ * This program and the accompanying materials are made available under the terms
+ * of the Apache License, Version 2.0 (the "License”); you may not use this file
+ * except in compliance with the License. You may obtain a copy of the License at:
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software distributed
+ * under the License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR
+ * CONDITIONS OF ANY KIND, either express or implied. See the License for the
+ * specific language governing permissions and limitations under the License.
+ */
+
+package model
+
+import (
+	"fmt"
+	"strings"
+
+	"skenario/pkg/simulator"
+)
+
+const cpuCapacityTolerance = 0.001
+
+type requestOutcomeInvariant struct {
+	outcomes map[simulator.EntityName]simulator.StockName
+}
+
+func (roi *requestOutcomeInvariant) Name() string {
+	return "request_outcome"
+}
+
+// Check ensures that a Request reaches an outcome -- completed or failed -- at most once.
+func (roi *requestOutcomeInvariant) Check(movement simulator.Movement, moved simulator.Entity) error {
+	if moved.Kind() != "Request" || !isRequestOutcome(movement.To().Name()) {
+		return nil
+	}
+
+	if previous, ok := roi.outcomes[moved.Name()]; ok {
+		return fmt.Errorf("request '%s' reached '%s' but had already reached '%s'", moved.Name(), movement.To().Name(), previous)
+	}
+	roi.outcomes[moved.Name()] = movement.To().Name()
+
+	return nil
+}
+
+func isRequestOutcome(stockName simulator.StockName) bool {
+	return strings.HasPrefix(string(stockName), "RequestsComplete") || strings.HasPrefix(string(stockName), "RequestsFailed")
+}
+
+func NewRequestOutcomeInvariant() simulator.Invariant {
+	return &requestOutcomeInvariant{
+		outcomes: make(map[simulator.EntityName]simulator.StockName),
+	}
+}
+
+type replicaCPUCapacityInvariant struct {
+	cluster ClusterModel
+}
+
+func (rci *replicaCPUCapacityInvariant) Name() string {
+	return "replica_cpu_capacity"
+}
+
+// Check ensures that no active Replica has more CPU capacity occupied than it has in total,
+// or less than none at all.
+func (rci *replicaCPUCapacityInvariant) Check(movement simulator.Movement, moved simulator.Entity) error {
+	for _, e := range rci.cluster.ActiveStock().EntitiesInStock() {
+		replica, ok := (*e).(*replicaEntity)
+		if !ok {
+			continue
+		}
+
+		occupied := replica.occupiedCPUCapacityMillisPerSecond
+		total := replica.totalCPUCapacityMillisPerSecond
+		if occupied < -cpuCapacityTolerance || occupied > total+cpuCapacityTolerance {
+			return fmt.Errorf("replica '%s' has %.3f of %.3f CPU millis per second occupied", replica.Name(), occupied, total)
+		}
+	}
+
+	return nil
+}
+
+func NewReplicaCPUCapacityInvariant(cluster ClusterModel) simulator.Invariant {
+	return &replicaCPUCapacityInvariant{
+		cluster: cluster,
+	}
+}
+
+type nodeCapacityInvariant struct {
+	cluster ClusterModel
+}
+
+func (nci *nodeCapacityInvariant) Name() string {
+	return "node_capacity"
+}
+
+// Check ensures that the replicas scheduled onto a node never request more CPU or memory
+// than the node has allocatable, nor less than none at all.
+func (nci *nodeCapacityInvariant) Check(movement simulator.Movement, moved simulator.Entity) error {
+	for _, node := range nci.cluster.Nodes() {
+		if node.CPURequested() < 0 || node.CPURequested() > node.CPUAllocatable() {
+			return fmt.Errorf("node '%s' has %d of %d CPU millis requested", node.Name(), node.CPURequested(), node.CPUAllocatable())
+		}
+		if node.MemoryRequested() < 0 || (node.MemoryAllocatable() > 0 && node.MemoryRequested() > node.MemoryAllocatable()) {
+			return fmt.Errorf("node '%s' has %d of %d bytes of memory requested", node.Name(), node.MemoryRequested(), node.MemoryAllocatable())
+		}
+	}
+
+	return nil
+}
+
+func NewNodeCapacityInvariant(cluster ClusterModel) simulator.Invariant {
+	return &nodeCapacityInvariant{
+		cluster: cluster,
+	}
+}
+
+type desiredCountInvariant struct {
+	cluster ClusterModel
+}
+
+func (dci *desiredCountInvariant) Name() string {
+	return "desired_count"
+}
+
+func (dci *desiredCountInvariant) Check(movement simulator.Movement, moved simulator.Entity) error {
+	return nil
+}
+
+// CheckIgnored ensures that nothing tries to take from the desired replicas of the cluster when
+// there are none, which would take the desired count below zero.
+func (dci *desiredCountInvariant) CheckIgnored(movement simulator.Movement) error {
+	if movement.From() != dci.cluster.Desired() {
+		return nil
+	}
+
+	return fmt.Errorf("'%s' would take the count of '%s' below zero", movement.Kind(), movement.From().Name())
+}
+
+func NewDesiredCountInvariant(cluster ClusterModel) simulator.Invariant {
+	return &desiredCountInvariant{
+		cluster: cluster,
+	}
+}
@@ -0,0 +1,156 @@
+/*
+ * Copyright (C) 2019-Present Pivotal Software, Inc. All rights reserved.
+ *
+ * This program and the accompanying materials are made available under the terms
+ * of the Apache License, Version 2.0 (the "License”); you may not use this file
+ * except in compliance with the License. You may obtain a copy of the License at:
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software distributed
+ * under the License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR
+ * CONDITIONS OF ANY KIND, either express or implied. See the License for the
+ * specific language governing permissions and limitations under the License.
+ */
+
+package model
+
+import (
+	"testing"
+	"time"
+
+	"github.com/sclevine/spec"
+	"github.com/sclevine/spec/report"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"skenario/pkg/simulator"
+)
+
+func TestInvariants(t *testing.T) {
+	spec.Run(t, "Request outcome invariant", testRequestOutcomeInvariant, spec.Report(report.Terminal{}))
+	spec.Run(t, "Replica CPU capacity invariant", testReplicaCPUCapacityInvariant, spec.Report(report.Terminal{}))
+	spec.Run(t, "Desired count invariant", testDesiredCountInvariant, spec.Report(report.Terminal{}))
+}
+
+func testRequestOutcomeInvariant(t *testing.T, describe spec.G, it spec.S) {
+	var subject simulator.Invariant
+	var request simulator.Entity
+	var processing simulator.ThroughStock
+	var complete, failed simulator.SinkStock
+
+	it.Before(func() {
+		subject = NewRequestOutcomeInvariant()
+		request = simulator.NewEntity("request-1", "Request")
+		processing = simulator.NewThroughStock("RequestsProcessing", "Request")
+		complete = simulator.NewSinkStock("RequestsComplete [1]", "Request")
+		failed = simulator.NewSinkStock("RequestsFailed", "Request")
+	})
+
+	it("is called request_outcome", func() {
+		assert.Equal(t, "request_outcome", subject.Name())
+	})
+
+	describe("when a request completes", func() {
+		it("is not violated", func() {
+			assert.NoError(t, subject.Check(simulator.NewMovement("complete_request", time.Unix(1, 0), processing, complete), request))
+		})
+	})
+
+	describe("when a request both completes and fails", func() {
+		it("is violated", func() {
+			require.NoError(t, subject.Check(simulator.NewMovement("complete_request", time.Unix(1, 0), processing, complete), request))
+
+			err := subject.Check(simulator.NewMovement("request_failed", time.Unix(2, 0), processing, failed), request)
+			assert.Error(t, err)
+			assert.Contains(t, err.Error(), "had already reached 'RequestsComplete [1]'")
+		})
+	})
+
+	describe("when a request moves between other stocks", func() {
+		it("is not violated", func() {
+			routing := simulator.NewThroughStock("RequestsRouting", "Request")
+			assert.NoError(t, subject.Check(simulator.NewMovement("send_to_replica", time.Unix(1, 0), routing, processing), request))
+			assert.NoError(t, subject.Check(simulator.NewMovement("send_to_replica", time.Unix(2, 0), routing, processing), request))
+		})
+	})
+}
+
+func testReplicaCPUCapacityInvariant(t *testing.T, describe spec.G, it spec.S) {
+	var subject simulator.Invariant
+	var cluster ClusterModel
+	var replica *replicaEntity
+	var movement simulator.Movement
+
+	it.Before(func() {
+		envFake := new(FakeEnvironment)
+		cluster = NewCluster(envFake, ClusterConfig{}, ReplicasConfig{})
+		cm := cluster.(*clusterModel)
+
+		replica = cm.replicaSource.Remove().(*replicaEntity)
+		err := cm.replicasActive.(*replicasActiveStock).delegate.Add(replica)
+		require.NoError(t, err)
+
+		subject = NewReplicaCPUCapacityInvariant(cluster)
+		movement = simulator.NewMovement("send_to_replica", time.Unix(1, 0), cm.requestsInRouting, replica.RequestsProcessing())
+	})
+
+	it("is called replica_cpu_capacity", func() {
+		assert.Equal(t, "replica_cpu_capacity", subject.Name())
+	})
+
+	describe("when occupied CPU is within the replica's capacity", func() {
+		it("is not violated", func() {
+			replica.occupiedCPUCapacityMillisPerSecond = 100
+			assert.NoError(t, subject.Check(movement, simulator.NewEntity("request-1", "Request")))
+		})
+	})
+
+	describe("when occupied CPU drifts above the replica's capacity", func() {
+		it("is violated", func() {
+			replica.occupiedCPUCapacityMillisPerSecond = 100.5
+			assert.Error(t, subject.Check(movement, simulator.NewEntity("request-1", "Request")))
+		})
+	})
+
+	describe("when occupied CPU drifts below zero", func() {
+		it("is violated", func() {
+			replica.occupiedCPUCapacityMillisPerSecond = -0.5
+			assert.Error(t, subject.Check(movement, simulator.NewEntity("request-1", "Request")))
+		})
+	})
+}
+
+func testDesiredCountInvariant(t *testing.T, describe spec.G, it spec.S) {
+	var subject simulator.Invariant
+	var cluster ClusterModel
+	var desiredSink simulator.ThroughStock
+
+	it.Before(func() {
+		envFake := new(FakeEnvironment)
+		cluster = NewCluster(envFake, ClusterConfig{}, ReplicasConfig{})
+		desiredSink = simulator.NewThroughStock("DesiredSink", "Desired")
+
+		subject = NewDesiredCountInvariant(cluster)
+	})
+
+	it("is called desired_count", func() {
+		assert.Equal(t, "desired_count", subject.Name())
+	})
+
+	describe("when the desired replicas are reduced while there are none", func() {
+		it("is violated", func() {
+			movement := simulator.NewMovement("reduce_desired", time.Unix(1, 0), cluster.Desired(), desiredSink)
+			err := subject.(simulator.IgnoredMovementChecker).CheckIgnored(movement)
+			require.Error(t, err)
+			assert.Contains(t, err.Error(), "'reduce_desired' would take the count of 'ReplicasDesired' below zero")
+		})
+	})
+
+	describe("when a movement from another stock is ignored", func() {
+		it("is not violated", func() {
+			movement := simulator.NewMovement("reduce_desired", time.Unix(1, 0), desiredSink, cluster.Desired())
+			assert.NoError(t, subject.(simulator.IgnoredMovementChecker).CheckIgnored(movement))
+		})
+	})
+}
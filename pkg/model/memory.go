@@ -0,0 +1,177 @@
+/*
+ * Copyright (C) 2019-Present Pivotal Software, Inc. All rights reserved.
+ *
+ * This program and the accompanying materials are made available under the terms
+ * of the Apache License, Version 2.0 (the "License”); you may not use this file
+ * except in compliance with the License. You may obtain a copy of the License at:
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software distributed
+ * under the License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR
+ * CONDITIONS OF ANY KIND, either express or implied. See the License for the
+ * specific language governing permissions and limitations under the License.
+ */
+
+package model
+
+import (
+	"fmt"
+	"time"
+
+	"skenario/pkg/simulator"
+)
+
+const (
+	// defaultRestartBackoff and maxRestartBackoff follow the kubelet, which waits 10s before
+	// restarting a crashed container, doubling each time it crashes again, up to 5 minutes.
+	defaultRestartBackoff = 10 * time.Second
+	maxRestartBackoff     = 5 * time.Minute
+)
+
+// MemoryConfig is the memory of a replica. A replica uses BaselineBytes when idle, plus the
+// memory of each request it is processing. If that comes to more than LimitBytes, the replica
+// is OOM-killed: its requests fail, and it restarts after RestartBackoff, which doubles each
+// time the same replica is killed again. A LimitBytes of zero means there is no limit.
+type MemoryConfig struct {
+	LimitBytes     int64         `json:"limit_bytes"`
+	BaselineBytes  int64         `json:"baseline_bytes,omitempty"`
+	RestartBackoff time.Duration `json:"restart_backoff,omitempty"`
+}
+
+func (mc MemoryConfig) Validate() error {
+	if mc.LimitBytes < 0 || mc.BaselineBytes < 0 {
+		return fmt.Errorf("replica memory must not be negative")
+	}
+	if mc.LimitBytes > 0 && mc.BaselineBytes >= mc.LimitBytes {
+		return fmt.Errorf("replica memory baseline of %d bytes leaves nothing of the %d byte limit for requests", mc.BaselineBytes, mc.LimitBytes)
+	}
+	if mc.RestartBackoff < 0 {
+		return fmt.Errorf("replica restart backoff must not be negative")
+	}
+
+	return nil
+}
+
+func (mc MemoryConfig) modelled() bool {
+	return mc != MemoryConfig{}
+}
+
+// restartBackoff is how long a replica which has already restarted the given number of times
+// waits before restarting again.
+func (mc MemoryConfig) restartBackoff(restarts int) time.Duration {
+	backoff := mc.RestartBackoff
+	if backoff == 0 {
+		backoff = defaultRestartBackoff
+	}
+
+	for i := 0; i < restarts && backoff < maxRestartBackoff; i++ {
+		backoff *= 2
+	}
+	if backoff > maxRestartBackoff {
+		backoff = maxRestartBackoff
+	}
+
+	return backoff
+}
+
+// oomKiller kills replicas which run out of memory. An active replica is taken out of
+// ReplicasActive until it has restarted; a replica which is unready or terminating fails its
+// requests and restarts where it is.
+type oomKiller struct {
+	env            simulator.Environment
+	replicasActive takingStock
+	restarting     *replicasRestartingStock
+}
+
+func (k *oomKiller) kill(replica *replicaEntity) {
+	now := k.env.CurrentMovementTime()
+	restartAt := now.Add(replica.memory.restartBackoff(replica.restarts))
+	replica.restarts++
+
+	replica.requestsProcessing.(*requestsProcessingStock).crash("oom_killed", restartAt)
+
+	k.env.AddToSchedule(simulator.NewMovement("oom_kill", now.Add(1*time.Nanosecond), departureOf(k.replicasActive, replica), k.restarting))
+	k.restarting.restartAt(replica, restartAt)
+}
+
+func newOOMKiller(env simulator.Environment, replicasActive takingStock, restarting *replicasRestartingStock) *oomKiller {
+	return &oomKiller{
+		env:            env,
+		replicasActive: replicasActive,
+		restarting:     restarting,
+	}
+}
+
+// replicasRestartingStock holds replicas which have been OOM-killed or are being resized, until
+// they have restarted and are active again. A replica being resized first finishes the requests
+// it is processing, then restarts at its new size after restartDelay.
+type replicasRestartingStock struct {
+	env            simulator.Environment
+	delegate       *entityStock
+	replicasActive simulator.SinkStock
+	restartDelay   func() time.Duration
+}
+
+func (rrs *replicasRestartingStock) Name() simulator.StockName {
+	return rrs.delegate.Name()
+}
+
+func (rrs *replicasRestartingStock) KindStocked() simulator.EntityKind {
+	return rrs.delegate.KindStocked()
+}
+
+func (rrs *replicasRestartingStock) Count() uint64 {
+	return rrs.delegate.Count()
+}
+
+func (rrs *replicasRestartingStock) EntitiesInStock() []*simulator.Entity {
+	return rrs.delegate.EntitiesInStock()
+}
+
+func (rrs *replicasRestartingStock) Remove() simulator.Entity {
+	return rrs.delegate.Remove()
+}
+
+func (rrs *replicasRestartingStock) take(entity simulator.Entity) simulator.Entity {
+	return rrs.delegate.take(entity)
+}
+
+func (rrs *replicasRestartingStock) Add(entity simulator.Entity) error {
+	err := rrs.delegate.Add(entity)
+	if err != nil {
+		return err
+	}
+
+	replica := entity.(*replicaEntity)
+	if replica.resizeTo != nil {
+		replica.requestsProcessing.WhenDrained(func() {
+			replica.resize(*replica.resizeTo)
+			replica.resizeTo = nil
+
+			delay := rrs.restartDelay()
+			if delay < 1*time.Nanosecond {
+				delay = 1 * time.Nanosecond
+			}
+			rrs.restartAt(replica, rrs.env.CurrentMovementTime().Add(delay))
+		})
+	}
+
+	return nil
+}
+
+// restartAt schedules a replica to restart and become active again, if it is restarting then.
+func (rrs *replicasRestartingStock) restartAt(replica *replicaEntity, at time.Time) {
+	restart := simulator.NewMovement("restart_replica", at, departureOf(rrs, replica), rrs.replicasActive)
+	restart.AddNote(fmt.Sprintf("requesting %dm CPU, limited to %.0fm", replica.cpuRequestMillis, replica.totalCPUCapacityMillisPerSecond))
+	rrs.env.AddToSchedule(restart)
+}
+
+func newReplicasRestartingStock(env simulator.Environment, replicasActive simulator.SinkStock, restartDelay func() time.Duration) *replicasRestartingStock {
+	return &replicasRestartingStock{
+		env:            env,
+		delegate:       newEntityStock("ReplicasRestarting", "Replica"),
+		replicasActive: replicasActive,
+		restartDelay:   restartDelay,
+	}
+}
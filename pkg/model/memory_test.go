@@ -0,0 +1,189 @@
+/*
+ * Copyright (C) 2019-Present Pivotal Software, Inc. All rights reserved.
+ *
+ * This program and the accompanying materials are made available under the terms
+ * of the Apache License, Version 2.0 (the "License”); you may not use this file
+ * except in compliance with the License. You may obtain a copy of the License at:
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software distributed
+ * under the License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR
+ * CONDITIONS OF ANY KIND, either express or implied. See the License for the
+ * specific language governing permissions and limitations under the License.
+ */
+
+package model
+
+import (
+	"testing"
+	"time"
+
+	"github.com/josephburnett/sk-plugin/pkg/skplug/proto"
+	"github.com/sclevine/spec"
+	"github.com/sclevine/spec/report"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"skenario/pkg/simulator"
+)
+
+func TestMemory(t *testing.T) {
+	spec.Run(t, "Replica memory", testMemory, spec.Report(report.Terminal{}))
+}
+
+func testMemory(t *testing.T, describe spec.G, it spec.S) {
+	var envFake *FakeEnvironment
+	var replica *replicaEntity
+	var processing *requestsProcessingStock
+	var active *entityStock
+	var killer *oomKiller
+	var failedSink simulator.SinkStock
+
+	arrive := func(memoryBytes int64) *requestEntity {
+		request := NewRequestEntity(envFake, nil, RequestConfig{CPUTimeMillis: 100, MemoryBytes: memoryBytes, Timeout: 10 * time.Second}).(*requestEntity)
+		require.NoError(t, processing.Add(request))
+		return request
+	}
+
+	movementsOfKind := func(kind simulator.MovementKind) []simulator.Movement {
+		movements := make([]simulator.Movement, 0)
+		for _, m := range envFake.Movements {
+			if m.Kind() == kind {
+				movements = append(movements, m)
+			}
+		}
+		return movements
+	}
+
+	it.Before(func() {
+		envFake = &FakeEnvironment{Movements: make([]simulator.Movement, 0), TheTime: time.Unix(0, 0)}
+		failedSink = simulator.NewSinkStock("RequestsFailed", "Request")
+		replica = NewReplicaEntity(envFake, nil, nil, "11.11.11.11", &failedSink).(*replicaEntity)
+		processing = replica.requestsProcessing.(*requestsProcessingStock)
+
+		active = newEntityStock("ReplicasActive", "Replica")
+		require.NoError(t, active.Add(replica))
+		killer = newOOMKiller(envFake, active, newReplicasRestartingStock(envFake, active, nil))
+
+		replica.limitMemory(MemoryConfig{LimitBytes: 100 << 20, BaselineBytes: 20 << 20}, killer)
+	})
+
+	describe("a replica within its limit", func() {
+		it.Before(func() {
+			arrive(30 << 20)
+			arrive(30 << 20)
+		})
+
+		it("uses its baseline plus the memory of its requests", func() {
+			assert.Equal(t, int64(80<<20), replica.memoryInUseBytes())
+		})
+
+		it("reports only the metrics the plugin protocol has to the autoscaler", func() {
+			stats := replica.Stats()
+			require.Len(t, stats, 2)
+			assert.Equal(t, proto.MetricType_CONCURRENT_REQUESTS_MILLIS, stats[0].Type)
+			assert.Equal(t, proto.MetricType_CPU_MILLIS, stats[1].Type)
+		})
+
+		it("gives back the memory of requests that leave", func() {
+			processing.Remove()
+			assert.Equal(t, int64(50<<20), replica.memoryInUseBytes())
+		})
+
+		it("is not killed", func() {
+			assert.Empty(t, movementsOfKind("oom_kill"))
+		})
+	})
+
+	describe("a replica which goes over its limit", func() {
+		it.Before(func() {
+			arrive(50 << 20)
+			envFake.TheTime = time.Unix(1, 0)
+			arrive(50 << 20)
+		})
+
+		it("fails every request it was processing", func() {
+			failures := movementsOfKind("oom_killed")
+			require.Len(t, failures, 2)
+			for _, failure := range failures {
+				assert.Equal(t, time.Unix(1, 1), failure.OccursAt())
+			}
+			assert.Len(t, movementsOfKind("complete_request"), 1)
+		})
+
+		it("is taken out of ReplicasActive", func() {
+			kills := movementsOfKind("oom_kill")
+			require.Len(t, kills, 1)
+			assert.Equal(t, time.Unix(1, 1), kills[0].OccursAt())
+			assert.Equal(t, simulator.StockName("ReplicasActive"), kills[0].From().Name())
+			assert.Equal(t, simulator.StockName("ReplicasRestarting"), kills[0].To().Name())
+		})
+
+		it("fails requests which arrive before it restarts", func() {
+			envFake.TheTime = time.Unix(5, 0)
+			arrive(1)
+			assert.Len(t, movementsOfKind("oom_killed"), 3)
+			assert.Len(t, movementsOfKind("oom_kill"), 1)
+		})
+
+		it("restarts after the default backoff", func() {
+			restarts := movementsOfKind("restart_replica")
+			require.Len(t, restarts, 1)
+			assert.Equal(t, time.Unix(11, 0), restarts[0].OccursAt())
+			assert.Equal(t, simulator.StockName("ReplicasRestarting"), restarts[0].From().Name())
+			assert.Equal(t, simulator.StockName("ReplicasActive"), restarts[0].To().Name())
+		})
+
+		describe("once it has restarted", func() {
+			it.Before(func() {
+				processing.Remove()
+				processing.Remove()
+				envFake.TheTime = time.Unix(11, 0)
+				arrive(10 << 20)
+			})
+
+			it("processes requests again", func() {
+				assert.Len(t, movementsOfKind("oom_killed"), 2)
+				assert.Len(t, movementsOfKind("complete_request"), 2)
+			})
+
+			it("waits twice as long to restart the next time it is killed", func() {
+				arrive(90 << 20)
+				assert.Equal(t, time.Unix(31, 0), processing.restartAt)
+			})
+		})
+	})
+
+	describe("restart backoff", func() {
+		it("starts at 10s by default and doubles", func() {
+			config := MemoryConfig{LimitBytes: 1}
+			assert.Equal(t, 10*time.Second, config.restartBackoff(0))
+			assert.Equal(t, 20*time.Second, config.restartBackoff(1))
+			assert.Equal(t, 40*time.Second, config.restartBackoff(2))
+		})
+
+		it("is at most 5 minutes", func() {
+			config := MemoryConfig{LimitBytes: 1, RestartBackoff: time.Minute}
+			assert.Equal(t, 4*time.Minute, config.restartBackoff(2))
+			assert.Equal(t, 5*time.Minute, config.restartBackoff(3))
+			assert.Equal(t, 5*time.Minute, config.restartBackoff(100))
+		})
+	})
+
+	describe("Validate()", func() {
+		it("accepts a baseline below the limit", func() {
+			assert.NoError(t, MemoryConfig{LimitBytes: 2, BaselineBytes: 1}.Validate())
+			assert.NoError(t, MemoryConfig{BaselineBytes: 1}.Validate())
+		})
+
+		it("rejects a baseline at or above the limit", func() {
+			assert.Error(t, MemoryConfig{LimitBytes: 1, BaselineBytes: 1}.Validate())
+		})
+
+		it("rejects negative values", func() {
+			assert.Error(t, MemoryConfig{LimitBytes: -1}.Validate())
+			assert.Error(t, MemoryConfig{RestartBackoff: -1}.Validate())
+		})
+	})
+}
@@ -0,0 +1,179 @@
+/*
+ * Copyright (C) 2019-Present Pivotal Software, Inc. All rights reserved.
+ *
+ * This program and the accompanying materials are made available under the terms
+ * of the Apache License, Version 2.0 (the "License”); you may not use this file
+ * except in compliance with the License. You may obtain a copy of the License at:
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software distributed
+ * under the License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR
+ * CONDITIONS OF ANY KIND, either express or implied. See the License for the
+ * specific language governing permissions and limitations under the License.
+ */
+
+package model
+
+import (
+	"fmt"
+	"sync/atomic"
+	"time"
+
+	"skenario/pkg/simulator"
+)
+
+// NodeConfig describes the nodes replicas are scheduled onto. When there are no initial nodes
+// and no cluster autoscaler, the cluster has unlimited capacity and replicas launch as soon as
+// they are desired.
+type NodeConfig struct {
+	InitialNodes           uint
+	CPUAllocatableMillis   int64
+	MemoryAllocatableBytes int64
+
+	// MaxNodes enables the cluster autoscaler, which adds nodes ProvisioningDelay after replicas
+	// are found not to fit, up to MaxNodes in total.
+	MaxNodes          uint
+	ProvisioningDelay time.Duration
+}
+
+func (nc NodeConfig) Enabled() bool {
+	return nc.InitialNodes > 0 || nc.MaxNodes > 0
+}
+
+type NodeEntity interface {
+	simulator.Entity
+	Fits(cpuMillis, memoryBytes int64) bool
+	Allocate(cpuMillis, memoryBytes int64)
+	Release(cpuMillis, memoryBytes int64)
+	CPURequested() int64
+	MemoryRequested() int64
+	CPUAllocatable() int64
+	MemoryAllocatable() int64
+}
+
+type nodeEntity struct {
+	number            int32
+	cpuAllocatable    int64
+	memoryAllocatable int64
+	cpuRequested      int64
+	memoryRequested   int64
+}
+
+var nodeNum int32
+
+func (ne *nodeEntity) Name() simulator.EntityName {
+	return simulator.EntityName(fmt.Sprintf("node-%d", ne.number))
+}
+
+func (ne *nodeEntity) Kind() simulator.EntityKind {
+	return "Node"
+}
+
+// Fits is true if the node has enough unrequested CPU and memory left. A node without any
+// allocatable memory is treated as not constraining memory at all.
+func (ne *nodeEntity) Fits(cpuMillis, memoryBytes int64) bool {
+	if ne.cpuRequested+cpuMillis > ne.cpuAllocatable {
+		return false
+	}
+	return ne.memoryAllocatable == 0 || ne.memoryRequested+memoryBytes <= ne.memoryAllocatable
+}
+
+func (ne *nodeEntity) Allocate(cpuMillis, memoryBytes int64) {
+	ne.cpuRequested += cpuMillis
+	ne.memoryRequested += memoryBytes
+}
+
+func (ne *nodeEntity) Release(cpuMillis, memoryBytes int64) {
+	ne.cpuRequested -= cpuMillis
+	ne.memoryRequested -= memoryBytes
+}
+
+func (ne *nodeEntity) CPURequested() int64 {
+	return ne.cpuRequested
+}
+
+func (ne *nodeEntity) MemoryRequested() int64 {
+	return ne.memoryRequested
+}
+
+func (ne *nodeEntity) CPUAllocatable() int64 {
+	return ne.cpuAllocatable
+}
+
+func (ne *nodeEntity) MemoryAllocatable() int64 {
+	return ne.memoryAllocatable
+}
+
+func NewNodeEntity(config NodeConfig) NodeEntity {
+	return &nodeEntity{
+		number:            atomic.AddInt32(&nodeNum, 1),
+		cpuAllocatable:    config.CPUAllocatableMillis,
+		memoryAllocatable: config.MemoryAllocatableBytes,
+	}
+}
+
+type nodeSource struct {
+	config NodeConfig
+}
+
+func (ns *nodeSource) Name() simulator.StockName {
+	return "NodeSource"
+}
+
+func (ns *nodeSource) KindStocked() simulator.EntityKind {
+	return "Node"
+}
+
+func (ns *nodeSource) Count() uint64 {
+	return 0
+}
+
+func (ns *nodeSource) EntitiesInStock() []*simulator.Entity {
+	return []*simulator.Entity{}
+}
+
+func (ns *nodeSource) Remove() simulator.Entity {
+	return NewNodeEntity(ns.config)
+}
+
+func NewNodeSource(config NodeConfig) simulator.SourceStock {
+	return &nodeSource{config: config}
+}
+
+type NodesStock interface {
+	simulator.SinkStock
+}
+
+type nodesStock struct {
+	delegate  simulator.ThroughStock
+	scheduler *scheduler
+}
+
+func (ns *nodesStock) Name() simulator.StockName {
+	return ns.delegate.Name()
+}
+
+func (ns *nodesStock) KindStocked() simulator.EntityKind {
+	return ns.delegate.KindStocked()
+}
+
+func (ns *nodesStock) Count() uint64 {
+	return ns.delegate.Count()
+}
+
+func (ns *nodesStock) EntitiesInStock() []*simulator.Entity {
+	return ns.delegate.EntitiesInStock()
+}
+
+// Add makes a newly provisioned node available to the scheduler, which immediately tries to
+// place any pending replicas onto it.
+func (ns *nodesStock) Add(entity simulator.Entity) error {
+	err := ns.delegate.Add(entity)
+	if err != nil {
+		return err
+	}
+
+	ns.scheduler.nodeProvisioned()
+	return nil
+}
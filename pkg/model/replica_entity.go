@@ -17,6 +17,7 @@ package model
 
 import (
 	"fmt"
+	"sync/atomic"
 
 	"github.com/josephburnett/sk-plugin/pkg/skplug/proto"
 	corev1 "k8s.io/api/core/v1"
@@ -32,6 +33,7 @@ type Replica interface {
 	Deactivate()
 	RequestsProcessing() RequestsProcessingStock
 	Stats() []*proto.Stat
+	CPURequestMillis() int64
 }
 
 type ReplicaEntity interface {
@@ -51,9 +53,15 @@ type replicaEntity struct {
 	numRequestsSinceStat               int32
 	totalCPUCapacityMillisPerSecond    float64
 	occupiedCPUCapacityMillisPerSecond float64
+	cpuRequestMillis                   int64
+	cpuLimitMillis                     float64
+	cpuFactors                         []float64
+	resizeTo                           *replicaSize
+	memory                             MemoryConfig
+	restarts                           int
 }
 
-var replicaNum int
+var replicaNum int32
 
 func (re *replicaEntity) Activate() {
 	endpoints, err := re.kubernetesClient.CoreV1().Endpoints("skenario").Get("Skenario Revision", metav1.GetOptions{})
@@ -122,16 +130,85 @@ func (re *replicaEntity) Stats() []*proto.Stat {
 		Time:    atTime.UnixNano(),
 		PodName: string(re.Name()),
 		Type:    proto.MetricType_CPU_MILLIS,
-		// TODO: calculate cpu usage based on request time in cpu stock, put instead of 0
-		Value: int32(0),
+		Value:   int32(re.occupiedCPUCapacityMillisPerSecond),
 	})
 
+	// The plugin protocol has no memory metric, so the memory a replica uses is not reported.
+
 	re.numRequestsSinceStat = 0
 	// TODO: report request count
 
 	return stats
 }
 
+// CPURequestMillis is the CPU the replica requests.
+func (re *replicaEntity) CPURequestMillis() int64 {
+	return re.cpuRequestMillis
+}
+
+// resize gives the replica a new CPU request and limit. Its limit is its capacity, less any
+// slowdowns in effect.
+func (re *replicaEntity) resize(size replicaSize) {
+	re.cpuRequestMillis = size.cpuRequestMillis
+	re.cpuLimitMillis = float64(size.cpuLimitMillis)
+	re.updateCPUCapacity()
+}
+
+// slowDown reduces the CPU capacity of the replica to factor of what it would be, until speedUp
+// is called with the same factor. Slowdowns which overlap compound.
+func (re *replicaEntity) slowDown(factor float64) {
+	re.cpuFactors = append(re.cpuFactors, factor)
+	re.updateCPUCapacity()
+}
+
+// speedUp ends a slowdown started by slowDown.
+func (re *replicaEntity) speedUp(factor float64) {
+	for i, f := range re.cpuFactors {
+		if f == factor {
+			re.cpuFactors = append(re.cpuFactors[:i], re.cpuFactors[i+1:]...)
+			break
+		}
+	}
+	re.updateCPUCapacity()
+}
+
+// updateCPUCapacity works out the CPU capacity of the replica from its limit and the slowdowns
+// in effect.
+func (re *replicaEntity) updateCPUCapacity() {
+	capacity := re.cpuLimitMillis
+	for _, f := range re.cpuFactors {
+		capacity *= f
+	}
+	re.requestsProcessing.(*requestsProcessingStock).setCPUCapacity(capacity)
+}
+
+// shareCPU has the requests on the replica share its CPU according to a shared CPU model.
+func (re *replicaEntity) shareCPU(config CPUConfig) {
+	re.requestsProcessing.(*requestsProcessingStock).cpu = newSharedCPU(config, re.env.CurrentMovementTime())
+}
+
+// limitMemory has the replica use memory, and be killed by killer when it uses more than its limit.
+func (re *replicaEntity) limitMemory(config MemoryConfig, killer *oomKiller) {
+	re.memory = config
+
+	rps := re.requestsProcessing.(*requestsProcessingStock)
+	if config.LimitBytes > 0 {
+		rps.memoryAvailableBytes = config.LimitBytes - config.BaselineBytes
+	}
+	rps.outOfMemory = func() {
+		killer.kill(re)
+	}
+}
+
+// makeCalls has the replica make calls to other services for the requests it handles.
+func (re *replicaEntity) makeCalls(calls *serviceCalls) {
+	re.requestsProcessing.(*requestsProcessingStock).calls = calls
+}
+
+func (re *replicaEntity) memoryInUseBytes() int64 {
+	return re.memory.BaselineBytes + re.requestsProcessing.(*requestsProcessingStock).memoryInUseBytes
+}
+
 func (re *replicaEntity) Name() simulator.EntityName {
 	return simulator.EntityName(fmt.Sprintf("replica-%d", re.number))
 }
@@ -141,15 +218,15 @@ func (re *replicaEntity) Kind() simulator.EntityKind {
 }
 
 func NewReplicaEntity(env simulator.Environment, client kubernetes.Interface, endpointsInformer informers.EndpointsInformer, address string, failedSink *simulator.SinkStock) ReplicaEntity {
-	replicaNum++
-
 	re := &replicaEntity{
 		env:                                env,
-		number:                             replicaNum,
+		number:                             int(atomic.AddInt32(&replicaNum, 1)),
 		kubernetesClient:                   client,
 		endpointsInformer:                  endpointsInformer,
-		totalCPUCapacityMillisPerSecond:    100,
+		totalCPUCapacityMillisPerSecond:    defaultCPUMillis,
 		occupiedCPUCapacityMillisPerSecond: 0,
+		cpuRequestMillis:                   defaultCPUMillis,
+		cpuLimitMillis:                     defaultCPUMillis,
 	}
 
 	re.requestsComplete = simulator.NewSinkStock(simulator.StockName(fmt.Sprintf("RequestsComplete [%d]", re.number)), "Request")
@@ -16,6 +16,7 @@
 package model
 
 import (
+	"skenario/pkg/plugin"
 	"skenario/pkg/simulator"
 
 	"github.com/josephburnett/sk-plugin/pkg/skplug"
@@ -28,7 +29,8 @@ type ReplicasActiveStock interface {
 
 type replicasActiveStock struct {
 	env      simulator.Environment
-	delegate simulator.ThroughStock
+	delegate *entityStock
+	plugin   *plugin.PluginPartition
 }
 
 func (ras *replicasActiveStock) Name() simulator.StockName {
@@ -48,7 +50,15 @@ func (ras *replicasActiveStock) EntitiesInStock() []*simulator.Entity {
 }
 
 func (ras *replicasActiveStock) Remove() simulator.Entity {
-	entity := ras.delegate.Remove()
+	return ras.deactivate(ras.delegate.Remove())
+}
+
+func (ras *replicasActiveStock) take(entity simulator.Entity) simulator.Entity {
+	return ras.deactivate(ras.delegate.take(entity))
+}
+
+// deactivate takes a replica out of the endpoints and tells the autoscaler it has gone.
+func (ras *replicasActiveStock) deactivate(entity simulator.Entity) simulator.Entity {
 	if entity == nil {
 		return nil
 	}
@@ -57,7 +67,7 @@ func (ras *replicasActiveStock) Remove() simulator.Entity {
 	replica.Deactivate()
 
 	now := ras.env.CurrentMovementTime().UnixNano()
-	err := ras.env.Plugin().Event(now, proto.EventType_DELETE, &skplug.Pod{
+	err := ras.plugin.Event(now, proto.EventType_DELETE, &skplug.Pod{
 		Name: string(entity.Name()),
 	})
 	if err != nil {
@@ -72,12 +82,12 @@ func (ras *replicasActiveStock) Add(entity simulator.Entity) error {
 	replica.Activate()
 
 	now := ras.env.CurrentMovementTime().UnixNano()
-	err := ras.env.Plugin().Event(now, proto.EventType_CREATE, &skplug.Pod{
+	err := ras.plugin.Event(now, proto.EventType_CREATE, &skplug.Pod{
 		Name: string(entity.Name()),
 		// TODO: enumerate states in proto.
 		State:          "active",
 		LastTransition: now,
-		CpuRequest:     1000,
+		CpuRequest:     int32(replica.CPURequestMillis()),
 	})
 	if err != nil {
 		panic(err)
@@ -89,6 +99,7 @@ func (ras *replicasActiveStock) Add(entity simulator.Entity) error {
 func NewReplicasActiveStock(env simulator.Environment) ReplicasActiveStock {
 	return &replicasActiveStock{
 		env:      env,
-		delegate: simulator.NewThroughStock("ReplicasActive", "Replica"),
+		delegate: newEntityStock("ReplicasActive", "Replica"),
+		plugin:   env.Plugin(),
 	}
 }
@@ -16,8 +16,10 @@
 package model
 
 import (
+	"fmt"
 	"time"
 
+	"skenario/pkg/model/distributions"
 	"skenario/pkg/simulator"
 )
 
@@ -25,12 +27,115 @@ type ReplicasConfig struct {
 	LaunchDelay    time.Duration
 	TerminateDelay time.Duration
 	MaxRPS         int64
+
+	// CPU is how the requests on each replica share its CPU.
+	CPU CPUConfig
+
+	// Memory is the memory each replica uses, and how much it may use before it is OOM-killed.
+	Memory MemoryConfig
+
+	// When given, these replace the fixed LaunchDelay and TerminateDelay.
+	LaunchPhases               []Phase
+	TerminateDelayDistribution distributions.Distribution
+
+	// Resources requested by each replica, which decide how many fit on a node. The CPU
+	// request is also what autoscaler plugins are told. It defaults to the CPU limit, or to
+	// 100 if that is not given either.
+	CPURequestMillis   int64
+	MemoryRequestBytes int64
+
+	// CPULimitMillis is the CPU each replica may use, which is its capacity for processing
+	// requests. It defaults to the CPU request, or to 100 if that is not given either.
+	CPULimitMillis int64
+}
+
+// replicaSize is the CPU a replica requests and the CPU it is limited to.
+type replicaSize struct {
+	cpuRequestMillis int64
+	cpuLimitMillis   int64
+}
+
+// withRequest is a size with the given CPU request, and a limit in the same ratio to it as
+// this size has, as a VerticalPodAutoscaler keeps it.
+func (rs replicaSize) withRequest(cpuRequestMillis int64) replicaSize {
+	return replicaSize{
+		cpuRequestMillis: cpuRequestMillis,
+		cpuLimitMillis:   cpuRequestMillis * rs.cpuLimitMillis / rs.cpuRequestMillis,
+	}
+}
+
+func (rc ReplicasConfig) Validate() error {
+	if rc.CPURequestMillis < 0 || rc.CPULimitMillis < 0 {
+		return fmt.Errorf("replica CPU must not be negative")
+	}
+	if rc.CPURequestMillis > 0 && rc.CPULimitMillis > 0 && rc.CPULimitMillis < rc.CPURequestMillis {
+		return fmt.Errorf("replica CPU limit of %dm is less than its request of %dm", rc.CPULimitMillis, rc.CPURequestMillis)
+	}
+
+	return nil
+}
+
+func (rc ReplicasConfig) size() replicaSize {
+	size := replicaSize{cpuRequestMillis: rc.CPURequestMillis, cpuLimitMillis: rc.CPULimitMillis}
+	switch {
+	case size.cpuRequestMillis <= 0 && size.cpuLimitMillis <= 0:
+		size = replicaSize{cpuRequestMillis: defaultCPUMillis, cpuLimitMillis: defaultCPUMillis}
+	case size.cpuRequestMillis <= 0:
+		// as in Kubernetes, a replica given only a limit requests its limit
+		size.cpuRequestMillis = size.cpuLimitMillis
+	case size.cpuLimitMillis <= 0:
+		size.cpuLimitMillis = size.cpuRequestMillis
+	}
+
+	return size
+}
+
+// launchPhases are the configured phases, or a single phase lasting exactly LaunchDelay.
+func (rc ReplicasConfig) launchPhases() []Phase {
+	if len(rc.LaunchPhases) > 0 {
+		return rc.LaunchPhases
+	}
+
+	return []Phase{{Name: "launch", Delay: distributions.NewConstant(rc.LaunchDelay)}}
+}
+
+func (rc ReplicasConfig) terminateDelay() distributions.Distribution {
+	if rc.TerminateDelayDistribution != nil {
+		return rc.TerminateDelayDistribution
+	}
+
+	return distributions.NewConstant(rc.TerminateDelay)
 }
 
+// RequestConfig describes a request. Requests of a named Class are told apart in results.
+// On a busy replica, a request only queues behind requests of its own or a higher Priority.
+//
+// Each request takes its own samples of CPUTime and IOTime when they are set, and otherwise
+// needs CPUTimeMillis and IOTimeMillis. A request uses MemoryBytes on the replica processing it.
 type RequestConfig struct {
+	Class         string
+	Priority      int
 	CPUTimeMillis int
 	IOTimeMillis  int
+	CPUTime       distributions.Distribution
+	IOTime        distributions.Distribution
+	MemoryBytes   int64
 	Timeout       time.Duration
+	Retry         RetryPolicy
+}
+
+func (rc RequestConfig) sampleCPUTime(env simulator.Environment) time.Duration {
+	if rc.CPUTime != nil {
+		return rc.CPUTime.Sample(env.Rand())
+	}
+	return time.Duration(rc.CPUTimeMillis) * time.Millisecond
+}
+
+func (rc RequestConfig) sampleIOTime(env simulator.Environment) time.Duration {
+	if rc.IOTime != nil {
+		return rc.IOTime.Sample(env.Rand())
+	}
+	return time.Duration(rc.IOTimeMillis) * time.Millisecond
 }
 
 type ReplicasDesiredStock interface {
@@ -46,6 +151,7 @@ type replicasDesiredStock struct {
 	replicasActive      simulator.ThroughStock
 	replicasTerminating ReplicasTerminatingStock
 	launchingCount      uint64
+	scheduler           *scheduler
 }
 
 func (rds *replicasDesiredStock) Name() simulator.StockName {
@@ -71,7 +177,15 @@ func (rds *replicasDesiredStock) Remove() simulator.Entity {
 	}
 
 	nextTerminate := rds.env.CurrentMovementTime().Add(1 * time.Nanosecond)
-	if rds.replicasLaunching.Count() > 0 {
+	if rds.scheduler != nil && rds.scheduler.waiting() > 0 {
+		rds.scheduler.pendingTerminations++
+		rds.env.AddToSchedule(simulator.NewMovement(
+			"terminate_pending",
+			nextTerminate,
+			rds.scheduler.pending,
+			rds.replicasTerminating,
+		))
+	} else if rds.replicasLaunching.Count() > 0 {
 		rds.env.AddToSchedule(simulator.NewMovement(
 			"terminate_launch",
 			nextTerminate,
@@ -96,23 +210,49 @@ func (rds *replicasDesiredStock) Add(entity simulator.Entity) error {
 		return err
 	}
 
+	// ReplicasLaunching decides when the replica becomes active. With a scheduler, the replica
+	// waits until it has been placed on a node before it starts launching.
+	var launchInto simulator.SinkStock = rds.replicasLaunching
+	if rds.scheduler != nil {
+		launchInto = rds.scheduler.pending
+	}
+
 	rds.env.AddToSchedule(simulator.NewMovement(
 		"begin_launch",
 		rds.env.CurrentMovementTime().Add(1*time.Nanosecond),
 		rds.replicaSource,
-		rds.replicasLaunching,
-	))
-
-	rds.env.AddToSchedule(simulator.NewMovement(
-		"finish_launching",
-		rds.env.CurrentMovementTime().Add(rds.config.LaunchDelay),
-		rds.replicasLaunching,
-		rds.replicasActive,
+		launchInto,
 	))
 
 	return nil
 }
 
+// bootstrappedDesiredStock stands in for ReplicasDesired for the replicas a cluster starts with.
+// They are already running, so nothing is launched for them.
+type bootstrappedDesiredStock struct {
+	desired *replicasDesiredStock
+}
+
+func (bds *bootstrappedDesiredStock) Name() simulator.StockName {
+	return bds.desired.Name()
+}
+
+func (bds *bootstrappedDesiredStock) KindStocked() simulator.EntityKind {
+	return bds.desired.KindStocked()
+}
+
+func (bds *bootstrappedDesiredStock) Count() uint64 {
+	return bds.desired.Count()
+}
+
+func (bds *bootstrappedDesiredStock) EntitiesInStock() []*simulator.Entity {
+	return bds.desired.EntitiesInStock()
+}
+
+func (bds *bootstrappedDesiredStock) Add(entity simulator.Entity) error {
+	return bds.desired.delegate.Add(entity)
+}
+
 func NewReplicasDesiredStock(env simulator.Environment, config ReplicasConfig, replicaSource ReplicaSource, replicasLaunching, replicasActive simulator.ThroughStock, replicasTerminating ReplicasTerminatingStock) ReplicasDesiredStock {
 	return &replicasDesiredStock{
 		env:                 env,
@@ -95,12 +95,9 @@ func testReplicasDesired(t *testing.T, describe spec.G, it spec.S) {
 			assert.Equal(t, simulator.MovementKind("begin_launch"), envFake.Movements[0].Kind())
 		})
 
-		it("schedules movements of new entities from ReplicasLaunching to ReplicasActive", func() {
-			assert.Equal(t, simulator.MovementKind("finish_launching"), envFake.Movements[1].Kind())
-		})
-
-		it("adds the LaunchDelay to the launch time", func() {
-			assert.Equal(t, envFake.TheTime.Add(111*time.Nanosecond), envFake.Movements[1].OccursAt())
+		it("leaves ReplicasLaunching to decide when the replica becomes active", func() {
+			assert.Len(t, envFake.Movements, 1)
+			assert.Equal(t, replicasLaunching, envFake.Movements[0].To())
 		})
 	})
 
@@ -164,4 +161,38 @@ func testReplicasDesired(t *testing.T, describe spec.G, it spec.S) {
 			// can this actually happen?
 		})
 	})
+
+	describe("ReplicasConfig", func() {
+		describe("without CPU configured", func() {
+			it("requests and is limited to the capacity of 100 replicas always had", func() {
+				assert.Equal(t, replicaSize{cpuRequestMillis: 100, cpuLimitMillis: 100}, ReplicasConfig{}.size())
+				assert.NoError(t, ReplicasConfig{}.Validate())
+			})
+
+			it("gives new replicas that capacity, and the same request to report to autoscaler plugins", func() {
+				replica := NewReplicaEntity(envFake, nil, nil, "11.11.11.11", nil).(*replicaEntity)
+				assert.Equal(t, 100.0, replica.totalCPUCapacityMillisPerSecond)
+				assert.Equal(t, int64(100), replica.CPURequestMillis())
+			})
+		})
+
+		describe("with only a CPU request", func() {
+			it("limits replicas to their request", func() {
+				assert.Equal(t, replicaSize{cpuRequestMillis: 500, cpuLimitMillis: 500}, ReplicasConfig{CPURequestMillis: 500}.size())
+			})
+		})
+
+		describe("with only a CPU limit", func() {
+			it("has replicas request their limit", func() {
+				assert.Equal(t, replicaSize{cpuRequestMillis: 250, cpuLimitMillis: 250}, ReplicasConfig{CPULimitMillis: 250}.size())
+				assert.NoError(t, ReplicasConfig{CPULimitMillis: 250}.Validate())
+			})
+		})
+
+		describe("with a CPU limit below the request", func() {
+			it("is not valid", func() {
+				assert.Error(t, ReplicasConfig{CPURequestMillis: 500, CPULimitMillis: 250}.Validate())
+			})
+		})
+	})
 }
@@ -0,0 +1,135 @@
+/*
+ * Copyright (C) 2019-Present Pivotal Software, Inc. All rights reserved.
+ *
+ * This program and the accompanying materials are made available under the terms
+ * of the Apache License, Version 2.0 (the "License”); you may not use this file
+ * except in compliance with the License. You may obtain a copy of the License at:
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software distributed
+ * under the License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR
+ * CONDITIONS OF ANY KIND, either express or implied. See the License for the
+ * specific language governing permissions and limitations under the License.
+ */
+
+package model
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"skenario/pkg/model/distributions"
+	"skenario/pkg/simulator"
+)
+
+// Phase is one step of launching a replica, such as pulling its image or passing its readiness
+// probe. Every replica takes its own sample of each phase's delay.
+type Phase struct {
+	Name  string
+	Delay distributions.Distribution
+}
+
+type ReplicasLaunchingStock interface {
+	simulator.ThroughStock
+}
+
+type launch struct {
+	readyAt time.Time
+	finish  simulator.ScheduledMovement
+}
+
+type replicasLaunchingStock struct {
+	env            simulator.Environment
+	config         ReplicasConfig
+	delegate       *entityStock
+	replicasActive simulator.ThroughStock
+	scheduler      *scheduler
+	launches       map[simulator.Entity]*launch
+}
+
+func (rls *replicasLaunchingStock) Name() simulator.StockName {
+	return rls.delegate.Name()
+}
+
+func (rls *replicasLaunchingStock) KindStocked() simulator.EntityKind {
+	return rls.delegate.KindStocked()
+}
+
+func (rls *replicasLaunchingStock) Count() uint64 {
+	return rls.delegate.Count()
+}
+
+func (rls *replicasLaunchingStock) EntitiesInStock() []*simulator.Entity {
+	return rls.delegate.EntitiesInStock()
+}
+
+// Remove gives up the replica furthest from being ready, which is the one Kubernetes prefers
+// to delete when scaling down. Its launch is cancelled.
+func (rls *replicasLaunchingStock) Remove() simulator.Entity {
+	var latest simulator.Entity
+	for _, e := range rls.delegate.EntitiesInStock() {
+		l, launching := rls.launches[*e]
+		if launching && (latest == nil || l.readyAt.After(rls.launches[latest].readyAt)) {
+			latest = *e
+		}
+	}
+
+	if latest == nil {
+		return rls.delegate.Remove()
+	}
+
+	rls.launches[latest].finish.Cancel()
+	return rls.take(latest)
+}
+
+func (rls *replicasLaunchingStock) take(entity simulator.Entity) simulator.Entity {
+	delete(rls.launches, entity)
+	return rls.delegate.take(entity)
+}
+
+// Add samples how long the replica spends in each launch phase and schedules it to become
+// active once all of them are over. With a scheduler, the replica is first bound to its node.
+func (rls *replicasLaunchingStock) Add(entity simulator.Entity) error {
+	err := rls.delegate.Add(entity)
+	if err != nil {
+		return err
+	}
+
+	if rls.scheduler != nil {
+		rls.scheduler.bind(entity)
+	}
+
+	var launchDelay time.Duration
+	phases := make([]string, 0)
+	for _, phase := range rls.config.launchPhases() {
+		delay := phase.Delay.Sample(rls.env.Rand())
+		launchDelay += delay
+		phases = append(phases, fmt.Sprintf("%s %s", phase.Name, delay))
+	}
+	if launchDelay < 1*time.Nanosecond {
+		launchDelay = 1 * time.Nanosecond
+	}
+
+	readyAt := rls.env.CurrentMovementTime().Add(launchDelay)
+	finish := simulator.NewMovement("finish_launching", readyAt, departureOf(rls, entity), rls.replicasActive)
+	finish.AddNote(strings.Join(phases, ", "))
+
+	scheduled, added := rls.env.ScheduleMovement(finish)
+	if added {
+		rls.launches[entity] = &launch{readyAt: readyAt, finish: scheduled}
+	}
+
+	return nil
+}
+
+func NewReplicasLaunchingStock(env simulator.Environment, config ReplicasConfig, replicasActive simulator.ThroughStock) ReplicasLaunchingStock {
+	return &replicasLaunchingStock{
+		env:            env,
+		config:         config,
+		delegate:       newEntityStock("ReplicasLaunching", "Replica"),
+		replicasActive: replicasActive,
+		launches:       make(map[simulator.Entity]*launch),
+	}
+}
@@ -0,0 +1,131 @@
+/*
+ * Copyright (C) 2019-Present Pivotal Software, Inc. All rights reserved.
+ *
+ * This program and the accompanying materials are made available under the terms
+ * of the Apache License, Version 2.0 (the "License”); you may not use this file
+ * except in compliance with the License. You may obtain a copy of the License at:
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software distributed
+ * under the License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR
+ * CONDITIONS OF ANY KIND, either express or implied. See the License for the
+ * specific language governing permissions and limitations under the License.
+ */
+
+package model
+
+import (
+	"testing"
+	"time"
+
+	"github.com/sclevine/spec"
+	"github.com/sclevine/spec/report"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"skenario/pkg/model/distributions"
+	"skenario/pkg/simulator"
+)
+
+func TestReplicasLaunching(t *testing.T) {
+	spec.Run(t, "ReplicasLaunching stock", testReplicasLaunching, spec.Report(report.Terminal{}))
+}
+
+func testReplicasLaunching(t *testing.T, describe spec.G, it spec.S) {
+	var subject ReplicasLaunchingStock
+	var rawSubject *replicasLaunchingStock
+	var envFake *FakeEnvironment
+	var config ReplicasConfig
+	var replicasActive simulator.ThroughStock
+	var first, second simulator.Entity
+
+	it.Before(func() {
+		envFake = &FakeEnvironment{Movements: make([]simulator.Movement, 0), TheTime: time.Unix(0, 0)}
+		config = ReplicasConfig{LaunchDelay: 111 * time.Nanosecond}
+		replicasActive = simulator.NewThroughStock("ReplicasActive", "Replica")
+		first = simulator.NewEntity("replica-1", "Replica")
+		second = simulator.NewEntity("replica-2", "Replica")
+	})
+
+	it.Before(func() {
+		subject = NewReplicasLaunchingStock(envFake, config, replicasActive)
+		rawSubject = subject.(*replicasLaunchingStock)
+	})
+
+	describe("Name()", func() {
+		it("calls itself ReplicasLaunching", func() {
+			assert.Equal(t, simulator.StockName("ReplicasLaunching"), subject.Name())
+		})
+	})
+
+	describe("Add()", func() {
+		describe("without launch phases", func() {
+			it.Before(func() {
+				require.NoError(t, subject.Add(first))
+			})
+
+			it("schedules the replica to become active after LaunchDelay", func() {
+				require.Len(t, envFake.Movements, 1)
+				assert.Equal(t, simulator.MovementKind("finish_launching"), envFake.Movements[0].Kind())
+				assert.Equal(t, time.Unix(0, 111), envFake.Movements[0].OccursAt())
+				assert.Equal(t, replicasActive, envFake.Movements[0].To())
+			})
+		})
+
+		describe("with launch phases", func() {
+			it.Before(func() {
+				config.LaunchPhases = []Phase{
+					{Name: "image_pull", Delay: distributions.NewConstant(2 * time.Second)},
+					{Name: "readiness_probe", Delay: distributions.NewConstant(3 * time.Second)},
+				}
+				subject = NewReplicasLaunchingStock(envFake, config, replicasActive)
+				require.NoError(t, subject.Add(first))
+			})
+
+			it("adds up the phases", func() {
+				assert.Equal(t, time.Unix(5, 0), envFake.Movements[0].OccursAt())
+			})
+
+			it("notes how long each phase took", func() {
+				assert.Equal(t, []string{"image_pull 2s, readiness_probe 3s"}, envFake.Movements[0].Notes())
+			})
+		})
+	})
+
+	describe("replicas that become ready out of order", func() {
+		it.Before(func() {
+			envFake.TheTime = time.Unix(5, 0)
+			require.NoError(t, subject.Add(first))
+			envFake.TheTime = time.Unix(0, 0)
+			require.NoError(t, subject.Add(second))
+		})
+
+		it("moves the replica each movement was scheduled for", func() {
+			assert.Equal(t, second, envFake.Movements[1].From().Remove())
+			assert.Equal(t, first, envFake.Movements[0].From().Remove())
+			assert.Equal(t, uint64(0), subject.Count())
+		})
+	})
+
+	describe("Remove()", func() {
+		it.Before(func() {
+			require.NoError(t, subject.Add(first))
+			envFake.TheTime = time.Unix(1, 0)
+			require.NoError(t, subject.Add(second))
+		})
+
+		it("gives up the replica furthest from being ready", func() {
+			assert.Equal(t, second, subject.Remove())
+			assert.Equal(t, uint64(1), subject.Count())
+		})
+
+		it("cancels its launch", func() {
+			cancelled := rawSubject.launches[second].finish.(*FakeScheduledMovement)
+			subject.Remove()
+
+			assert.True(t, cancelled.Cancelled)
+			assert.True(t, rawSubject.launches[first].finish.IsPending())
+		})
+	})
+}
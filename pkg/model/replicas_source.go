@@ -40,10 +40,16 @@ type replicaSource struct {
 	nextIPValue       uint32
 	maxReplicaRPS     int64
 	failedSink        simulator.SinkStock
+	size              replicaSize
+	cpu               CPUConfig
+	memory            MemoryConfig
+	oomKiller         *oomKiller
+	qualifier         string
+	calls             *serviceCalls
 }
 
 func (rs *replicaSource) Name() simulator.StockName {
-	return "ReplicaSource"
+	return qualifiedStockName(rs.qualifier, "ReplicaSource")
 }
 
 func (rs *replicaSource) KindStocked() simulator.EntityKind {
@@ -59,7 +65,19 @@ func (rs *replicaSource) EntitiesInStock() []*simulator.Entity {
 }
 
 func (rs *replicaSource) Remove() simulator.Entity {
-	return NewReplicaEntity(rs.env, rs.kubernetesClient, rs.endpointsInformer, rs.Next(), &rs.failedSink)
+	replica := NewReplicaEntity(rs.env, rs.kubernetesClient, rs.endpointsInformer, rs.Next(), &rs.failedSink)
+	replica.(*replicaEntity).resize(rs.size)
+	if rs.cpu.shared() {
+		replica.(*replicaEntity).shareCPU(rs.cpu)
+	}
+	if rs.memory.modelled() {
+		replica.(*replicaEntity).limitMemory(rs.memory, rs.oomKiller)
+	}
+	if rs.calls != nil {
+		replica.(*replicaEntity).makeCalls(rs.calls)
+	}
+
+	return replica
 }
 
 func (rs *replicaSource) Next() string {
@@ -79,5 +97,6 @@ func NewReplicaSource(env simulator.Environment, client kubernetes.Interface, in
 		nextIPValue:       1,
 		maxReplicaRPS:     maxReplicaRPS,
 		failedSink:        simulator.NewSinkStock("RequestsFailed", "Request"),
+		size:              ReplicasConfig{}.size(),
 	}
 }
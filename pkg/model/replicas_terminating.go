@@ -17,8 +17,8 @@ package model
 
 import (
 	"fmt"
+
 	"skenario/pkg/simulator"
-	"time"
 )
 
 type ReplicasTerminatingStock interface {
@@ -28,8 +28,9 @@ type ReplicasTerminatingStock interface {
 type replicasTerminatingStock struct {
 	env                simulator.Environment
 	config             ReplicasConfig
-	delegate           simulator.ThroughStock
+	delegate           *entityStock
 	replicasTerminated simulator.SinkStock
+	scheduler          *scheduler
 }
 
 func (rts *replicasTerminatingStock) Name() simulator.StockName {
@@ -49,26 +50,44 @@ func (rts *replicasTerminatingStock) EntitiesInStock() []*simulator.Entity {
 }
 
 func (rts *replicasTerminatingStock) Remove() simulator.Entity {
-	return rts.delegate.Remove()
+	entity := rts.delegate.Remove()
+	if entity != nil && rts.scheduler != nil {
+		rts.scheduler.release(entity)
+	}
+
+	return entity
+}
+
+func (rts *replicasTerminatingStock) take(entity simulator.Entity) simulator.Entity {
+	taken := rts.delegate.take(entity)
+	if taken != nil && rts.scheduler != nil {
+		rts.scheduler.release(taken)
+	}
+
+	return taken
 }
 
+// Add lets the replica drain. It finishes terminating TerminateDelay after its last in-flight
+// request has completed or failed.
 func (rts *replicasTerminatingStock) Add(entity simulator.Entity) error {
 	err := rts.delegate.Add(entity)
 	if err != nil {
 		return fmt.Errorf("could not add entity (%+v) to ReplicasTerminating stock: %s", entity, err.Error())
 	}
 
-	replica := entity.(Replica)
-	count := replica.RequestsProcessing().Count()
-	drainTime := time.Second * time.Duration(count)
+	if rts.scheduler != nil {
+		rts.scheduler.terminating(entity)
+	}
 
-	terminateAt := rts.env.CurrentMovementTime().Add(drainTime).Add(rts.config.TerminateDelay)
-	rts.env.AddToSchedule(simulator.NewMovement(
-		"finish_terminating",
-		terminateAt,
-		rts.delegate,
-		rts.replicasTerminated,
-	))
+	replica := entity.(Replica)
+	replica.RequestsProcessing().WhenDrained(func() {
+		rts.env.AddToSchedule(simulator.NewMovement(
+			"finish_terminating",
+			rts.env.CurrentMovementTime().Add(rts.config.terminateDelay().Sample(rts.env.Rand())),
+			departureOf(rts, entity),
+			rts.replicasTerminated,
+		))
+	})
 
 	return nil
 }
@@ -77,7 +96,7 @@ func NewReplicasTerminatingStock(env simulator.Environment, config ReplicasConfi
 	return &replicasTerminatingStock{
 		env:                env,
 		config:             config,
-		delegate:           simulator.NewThroughStock("ReplicasTerminating", "Replica"),
+		delegate:           newEntityStock("ReplicasTerminating", "Replica"),
 		replicasTerminated: replicasTerminated,
 	}
 }
@@ -16,13 +16,16 @@
 package model
 
 import (
+	"testing"
+	"time"
+
 	"github.com/sclevine/spec"
 	"github.com/sclevine/spec/report"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
+
+	"skenario/pkg/model/distributions"
 	"skenario/pkg/simulator"
-	"testing"
-	"time"
 )
 
 func TestReplicasTerminating(t *testing.T) {
@@ -94,14 +97,14 @@ func testReplicasTerminating(t *testing.T, describe spec.G, it spec.S) {
 			})
 		})
 
-		describe.Focus("when the replica has requests processing", func() {
+		describe("when the replica has requests processing", func() {
 			it.Before(func() {
 				totalCPUCapacityMillisPerSecond := 100.0
 				occupiedCPUCapacityMillisPerSecond := 0.0
 				failedSink := simulator.NewSinkStock("RequestsFailed", "Request")
 				processingStock = NewRequestsProcessingStock(envFake, 111, simulator.NewSinkStock("RequestsCompleted", "Request"),
 					&failedSink, &totalCPUCapacityMillisPerSecond, &occupiedCPUCapacityMillisPerSecond)
-				bufferStock := NewRequestsRoutingStock(envFake, NewReplicasActiveStock(), nil)
+				bufferStock := NewRequestsRoutingStock(envFake, NewReplicasActiveStock(envFake), nil)
 				err := processingStock.Add(NewRequestEntity(envFake, bufferStock, RequestConfig{CPUTimeMillis: 500, IOTimeMillis: 500, Timeout: 1 * time.Second}))
 				require.NoError(t, err)
 				replicaFake.ProcessingStock = processingStock
@@ -109,14 +112,54 @@ func testReplicasTerminating(t *testing.T, describe spec.G, it spec.S) {
 				require.NoError(t, err)
 			})
 
-			it("schedules movements from ReplicasTerminating to ReplicasTerminated", func() {
-				assert.Len(t, envFake.Movements, 2) // 1 request move and 1 replica move
-				assert.Equal(t, simulator.MovementKind("finish_terminating"), envFake.Movements[1].Kind())
+			it("waits for the requests to drain", func() {
+				assert.Len(t, envFake.Movements, 1) // the request completing
+			})
+
+			describe("once the last request has left", func() {
+				it.Before(func() {
+					envFake.TheTime = time.Unix(3, 0)
+					processingStock.Remove()
+				})
+
+				it("schedules movements from ReplicasTerminating to ReplicasTerminated", func() {
+					assert.Len(t, envFake.Movements, 2)
+					assert.Equal(t, simulator.MovementKind("finish_terminating"), envFake.Movements[1].Kind())
+				})
+
+				it("schedules movements that occur TerminateDelay after the request left", func() {
+					assert.Equal(t, time.Unix(3, 222), envFake.Movements[1].OccursAt())
+				})
+			})
+		})
+
+		describe("when the terminate delay is a distribution", func() {
+			it.Before(func() {
+				config.TerminateDelayDistribution = distributions.NewNormal(time.Second, 100*time.Millisecond)
+				subject = NewReplicasTerminatingStock(envFake, config, terminatedStock)
+				subject.Add(replicaFake)
+			})
+
+			it("samples the delay for each replica", func() {
+				delay := envFake.Movements[0].OccursAt().Sub(envFake.TheTime)
+				assert.NotEqual(t, time.Second, delay)
+				assert.InDelta(t, float64(time.Second), float64(delay), float64(500*time.Millisecond))
+			})
+		})
+
+		describe("when replicas finish terminating out of order", func() {
+			var otherReplica *FakeReplica
+
+			it.Before(func() {
+				otherReplica = new(FakeReplica)
+				subject.Add(replicaFake)
+				subject.Add(otherReplica)
 			})
 
-			it("schedules movements that occur after the last request completes + TerminateDelay", func() {
-				requestTimePlusDelayTime := envFake.TheTime.Add(222 * time.Nanosecond).Add(1 * time.Second)
-				assert.Equal(t, requestTimePlusDelayTime, envFake.Movements[1].OccursAt())
+			it("moves the replica each movement was scheduled for", func() {
+				assert.Same(t, otherReplica, envFake.Movements[1].From().Remove())
+				assert.Same(t, replicaFake, envFake.Movements[0].From().Remove())
+				assert.Equal(t, uint64(0), subject.Count())
 			})
 		})
 	})
@@ -17,6 +17,9 @@ package model
 
 import (
 	"fmt"
+	"sync/atomic"
+	"time"
+
 	"skenario/pkg/simulator"
 )
 
@@ -34,11 +37,27 @@ type requestEntity struct {
 	requestConfig                        RequestConfig
 	routingStock                         RequestsRoutingStock
 	utilizationForRequestMillisPerSecond *float64
+	cpuTime                              time.Duration
+	ioTime                               time.Duration
+	attempts                             int
+	retrying                             *requestsRetryingStock
+
+	// requestsFailed is where the request fails to from RequestsRetrying if it may not be
+	// retried. It is the failed stock of the cluster its last attempt failed in.
+	requestsFailed simulator.SinkStock
+
+	// calls are the synchronous calls the request is waiting for on its replica, if any.
+	calls *pendingCalls
+	// returnTo is waiting for the request, when it is a synchronous call made by another.
+	returnTo *pendingCalls
 }
 
-var reqNumber int
+var reqNumber int32
 
 func (re *requestEntity) Name() simulator.EntityName {
+	if re.requestConfig.Class != "" {
+		return simulator.EntityName(fmt.Sprintf("request-%d [%s]", re.number, re.requestConfig.Class))
+	}
 	return simulator.EntityName(fmt.Sprintf("request-%d", re.number))
 }
 
@@ -47,13 +66,33 @@ func (re *requestEntity) Kind() simulator.EntityKind {
 }
 
 func NewRequestEntity(env simulator.Environment, routingStock RequestsRoutingStock, requestConfig RequestConfig) RequestEntity {
-	reqNumber++
 	utilizationForRequest := 0.0
 	return &requestEntity{
 		env:                                  env,
-		number:                               reqNumber,
+		number:                               int(atomic.AddInt32(&reqNumber, 1)),
 		routingStock:                         routingStock,
 		requestConfig:                        requestConfig,
 		utilizationForRequestMillisPerSecond: &utilizationForRequest,
+		cpuTime:                              requestConfig.sampleCPUTime(env),
+		ioTime:                               requestConfig.sampleIOTime(env),
+	}
+}
+
+// failedInto is where a request goes when an attempt at it fails: RequestsRetrying if the client
+// will try again, otherwise the stock of failed requests, which tells the request that called it
+// if it was a synchronous call.
+func failedInto(entity simulator.Entity, requestsFailed simulator.SinkStock) simulator.SinkStock {
+	request, ok := entity.(*requestEntity)
+	if !ok {
+		return requestsFailed
+	}
+	if request.returnTo != nil {
+		return &returningCall{SinkStock: requestsFailed, pending: request.returnTo, ok: false}
 	}
+	if request.retrying == nil || request.attempts >= request.requestConfig.Retry.MaxAttempts {
+		return requestsFailed
+	}
+
+	request.requestsFailed = requestsFailed
+	return request.retrying
 }
@@ -24,6 +24,7 @@ import (
 	"github.com/sclevine/spec/report"
 	"github.com/stretchr/testify/assert"
 
+	"skenario/pkg/model/distributions"
 	"skenario/pkg/simulator"
 )
 
@@ -38,7 +39,7 @@ func testRequestEntity(t *testing.T, describe spec.G, it spec.S) {
 	var routingStock RequestsRoutingStock
 
 	it.Before(func() {
-		routingStock = NewRequestsRoutingStock(envFake, NewReplicasActiveStock(), nil)
+		routingStock = NewRequestsRoutingStock(envFake, NewReplicasActiveStock(envFake), nil)
 		envFake = new(FakeEnvironment)
 		subject = NewRequestEntity(envFake, routingStock, RequestConfig{CPUTimeMillis: 500, IOTimeMillis: 500, Timeout: 1 * time.Second})
 		rawSubject = subject.(*requestEntity)
@@ -73,5 +74,26 @@ func testRequestEntity(t *testing.T, describe spec.G, it spec.S) {
 		it("implements Kind()", func() {
 			assert.Equal(t, simulator.EntityKind("Request"), subject.Kind())
 		})
+
+		it("needs the configured CPU and IO time", func() {
+			assert.Equal(t, 500*time.Millisecond, rawSubject.cpuTime)
+			assert.Equal(t, 500*time.Millisecond, rawSubject.ioTime)
+		})
+
+		it("samples its CPU and IO time from distributions when given", func() {
+			sampled := NewRequestEntity(envFake, routingStock, RequestConfig{
+				CPUTimeMillis: 500,
+				CPUTime:       distributions.NewConstant(7 * time.Millisecond),
+				IOTime:        distributions.NewExponential(time.Second),
+			}).(*requestEntity)
+
+			assert.Equal(t, 7*time.Millisecond, sampled.cpuTime)
+			assert.NotEqual(t, time.Duration(0), sampled.ioTime)
+		})
+
+		it("names the class of the request", func() {
+			classy := NewRequestEntity(envFake, routingStock, RequestConfig{Class: "reports"})
+			assert.Equal(t, simulator.EntityName(fmt.Sprintf("request-%d [reports]", classy.(*requestEntity).number)), classy.Name())
+		})
 	})
 }
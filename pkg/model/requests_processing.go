@@ -27,17 +27,32 @@ import (
 type RequestsProcessingStock interface {
 	simulator.ThroughStock
 	RequestCount() int32
+	WhenDrained(callback func())
+	FailAll()
 }
 
 type requestsProcessingStock struct {
 	env                                simulator.Environment
-	delegate                           simulator.ThroughStock
+	delegate                           *entityStock
 	replicaNumber                      int
 	requestsComplete                   simulator.SinkStock
 	requestsFailed                     *simulator.SinkStock
 	numRequestsSinceLast               int32
 	totalCPUCapacityMillisPerSecond    *float64
 	occupiedCPUCapacityMillisPerSecond *float64
+	drained                            []func()
+	outcomes                           map[simulator.Entity]simulator.ScheduledMovement
+	down                               bool
+	downKind                           simulator.MovementKind
+	restartAt                          time.Time
+	cpu                                *sharedCPU
+	calls                              *serviceCalls
+
+	// memoryInUseBytes is the memory of the requests in the stock. When it comes to more than
+	// memoryAvailableBytes, the replica is out of memory.
+	memoryInUseBytes     int64
+	memoryAvailableBytes int64
+	outOfMemory          func()
 }
 
 func (rps *requestsProcessingStock) Name() simulator.StockName {
@@ -58,36 +73,273 @@ func (rps *requestsProcessingStock) EntitiesInStock() []*simulator.Entity {
 }
 
 func (rps *requestsProcessingStock) Remove() simulator.Entity {
-	request := rps.delegate.Remove().(*requestEntity)
-	*rps.occupiedCPUCapacityMillisPerSecond -= *request.utilizationForRequestMillisPerSecond
+	if rps.delegate.Count() == 0 {
+		return nil
+	}
+
+	return rps.take(*rps.delegate.EntitiesInStock()[0])
+}
+
+func (rps *requestsProcessingStock) take(entity simulator.Entity) simulator.Entity {
+	taken := rps.delegate.take(entity)
+	if taken == nil {
+		return nil
+	}
+
+	request := taken.(*requestEntity)
+	delete(rps.outcomes, taken)
+	request.calls = nil
+	rps.memoryInUseBytes -= request.requestConfig.MemoryBytes
+	if rps.cpu != nil {
+		rps.cpu.advance(rps.env.CurrentMovementTime(), *rps.totalCPUCapacityMillisPerSecond)
+		rps.cpu.remove(request)
+		if !rps.isDown() {
+			rps.replan()
+		}
+	} else {
+		*rps.occupiedCPUCapacityMillisPerSecond -= *request.utilizationForRequestMillisPerSecond
+	}
+
+	if rps.delegate.Count() == 0 {
+		rps.notifyDrained()
+	}
+
 	return request
 }
 
+// WhenDrained calls back once the last request in the stock has left it, or straight away if
+// there are none.
+func (rps *requestsProcessingStock) WhenDrained(callback func()) {
+	rps.drained = append(rps.drained, callback)
+	if rps.delegate.Count() == 0 {
+		rps.notifyDrained()
+	}
+}
+
+func (rps *requestsProcessingStock) notifyDrained() {
+	drained := rps.drained
+	rps.drained = nil
+	for _, callback := range drained {
+		callback()
+	}
+}
+
 func (rps *requestsProcessingStock) Add(entity simulator.Entity) error {
-	var totalTime time.Duration
+	err := rps.delegate.Add(entity)
+	if err != nil {
+		return err
+	}
+
+	rps.memoryInUseBytes += entity.(*requestEntity).requestConfig.MemoryBytes
+	if rps.isDown() {
+		rps.fail(entity)
+		return nil
+	}
+	if rps.memoryAvailableBytes > 0 && rps.memoryInUseBytes > rps.memoryAvailableBytes {
+		rps.outOfMemory()
+		return nil
+	}
+
 	rps.numRequestsSinceLast++
+	if rps.calls != nil {
+		rps.calls.make(rps, entity.(*requestEntity))
+	}
+	if rps.cpu != nil {
+		rps.shareCPU(entity.(*requestEntity))
+		return nil
+	}
+
+	var totalTime time.Duration
 	request := *entity.(*requestEntity)
 	isRequestSuccessful := true
+	*request.utilizationForRequestMillisPerSecond = 0
 
 	rps.calculateCPUUtilizationForRequest(request, &totalTime, &isRequestSuccessful)
 
 	if isRequestSuccessful {
-		rps.env.AddToSchedule(simulator.NewMovement(
-			"complete_request",
-			rps.env.CurrentMovementTime().Add(totalTime),
-			rps,
-			rps.requestsComplete,
-		))
+		kind, at := rps.awaitCalls(entity.(*requestEntity), "complete_request", rps.env.CurrentMovementTime().Add(totalTime))
+		rps.schedule(entity.(*requestEntity), kind, at)
 	} else {
-		rps.env.AddToSchedule(simulator.NewMovement(
-			"request_failed",
-			rps.env.CurrentMovementTime().Add(request.requestConfig.Timeout),
-			rps,
-			*rps.requestsFailed,
-		))
+		rps.schedule(entity.(*requestEntity), "request_failed", rps.env.CurrentMovementTime().Add(request.requestConfig.Timeout))
 	}
 
-	return rps.delegate.Add(entity)
+	return nil
+}
+
+// shareCPU starts a request on a shared CPU, which changes when the other requests will be done.
+func (rps *requestsProcessingStock) shareCPU(request *requestEntity) {
+	now := rps.env.CurrentMovementTime()
+	rps.cpu.advance(now, *rps.totalCPUCapacityMillisPerSecond)
+	rps.cpu.add(&cpuTask{
+		request:  request,
+		work:     float64(request.cpuTime),
+		deadline: now.Add(request.requestConfig.Timeout),
+	})
+	rps.replan()
+}
+
+// replan predicts when each request on a shared CPU will be done, and moves its outcome to
+// match. Requests which would be done after their timeout fail at the timeout instead.
+func (rps *requestsProcessingStock) replan() {
+	now := rps.env.CurrentMovementTime()
+	capacity := *rps.totalCPUCapacityMillisPerSecond
+
+	cpuDone := rps.cpu.predict(capacity)
+	for i, task := range rps.cpu.tasks {
+		kind, at := simulator.MovementKind("complete_request"), cpuDone[i].Add(task.request.ioTime)
+		if at.After(task.deadline) {
+			kind, at = "request_failed", task.deadline
+		}
+		kind, at = rps.awaitCalls(task.request, kind, at)
+		if !at.After(now) {
+			at = now.Add(1 * time.Nanosecond)
+		}
+
+		rps.plan(task, kind, at)
+	}
+
+	*rps.occupiedCPUCapacityMillisPerSecond = rps.cpu.utilization(capacity)
+}
+
+func (rps *requestsProcessingStock) plan(task *cpuTask, kind simulator.MovementKind, at time.Time) {
+	outcome, planned := rps.outcomes[task.request]
+	if planned && task.outcomeKind == kind {
+		if task.outcomeAt.Equal(at) {
+			return
+		}
+		if outcome.Reschedule(at) {
+			task.outcomeAt = at
+			return
+		}
+	}
+	if planned {
+		outcome.Cancel()
+	}
+
+	if rps.schedule(task.request, kind, at) {
+		task.outcomeKind, task.outcomeAt = kind, at
+	}
+}
+
+// schedule schedules the outcome of a request, and reports whether it could be scheduled.
+func (rps *requestsProcessingStock) schedule(request *requestEntity, kind simulator.MovementKind, at time.Time) bool {
+	to := completedInto(request, rps.requestsComplete)
+	if kind != "complete_request" {
+		to = failedInto(request, *rps.requestsFailed)
+	}
+
+	scheduled, added := rps.env.ScheduleMovement(simulator.NewMovement(kind, at, departureOf(rps, request), to))
+	if added {
+		rps.outcomes[request] = scheduled
+	} else {
+		delete(rps.outcomes, request)
+	}
+	return added
+}
+
+// awaitCalls is the outcome of a request which would otherwise have the given outcome, when
+// it has made synchronous calls. A request which would complete fails straight away if one of
+// its calls has failed, fails at its timeout if it is still waiting for calls, and otherwise
+// completes once its own work is done.
+func (rps *requestsProcessingStock) awaitCalls(request *requestEntity, kind simulator.MovementKind, at time.Time) (simulator.MovementKind, time.Time) {
+	pending := request.calls
+	if pending == nil || kind != "complete_request" {
+		return kind, at
+	}
+
+	pending.workDoneAt = at
+	switch {
+	case !pending.failedAt.IsZero():
+		return "call_failed", pending.failedAt
+	case pending.waiting > 0:
+		return "request_failed", pending.deadline
+	}
+
+	if now := rps.env.CurrentMovementTime(); !at.After(now) {
+		at = now.Add(1 * time.Nanosecond)
+	}
+	return kind, at
+}
+
+// callsChanged plans the outcome of a request again, once its calls have all returned or one of
+// them has failed.
+func (rps *requestsProcessingStock) callsChanged(request *requestEntity) {
+	if rps.isDown() {
+		return
+	}
+
+	if rps.cpu != nil {
+		rps.cpu.advance(rps.env.CurrentMovementTime(), *rps.totalCPUCapacityMillisPerSecond)
+		rps.replan()
+		return
+	}
+
+	// a request which was never going to be done in time fails at its timeout regardless
+	if request.calls.workDoneAt.IsZero() {
+		return
+	}
+
+	if outcome, ok := rps.outcomes[request]; ok {
+		outcome.Cancel()
+	}
+	kind, at := rps.awaitCalls(request, "complete_request", request.calls.workDoneAt)
+	rps.schedule(request, kind, at)
+}
+
+// setCPUCapacity changes the CPU capacity of the replica. Requests which already have their
+// processing time carry on as they were, unless they share the CPU.
+func (rps *requestsProcessingStock) setCPUCapacity(millisPerSecond float64) {
+	if rps.cpu != nil {
+		rps.cpu.advance(rps.env.CurrentMovementTime(), *rps.totalCPUCapacityMillisPerSecond)
+	}
+
+	*rps.totalCPUCapacityMillisPerSecond = millisPerSecond
+
+	if rps.cpu != nil && !rps.isDown() {
+		rps.replan()
+	}
+}
+
+// FailAll fails every request in the stock straight away, and any that arrive later, as when
+// the replica processing them has been killed. The requests fail with "replica_killed" movements.
+func (rps *requestsProcessingStock) FailAll() {
+	rps.down = true
+	rps.downKind = "replica_killed"
+	rps.failInFlight()
+}
+
+// crash fails every request in the stock straight away, and any that arrive before restartAt,
+// as when the replica processing them has crashed and will be restarted. The requests fail
+// with a movement of the given kind.
+func (rps *requestsProcessingStock) crash(kind simulator.MovementKind, restartAt time.Time) {
+	rps.downKind = kind
+	rps.restartAt = restartAt
+	rps.failInFlight()
+}
+
+func (rps *requestsProcessingStock) isDown() bool {
+	return rps.down || rps.env.CurrentMovementTime().Before(rps.restartAt)
+}
+
+func (rps *requestsProcessingStock) failInFlight() {
+	for _, e := range rps.delegate.EntitiesInStock() {
+		if outcome, ok := rps.outcomes[*e]; ok {
+			outcome.Cancel()
+		}
+		rps.fail(*e)
+	}
+}
+
+func (rps *requestsProcessingStock) fail(request simulator.Entity) {
+	scheduled, added := rps.env.ScheduleMovement(simulator.NewMovement(
+		rps.downKind,
+		rps.env.CurrentMovementTime().Add(1*time.Nanosecond),
+		departureOf(rps, request),
+		failedInto(request, *rps.requestsFailed),
+	))
+	if added {
+		rps.outcomes[request] = scheduled
+	}
 }
 
 func (rps *requestsProcessingStock) calculateCPUUtilizationForRequest(request requestEntity, totalTime *time.Duration, isRequestSuccessful *bool) {
@@ -97,10 +349,10 @@ func (rps *requestsProcessingStock) calculateCPUUtilizationForRequest(request re
 	if freeCPUCapacityMillisPerSecond > eps {
 		//step 2 Calculate how many cpu time we need to process this request, need to multiply by 1000
 		//to get cpuTimeMillis in milliseconds
-		cpuTimeMillis := float64(request.requestConfig.CPUTimeMillis) * 1000 / freeCPUCapacityMillisPerSecond
+		cpuTimeMillis := float64(request.cpuTime) / float64(time.Millisecond) * 1000 / freeCPUCapacityMillisPerSecond
 
 		//step 3 Calculate how many time we need to process this request taking into account io time
-		processingTimeMillis := cpuTimeMillis + float64(request.requestConfig.IOTimeMillis)
+		processingTimeMillis := cpuTimeMillis + float64(request.ioTime)/float64(time.Millisecond)
 
 		//step 4 Calculate average cpu load for the request that is utilization for the request
 		utilizationForRequestMillisPerSecond := cpuTimeMillis * freeCPUCapacityMillisPerSecond / processingTimeMillis
@@ -110,13 +362,11 @@ func (rps *requestsProcessingStock) calculateCPUUtilizationForRequest(request re
 		//step 5 Add  this utilization to occupied cpu capacity, we'll subtract it Remove() method
 		*rps.occupiedCPUCapacityMillisPerSecond += utilizationForRequestMillisPerSecond
 
-		rng := rand.New(rand.NewSource(time.Now().UnixNano()))
-
-		//step 6 Calculate currentUtilization in percentage
-		currentUtilization := *rps.occupiedCPUCapacityMillisPerSecond * 100 / *rps.totalCPUCapacityMillisPerSecond
+		//step 6 Calculate currentUtilization in percentage, counting only the requests this one queues behind
+		currentUtilization := rps.occupiedAtOrAbove(request.requestConfig.Priority) * 100 / *rps.totalCPUCapacityMillisPerSecond
 
 		//step 7 Calculate delay by sakasegawaApproximation which plus processing time forms total time for processing a request
-		*totalTime = calculateTime(currentUtilization, time.Duration(processingTimeMillis)*time.Millisecond, rng)
+		*totalTime = calculateTime(currentUtilization, time.Duration(processingTimeMillis)*time.Millisecond, rps.env.Rand())
 
 		*isRequestSuccessful = *totalTime <= request.requestConfig.Timeout
 	} else {
@@ -124,6 +374,19 @@ func (rps *requestsProcessingStock) calculateCPUUtilizationForRequest(request re
 	}
 }
 
+// occupiedAtOrAbove is the CPU occupied by requests of the given priority or higher, which are
+// the requests a request of that priority has to queue behind.
+func (rps *requestsProcessingStock) occupiedAtOrAbove(priority int) float64 {
+	occupied := *rps.occupiedCPUCapacityMillisPerSecond
+	for _, e := range rps.delegate.EntitiesInStock() {
+		request := (*e).(*requestEntity)
+		if request.requestConfig.Priority < priority {
+			occupied -= *request.utilizationForRequestMillisPerSecond
+		}
+	}
+	return occupied
+}
+
 func (rps *requestsProcessingStock) RequestCount() int32 {
 	rc := rps.numRequestsSinceLast
 	rps.numRequestsSinceLast = 0
@@ -134,12 +397,13 @@ func NewRequestsProcessingStock(env simulator.Environment, replicaNumber int, re
 	requestFailed *simulator.SinkStock, totalCPUCapacityMillisPerSecond *float64, occupiedCPUCapacityMillisPerSecond *float64) RequestsProcessingStock {
 	return &requestsProcessingStock{
 		env:                                env,
-		delegate:                           simulator.NewThroughStock("RequestsProcessing", "Request"),
+		delegate:                           newEntityStock("RequestsProcessing", "Request"),
 		replicaNumber:                      replicaNumber,
 		requestsComplete:                   requestComplete,
 		requestsFailed:                     requestFailed,
 		occupiedCPUCapacityMillisPerSecond: occupiedCPUCapacityMillisPerSecond,
 		totalCPUCapacityMillisPerSecond:    totalCPUCapacityMillisPerSecond,
+		outcomes:                           make(map[simulator.Entity]simulator.ScheduledMovement),
 	}
 }
 
@@ -73,7 +73,7 @@ func testRequestsProcessing(t *testing.T, describe spec.G, it spec.S) {
 		var request simulator.Entity
 
 		it.Before(func() {
-			bufferStock := NewRequestsRoutingStock(envFake, NewReplicasActiveStock(), nil)
+			bufferStock := NewRequestsRoutingStock(envFake, NewReplicasActiveStock(envFake), nil)
 			request = NewRequestEntity(envFake, bufferStock, RequestConfig{CPUTimeMillis: 200, IOTimeMillis: 200, Timeout: 3 * time.Second})
 			subject.Add(request)
 		})
@@ -87,14 +87,34 @@ func testRequestsProcessing(t *testing.T, describe spec.G, it spec.S) {
 				assert.Equal(t, simulator.StockName("RequestsComplete"), envFake.Movements[0].To().Name())
 			})
 		})
+
+		describe("requests of different priorities", func() {
+			var high, low simulator.Entity
+
+			it.Before(func() {
+				bufferStock := NewRequestsRoutingStock(envFake, NewReplicasActiveStock(envFake), nil)
+				low = NewRequestEntity(envFake, bufferStock, RequestConfig{CPUTimeMillis: 200, IOTimeMillis: 200, Timeout: 3 * time.Second})
+				high = NewRequestEntity(envFake, bufferStock, RequestConfig{Priority: 1, CPUTimeMillis: 200, IOTimeMillis: 200, Timeout: 3 * time.Second})
+				subject.Add(low)
+				subject.Add(high)
+			})
+
+			it("only counts the CPU of equal or higher priority requests towards queueing", func() {
+				highUtilization := *high.(*requestEntity).utilizationForRequestMillisPerSecond
+
+				assert.Equal(t, *rawSubject.occupiedCPUCapacityMillisPerSecond, rawSubject.occupiedAtOrAbove(0))
+				assert.InDelta(t, highUtilization, rawSubject.occupiedAtOrAbove(1), 0.0001)
+				assert.True(t, *low.(*requestEntity).utilizationForRequestMillisPerSecond > 0)
+			})
+		})
 	})
 
 	describe("RequestCount()", func() {
 		it.Before(func() {
 
-			subject.Add(NewRequestEntity(envFake, NewRequestsRoutingStock(envFake, NewReplicasActiveStock(), nil),
+			subject.Add(NewRequestEntity(envFake, NewRequestsRoutingStock(envFake, NewReplicasActiveStock(envFake), nil),
 				RequestConfig{CPUTimeMillis: 200, IOTimeMillis: 200, Timeout: 1 * time.Second}))
-			subject.Add(NewRequestEntity(envFake, NewRequestsRoutingStock(envFake, NewReplicasActiveStock(), nil),
+			subject.Add(NewRequestEntity(envFake, NewRequestsRoutingStock(envFake, NewReplicasActiveStock(envFake), nil),
 				RequestConfig{CPUTimeMillis: 200, IOTimeMillis: 200, Timeout: 1 * time.Second}))
 		})
 
@@ -0,0 +1,198 @@
+/*
+ * Copyright (C) 2019-Present Pivotal Software, Inc. All rights reserved.
+ *
+ * This program and the accompanying materials are made available under the terms
+ * of the Apache License, Version 2.0 (the "License”); you may not use this file
+ * except in compliance with the License. You may obtain a copy of the License at:
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software distributed
+ * under the License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR
+ * CONDITIONS OF ANY KIND, either express or implied. See the License for the
+ * specific language governing permissions and limitations under the License.
+ */
+
+package model
+
+import (
+	"fmt"
+	"math"
+	"math/rand"
+	"time"
+
+	"skenario/pkg/simulator"
+)
+
+// retryBudgetWindow is how far back a retry budget looks when comparing retries to requests.
+const retryBudgetWindow = 10 * time.Second
+
+// minRetriesInBudget are the retries allowed in any window, however few requests there were,
+// so that a quiet service can still retry.
+const minRetriesInBudget = 3
+
+// RetryPolicy is how clients retry requests which fail, whether for lack of replicas, because
+// they timed out or because the replica processing them crashed. A request is attempted at
+// most MaxAttempts times in all; with MaxAttempts of 0 or 1 it is never retried.
+//
+// Before each retry the client backs off for InitialBackoff, multiplied by Multiplier (2 if not
+// set) for every earlier retry and capped at MaxBackoff. Jitter takes up to that fraction off
+// each backoff at random; a Jitter of 1 is "full jitter".
+//
+// Budget limits retries to that fraction of the requests sent in the last 10 seconds, as a
+// retry budget in a service mesh does, with at least 3 retries allowed at any time. Requests
+// which may not be retried because the budget is spent fail straight away. A Budget of 0
+// leaves retries unlimited.
+type RetryPolicy struct {
+	MaxAttempts    int           `json:"max_attempts"`
+	InitialBackoff time.Duration `json:"initial_backoff,omitempty"`
+	MaxBackoff     time.Duration `json:"max_backoff,omitempty"`
+	Multiplier     float64       `json:"multiplier,omitempty"`
+	Jitter         float64       `json:"jitter,omitempty"`
+	Budget         float64       `json:"budget,omitempty"`
+}
+
+func (rp RetryPolicy) Validate() error {
+	if rp.MaxAttempts < 0 {
+		return fmt.Errorf("retry policy has %d max_attempts, which is negative", rp.MaxAttempts)
+	}
+	if rp.InitialBackoff < 0 || rp.MaxBackoff < 0 {
+		return fmt.Errorf("retry policy has a negative backoff")
+	}
+	if rp.Multiplier != 0 && rp.Multiplier < 1 {
+		return fmt.Errorf("retry policy has a multiplier of %g, which is less than 1", rp.Multiplier)
+	}
+	if rp.Jitter < 0 || rp.Jitter > 1 {
+		return fmt.Errorf("retry policy has a jitter of %g, which is not between 0 and 1", rp.Jitter)
+	}
+	if rp.Budget < 0 {
+		return fmt.Errorf("retry policy has a budget of %g, which is negative", rp.Budget)
+	}
+
+	return nil
+}
+
+func (rp RetryPolicy) retries() bool {
+	return rp.MaxAttempts > 1
+}
+
+// backoff samples how long to wait before trying again, given the attempts made so far.
+func (rp RetryPolicy) backoff(attempts int, rng *rand.Rand) time.Duration {
+	multiplier := rp.Multiplier
+	if multiplier == 0 {
+		multiplier = 2
+	}
+
+	backoff := float64(rp.InitialBackoff) * math.Pow(multiplier, float64(attempts-1))
+	if rp.MaxBackoff > 0 && backoff > float64(rp.MaxBackoff) {
+		backoff = float64(rp.MaxBackoff)
+	}
+	backoff -= backoff * rp.Jitter * rng.Float64()
+
+	if backoff < 1 {
+		return 1 * time.Nanosecond
+	}
+	return time.Duration(backoff)
+}
+
+// requestsRetryingStock holds failed requests while their clients back off, then sends them
+// back to RequestsRouting for another attempt.
+type requestsRetryingStock struct {
+	env             simulator.Environment
+	delegate        *entityStock
+	requestsRouting RequestsRoutingStock
+	requestTimes    []time.Time
+	retryTimes      []time.Time
+}
+
+func (rrs *requestsRetryingStock) Name() simulator.StockName {
+	return rrs.delegate.Name()
+}
+
+func (rrs *requestsRetryingStock) KindStocked() simulator.EntityKind {
+	return rrs.delegate.KindStocked()
+}
+
+func (rrs *requestsRetryingStock) Count() uint64 {
+	return rrs.delegate.Count()
+}
+
+func (rrs *requestsRetryingStock) EntitiesInStock() []*simulator.Entity {
+	return rrs.delegate.EntitiesInStock()
+}
+
+func (rrs *requestsRetryingStock) Remove() simulator.Entity {
+	return rrs.delegate.Remove()
+}
+
+func (rrs *requestsRetryingStock) take(entity simulator.Entity) simulator.Entity {
+	return rrs.delegate.take(entity)
+}
+
+// Add schedules the request to be tried again once its backoff is over, or if the retry budget
+// is spent, to fail in the cluster its last attempt failed in.
+func (rrs *requestsRetryingStock) Add(entity simulator.Entity) error {
+	err := rrs.delegate.Add(entity)
+	if err != nil {
+		return err
+	}
+
+	now := rrs.env.CurrentMovementTime()
+	request := entity.(*requestEntity)
+	policy := request.requestConfig.Retry
+	if !rrs.withinBudget(now, policy.Budget) {
+		rrs.env.AddToSchedule(simulator.NewMovement(
+			"retry_budget_exhausted",
+			now.Add(1*time.Nanosecond),
+			departureOf(rrs, entity),
+			request.requestsFailed,
+		))
+		return nil
+	}
+	rrs.retryTimes = append(rrs.retryTimes, now)
+
+	attempts := request.attempts
+	backoff := policy.backoff(attempts, rrs.env.Rand())
+	retry := simulator.NewMovement("retry_request", now.Add(backoff), departureOf(rrs, entity), rrs.requestsRouting)
+	retry.AddNote(fmt.Sprintf("attempt %d after backing off for %s", attempts+1, backoff))
+	rrs.env.AddToSchedule(retry)
+
+	return nil
+}
+
+// recordRequest counts a new request, which a retry budget allows a fraction of a retry for.
+func (rrs *requestsRetryingStock) recordRequest() {
+	now := rrs.env.CurrentMovementTime()
+	rrs.requestTimes = append(timesSince(rrs.requestTimes, now.Add(-retryBudgetWindow)), now)
+}
+
+func (rrs *requestsRetryingStock) withinBudget(now time.Time, budget float64) bool {
+	if budget == 0 {
+		return true
+	}
+
+	since := now.Add(-retryBudgetWindow)
+	rrs.requestTimes = timesSince(rrs.requestTimes, since)
+	rrs.retryTimes = timesSince(rrs.retryTimes, since)
+
+	allowed := math.Max(minRetriesInBudget, budget*float64(len(rrs.requestTimes)))
+	return float64(len(rrs.retryTimes)) < allowed
+}
+
+// timesSince drops the times, which are in order, from before since.
+func timesSince(times []time.Time, since time.Time) []time.Time {
+	for i, t := range times {
+		if !t.Before(since) {
+			return times[i:]
+		}
+	}
+	return times[:0]
+}
+
+func newRequestsRetryingStock(env simulator.Environment, requestsRouting RequestsRoutingStock) *requestsRetryingStock {
+	return &requestsRetryingStock{
+		env:             env,
+		delegate:        newEntityStock("RequestsRetrying", "Request"),
+		requestsRouting: requestsRouting,
+	}
+}
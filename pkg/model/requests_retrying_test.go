@@ -0,0 +1,194 @@
+/*
+ * Copyright (C) 2019-Present Pivotal Software, Inc. All rights reserved.
+ *
+ * This program and the accompanying materials are made available under the terms
+ * of the Apache License, Version 2.0 (the "License”); you may not use this file
+ * except in compliance with the License. You may obtain a copy of the License at:
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software distributed
+ * under the License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR
+ * CONDITIONS OF ANY KIND, either express or implied. See the License for the
+ * specific language governing permissions and limitations under the License.
+ */
+
+package model
+
+import (
+	"testing"
+	"time"
+
+	"github.com/sclevine/spec"
+	"github.com/sclevine/spec/report"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"skenario/pkg/simulator"
+)
+
+func TestRequestsRetrying(t *testing.T) {
+	spec.Run(t, "RequestsRetrying stock", testRequestsRetrying, spec.Report(report.Terminal{}))
+}
+
+func testRequestsRetrying(t *testing.T, describe spec.G, it spec.S) {
+	var envFake *FakeEnvironment
+	var failed simulator.SinkStock
+	var routing RequestsRoutingStock
+	var source TrafficSource
+	var policy RetryPolicy
+
+	// perform carries out the first scheduled movement
+	perform := func() simulator.Movement {
+		require.NotEmpty(t, envFake.Movements)
+		m := envFake.Movements[0]
+		envFake.Movements = envFake.Movements[1:]
+		envFake.TheTime = m.OccursAt()
+		moved := m.From().Remove()
+		require.NotNil(t, moved)
+		require.NoError(t, m.To().Add(moved))
+		return m
+	}
+
+	arrive := func() simulator.Entity {
+		request := source.Remove()
+		require.NoError(t, routing.Add(request))
+		return request
+	}
+
+	it.Before(func() {
+		envFake = &FakeEnvironment{Movements: make([]simulator.Movement, 0), TheTime: time.Unix(0, 0)}
+		failed = simulator.NewSinkStock("RequestsFailed", "Request")
+		routing = NewRequestsRoutingStock(envFake, newEntityStock("ReplicasActive", "Replica"), failed)
+		policy = RetryPolicy{MaxAttempts: 3, InitialBackoff: 100 * time.Millisecond}
+	})
+
+	it.Before(func() {
+		source = NewTrafficSource(envFake, routing, RequestConfig{Timeout: time.Second, Retry: policy})
+	})
+
+	describe("a request which fails with attempts left", func() {
+		var request simulator.Entity
+
+		it.Before(func() {
+			request = arrive()
+			perform()
+		})
+
+		it("moves to RequestsRetrying", func() {
+			assert.Equal(t, uint64(0), failed.Count())
+			assert.Equal(t, uint64(1), source.(*trafficSource).retrying.Count())
+		})
+
+		it("is sent back to routing after backing off", func() {
+			retry := envFake.Movements[0]
+			assert.Equal(t, simulator.MovementKind("retry_request"), retry.Kind())
+			assert.Equal(t, time.Unix(0, 1).Add(100*time.Millisecond), retry.OccursAt())
+			assert.Equal(t, routing, retry.To())
+			assert.Equal(t, []string{"attempt 2 after backing off for 100ms"}, retry.Notes())
+		})
+
+		it("counts its attempts", func() {
+			perform()
+			assert.Equal(t, 2, request.(*requestEntity).attempts)
+		})
+
+		it("fails for good once it runs out of attempts", func() {
+			for i := 0; i < 4; i++ {
+				perform()
+			}
+
+			assert.Equal(t, 3, request.(*requestEntity).attempts)
+			assert.Equal(t, uint64(1), failed.Count())
+			assert.Empty(t, envFake.Movements)
+		})
+	})
+
+	describe("with a retry budget", func() {
+		it.Before(func() {
+			policy.Budget = 0.1
+			source = NewTrafficSource(envFake, routing, RequestConfig{Timeout: time.Second, Retry: policy})
+
+			for i := 0; i < 5; i++ {
+				arrive()
+			}
+			for i := 0; i < 5; i++ {
+				perform()
+			}
+		})
+
+		it("retries no more than the budget allows", func() {
+			kinds := make([]simulator.MovementKind, 0)
+			for _, m := range envFake.Movements {
+				kinds = append(kinds, m.Kind())
+			}
+
+			assert.Equal(t, []simulator.MovementKind{
+				"retry_request", "retry_request", "retry_request", "retry_budget_exhausted", "retry_budget_exhausted",
+			}, kinds)
+		})
+
+		it("fails the requests it may not retry into RequestsFailed", func() {
+			assert.Equal(t, failed, envFake.Movements[3].To())
+		})
+	})
+
+	describe("with requests split between revisions", func() {
+		var stable ClusterModel
+
+		it.Before(func() {
+			stable = NewCluster(envFake, ClusterConfig{Revision: "stable"}, ReplicasConfig{})
+			routing = NewTrafficSplit(envFake, time.Unix(0, 0), []ClusterModel{stable}, []TrafficSplit{
+				{At: 0, Percent: map[string]float64{"stable": 100}},
+			})
+			policy.Budget = 0.1
+			source = NewTrafficSource(envFake, routing, RequestConfig{Timeout: time.Second, Retry: policy})
+
+			for i := 0; i < 5; i++ {
+				arrive()
+			}
+			for i := 0; i < 10; i++ {
+				perform()
+			}
+		})
+
+		it("fails the requests it may not retry into the RequestsFailed of the revision they failed in", func() {
+			exhausted := envFake.Movements[3]
+			assert.Equal(t, simulator.MovementKind("retry_budget_exhausted"), exhausted.Kind())
+			assert.Equal(t, simulator.StockName("RequestsFailed [stable]"), exhausted.To().Name())
+		})
+	})
+
+	describe("RetryPolicy", func() {
+		describe("backoff()", func() {
+			it("grows exponentially up to MaxBackoff", func() {
+				policy = RetryPolicy{InitialBackoff: time.Second, MaxBackoff: 5 * time.Second}
+				assert.Equal(t, time.Second, policy.backoff(1, envFake.Rand()))
+				assert.Equal(t, 4*time.Second, policy.backoff(3, envFake.Rand()))
+				assert.Equal(t, 5*time.Second, policy.backoff(4, envFake.Rand()))
+			})
+
+			it("takes off up to Jitter of the backoff at random", func() {
+				policy = RetryPolicy{InitialBackoff: time.Second, Jitter: 0.5}
+				for i := 0; i < 100; i++ {
+					backoff := policy.backoff(1, envFake.Rand())
+					assert.True(t, backoff >= 500*time.Millisecond && backoff <= time.Second)
+				}
+			})
+		})
+
+		describe("Validate()", func() {
+			it("accepts sensible policies", func() {
+				assert.NoError(t, RetryPolicy{MaxAttempts: 3, InitialBackoff: time.Second, Jitter: 1, Budget: 0.2}.Validate())
+			})
+
+			it("rejects jitter above 1", func() {
+				assert.Error(t, RetryPolicy{MaxAttempts: 3, Jitter: 1.5}.Validate())
+			})
+
+			it("rejects multipliers which would shrink the backoff", func() {
+				assert.Error(t, RetryPolicy{MaxAttempts: 3, Multiplier: 0.5}.Validate())
+			})
+		})
+	})
+}
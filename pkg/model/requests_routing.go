@@ -27,10 +27,12 @@ type RequestsRoutingStock interface {
 
 type requestsRoutingStock struct {
 	env            simulator.Environment
-	delegate       simulator.ThroughStock
+	delegate       *entityStock
 	replicas       ReplicasActiveStock
 	requestsFailed simulator.SinkStock
 	countRequests  int
+	// partitioned counts the partition faults in effect on each replica cut off from routing
+	partitioned map[simulator.Entity]int
 }
 
 func (rbs *requestsRoutingStock) Name() simulator.StockName {
@@ -53,40 +55,64 @@ func (rbs *requestsRoutingStock) Remove() simulator.Entity {
 	return rbs.delegate.Remove()
 }
 
+func (rbs *requestsRoutingStock) take(entity simulator.Entity) simulator.Entity {
+	return rbs.delegate.take(entity)
+}
+
 func (rbs *requestsRoutingStock) Add(entity simulator.Entity) error {
 	addResult := rbs.delegate.Add(entity)
 
 	rbs.countRequests++
+	if request, ok := entity.(*requestEntity); ok {
+		request.attempts++
+	}
 
-	countReplicas := rbs.replicas.Count()
+	replicas := rbs.reachableReplicas()
+	countReplicas := uint64(len(replicas))
 	if countReplicas > 0 {
-		replicas := rbs.replicas.EntitiesInStock()
 		replica := (*replicas[uint64(rbs.countRequests)%countReplicas]).(ReplicaEntity)
 
 		rbs.env.AddToSchedule(simulator.NewMovement(
 			"send_to_replica",
 			rbs.env.CurrentMovementTime().Add(1*time.Nanosecond),
-			rbs,
+			departureOf(rbs, entity),
 			replica.RequestsProcessing(),
 		))
 	} else {
 		rbs.env.AddToSchedule(simulator.NewMovement(
 			"request_failed",
 			rbs.env.CurrentMovementTime().Add(1*time.Nanosecond),
-			rbs,
-			rbs.requestsFailed,
+			departureOf(rbs, entity),
+			failedInto(entity, rbs.requestsFailed),
 		))
 	}
 
 	return addResult
 }
 
+// reachableReplicas are the active replicas which have not been partitioned from routing.
+func (rbs *requestsRoutingStock) reachableReplicas() []*simulator.Entity {
+	replicas := rbs.replicas.EntitiesInStock()
+	if len(rbs.partitioned) == 0 {
+		return replicas
+	}
+
+	reachable := make([]*simulator.Entity, 0, len(replicas))
+	for _, r := range replicas {
+		if rbs.partitioned[*r] == 0 {
+			reachable = append(reachable, r)
+		}
+	}
+	return reachable
+}
+
 func NewRequestsRoutingStock(env simulator.Environment, replicas ReplicasActiveStock, requestsFailed simulator.SinkStock) RequestsRoutingStock {
 	return &requestsRoutingStock{
 		env:            env,
-		delegate:       simulator.NewThroughStock("RequestsRouting", "Request"),
+		delegate:       newEntityStock("RequestsRouting", "Request"),
 		replicas:       replicas,
 		requestsFailed: requestsFailed,
 		countRequests:  0,
+		partitioned:    make(map[simulator.Entity]int),
 	}
 }
@@ -0,0 +1,204 @@
+/*
+ * Copyright (C) 2019-Present Pivotal Software, Inc. All rights reserved.
+ *
+ * This program and the accompanying materials are made available under the terms
+ * of the Apache License, Version 2.0 (the "License”); you may not use this file
+ * except in compliance with the License. You may obtain a copy of the License at:
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software distributed
+ * under the License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR
+ * CONDITIONS OF ANY KIND, either express or implied. See the License for the
+ * specific language governing permissions and limitations under the License.
+ */
+
+package model
+
+import (
+	"testing"
+	"time"
+
+	"github.com/sclevine/spec"
+	"github.com/sclevine/spec/report"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"skenario/pkg/simulator"
+)
+
+func TestScaleBounds(t *testing.T) {
+	spec.Run(t, "Scale bounds", testScaleBounds, spec.Report(report.Terminal{}))
+}
+
+func testScaleBounds(t *testing.T, describe spec.G, it spec.S) {
+	var envFake *FakeEnvironment
+	var cluster *clusterModel
+
+	kinds := func() []simulator.MovementKind {
+		kinds := make([]simulator.MovementKind, 0)
+		for _, m := range envFake.Movements {
+			kinds = append(kinds, m.Kind())
+		}
+		return kinds
+	}
+
+	it.Before(func() {
+		envFake = &FakeEnvironment{Movements: make([]simulator.Movement, 0), TheTime: time.Unix(0, 0)}
+		cluster = NewCluster(envFake, ClusterConfig{Service: "web", InitialNumberOfReplicas: 3}, ReplicasConfig{}).(*clusterModel)
+	})
+
+	describe("HPAConfig", func() {
+		it("clamps replicas to its min and max replicas, or to their defaults", func() {
+			assert.Equal(t, int32(1), HPAConfig{}.clamp(0))
+			assert.Equal(t, int32(10), HPAConfig{}.clamp(12))
+			assert.Equal(t, int32(4), HPAConfig{MinReplicas: 4, MaxReplicas: 8}.clamp(2))
+			assert.Equal(t, int32(5), HPAConfig{MinReplicas: 4, MaxReplicas: 8}.clamp(5))
+		})
+
+		it("lets the max replicas win when the min replicas is above it", func() {
+			assert.Equal(t, int32(2), HPAConfig{MinReplicas: 4, MaxReplicas: 2}.clamp(3))
+		})
+
+		it("rejects min replicas above max replicas", func() {
+			assert.NoError(t, HPAConfig{MinReplicas: 4}.Validate())
+			assert.Error(t, HPAConfig{MinReplicas: 12}.Validate())
+			assert.Error(t, HPAConfig{MinReplicas: -1}.Validate())
+		})
+	})
+
+	describe("bootstrap()", func() {
+		var desiredSource simulator.ThroughStock
+
+		it.Before(func() {
+			desiredSource = simulator.NewThroughStock("DesiredSource [web]", "Desired")
+		})
+
+		it("starts the cluster with its initial replicas desired and active", func() {
+			bootstrap(envFake, time.Unix(0, 0), cluster, desiredSource)
+			require.Len(t, envFake.Movements, 6)
+			for _, m := range envFake.Movements {
+				assert.Equal(t, time.Unix(0, 1), m.OccursAt())
+				envFake.TheTime = m.OccursAt()
+				require.NoError(t, m.To().Add(m.From().Remove()))
+			}
+
+			assert.Equal(t, uint64(3), cluster.Desired().Count())
+			assert.Equal(t, uint64(3), cluster.ActiveStock().Count())
+		})
+
+		it("does not launch the initial replicas", func() {
+			bootstrap(envFake, time.Unix(0, 0), cluster, desiredSource)
+			for _, m := range envFake.Movements {
+				require.NoError(t, m.To().Add(m.From().Remove()))
+			}
+
+			assert.NotContains(t, kinds(), simulator.MovementKind("begin_launch"))
+		})
+
+		it("keeps the initial replicas within the min and max replicas", func() {
+			cluster.hpa = HPAConfig{MaxReplicas: 2}
+			assert.Equal(t, int32(2), cluster.initialScale())
+
+			cluster.hpa = HPAConfig{MinReplicas: 5}
+			assert.Equal(t, int32(5), cluster.initialScale())
+
+			cluster.config.InitialNumberOfReplicas = 0
+			cluster.hpa = HPAConfig{}
+			assert.Equal(t, int32(1), cluster.initialScale())
+		})
+	})
+
+	describe("bootstrap() with nodes", func() {
+		// runUntil carries out scheduled movements in the order they occur, up to the given time
+		runUntil := func(until time.Time) {
+			for {
+				next := -1
+				for i, m := range envFake.Movements {
+					if !m.OccursAt().After(until) && (next < 0 || m.OccursAt().Before(envFake.Movements[next].OccursAt())) {
+						next = i
+					}
+				}
+				if next < 0 {
+					return
+				}
+
+				m := envFake.Movements[next]
+				envFake.Movements = append(envFake.Movements[:next:next], envFake.Movements[next+1:]...)
+				envFake.TheTime = m.OccursAt()
+				moved := m.From().Remove()
+				require.NotNil(t, moved, "nothing to move for '%s'", m.Kind())
+				require.NoError(t, m.To().Add(moved))
+			}
+		}
+
+		var node NodeEntity
+
+		it.Before(func() {
+			cluster = NewCluster(envFake, ClusterConfig{
+				Service:                 "web",
+				InitialNumberOfReplicas: 3,
+				Nodes:                   NodeConfig{InitialNodes: 1, CPUAllocatableMillis: 4000},
+			}, ReplicasConfig{LaunchDelay: time.Second}).(*clusterModel)
+
+			bootstrap(envFake, time.Unix(0, 0), cluster, simulator.NewThroughStock("DesiredSource [web]", "Desired"))
+			runUntil(time.Unix(10, 0))
+
+			nodes := cluster.scheduler.nodes.EntitiesInStock()
+			require.Len(t, nodes, 1)
+			node = (*nodes[0]).(NodeEntity)
+		})
+
+		it("schedules the initial replicas onto nodes before they become active", func() {
+			assert.Equal(t, uint64(3), cluster.Desired().Count())
+			assert.Equal(t, uint64(3), cluster.ActiveStock().Count())
+			assert.Equal(t, int64(300), node.CPURequested())
+		})
+
+		it("frees their nodes when they are released", func() {
+			replica := *cluster.ActiveStock().EntitiesInStock()[0]
+			cluster.scheduler.release(replica)
+
+			assert.Equal(t, int64(200), node.CPURequested())
+		})
+	})
+
+	describe("enforceScaleBounds()", func() {
+		var ticktock *autoscalerTicktockStock
+
+		it.Before(func() {
+			ticktock = NewAutoscalerTicktockStock(envFake, simulator.NewEntity("Autoscaler", "Autoscaler"), cluster).(*autoscalerTicktockStock)
+			cluster.hpa = HPAConfig{MinReplicas: 2, MaxReplicas: 5}
+		})
+
+		it("passes on recommendations within the bounds", func() {
+			desired, err := ticktock.enforceScaleBounds(3)
+			require.NoError(t, err)
+			assert.Equal(t, int32(3), desired)
+			assert.Empty(t, envFake.Movements)
+		})
+
+		it("clamps recommendations outside the bounds", func() {
+			desired, err := ticktock.enforceScaleBounds(8)
+			require.NoError(t, err)
+			assert.Equal(t, int32(5), desired)
+
+			desired, err = ticktock.enforceScaleBounds(0)
+			require.NoError(t, err)
+			assert.Equal(t, int32(2), desired)
+		})
+
+		it("records each clamped recommendation as a bound violation", func() {
+			_, err := ticktock.enforceScaleBounds(8)
+			require.NoError(t, err)
+			_, err = ticktock.enforceScaleBounds(0)
+			require.NoError(t, err)
+
+			assert.Equal(t, []simulator.MovementKind{"clamp_to_max_scale", "clamp_to_min_scale"}, kinds())
+			violation := envFake.Movements[0]
+			assert.Equal(t, simulator.StockName("ScaleRecommendations [web]"), violation.From().Name())
+			assert.Equal(t, simulator.StockName("BoundViolations [web]"), violation.To().Name())
+			assert.Equal(t, simulator.EntityName("bound-violation-1 (recommended 8)"), violation.From().Remove().Name())
+		})
+	})
+}
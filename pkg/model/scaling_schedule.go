@@ -0,0 +1,260 @@
+/*
+ * Copyright (C) 2019-Present Pivotal Software, Inc. All rights reserved.
+ *
+ * This program and the accompanying materials are made available under the terms
+ * of the Apache License, Version 2.0 (the "License”); you may not use this file
+ * except in compliance with the License. You may obtain a copy of the License at:
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software distributed
+ * under the License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR
+ * CONDITIONS OF ANY KIND, either express or implied. See the License for the
+ * specific language governing permissions and limitations under the License.
+ */
+
+package model
+
+import (
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/josephburnett/sk-plugin/pkg/skplug"
+	"github.com/josephburnett/sk-plugin/pkg/skplug/proto"
+
+	"skenario/pkg/simulator"
+)
+
+type ScalingActionKind string
+
+const (
+	// UpdateAutoscalerAction changes the minimum and maximum number of replicas or the target
+	// utilization of the autoscaler, and hands the new configuration to the plugin. Parameters
+	// which are not given keep their current values. An action which would leave the minimum
+	// above the maximum is rejected when it comes to be taken.
+	UpdateAutoscalerAction ScalingActionKind = "update_autoscaler"
+	// SetDesiredAction sets the number of desired replicas by hand, as scaling a deployment
+	// would, within the minimum and maximum number of replicas. The autoscaler is free to
+	// change it again on its next tick.
+	SetDesiredAction ScalingActionKind = "set_desired"
+)
+
+// ScalingAction is something an operator does to the scaling of a cluster during a run, such as
+// raising the minimum number of replicas ahead of an expected peak. It is taken once, At after
+// the start of the run, or whenever Cron comes round if it is given. Cron is read on the
+// simulated clock, which starts at midnight UTC on the 1st of January 1970.
+//
+// Target is the revision or service whose cluster the action applies to. Without it, the action
+// applies to every cluster.
+type ScalingAction struct {
+	Kind   ScalingActionKind `json:"kind"`
+	Target string            `json:"target,omitempty"`
+	At     time.Duration     `json:"at,omitempty"`
+	Cron   string            `json:"cron,omitempty"`
+
+	MinReplicas       int32 `json:"min_replicas,omitempty"`
+	MaxReplicas       int32 `json:"max_replicas,omitempty"`
+	TargetUtilization int32 `json:"target_utilization,omitempty"`
+
+	Replicas int32 `json:"replicas,omitempty"`
+}
+
+func (sa ScalingAction) Validate() error {
+	switch sa.Kind {
+	case UpdateAutoscalerAction:
+		if sa.MinReplicas < 0 || sa.MaxReplicas < 0 || sa.TargetUtilization < 0 {
+			return fmt.Errorf("%s action has a negative parameter", sa.Kind)
+		}
+		if sa.MinReplicas == 0 && sa.MaxReplicas == 0 && sa.TargetUtilization == 0 {
+			return fmt.Errorf("%s action needs min_replicas, max_replicas or target_utilization", sa.Kind)
+		}
+		if sa.MaxReplicas > 0 && sa.MinReplicas > sa.MaxReplicas {
+			return fmt.Errorf("%s action has min_replicas %d above max_replicas %d", sa.Kind, sa.MinReplicas, sa.MaxReplicas)
+		}
+	case SetDesiredAction:
+		if sa.Replicas < 0 {
+			return fmt.Errorf("%s action has a negative number of replicas", sa.Kind)
+		}
+	default:
+		return fmt.Errorf("unknown scaling action kind '%s'", sa.Kind)
+	}
+
+	if sa.Cron == "" {
+		if sa.At <= 0 {
+			return fmt.Errorf("%s action needs an at greater than zero or a cron", sa.Kind)
+		}
+	} else {
+		if sa.At != 0 {
+			return fmt.Errorf("%s action has both at and cron", sa.Kind)
+		}
+		_, err := ParseCron(sa.Cron)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+type scalingActionEntity struct {
+	number int
+	action ScalingAction
+}
+
+func (sae *scalingActionEntity) Name() simulator.EntityName {
+	return simulator.EntityName(fmt.Sprintf("scaling-action-%d", sae.number))
+}
+
+func (sae *scalingActionEntity) Kind() simulator.EntityKind {
+	return "ScalingAction"
+}
+
+// scalingSchedule takes scaling actions for a cluster. Each time an action is taken is an entity
+// which moves from ScalingActionsScheduled to ScalingActionsTaken when it is taken.
+type scalingSchedule struct {
+	env           simulator.Environment
+	cluster       *clusterModel
+	scheduled     *entityStock
+	taken         *scalingActionsTakenStock
+	rejecting     simulator.ThroughStock
+	rejected      simulator.SinkStock
+	desiredSource simulator.ThroughStock
+	desiredSink   simulator.ThroughStock
+	actionCount   int
+}
+
+func (ss *scalingSchedule) schedule(action ScalingAction, at time.Time) {
+	ss.actionCount++
+	sae := &scalingActionEntity{number: ss.actionCount, action: action}
+
+	err := ss.scheduled.Add(sae)
+	if err != nil {
+		panic(err)
+	}
+
+	ss.env.AddToSchedule(simulator.NewMovement(simulator.MovementKind(action.Kind), at, departureOf(ss.scheduled, sae), ss.taken))
+}
+
+func (ss *scalingSchedule) take(sae *scalingActionEntity) error {
+	now := ss.env.CurrentMovementTime()
+	action := sae.action
+
+	switch action.Kind {
+	case UpdateAutoscalerAction:
+		hpa := ss.cluster.hpa
+		if action.MinReplicas > 0 {
+			hpa.MinReplicas = action.MinReplicas
+		}
+		if action.MaxReplicas > 0 {
+			hpa.MaxReplicas = action.MaxReplicas
+		}
+		if action.TargetUtilization > 0 {
+			hpa.TargetUtilization = action.TargetUtilization
+		}
+
+		// an action can only be judged against the configuration it is taken on
+		err := hpa.Validate()
+		if err != nil {
+			return ss.reject(sae, err)
+		}
+		ss.cluster.hpa = hpa
+
+		err = ss.cluster.Plugin().Event(now.UnixNano(), proto.EventType_UPDATE, &skplug.Autoscaler{
+			Type: "hpa.v2beta2.autoscaling.k8s.io",
+			Yaml: ss.cluster.hpa.Yaml(),
+		})
+		if err != nil {
+			return err
+		}
+		log.Printf("Updated autoscaler.")
+	case SetDesiredAction:
+		return scaleDesired(ss.env, ss.cluster, ss.desiredSource, ss.desiredSink, ss.cluster.hpa.clamp(action.Replicas))
+	}
+
+	return nil
+}
+
+// reject records that an action could not be taken, as a ScalingAction named with the reason
+// which moves from ScalingActionsRejecting to ScalingActionsRejected.
+func (ss *scalingSchedule) reject(sae *scalingActionEntity, reason error) error {
+	log.Printf("Rejected %s: %s", sae.Name(), reason.Error())
+
+	rejection := simulator.NewEntity(simulator.EntityName(fmt.Sprintf("%s (%s)", sae.Name(), reason.Error())), "ScalingAction")
+	err := ss.rejecting.Add(rejection)
+	if err != nil {
+		return err
+	}
+
+	ss.env.AddToSchedule(simulator.NewMovement(
+		"reject_scaling_action",
+		ss.env.CurrentMovementTime().Add(1*time.Nanosecond),
+		ss.rejecting,
+		ss.rejected,
+	))
+
+	return nil
+}
+
+// NewScalingSchedule schedules scaling actions for a cluster, relative to startAt. Actions with a
+// Cron are scheduled for every time it comes round before the run halts. The cluster's autoscaler
+// must already have been created.
+func NewScalingSchedule(env simulator.Environment, startAt time.Time, cluster ClusterModel, actions []ScalingAction) {
+	cm := cluster.(*clusterModel)
+	ss := &scalingSchedule{
+		env:           env,
+		cluster:       cm,
+		scheduled:     newEntityStock(cm.stockName("ScalingActionsScheduled"), "ScalingAction"),
+		rejecting:     simulator.NewThroughStock(cm.stockName("ScalingActionsRejecting"), "ScalingAction"),
+		rejected:      simulator.NewSinkStock(cm.stockName("ScalingActionsRejected"), "ScalingAction"),
+		desiredSource: simulator.NewThroughStock(cm.stockName("DesiredSource"), "Desired"),
+		desiredSink:   simulator.NewThroughStock(cm.stockName("DesiredSink"), "Desired"),
+	}
+	ss.taken = &scalingActionsTakenStock{delegate: simulator.NewSinkStock(cm.stockName("ScalingActionsTaken"), "ScalingAction"), schedule: ss}
+
+	for _, action := range actions {
+		if action.Cron == "" {
+			ss.schedule(action, startAt.Add(action.At))
+			continue
+		}
+
+		cron, err := ParseCron(action.Cron)
+		if err != nil {
+			panic(err)
+		}
+		for at := cron.Next(startAt); !at.IsZero() && at.Before(env.HaltTime()); at = cron.Next(at) {
+			ss.schedule(action, at)
+		}
+	}
+}
+
+// scalingActionsTakenStock is where scaling actions end up. Each is taken as it arrives.
+type scalingActionsTakenStock struct {
+	delegate simulator.SinkStock
+	schedule *scalingSchedule
+}
+
+func (sts *scalingActionsTakenStock) Name() simulator.StockName {
+	return sts.delegate.Name()
+}
+
+func (sts *scalingActionsTakenStock) KindStocked() simulator.EntityKind {
+	return sts.delegate.KindStocked()
+}
+
+func (sts *scalingActionsTakenStock) Count() uint64 {
+	return sts.delegate.Count()
+}
+
+func (sts *scalingActionsTakenStock) EntitiesInStock() []*simulator.Entity {
+	return sts.delegate.EntitiesInStock()
+}
+
+func (sts *scalingActionsTakenStock) Add(entity simulator.Entity) error {
+	err := sts.delegate.Add(entity)
+	if err != nil {
+		return err
+	}
+
+	return sts.schedule.take(entity.(*scalingActionEntity))
+}
@@ -0,0 +1,161 @@
+/*
+ * Copyright (C) 2019-Present Pivotal Software, Inc. All rights reserved.
+ *
+ * This program and the accompanying materials are made available under the terms
+ * of the Apache License, Version 2.0 (the "License”); you may not use this file
+ * except in compliance with the License. You may obtain a copy of the License at:
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software distributed
+ * under the License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR
+ * CONDITIONS OF ANY KIND, either express or implied. See the License for the
+ * specific language governing permissions and limitations under the License.
+ */
+
+package model
+
+import (
+	"testing"
+	"time"
+
+	"github.com/sclevine/spec"
+	"github.com/sclevine/spec/report"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"skenario/pkg/simulator"
+)
+
+func TestScalingSchedule(t *testing.T) {
+	spec.Run(t, "Scaling schedule", testScalingSchedule, spec.Report(report.Terminal{}))
+}
+
+func testScalingSchedule(t *testing.T, describe spec.G, it spec.S) {
+	var envFake *FakeEnvironment
+	var cluster *clusterModel
+
+	// perform carries out the first scheduled movement of the given kind
+	perform := func(kind simulator.MovementKind) {
+		for i, m := range envFake.Movements {
+			if m.Kind() != kind {
+				continue
+			}
+
+			envFake.Movements = append(envFake.Movements[:i:i], envFake.Movements[i+1:]...)
+			envFake.TheTime = m.OccursAt()
+			moved := m.From().Remove()
+			require.NotNil(t, moved, "nothing to move for '%s'", kind)
+			require.NoError(t, m.To().Add(moved))
+			return
+		}
+
+		require.Failf(t, "no movement scheduled", "kind '%s'", kind)
+	}
+
+	occurrences := func(kind simulator.MovementKind) []time.Time {
+		times := make([]time.Time, 0)
+		for _, m := range envFake.Movements {
+			if m.Kind() == kind {
+				times = append(times, m.OccursAt())
+			}
+		}
+		return times
+	}
+
+	it.Before(func() {
+		envFake = &FakeEnvironment{Movements: make([]simulator.Movement, 0), TheTime: time.Unix(0, 0), TheHaltTime: time.Unix(200, 0)}
+		cluster = NewCluster(envFake, ClusterConfig{Service: "web"}, ReplicasConfig{}).(*clusterModel)
+		cluster.hpa = HPAConfig{MinReplicas: 1, MaxReplicas: 10, TargetUtilization: 50}
+	})
+
+	describe("NewScalingSchedule()", func() {
+		it("schedules actions relative to the start of the run", func() {
+			NewScalingSchedule(envFake, time.Unix(0, 0), cluster, []ScalingAction{{Kind: SetDesiredAction, At: 10 * time.Second, Replicas: 3}})
+
+			assert.Equal(t, []time.Time{time.Unix(10, 0)}, occurrences("set_desired"))
+			assert.Equal(t, simulator.StockName("ScalingActionsScheduled [web]"), envFake.Movements[0].From().Name())
+		})
+
+		it("schedules actions with a cron for every time it comes round before the run halts", func() {
+			NewScalingSchedule(envFake, time.Unix(0, 0), cluster, []ScalingAction{
+				{Kind: SetDesiredAction, Cron: "* * * * *", Replicas: 3},
+				{Kind: UpdateAutoscalerAction, Cron: "@every 75s", MinReplicas: 2},
+			})
+
+			assert.Equal(t, []time.Time{time.Unix(60, 0), time.Unix(120, 0), time.Unix(180, 0)}, occurrences("set_desired"))
+			assert.Equal(t, []time.Time{time.Unix(75, 0), time.Unix(150, 0)}, occurrences("update_autoscaler"))
+		})
+	})
+
+	describe("set_desired actions", func() {
+		it("scale the desired replicas up or down to the number given", func() {
+			NewScalingSchedule(envFake, time.Unix(0, 0), cluster, []ScalingAction{{Kind: SetDesiredAction, At: 10 * time.Second, Replicas: 3}})
+			perform("set_desired")
+
+			assert.Equal(t, []time.Time{time.Unix(10, 1), time.Unix(10, 1), time.Unix(10, 1)}, occurrences("increase_desired"))
+		})
+
+		it("keep the desired replicas within the max replicas", func() {
+			NewScalingSchedule(envFake, time.Unix(0, 0), cluster, []ScalingAction{{Kind: SetDesiredAction, At: 10 * time.Second, Replicas: 30}})
+			perform("set_desired")
+
+			assert.Len(t, occurrences("increase_desired"), 10)
+		})
+	})
+
+	describe("update_autoscaler actions", func() {
+		it("change only the parameters they are given", func() {
+			NewScalingSchedule(envFake, time.Unix(0, 0), cluster, []ScalingAction{{Kind: UpdateAutoscalerAction, At: 10 * time.Second, MinReplicas: 5}})
+			taken := envFake.Movements[0].To()
+			perform("update_autoscaler")
+
+			assert.Equal(t, HPAConfig{MinReplicas: 5, MaxReplicas: 10, TargetUtilization: 50}, cluster.hpa)
+			assert.Equal(t, simulator.StockName("ScalingActionsTaken [web]"), taken.Name())
+			assert.Equal(t, uint64(1), taken.Count())
+		})
+
+		describe("which would leave the min replicas above the max", func() {
+			it.Before(func() {
+				NewScalingSchedule(envFake, time.Unix(0, 0), cluster, []ScalingAction{{Kind: UpdateAutoscalerAction, At: 10 * time.Second, MinReplicas: 20}})
+				perform("update_autoscaler")
+			})
+
+			it("leave the autoscaler as it was", func() {
+				assert.Equal(t, HPAConfig{MinReplicas: 1, MaxReplicas: 10, TargetUtilization: 50}, cluster.hpa)
+			})
+
+			it("are rejected, with the reason", func() {
+				require.Equal(t, []time.Time{time.Unix(10, 1)}, occurrences("reject_scaling_action"))
+				rejection := envFake.Movements[len(envFake.Movements)-1]
+				assert.Equal(t, simulator.StockName("ScalingActionsRejected [web]"), rejection.To().Name())
+
+				perform("reject_scaling_action")
+				rejected := rejection.To().EntitiesInStock()
+				require.Len(t, rejected, 1)
+				assert.Equal(t, simulator.EntityName("scaling-action-1 (HPA min replicas of 20 is above its max replicas of 10)"), (*rejected[0]).Name())
+			})
+		})
+	})
+
+	describe("Validate()", func() {
+		it("accepts actions taken at a set time or on a cron schedule", func() {
+			assert.NoError(t, ScalingAction{Kind: SetDesiredAction, At: time.Second, Replicas: 0}.Validate())
+			assert.NoError(t, ScalingAction{Kind: UpdateAutoscalerAction, Cron: "0 9 * * 1-5", MaxReplicas: 20}.Validate())
+		})
+
+		it("rejects actions which could not be taken", func() {
+			for _, action := range []ScalingAction{
+				{Kind: "reboot", At: time.Second},
+				{Kind: SetDesiredAction},
+				{Kind: SetDesiredAction, At: time.Second, Cron: "@hourly"},
+				{Kind: SetDesiredAction, Cron: "@sometimes"},
+				{Kind: SetDesiredAction, At: time.Second, Replicas: -1},
+				{Kind: UpdateAutoscalerAction, At: time.Second},
+				{Kind: UpdateAutoscalerAction, At: time.Second, MinReplicas: 5, MaxReplicas: 2},
+			} {
+				assert.Error(t, action.Validate(), "%+v", action)
+			}
+		})
+	})
+}
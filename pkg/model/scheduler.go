@@ -0,0 +1,269 @@
+/*
+ * Copyright (C) 2019-Present Pivotal Software, Inc. All rights reserved.
+ *
+ * This program and the accompanying materials are made available under the terms
+ * of the Apache License, Version 2.0 (the "License”); you may not use this file
+ * except in compliance with the License. You may obtain a copy of the License at:
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software distributed
+ * under the License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR
+ * CONDITIONS OF ANY KIND, either express or implied. See the License for the
+ * specific language governing permissions and limitations under the License.
+ */
+
+package model
+
+import (
+	"fmt"
+	"time"
+
+	"skenario/pkg/simulator"
+)
+
+// defaultCPUMillis is the CPU a replica requests and is limited to when neither is configured.
+// It is the capacity replicas have always processed requests at, and it is what autoscaler
+// plugins are told the replica requests.
+const defaultCPUMillis = 100
+
+// defaultNodeCPUMillis is the CPU allocatable on a node when none is configured.
+const defaultNodeCPUMillis = 4000
+
+// scheduler places pending replicas onto nodes, in the order they became pending. A replica
+// which fits is reserved space on the least requested node, then moved into ReplicasLaunching.
+// Replicas that fit nowhere stay pending until a node is provisioned or space is released.
+type scheduler struct {
+	env           simulator.Environment
+	config        NodeConfig
+	size          replicaSize
+	memoryRequest int64
+	nodeSource    simulator.SourceStock
+	nodes         *nodesStock
+	pending       *replicasPendingStock
+	launching     *replicasLaunchingStock
+
+	// nodes reserved for replicas on their way from pending to launching, in order
+	reserved []binding
+	bindings map[simulator.EntityName]binding
+
+	provisioning        uint
+	pendingTerminations int
+}
+
+// waiting is the number of pending replicas that have neither been placed on a node nor are
+// about to be terminated.
+func (s *scheduler) waiting() int {
+	return int(s.pending.Count()) - len(s.reserved) - s.pendingTerminations
+}
+
+func (s *scheduler) schedulePending() {
+	waiting := s.waiting()
+	for placed := 0; placed < waiting; placed++ {
+		node := s.leastRequestedFit()
+		if node == nil {
+			s.provisionNodes(waiting - placed)
+			return
+		}
+
+		node.Allocate(s.size.cpuRequestMillis, s.memoryRequest)
+		s.reserved = append(s.reserved, binding{node: node, size: s.size})
+
+		s.env.AddToSchedule(simulator.NewMovement(
+			"schedule_replica",
+			s.env.CurrentMovementTime().Add(1*time.Nanosecond),
+			s.pending,
+			s.launching,
+		))
+	}
+}
+
+// leastRequestedFit spreads replicas across nodes, as the Kubernetes scheduler does by default.
+func (s *scheduler) leastRequestedFit() NodeEntity {
+	var best NodeEntity
+	bestRequested := 0.0
+
+	for _, e := range s.nodes.EntitiesInStock() {
+		node := (*e).(NodeEntity)
+		if !node.Fits(s.size.cpuRequestMillis, s.memoryRequest) {
+			continue
+		}
+
+		requested := float64(node.CPURequested()) / float64(node.CPUAllocatable())
+		if best == nil || requested < bestRequested {
+			best = node
+			bestRequested = requested
+		}
+	}
+
+	return best
+}
+
+// provisionNodes has the cluster autoscaler add enough nodes for replicas that do not fit,
+// counting those already being provisioned, up to the maximum number of nodes.
+func (s *scheduler) provisionNodes(unplaced int) {
+	if s.config.MaxNodes == 0 {
+		return
+	}
+
+	perNode := s.config.CPUAllocatableMillis / s.size.cpuRequestMillis
+	if s.config.MemoryAllocatableBytes > 0 && s.memoryRequest > 0 {
+		perMemory := s.config.MemoryAllocatableBytes / s.memoryRequest
+		if perMemory < perNode {
+			perNode = perMemory
+		}
+	}
+	if perNode < 1 {
+		// a replica will never fit on a new node
+		return
+	}
+
+	needed := (int64(unplaced)+perNode-1)/perNode - int64(s.provisioning)
+	room := int64(s.config.MaxNodes) - int64(s.nodes.Count()) - int64(s.provisioning)
+	if needed > room {
+		needed = room
+	}
+
+	delay := s.config.ProvisioningDelay
+	if delay < 1*time.Nanosecond {
+		delay = 1 * time.Nanosecond
+	}
+	for i := int64(0); i < needed; i++ {
+		s.provisionNode(s.env.CurrentMovementTime().Add(delay))
+	}
+}
+
+func (s *scheduler) provisionNode(at time.Time) {
+	if s.env.AddToSchedule(simulator.NewMovement("provision_node", at, s.nodeSource, s.nodes)) {
+		s.provisioning++
+	}
+}
+
+func (s *scheduler) nodeProvisioned() {
+	if s.provisioning > 0 {
+		s.provisioning--
+	}
+	s.schedulePending()
+}
+
+// bind gives a replica arriving in ReplicasLaunching the node reserved for it, and the size it
+// was reserved at.
+func (s *scheduler) bind(replica simulator.Entity) {
+	if len(s.reserved) == 0 {
+		panic(fmt.Errorf("replica '%s' began launching without being scheduled onto a node", replica.Name()))
+	}
+
+	reserved := s.reserved[0]
+	s.bindings[replica.Name()], s.reserved = reserved, s.reserved[1:]
+	if re, ok := replica.(*replicaEntity); ok {
+		re.resize(reserved.size)
+	}
+}
+
+// resize makes room on the node of a replica for it to take a new size, or returns false if
+// there is no room. Replicas without a node can always be resized.
+func (s *scheduler) resize(replica simulator.Entity, size replicaSize) bool {
+	bound, ok := s.bindings[replica.Name()]
+	if !ok {
+		return true
+	}
+
+	bound.node.Release(bound.size.cpuRequestMillis, s.memoryRequest)
+	if !bound.node.Fits(size.cpuRequestMillis, s.memoryRequest) {
+		bound.node.Allocate(bound.size.cpuRequestMillis, s.memoryRequest)
+		return false
+	}
+
+	bound.node.Allocate(size.cpuRequestMillis, s.memoryRequest)
+	s.bindings[replica.Name()] = binding{node: bound.node, size: size}
+	s.schedulePending()
+	return true
+}
+
+// terminating notes a replica entering ReplicasTerminating. Replicas without a node can only
+// have come from ReplicasPending.
+func (s *scheduler) terminating(replica simulator.Entity) {
+	if _, bound := s.bindings[replica.Name()]; !bound && s.pendingTerminations > 0 {
+		s.pendingTerminations--
+	}
+}
+
+// release frees the node of a replica that has finished terminating, making room for any
+// pending replicas.
+func (s *scheduler) release(replica simulator.Entity) {
+	bound, ok := s.bindings[replica.Name()]
+	if !ok {
+		return
+	}
+
+	bound.node.Release(bound.size.cpuRequestMillis, s.memoryRequest)
+	delete(s.bindings, replica.Name())
+	s.schedulePending()
+}
+
+func newScheduler(env simulator.Environment, config NodeConfig, replicasConfig ReplicasConfig, launching *replicasLaunchingStock) *scheduler {
+	if config.CPUAllocatableMillis <= 0 {
+		config.CPUAllocatableMillis = defaultNodeCPUMillis
+	}
+
+	s := &scheduler{
+		env:           env,
+		config:        config,
+		size:          replicasConfig.size(),
+		memoryRequest: replicasConfig.MemoryRequestBytes,
+		nodeSource:    NewNodeSource(config),
+		launching:     launching,
+		bindings:      make(map[simulator.EntityName]binding),
+	}
+
+	s.nodes = &nodesStock{delegate: simulator.NewThroughStock("Nodes", "Node"), scheduler: s}
+	s.pending = &replicasPendingStock{delegate: simulator.NewThroughStock("ReplicasPending", "Replica"), scheduler: s}
+	launching.scheduler = s
+
+	for i := uint(0); i < config.InitialNodes; i++ {
+		s.provisionNode(env.CurrentMovementTime().Add(1 * time.Nanosecond))
+	}
+
+	return s
+}
+
+// binding is a node and the size of the replica given room on it.
+type binding struct {
+	node NodeEntity
+	size replicaSize
+}
+
+type replicasPendingStock struct {
+	delegate  simulator.ThroughStock
+	scheduler *scheduler
+}
+
+func (rps *replicasPendingStock) Name() simulator.StockName {
+	return rps.delegate.Name()
+}
+
+func (rps *replicasPendingStock) KindStocked() simulator.EntityKind {
+	return rps.delegate.KindStocked()
+}
+
+func (rps *replicasPendingStock) Count() uint64 {
+	return rps.delegate.Count()
+}
+
+func (rps *replicasPendingStock) EntitiesInStock() []*simulator.Entity {
+	return rps.delegate.EntitiesInStock()
+}
+
+func (rps *replicasPendingStock) Remove() simulator.Entity {
+	return rps.delegate.Remove()
+}
+
+func (rps *replicasPendingStock) Add(entity simulator.Entity) error {
+	err := rps.delegate.Add(entity)
+	if err != nil {
+		return err
+	}
+
+	rps.scheduler.schedulePending()
+	return nil
+}
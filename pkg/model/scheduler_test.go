@@ -0,0 +1,196 @@
+/*
+ * Copyright (C) 2019-Present Pivotal Software, Inc. All rights reserved.
+ *
+ * This program and the accompanying materials are made available under the terms
+ * of the Apache License, Version 2.0 (the "License”); you may not use this file
+ * except in compliance with the License. You may obtain a copy of the License at:
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software distributed
+ * under the License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR
+ * CONDITIONS OF ANY KIND, either express or implied. See the License for the
+ * specific language governing permissions and limitations under the License.
+ */
+
+package model
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/sclevine/spec"
+	"github.com/sclevine/spec/report"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"skenario/pkg/simulator"
+)
+
+func TestScheduler(t *testing.T) {
+	spec.Run(t, "Scheduler", testScheduler, spec.Report(report.Terminal{}))
+}
+
+func testScheduler(t *testing.T, describe spec.G, it spec.S) {
+	var subject *scheduler
+	var config NodeConfig
+	var envFake *FakeEnvironment
+	var replicasActive simulator.ThroughStock
+	var replicaNumber int
+
+	// perform carries out every scheduled movement, in the order they were scheduled
+	perform := func() {
+		for len(envFake.Movements) > 0 {
+			movement := envFake.Movements[0]
+			envFake.Movements = envFake.Movements[1:]
+
+			moved := movement.From().Remove()
+			require.NotNil(t, moved, "nothing to move for '%s'", movement.Kind())
+			require.NoError(t, movement.To().Add(moved))
+		}
+	}
+
+	addPending := func(count int) {
+		for i := 0; i < count; i++ {
+			replicaNumber++
+			err := subject.pending.Add(simulator.NewEntity(simulator.EntityName(fmt.Sprintf("replica-%d", replicaNumber)), "Replica"))
+			require.NoError(t, err)
+		}
+	}
+
+	newSchedulerWith := func(replicasConfig ReplicasConfig) *scheduler {
+		launching := NewReplicasLaunchingStock(envFake, replicasConfig, replicasActive).(*replicasLaunchingStock)
+		return newScheduler(envFake, config, replicasConfig, launching)
+	}
+
+	kinds := func() []simulator.MovementKind {
+		kinds := make([]simulator.MovementKind, 0)
+		for _, m := range envFake.Movements {
+			kinds = append(kinds, m.Kind())
+		}
+		return kinds
+	}
+
+	it.Before(func() {
+		envFake = &FakeEnvironment{Movements: make([]simulator.Movement, 0), TheTime: time.Unix(0, 0)}
+		replicasActive = simulator.NewThroughStock("ReplicasActive", "Replica")
+		config = NodeConfig{InitialNodes: 2, CPUAllocatableMillis: 2000}
+	})
+
+	describe("newScheduler()", func() {
+		it.Before(func() {
+			subject = newSchedulerWith(ReplicasConfig{LaunchDelay: time.Second})
+		})
+
+		it("provisions the initial nodes", func() {
+			assert.Equal(t, []simulator.MovementKind{"provision_node", "provision_node"}, kinds())
+
+			perform()
+			assert.Equal(t, uint64(2), subject.nodes.Count())
+		})
+
+		it("defaults replicas to requesting 100 CPU millis", func() {
+			assert.Equal(t, int64(100), subject.size.cpuRequestMillis)
+		})
+	})
+
+	describe("scheduling pending replicas", func() {
+		it.Before(func() {
+			subject = newSchedulerWith(ReplicasConfig{LaunchDelay: time.Second, CPURequestMillis: 1000})
+			perform()
+		})
+
+		it("launches as many replicas as fit", func() {
+			addPending(5)
+			assert.Len(t, envFake.Movements, 4)
+
+			perform()
+			assert.Equal(t, uint64(1), subject.pending.Count())
+			assert.Equal(t, uint64(4), replicasActive.Count())
+		})
+
+		it("spreads replicas across nodes", func() {
+			addPending(2)
+			perform()
+
+			for _, node := range subject.nodes.EntitiesInStock() {
+				assert.Equal(t, int64(1000), (*node).(NodeEntity).CPURequested())
+			}
+		})
+
+		it("schedules a pending replica once space is released", func() {
+			addPending(5)
+			perform()
+
+			subject.release(*replicasActive.EntitiesInStock()[0])
+			assert.Equal(t, []simulator.MovementKind{"schedule_replica"}, kinds())
+		})
+
+		it("leaves pending replicas that are being terminated alone", func() {
+			addPending(5)
+			perform()
+
+			subject.pendingTerminations++
+			subject.release(*replicasActive.EntitiesInStock()[0])
+			assert.Empty(t, envFake.Movements)
+		})
+
+		it("resizes a replica in place when its node has room", func() {
+			addPending(2)
+			perform()
+
+			replica := *replicasActive.EntitiesInStock()[0]
+			node := subject.bindings[replica.Name()].node
+			assert.True(t, subject.resize(replica, replicaSize{cpuRequestMillis: 2000, cpuLimitMillis: 2000}))
+			assert.Equal(t, int64(2000), node.CPURequested())
+
+			subject.release(replica)
+			assert.Equal(t, int64(0), node.CPURequested())
+		})
+
+		it("does not resize a replica whose node has no room", func() {
+			addPending(4)
+			perform()
+
+			replica := *replicasActive.EntitiesInStock()[0]
+			assert.False(t, subject.resize(replica, replicaSize{cpuRequestMillis: 1500, cpuLimitMillis: 1500}))
+			assert.Equal(t, int64(2000), subject.bindings[replica.Name()].node.CPURequested())
+		})
+	})
+
+	describe("the cluster autoscaler", func() {
+		it.Before(func() {
+			config.MaxNodes = 4
+			config.ProvisioningDelay = 30 * time.Second
+			subject = newSchedulerWith(ReplicasConfig{LaunchDelay: time.Second, CPURequestMillis: 1000})
+			perform()
+		})
+
+		it("provisions enough nodes for replicas that do not fit", func() {
+			addPending(7)
+
+			provisioned := 0
+			for _, m := range envFake.Movements {
+				if m.Kind() == "provision_node" {
+					provisioned++
+					assert.Equal(t, time.Unix(30, 0), m.OccursAt())
+				}
+			}
+			assert.Equal(t, 2, provisioned)
+		})
+
+		it("counts nodes already being provisioned", func() {
+			addPending(5)
+			addPending(1)
+
+			assert.Equal(t, uint(1), subject.provisioning)
+		})
+
+		it("does not exceed the maximum number of nodes", func() {
+			addPending(20)
+
+			assert.Equal(t, uint(2), subject.provisioning)
+		})
+	})
+}
@@ -0,0 +1,299 @@
+/*
+ * Copyright (C) 2019-Present Pivotal Software, Inc. All rights reserved.
+ *
+ * This program and the accompanying materials are made available under the terms
+ * of the Apache License, Version 2.0 (the "License”); you may not use this file
+ * except in compliance with the License. You may obtain a copy of the License at:
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software distributed
+ * under the License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR
+ * CONDITIONS OF ANY KIND, either express or implied. See the License for the
+ * specific language governing permissions and limitations under the License.
+ */
+
+package model
+
+import (
+	"fmt"
+	"time"
+
+	"skenario/pkg/simulator"
+)
+
+// CallMode is whether a service waits for the calls it makes to another service.
+type CallMode string
+
+const (
+	// SyncCall holds the request which made the call on its replica until the call returns,
+	// and fails the request if the call fails. It is the default.
+	SyncCall CallMode = "sync"
+	// AsyncCall sends the call and carries on without waiting for it.
+	AsyncCall CallMode = "async"
+)
+
+// Call is a call to another service, made for every request a service handles. Calls are made
+// as soon as the request reaches a replica, alongside the request's own work.
+type Call struct {
+	Service string   `json:"service"`
+	Mode    CallMode `json:"mode,omitempty"`
+}
+
+// Service is one of the services of a topology. Its cluster must be named after it. Calls to
+// the service are requests like Request, and for each the service makes its own Calls.
+type Service struct {
+	Cluster ClusterModel
+	Request RequestConfig
+	Calls   []Call
+}
+
+// ValidateTopology checks that the calls of each service are to other known services, in a
+// known mode, and that no request can lead to a call back to a service it has already passed
+// through.
+func ValidateTopology(services []string, calls map[string][]Call) error {
+	known := make(map[string]bool, len(services))
+	for _, service := range services {
+		known[service] = true
+	}
+
+	for caller, callsOf := range calls {
+		if !known[caller] {
+			return fmt.Errorf("calls are given for unknown service '%s'", caller)
+		}
+		for _, call := range callsOf {
+			if !known[call.Service] {
+				return fmt.Errorf("service '%s' calls unknown service '%s'", caller, call.Service)
+			}
+			switch call.Mode {
+			case "", SyncCall, AsyncCall:
+			default:
+				return fmt.Errorf("service '%s' calls service '%s' in unknown mode '%s'", caller, call.Service, call.Mode)
+			}
+		}
+	}
+
+	// a service is visiting while the services it calls are being checked, and visited after
+	visiting, visited := make(map[string]bool), make(map[string]bool)
+	var visit func(service string) error
+	visit = func(service string) error {
+		if visiting[service] {
+			return fmt.Errorf("service '%s' is called by a service which it calls itself", service)
+		}
+		if visited[service] {
+			return nil
+		}
+
+		visiting[service] = true
+		for _, call := range calls[service] {
+			if err := visit(call.Service); err != nil {
+				return err
+			}
+		}
+		visiting[service] = false
+		visited[service] = true
+		return nil
+	}
+	for _, service := range services {
+		if err := visit(service); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// NewTopology connects services to each other, so that the replicas of each service make its
+// calls to the others. Requests should be sent to the RoutingStock of the first service. The
+// calls must be valid for the services.
+func NewTopology(env simulator.Environment, services []Service) {
+	byName := make(map[string]Service, len(services))
+	for _, service := range services {
+		byName[service.Cluster.Service()] = service
+	}
+
+	for _, service := range services {
+		if len(service.Calls) == 0 {
+			continue
+		}
+
+		sc := &serviceCalls{
+			env:    env,
+			source: &callSource{name: service.Cluster.stockName("CallSource")},
+		}
+		for _, call := range service.Calls {
+			callee := byName[call.Service]
+			sc.calls = append(sc.calls, downstreamCall{
+				routing: callee.Cluster.RoutingStock(),
+				request: callee.Request,
+				sync:    call.Mode != AsyncCall,
+			})
+		}
+
+		service.Cluster.(*clusterModel).replicaSource.(*replicaSource).calls = sc
+	}
+}
+
+// downstreamCall is a call made by the replicas of a service to another service.
+type downstreamCall struct {
+	routing RequestsRoutingStock
+	request RequestConfig
+	sync    bool
+}
+
+// serviceCalls are the calls a service makes for each request it handles.
+type serviceCalls struct {
+	env    simulator.Environment
+	source *callSource
+	calls  []downstreamCall
+}
+
+// make makes the calls for a request which has reached a replica. The request waits for its
+// synchronous calls until it leaves the replica.
+func (sc *serviceCalls) make(processing *requestsProcessingStock, request *requestEntity) {
+	now := sc.env.CurrentMovementTime()
+
+	var pending *pendingCalls
+	for _, call := range sc.calls {
+		callee := NewRequestEntity(sc.env, call.routing, call.request).(*requestEntity)
+		if call.sync {
+			if pending == nil {
+				pending = &pendingCalls{
+					caller:     request,
+					processing: processing,
+					deadline:   now.Add(request.requestConfig.Timeout),
+				}
+			}
+			pending.waiting++
+			callee.returnTo = pending
+		}
+
+		sc.env.AddToSchedule(simulator.NewMovement(
+			"call_service",
+			now.Add(1*time.Nanosecond),
+			&outgoingCall{source: sc.source, request: callee},
+			call.routing,
+		))
+	}
+
+	request.calls = pending
+}
+
+// pendingCalls are the synchronous calls made by a request on a replica, which the request
+// waits for before it is done.
+type pendingCalls struct {
+	caller     *requestEntity
+	processing *requestsProcessingStock
+	waiting    int
+	deadline   time.Time
+
+	// workDoneAt is when the request is done with its own work, once that is known.
+	workDoneAt time.Time
+	// failedAt is when the request fails because one of its calls failed, if one has.
+	failedAt time.Time
+}
+
+// returned is told when a call has returned, successfully or not. Calls which return after the
+// request which made them has left its replica are ignored.
+func (pc *pendingCalls) returned(ok bool) {
+	if pc.caller.calls != pc {
+		return
+	}
+
+	if !ok {
+		if pc.failedAt.IsZero() {
+			pc.failedAt = pc.processing.env.CurrentMovementTime().Add(1 * time.Nanosecond)
+			pc.processing.callsChanged(pc.caller)
+		}
+		return
+	}
+
+	pc.waiting--
+	if pc.waiting == 0 {
+		pc.processing.callsChanged(pc.caller)
+	}
+}
+
+// returningCall is the stock a synchronous call reaches when it is done, which tells the
+// request that made the call that it has returned.
+type returningCall struct {
+	simulator.SinkStock
+	pending *pendingCalls
+	ok      bool
+}
+
+func (rc *returningCall) Add(entity simulator.Entity) error {
+	err := rc.SinkStock.Add(entity)
+	if err != nil {
+		return err
+	}
+
+	rc.pending.returned(rc.ok)
+	return nil
+}
+
+// completedInto is where a request goes when it is done: the stock of completed requests,
+// which tells the request that called it, if it was a synchronous call.
+func completedInto(entity simulator.Entity, requestsComplete simulator.SinkStock) simulator.SinkStock {
+	request, ok := entity.(*requestEntity)
+	if !ok || request.returnTo == nil {
+		return requestsComplete
+	}
+
+	return &returningCall{SinkStock: requestsComplete, pending: request.returnTo, ok: true}
+}
+
+// callSource is where the calls made by a service come from, as TrafficSource is where
+// requests to the first service come from.
+type callSource struct {
+	name simulator.StockName
+}
+
+func (cs *callSource) Name() simulator.StockName {
+	return cs.name
+}
+
+func (cs *callSource) KindStocked() simulator.EntityKind {
+	return "Request"
+}
+
+func (cs *callSource) Count() uint64 {
+	return 0
+}
+
+func (cs *callSource) EntitiesInStock() []*simulator.Entity {
+	return []*simulator.Entity{}
+}
+
+func (cs *callSource) Remove() simulator.Entity {
+	return nil
+}
+
+// outgoingCall is the source of the movement of one call. It stands in for the CallSource of
+// the calling service, but gives up that call.
+type outgoingCall struct {
+	source  *callSource
+	request simulator.Entity
+}
+
+func (oc *outgoingCall) Name() simulator.StockName {
+	return oc.source.Name()
+}
+
+func (oc *outgoingCall) KindStocked() simulator.EntityKind {
+	return oc.source.KindStocked()
+}
+
+func (oc *outgoingCall) Count() uint64 {
+	return oc.source.Count()
+}
+
+func (oc *outgoingCall) EntitiesInStock() []*simulator.Entity {
+	return oc.source.EntitiesInStock()
+}
+
+func (oc *outgoingCall) Remove() simulator.Entity {
+	request := oc.request
+	oc.request = nil
+	return request
+}
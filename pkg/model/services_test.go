@@ -0,0 +1,178 @@
+/*
+ * Copyright (C) 2019-Present Pivotal Software, Inc. All rights reserved.
+ *
+ * This program and the accompanying materials are made available under the terms
+ * of the Apache License, Version 2.0 (the "License”); you may not use this file
+ * except in compliance with the License. You may obtain a copy of the License at:
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software distributed
+ * under the License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR
+ * CONDITIONS OF ANY KIND, either express or implied. See the License for the
+ * specific language governing permissions and limitations under the License.
+ */
+
+package model
+
+import (
+	"testing"
+	"time"
+
+	"github.com/sclevine/spec"
+	"github.com/sclevine/spec/report"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"skenario/pkg/simulator"
+)
+
+func TestServices(t *testing.T) {
+	spec.Run(t, "Services", testServices, spec.Report(report.Terminal{}))
+}
+
+func testServices(t *testing.T, describe spec.G, it spec.S) {
+	var envFake *FakeEnvironment
+	var frontend, backend, audit ClusterModel
+	var subject *requestsProcessingStock
+	var request *requestEntity
+
+	// movementsOf are the movements of a kind scheduled so far
+	movementsOf := func(kind simulator.MovementKind) []simulator.Movement {
+		movements := make([]simulator.Movement, 0)
+		for _, m := range envFake.Movements {
+			if m.Kind() == kind {
+				movements = append(movements, m)
+			}
+		}
+		return movements
+	}
+
+	// callTo takes the call that was made to a service
+	callTo := func(service ClusterModel) *requestEntity {
+		for _, m := range movementsOf("call_service") {
+			if m.To() == service.RoutingStock() {
+				return m.From().Remove().(*requestEntity)
+			}
+		}
+		require.FailNow(t, "no call was made", "to %s", service.Service())
+		return nil
+	}
+
+	it.Before(func() {
+		envFake = &FakeEnvironment{Movements: make([]simulator.Movement, 0), TheTime: time.Unix(0, 0)}
+		frontend = NewCluster(envFake, ClusterConfig{Service: "frontend"}, ReplicasConfig{})
+		backend = NewCluster(envFake, ClusterConfig{Service: "backend"}, ReplicasConfig{})
+		audit = NewCluster(envFake, ClusterConfig{Service: "audit"}, ReplicasConfig{})
+
+		NewTopology(envFake, []Service{
+			{Cluster: frontend, Calls: []Call{{Service: "backend", Mode: SyncCall}, {Service: "audit", Mode: AsyncCall}}},
+			{Cluster: backend, Request: RequestConfig{CPUTimeMillis: 50, Timeout: time.Second}},
+			{Cluster: audit, Request: RequestConfig{CPUTimeMillis: 10, Timeout: time.Second}},
+		})
+
+		replica := frontend.(*clusterModel).replicaSource.Remove().(*replicaEntity)
+		subject = replica.requestsProcessing.(*requestsProcessingStock)
+
+		request = NewRequestEntity(envFake, frontend.RoutingStock(), RequestConfig{CPUTimeMillis: 10, IOTimeMillis: 10, Timeout: 2 * time.Second}).(*requestEntity)
+		require.NoError(t, subject.Add(request))
+	})
+
+	describe("NewTopology()", func() {
+		it("names the stocks of each service after it", func() {
+			assert.Equal(t, simulator.StockName("RequestsRouting [backend]"), backend.RoutingStock().Name())
+			assert.Equal(t, simulator.StockName("ReplicasActive [audit]"), audit.ActiveStock().Name())
+		})
+
+		it("gives each service its own autoscaler", func() {
+			assert.NotNil(t, frontend.Plugin())
+			assert.NotEqual(t, frontend.Plugin(), backend.Plugin())
+		})
+	})
+
+	describe("making calls", func() {
+		it("calls each service from the CallSource of the caller", func() {
+			calls := movementsOf("call_service")
+			require.Len(t, calls, 2)
+			assert.Equal(t, simulator.StockName("CallSource [frontend]"), calls[0].From().Name())
+			assert.Equal(t, simulator.StockName("RequestsRouting [backend]"), calls[0].To().Name())
+			assert.Equal(t, simulator.StockName("RequestsRouting [audit]"), calls[1].To().Name())
+		})
+
+		it("makes calls like the requests of the service called", func() {
+			assert.Equal(t, 50*time.Millisecond, callTo(backend).cpuTime)
+		})
+
+		it("does not wait for asynchronous calls", func() {
+			assert.Nil(t, callTo(audit).returnTo)
+		})
+	})
+
+	describe("waiting for synchronous calls", func() {
+		var call *requestEntity
+		var waiting *FakeScheduledMovement
+
+		it.Before(func() {
+			call = callTo(backend)
+			waiting = subject.outcomes[request].(*FakeScheduledMovement)
+		})
+
+		it("holds the request until its timeout while it waits", func() {
+			assert.Equal(t, simulator.MovementKind("request_failed"), waiting.Movement().Kind())
+			assert.Equal(t, time.Unix(2, 0), waiting.Movement().OccursAt())
+			assert.Equal(t, uint64(1), subject.Count())
+		})
+
+		it("completes the request once the call returns", func() {
+			envFake.TheTime = time.Unix(1, 0)
+			require.NoError(t, completedInto(call, simulator.NewSinkStock("RequestsComplete", "Request")).Add(call))
+
+			assert.True(t, waiting.Cancelled)
+			completed := movementsOf("complete_request")
+			require.Len(t, completed, 1)
+			assert.Equal(t, time.Unix(1, 1), completed[0].OccursAt())
+		})
+
+		it("fails the request when the call fails", func() {
+			envFake.TheTime = time.Unix(1, 0)
+			require.NoError(t, failedInto(call, simulator.NewSinkStock("RequestsFailed", "Request")).Add(call))
+
+			assert.True(t, waiting.Cancelled)
+			failed := movementsOf("call_failed")
+			require.Len(t, failed, 1)
+			assert.Equal(t, simulator.StockName("RequestsFailed [frontend]"), failed[0].To().Name())
+		})
+
+		it("ignores calls which return after the request has left", func() {
+			subject.take(request)
+			scheduled := len(envFake.Movements)
+
+			require.NoError(t, completedInto(call, simulator.NewSinkStock("RequestsComplete", "Request")).Add(call))
+			assert.Len(t, envFake.Movements, scheduled)
+		})
+	})
+
+	describe("ValidateTopology()", func() {
+		services := []string{"frontend", "backend", "audit"}
+
+		it("accepts services which call each other without going round in circles", func() {
+			assert.NoError(t, ValidateTopology(services, map[string][]Call{
+				"frontend": {{Service: "backend"}, {Service: "audit", Mode: AsyncCall}},
+				"backend":  {{Service: "audit"}},
+			}))
+		})
+
+		it("rejects calls to unknown services or in unknown modes", func() {
+			assert.Error(t, ValidateTopology(services, map[string][]Call{"frontend": {{Service: "other"}}}))
+			assert.Error(t, ValidateTopology(services, map[string][]Call{"frontend": {{Service: "backend", Mode: "later"}}}))
+		})
+
+		it("rejects calls which lead back to the caller", func() {
+			assert.Error(t, ValidateTopology(services, map[string][]Call{
+				"frontend": {{Service: "backend"}},
+				"backend":  {{Service: "frontend", Mode: AsyncCall}},
+			}))
+			assert.Error(t, ValidateTopology(services, map[string][]Call{"audit": {{Service: "audit"}}}))
+		})
+	})
+}
@@ -26,7 +26,16 @@ type TrafficSource interface {
 type trafficSource struct {
 	env             simulator.Environment
 	requestsRouting RequestsRoutingStock
-	requestConfig   RequestConfig
+	classes         []RequestClass
+	totalWeight     float64
+	retrying        *requestsRetryingStock
+}
+
+// RequestClass is one kind of request in a workload mix, such as cheap health checks or
+// expensive reports. Each request is of a class chosen at random in proportion to Weight.
+type RequestClass struct {
+	Weight float64
+	RequestConfig
 }
 
 func (ts *trafficSource) Name() simulator.StockName {
@@ -46,13 +55,51 @@ func (ts *trafficSource) EntitiesInStock() []*simulator.Entity {
 }
 
 func (ts *trafficSource) Remove() simulator.Entity {
-	return NewRequestEntity(ts.env, ts.requestsRouting, ts.requestConfig)
+	request := NewRequestEntity(ts.env, ts.requestsRouting, ts.chooseClass().RequestConfig)
+	if ts.retrying != nil {
+		request.(*requestEntity).retrying = ts.retrying
+		ts.retrying.recordRequest()
+	}
+
+	return request
+}
+
+func (ts *trafficSource) chooseClass() RequestClass {
+	if len(ts.classes) == 1 {
+		return ts.classes[0]
+	}
+
+	pick := ts.env.Rand().Float64() * ts.totalWeight
+	for _, class := range ts.classes {
+		pick -= class.Weight
+		if pick < 0 {
+			return class
+		}
+	}
+	return ts.classes[len(ts.classes)-1]
 }
 
+// NewTrafficSource creates requests for RequestsRouting, all alike.
 func NewTrafficSource(env simulator.Environment, requestsRouting RequestsRoutingStock, requestConfig RequestConfig) TrafficSource {
-	return &trafficSource{
+	return NewWorkloadMix(env, requestsRouting, []RequestClass{{Weight: 1, RequestConfig: requestConfig}})
+}
+
+// NewWorkloadMix creates requests for RequestsRouting from a mix of request classes. If any
+// class has a RetryPolicy which retries, its requests are retried through a RequestsRetrying
+// stock.
+func NewWorkloadMix(env simulator.Environment, requestsRouting RequestsRoutingStock, classes []RequestClass) TrafficSource {
+	ts := &trafficSource{
 		env:             env,
 		requestsRouting: requestsRouting,
-		requestConfig:   requestConfig,
+		classes:         classes,
 	}
+
+	for _, class := range classes {
+		ts.totalWeight += class.Weight
+		if class.Retry.retries() && ts.retrying == nil {
+			ts.retrying = newRequestsRetryingStock(env, requestsRouting)
+		}
+	}
+
+	return ts
 }
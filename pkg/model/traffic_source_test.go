@@ -36,7 +36,7 @@ func testTrafficSource(t *testing.T, describe spec.G, it spec.S) {
 	var envFake *FakeEnvironment
 
 	it.Before(func() {
-		routingStock := NewRequestsRoutingStock(envFake, NewReplicasActiveStock(), simulator.NewSinkStock("RequestsFailed", "Request"))
+		routingStock := NewRequestsRoutingStock(envFake, NewReplicasActiveStock(envFake), simulator.NewSinkStock("RequestsFailed", "Request"))
 		envFake = new(FakeEnvironment)
 
 		subject = NewTrafficSource(envFake, routingStock, RequestConfig{CPUTimeMillis: 500, IOTimeMillis: 500, Timeout: 1 * time.Second})
@@ -94,4 +94,25 @@ func testTrafficSource(t *testing.T, describe spec.G, it spec.S) {
 			assert.Equal(t, simulator.EntityKind("Request"), entity1.Kind())
 		})
 	})
+
+	describe("NewWorkloadMix()", func() {
+		it.Before(func() {
+			envFake = new(FakeEnvironment)
+			routingStock := NewRequestsRoutingStock(envFake, NewReplicasActiveStock(envFake), simulator.NewSinkStock("RequestsFailed", "Request"))
+			subject = NewWorkloadMix(envFake, routingStock, []RequestClass{
+				{Weight: 9, RequestConfig: RequestConfig{Class: "health", CPUTimeMillis: 1}},
+				{Weight: 1, RequestConfig: RequestConfig{Class: "reports", CPUTimeMillis: 1000}},
+			})
+		})
+
+		it("creates requests of each class in proportion to its weight", func() {
+			counts := make(map[string]int)
+			for i := 0; i < 1000; i++ {
+				counts[subject.Remove().(*requestEntity).requestConfig.Class]++
+			}
+
+			assert.InDelta(t, 900, counts["health"], 50)
+			assert.InDelta(t, 100, counts["reports"], 50)
+		})
+	})
 }
@@ -0,0 +1,169 @@
+/*
+ * Copyright (C) 2019-Present Pivotal Software, Inc. All rights reserved.
+ *
+ * This program and the accompanying materials are made available under the terms
+ * of the Apache License, Version 2.0 (the "License”); you may not use this file
+ * except in compliance with the License. You may obtain a copy of the License at:
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software distributed
+ * under the License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR
+ * CONDITIONS OF ANY KIND, either express or implied. See the License for the
+ * specific language governing permissions and limitations under the License.
+ */
+
+package model
+
+import (
+	"fmt"
+	"math"
+	"time"
+
+	"skenario/pkg/simulator"
+)
+
+// TrafficSplit is the percentage of requests sent to each revision of a service, from At into
+// the run until the next split. Revisions which are not named get no requests.
+type TrafficSplit struct {
+	At      time.Duration      `json:"at"`
+	Percent map[string]float64 `json:"percent"`
+}
+
+// ValidateTrafficSplits checks that splits name only the given revisions, that each sends all
+// of the requests somewhere and that they come in the order they take effect, the first at
+// the start of the run.
+func ValidateTrafficSplits(revisions []string, splits []TrafficSplit) error {
+	if len(splits) == 0 {
+		return fmt.Errorf("there must be at least one traffic split")
+	}
+	if splits[0].At != 0 {
+		return fmt.Errorf("the first traffic split must be at 0, but it was at %s", splits[0].At)
+	}
+
+	known := make(map[string]bool, len(revisions))
+	for _, revision := range revisions {
+		known[revision] = true
+	}
+
+	for i, split := range splits {
+		if i > 0 && split.At <= splits[i-1].At {
+			return fmt.Errorf("traffic split at %s does not come after the split at %s", split.At, splits[i-1].At)
+		}
+
+		var total float64
+		for revision, percent := range split.Percent {
+			if !known[revision] {
+				return fmt.Errorf("traffic split at %s names unknown revision '%s'", split.At, revision)
+			}
+			if percent < 0 {
+				return fmt.Errorf("traffic split at %s sends %g%% to revision '%s'", split.At, percent, revision)
+			}
+			total += percent
+		}
+		if math.Abs(total-100) > 1e-9 {
+			return fmt.Errorf("traffic split at %s adds up to %g%%, not 100%%", split.At, total)
+		}
+	}
+
+	return nil
+}
+
+// requestsSplittingStock is where requests to a service arrive. It sends each request on to the
+// RequestsRouting stock of one of the service's revisions, chosen at random according to the
+// traffic split at the time.
+type requestsSplittingStock struct {
+	env       simulator.Environment
+	delegate  *entityStock
+	startAt   time.Time
+	revisions []ClusterModel
+	splits    []TrafficSplit
+}
+
+func (rss *requestsSplittingStock) Name() simulator.StockName {
+	return rss.delegate.Name()
+}
+
+func (rss *requestsSplittingStock) KindStocked() simulator.EntityKind {
+	return rss.delegate.KindStocked()
+}
+
+func (rss *requestsSplittingStock) Count() uint64 {
+	return rss.delegate.Count()
+}
+
+func (rss *requestsSplittingStock) EntitiesInStock() []*simulator.Entity {
+	return rss.delegate.EntitiesInStock()
+}
+
+func (rss *requestsSplittingStock) Remove() simulator.Entity {
+	return rss.delegate.Remove()
+}
+
+func (rss *requestsSplittingStock) take(entity simulator.Entity) simulator.Entity {
+	return rss.delegate.take(entity)
+}
+
+func (rss *requestsSplittingStock) Add(entity simulator.Entity) error {
+	err := rss.delegate.Add(entity)
+	if err != nil {
+		return err
+	}
+
+	revision := rss.choose(rss.splitAt(rss.env.CurrentMovementTime()))
+	rss.env.AddToSchedule(simulator.NewMovement(
+		"split_traffic",
+		rss.env.CurrentMovementTime().Add(1*time.Nanosecond),
+		departureOf(rss, entity),
+		revision.RoutingStock(),
+	))
+
+	return nil
+}
+
+// splitAt is the traffic split in effect at a time.
+func (rss *requestsSplittingStock) splitAt(at time.Time) TrafficSplit {
+	split := rss.splits[0]
+	for _, s := range rss.splits[1:] {
+		if rss.startAt.Add(s.At).After(at) {
+			break
+		}
+		split = s
+	}
+	return split
+}
+
+// choose picks a revision at random, weighted by its percentage of the split. Revisions are
+// considered in order, so that a run with the same seed makes the same choices.
+func (rss *requestsSplittingStock) choose(split TrafficSplit) ClusterModel {
+	pick := rss.env.Rand().Float64() * 100
+
+	var chosen ClusterModel
+	for _, revision := range rss.revisions {
+		percent := split.Percent[revision.Revision()]
+		if percent <= 0 {
+			continue
+		}
+
+		chosen = revision
+		pick -= percent
+		if pick < 0 {
+			break
+		}
+	}
+
+	return chosen
+}
+
+// NewTrafficSplit splits the requests to a service between its revisions. Requests should be
+// sent to the stock it returns, which is named RequestsRouting, as the stock of a service with
+// only one revision is. The splits must be valid for the revisions.
+func NewTrafficSplit(env simulator.Environment, startAt time.Time, revisions []ClusterModel, splits []TrafficSplit) RequestsRoutingStock {
+	return &requestsSplittingStock{
+		env:       env,
+		delegate:  newEntityStock("RequestsRouting", "Request"),
+		startAt:   startAt,
+		revisions: revisions,
+		splits:    splits,
+	}
+}
@@ -0,0 +1,135 @@
+/*
+ * Copyright (C) 2019-Present Pivotal Software, Inc. All rights reserved.
+ *
+ * This program and the accompanying materials are made available under the terms
+ * of the Apache License, Version 2.0 (the "License”); you may not use this file
+ * except in compliance with the License. You may obtain a copy of the License at:
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software distributed
+ * under the License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR
+ * CONDITIONS OF ANY KIND, either express or implied. See the License for the
+ * specific language governing permissions and limitations under the License.
+ */
+
+package model
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/sclevine/spec"
+	"github.com/sclevine/spec/report"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"skenario/pkg/simulator"
+)
+
+func TestTrafficSplit(t *testing.T) {
+	spec.Run(t, "Traffic split", testTrafficSplit, spec.Report(report.Terminal{}))
+}
+
+func testTrafficSplit(t *testing.T, describe spec.G, it spec.S) {
+	var subject RequestsRoutingStock
+	var envFake *FakeEnvironment
+	var stable, canary ClusterModel
+	var requestNumber int
+
+	// arrive sends requests to the service and counts where they are split to
+	arrive := func(count int) map[simulator.StockName]int {
+		envFake.Movements = envFake.Movements[:0]
+		for i := 0; i < count; i++ {
+			requestNumber++
+			require.NoError(t, subject.Add(simulator.NewEntity(simulator.EntityName(fmt.Sprintf("request-%d", requestNumber)), "Request")))
+		}
+
+		splitTo := make(map[simulator.StockName]int)
+		for _, m := range envFake.Movements {
+			require.Equal(t, simulator.MovementKind("split_traffic"), m.Kind())
+			splitTo[m.To().Name()]++
+		}
+		return splitTo
+	}
+
+	it.Before(func() {
+		envFake = &FakeEnvironment{Movements: make([]simulator.Movement, 0), TheTime: time.Unix(0, 0)}
+		stable = NewCluster(envFake, ClusterConfig{Revision: "stable"}, ReplicasConfig{})
+		canary = NewCluster(envFake, ClusterConfig{Revision: "canary"}, ReplicasConfig{})
+
+		subject = NewTrafficSplit(envFake, time.Unix(0, 0), []ClusterModel{stable, canary}, []TrafficSplit{
+			{At: 0, Percent: map[string]float64{"stable": 100}},
+			{At: 10 * time.Second, Percent: map[string]float64{"stable": 80, "canary": 20}},
+			{At: 20 * time.Second, Percent: map[string]float64{"canary": 100}},
+		})
+	})
+
+	describe("NewTrafficSplit()", func() {
+		it("is where requests to the service arrive", func() {
+			assert.Equal(t, simulator.StockName("RequestsRouting"), subject.Name())
+		})
+
+		it("names the stocks of each revision after it", func() {
+			assert.Equal(t, simulator.StockName("RequestsRouting [stable]"), stable.RoutingStock().Name())
+			assert.Equal(t, simulator.StockName("ReplicasActive [canary]"), canary.ActiveStock().Name())
+			assert.Equal(t, simulator.StockName("ReplicasDesired [canary]"), canary.Desired().Name())
+		})
+
+		it("gives each revision its own autoscaler", func() {
+			assert.NotNil(t, stable.Plugin())
+			assert.NotEqual(t, stable.Plugin(), canary.Plugin())
+		})
+	})
+
+	describe("splitting requests", func() {
+		it("sends requests according to the first split at the start", func() {
+			splitTo := arrive(100)
+			assert.Equal(t, 100, splitTo["RequestsRouting [stable]"])
+		})
+
+		it("sends requests according to the split in effect at the time", func() {
+			envFake.TheTime = time.Unix(15, 0)
+			splitTo := arrive(1000)
+			assert.InDelta(t, 800, splitTo["RequestsRouting [stable]"], 50)
+			assert.InDelta(t, 200, splitTo["RequestsRouting [canary]"], 50)
+
+			envFake.TheTime = time.Unix(20, 0)
+			splitTo = arrive(100)
+			assert.Equal(t, 100, splitTo["RequestsRouting [canary]"])
+		})
+	})
+
+	describe("ValidateTrafficSplits()", func() {
+		revisions := []string{"stable", "canary"}
+
+		it("accepts splits which add up to 100%", func() {
+			assert.NoError(t, ValidateTrafficSplits(revisions, []TrafficSplit{
+				{At: 0, Percent: map[string]float64{"stable": 90, "canary": 10}},
+			}))
+		})
+
+		it("rejects splits which do not add up to 100%", func() {
+			assert.Error(t, ValidateTrafficSplits(revisions, []TrafficSplit{
+				{At: 0, Percent: map[string]float64{"stable": 90}},
+			}))
+		})
+
+		it("rejects unknown revisions", func() {
+			assert.Error(t, ValidateTrafficSplits(revisions, []TrafficSplit{
+				{At: 0, Percent: map[string]float64{"other": 100}},
+			}))
+		})
+
+		it("rejects splits out of order or not starting at 0", func() {
+			assert.Error(t, ValidateTrafficSplits(revisions, []TrafficSplit{
+				{At: time.Second, Percent: map[string]float64{"stable": 100}},
+			}))
+			assert.Error(t, ValidateTrafficSplits(revisions, []TrafficSplit{
+				{At: 0, Percent: map[string]float64{"stable": 100}},
+				{At: 0, Percent: map[string]float64{"canary": 100}},
+			}))
+		})
+	})
+}
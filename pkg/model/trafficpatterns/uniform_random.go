@@ -16,7 +16,6 @@
 package trafficpatterns
 
 import (
-	"math/rand"
 	"time"
 
 	"skenario/pkg/model"
@@ -44,7 +43,7 @@ func (ur *uniformRandom) Name() string {
 
 func (ur *uniformRandom) Generate() {
 	for i := 0; i < ur.numberOfRequests; i++ {
-		r := rand.Int63n(ur.runFor.Nanoseconds())
+		r := ur.env.Rand().Int63n(ur.runFor.Nanoseconds())
 
 		ur.env.AddToSchedule(simulator.NewMovement(
 			"arrive_at_routing_stock",
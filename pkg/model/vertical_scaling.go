@@ -0,0 +1,277 @@
+/*
+ * Copyright (C) 2019-Present Pivotal Software, Inc. All rights reserved.
+ *
+ * This program and the accompanying materials are made available under the terms
+ * of the Apache License, Version 2.0 (the "License”); you may not use this file
+ * except in compliance with the License. You may obtain a copy of the License at:
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software distributed
+ * under the License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR
+ * CONDITIONS OF ANY KIND, either express or implied. See the License for the
+ * specific language governing permissions and limitations under the License.
+ */
+
+package model
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"time"
+
+	"github.com/josephburnett/sk-plugin/pkg/skplug/proto"
+
+	"skenario/pkg/simulator"
+)
+
+const (
+	// The defaults follow the VerticalPodAutoscaler, which recommends every minute, keeps the
+	// CPU request of a pod at least 25m and only evicts pods whose request is more than 10%
+	// away from its recommendation.
+	defaultVerticalInterval        = 1 * time.Minute
+	defaultVerticalWindow          = 10 * time.Minute
+	defaultVerticalMinCPUMillis    = 25
+	defaultVerticalUpdateThreshold = 0.1
+
+	// vpaTargetPercentile and vpaSafetyMargin are how the VerticalPodAutoscaler recommender
+	// turns CPU usage into a target request.
+	vpaTargetPercentile = 0.9
+	vpaSafetyMargin     = 0.15
+)
+
+// VerticalScalingConfig has replicas resized to the CPU request recommended by a vertical
+// autoscaler, as a VerticalPodAutoscaler in "Auto" mode does. Every Interval, replicas whose
+// request is more than UpdateThreshold away from the recommendation are taken out of
+// ReplicasActive, finish their requests and restart at the recommended size, at most half of
+// the replicas at a time. A replica's CPU limit keeps its ratio to the request.
+//
+// Replicas take RestartDelay to restart, or as long as they take to launch if it is zero.
+type VerticalScalingConfig struct {
+	Interval        time.Duration `json:"interval,omitempty"`
+	Window          time.Duration `json:"window,omitempty"`
+	MinCPUMillis    int64         `json:"min_cpu_millis,omitempty"`
+	MaxCPUMillis    int64         `json:"max_cpu_millis,omitempty"`
+	UpdateThreshold float64       `json:"update_threshold,omitempty"`
+	RestartDelay    time.Duration `json:"restart_delay,omitempty"`
+}
+
+func (vc VerticalScalingConfig) Validate() error {
+	if vc.Interval < 0 || vc.Window < 0 || vc.RestartDelay < 0 {
+		return fmt.Errorf("vertical scaling has a negative duration")
+	}
+	if vc.MinCPUMillis < 0 || vc.MaxCPUMillis < 0 {
+		return fmt.Errorf("vertical scaling has a negative CPU bound")
+	}
+	if vc.MaxCPUMillis > 0 && vc.MaxCPUMillis < vc.withDefaults().MinCPUMillis {
+		return fmt.Errorf("vertical scaling has a max_cpu_millis of %d, which is less than its min_cpu_millis", vc.MaxCPUMillis)
+	}
+	if vc.UpdateThreshold < 0 || vc.UpdateThreshold >= 1 {
+		return fmt.Errorf("vertical scaling has an update_threshold of %g, which is not at least 0 and less than 1", vc.UpdateThreshold)
+	}
+
+	return nil
+}
+
+func (vc VerticalScalingConfig) withDefaults() VerticalScalingConfig {
+	if vc.Interval == 0 {
+		vc.Interval = defaultVerticalInterval
+	}
+	if vc.Window == 0 {
+		vc.Window = defaultVerticalWindow
+	}
+	if vc.MinCPUMillis == 0 {
+		vc.MinCPUMillis = defaultVerticalMinCPUMillis
+	}
+	if vc.UpdateThreshold == 0 {
+		vc.UpdateThreshold = defaultVerticalUpdateThreshold
+	}
+
+	return vc
+}
+
+// VerticalAutoscaler recommends how much CPU each replica should request. It is sent the same
+// stats as the autoscaler plugin, whose protocol only has room for horizontal scaling.
+type VerticalAutoscaler interface {
+	Stat(stats []*proto.Stat)
+	Recommend(now time.Time) (cpuRequestMillis int64, ok bool)
+}
+
+type cpuSample struct {
+	at     time.Time
+	millis float64
+}
+
+// vpaRecommender recommends a CPU request as the VerticalPodAutoscaler recommender does: the
+// 90th percentile of the CPU used by replicas over a window, plus a safety margin.
+type vpaRecommender struct {
+	config  VerticalScalingConfig
+	samples []cpuSample
+}
+
+func (vr *vpaRecommender) Stat(stats []*proto.Stat) {
+	for _, stat := range stats {
+		if stat.Type == proto.MetricType_CPU_MILLIS {
+			vr.samples = append(vr.samples, cpuSample{at: time.Unix(0, stat.Time), millis: float64(stat.Value)})
+		}
+	}
+}
+
+func (vr *vpaRecommender) Recommend(now time.Time) (int64, bool) {
+	since := now.Add(-vr.config.Window)
+	for len(vr.samples) > 0 && vr.samples[0].at.Before(since) {
+		vr.samples = vr.samples[1:]
+	}
+	if len(vr.samples) == 0 {
+		return 0, false
+	}
+
+	usage := make([]float64, 0, len(vr.samples))
+	for _, sample := range vr.samples {
+		usage = append(usage, sample.millis)
+	}
+	sort.Float64s(usage)
+	target := usage[int(math.Ceil(vpaTargetPercentile*float64(len(usage))))-1]
+
+	recommended := int64(math.Ceil(target * (1 + vpaSafetyMargin)))
+	if recommended < vr.config.MinCPUMillis {
+		recommended = vr.config.MinCPUMillis
+	}
+	if vr.config.MaxCPUMillis > 0 && recommended > vr.config.MaxCPUMillis {
+		recommended = vr.config.MaxCPUMillis
+	}
+
+	return recommended, true
+}
+
+// NewVPARecommender is a VerticalAutoscaler which recommends as the VerticalPodAutoscaler does.
+func NewVPARecommender(config VerticalScalingConfig) VerticalAutoscaler {
+	return &vpaRecommender{config: config.withDefaults()}
+}
+
+// verticalScaler resizes replicas to the recommendations of a VerticalAutoscaler, as the
+// updater and admission controller of a VerticalPodAutoscaler do. New replicas are given the
+// recommended size as they are created.
+type verticalScaler struct {
+	env         simulator.Environment
+	cluster     *clusterModel
+	config      VerticalScalingConfig
+	recommender VerticalAutoscaler
+	tickTock    *verticalTicktockStock
+}
+
+func (vs *verticalScaler) update() {
+	recommended, ok := vs.recommender.Recommend(vs.env.CurrentMovementTime())
+	if !ok {
+		return
+	}
+
+	source := vs.cluster.replicaSource.(*replicaSource)
+	size := source.size.withRequest(recommended)
+	source.size = size
+	if vs.cluster.scheduler != nil {
+		vs.cluster.scheduler.size = size
+	}
+
+	// like a VerticalPodAutoscaler, leave at least half of the replicas running
+	restarting := vs.cluster.restartingStock()
+	active := vs.cluster.replicasActive.EntitiesInStock()
+	allowed := (len(active)+int(restarting.Count()))/2 - int(restarting.Count())
+	if allowed < 1 && restarting.Count() == 0 {
+		allowed = 1
+	}
+
+	for _, e := range active {
+		if allowed <= 0 {
+			return
+		}
+
+		replica := (*e).(*replicaEntity)
+		if !vs.outdated(replica, recommended) {
+			continue
+		}
+		if vs.cluster.scheduler != nil && !vs.cluster.scheduler.resize(replica, size) {
+			continue
+		}
+
+		replica.resizeTo = &size
+		vs.env.AddToSchedule(simulator.NewMovement(
+			"resize_replica",
+			vs.env.CurrentMovementTime().Add(1*time.Nanosecond),
+			departureOf(vs.cluster.replicasActive.(takingStock), replica),
+			restarting,
+		))
+		allowed--
+	}
+}
+
+func (vs *verticalScaler) outdated(replica *replicaEntity, recommended int64) bool {
+	current := float64(replica.cpuRequestMillis)
+	return math.Abs(float64(recommended)-current)/current > vs.config.UpdateThreshold
+}
+
+// NewVerticalScaling has the replicas of a cluster resized to the recommendations of
+// recommender, from startAt until the end of the run.
+func NewVerticalScaling(env simulator.Environment, startAt time.Time, cluster ClusterModel, config VerticalScalingConfig, recommender VerticalAutoscaler) {
+	cm := cluster.(*clusterModel)
+	config = config.withDefaults()
+
+	vs := &verticalScaler{
+		env:         env,
+		cluster:     cm,
+		config:      config,
+		recommender: recommender,
+	}
+	vs.tickTock = &verticalTicktockStock{entity: simulator.NewEntity("VerticalAutoscaler", "VerticalAutoscaler"), scaler: vs}
+	cm.verticalAutoscaler = recommender
+
+	if config.RestartDelay > 0 {
+		cm.restartingStock().restartDelay = func() time.Duration {
+			return config.RestartDelay
+		}
+	}
+
+	for theTime := startAt.Add(config.Interval).Add(1 * time.Nanosecond); theTime.Before(env.HaltTime()); theTime = theTime.Add(config.Interval) {
+		env.AddToSchedule(simulator.NewMovement(
+			"vertical_autoscaler_tick",
+			theTime,
+			vs.tickTock,
+			vs.tickTock,
+		))
+	}
+}
+
+type verticalTicktockStock struct {
+	entity simulator.Entity
+	scaler *verticalScaler
+}
+
+func (vts *verticalTicktockStock) Name() simulator.StockName {
+	return vts.scaler.cluster.stockName("VerticalAutoscaler Ticktock")
+}
+
+func (vts *verticalTicktockStock) KindStocked() simulator.EntityKind {
+	return vts.entity.Kind()
+}
+
+func (vts *verticalTicktockStock) Count() uint64 {
+	return 1
+}
+
+func (vts *verticalTicktockStock) EntitiesInStock() []*simulator.Entity {
+	return []*simulator.Entity{&vts.entity}
+}
+
+func (vts *verticalTicktockStock) Remove() simulator.Entity {
+	return vts.entity
+}
+
+func (vts *verticalTicktockStock) Add(entity simulator.Entity) error {
+	if vts.entity != entity {
+		return fmt.Errorf("'%+v' is different from the entity given at creation time, '%+v'", entity, vts.entity)
+	}
+
+	vts.scaler.update()
+	return nil
+}
@@ -0,0 +1,220 @@
+/*
+ * Copyright (C) 2019-Present Pivotal Software, Inc. All rights reserved.
+ *
+ * This program and the accompanying materials are made available under the terms
+ * of the Apache License, Version 2.0 (the "License”); you may not use this file
+ * except in compliance with the License. You may obtain a copy of the License at:
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software distributed
+ * under the License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR
+ * CONDITIONS OF ANY KIND, either express or implied. See the License for the
+ * specific language governing permissions and limitations under the License.
+ */
+
+package model
+
+import (
+	"testing"
+	"time"
+
+	"github.com/josephburnett/sk-plugin/pkg/skplug/proto"
+	"github.com/sclevine/spec"
+	"github.com/sclevine/spec/report"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"skenario/pkg/simulator"
+)
+
+type fakeVerticalAutoscaler struct {
+	recommendation int64
+	stats          []*proto.Stat
+}
+
+func (fva *fakeVerticalAutoscaler) Stat(stats []*proto.Stat) {
+	fva.stats = append(fva.stats, stats...)
+}
+
+func (fva *fakeVerticalAutoscaler) Recommend(now time.Time) (int64, bool) {
+	return fva.recommendation, fva.recommendation > 0
+}
+
+func TestVerticalScaling(t *testing.T) {
+	spec.Run(t, "Vertical scaling", testVerticalScaling, spec.Report(report.Terminal{}))
+}
+
+func testVerticalScaling(t *testing.T, describe spec.G, it spec.S) {
+	describe("vpaRecommender", func() {
+		var subject VerticalAutoscaler
+
+		stat := func(at time.Duration, millis int32) {
+			subject.Stat([]*proto.Stat{
+				{Time: time.Unix(0, 0).Add(at).UnixNano(), PodName: "replica-1", Type: proto.MetricType_CPU_MILLIS, Value: millis},
+				{Time: time.Unix(0, 0).Add(at).UnixNano(), PodName: "replica-1", Type: proto.MetricType_CONCURRENT_REQUESTS_MILLIS, Value: 99000},
+			})
+		}
+
+		it.Before(func() {
+			subject = NewVPARecommender(VerticalScalingConfig{Window: time.Minute, MaxCPUMillis: 2000})
+		})
+
+		it("has nothing to recommend without CPU stats", func() {
+			_, ok := subject.Recommend(time.Unix(0, 0))
+			assert.False(t, ok)
+		})
+
+		it("recommends the 90th percentile of CPU used, with a safety margin", func() {
+			for i := int32(1); i <= 10; i++ {
+				stat(time.Duration(i)*time.Second, i*100)
+			}
+
+			recommended, ok := subject.Recommend(time.Unix(10, 0))
+			require.True(t, ok)
+			assert.Equal(t, int64(1035), recommended)
+		})
+
+		it("forgets CPU used before the window", func() {
+			stat(0, 1000)
+			stat(90*time.Second, 100)
+
+			recommended, _ := subject.Recommend(time.Unix(100, 0))
+			assert.Equal(t, int64(115), recommended)
+		})
+
+		it("keeps to the minimum and maximum", func() {
+			stat(0, 1)
+			recommended, _ := subject.Recommend(time.Unix(0, 0))
+			assert.Equal(t, int64(25), recommended)
+
+			stat(0, 5000)
+			recommended, _ = subject.Recommend(time.Unix(0, 0))
+			assert.Equal(t, int64(2000), recommended)
+		})
+	})
+
+	describe("resizing replicas", func() {
+		var envFake *FakeEnvironment
+		var cluster *clusterModel
+		var recommender *fakeVerticalAutoscaler
+		var replicas []*replicaEntity
+
+		perform := func(kind simulator.MovementKind) simulator.Movement {
+			for i, m := range envFake.Movements {
+				if m.Kind() == kind {
+					envFake.Movements = append(envFake.Movements[:i:i], envFake.Movements[i+1:]...)
+					envFake.TheTime = m.OccursAt()
+					moved := m.From().Remove()
+					require.NotNil(t, moved, "nothing to move for '%s'", kind)
+					require.NoError(t, m.To().Add(moved))
+					return m
+				}
+			}
+			require.Fail(t, "no movement to perform", "kind: %s", kind)
+			return nil
+		}
+
+		count := func(kind simulator.MovementKind) int {
+			n := 0
+			for _, m := range envFake.Movements {
+				if m.Kind() == kind {
+					n++
+				}
+			}
+			return n
+		}
+
+		it.Before(func() {
+			envFake = &FakeEnvironment{Movements: make([]simulator.Movement, 0), TheTime: time.Unix(0, 0), TheHaltTime: time.Unix(150, 0)}
+			cluster = NewCluster(envFake, ClusterConfig{}, ReplicasConfig{CPURequestMillis: 1000, CPULimitMillis: 2000}).(*clusterModel)
+			cluster.replicasActive = newEntityStock("ReplicasActive", "Replica")
+
+			replicas = nil
+			for i := 0; i < 4; i++ {
+				replica := cluster.replicaSource.Remove().(*replicaEntity)
+				require.NoError(t, cluster.replicasActive.Add(replica))
+				replicas = append(replicas, replica)
+			}
+
+			recommender = &fakeVerticalAutoscaler{recommendation: 500}
+			NewVerticalScaling(envFake, time.Unix(0, 0), cluster, VerticalScalingConfig{RestartDelay: 2 * time.Second}, recommender)
+		})
+
+		it("gives replicas the CPU they are configured with", func() {
+			assert.Equal(t, int64(1000), replicas[0].CPURequestMillis())
+			assert.Equal(t, 2000.0, replicas[0].totalCPUCapacityMillisPerSecond)
+		})
+
+		it("recommends every minute", func() {
+			assert.Equal(t, 2, count("vertical_autoscaler_tick"))
+		})
+
+		it("sends the recommender the stats sent to the autoscaler plugin", func() {
+			assert.Equal(t, cluster.verticalAutoscaler, recommender)
+		})
+
+		describe("when the recommendation is far from what replicas request", func() {
+			it.Before(func() {
+				perform("vertical_autoscaler_tick")
+			})
+
+			it("resizes half of the replicas at a time", func() {
+				assert.Equal(t, 2, count("resize_replica"))
+			})
+
+			it("gives new replicas the recommended size, keeping the ratio of limit to request", func() {
+				replica := cluster.replicaSource.Remove().(*replicaEntity)
+				assert.Equal(t, int64(500), replica.CPURequestMillis())
+				assert.Equal(t, 1000.0, replica.totalCPUCapacityMillisPerSecond)
+			})
+
+			it("restarts a resized replica at its new size once it has finished its requests", func() {
+				resize := perform("resize_replica")
+				assert.Equal(t, simulator.StockName("ReplicasRestarting"), resize.To().Name())
+				assert.Equal(t, 3, int(cluster.replicasActive.Count()))
+
+				restart := perform("restart_replica")
+				assert.Equal(t, time.Unix(62, 2), restart.OccursAt())
+				assert.Equal(t, []string{"requesting 500m CPU, limited to 1000m"}, restart.Notes())
+				assert.Equal(t, 4, int(cluster.replicasActive.Count()))
+			})
+
+			it("resizes the rest at the next recommendation", func() {
+				perform("resize_replica")
+				perform("resize_replica")
+				perform("restart_replica")
+				perform("restart_replica")
+
+				perform("vertical_autoscaler_tick")
+				assert.Equal(t, 2, count("resize_replica"))
+			})
+		})
+
+		describe("when the recommendation is close to what replicas request", func() {
+			it.Before(func() {
+				recommender.recommendation = 950
+				perform("vertical_autoscaler_tick")
+			})
+
+			it("leaves the replicas be", func() {
+				assert.Equal(t, 0, count("resize_replica"))
+			})
+		})
+	})
+
+	describe("Validate()", func() {
+		it("accepts the defaults", func() {
+			assert.NoError(t, VerticalScalingConfig{}.Validate())
+		})
+
+		it("rejects a maximum below the minimum", func() {
+			assert.Error(t, VerticalScalingConfig{MaxCPUMillis: 10}.Validate())
+			assert.Error(t, VerticalScalingConfig{MinCPUMillis: 200, MaxCPUMillis: 100}.Validate())
+		})
+
+		it("rejects an update threshold of 1 or more", func() {
+			assert.Error(t, VerticalScalingConfig{UpdateThreshold: 1}.Validate())
+		})
+	})
+}
@@ -0,0 +1,171 @@
+/*
+ * Copyright (C) 2019-Present Pivotal Software, Inc. All rights reserved.
+ *
+ * This program and the accompanying materials are made available under the terms
+ * of the Apache License, Version 2.0 (the "License”); you may not use this file
+ * except in compliance with the License. You may obtain a copy of the License at:
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software distributed
+ * under the License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR
+ * CONDITIONS OF ANY KIND, either express or implied. See the License for the
+ * specific language governing permissions and limitations under the License.
+ */
+
+package report
+
+import (
+	"bytes"
+	"fmt"
+	"html"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Point is a value at an instant, given in nanoseconds since the start of the run.
+type Point struct {
+	At    int64
+	Value float64
+}
+
+type Series struct {
+	Name   string
+	Color  string
+	Points []Point
+
+	// Step series hold each value until the next point. Otherwise points are joined by lines,
+	// or drawn as dots when Scatter is set.
+	Step    bool
+	Scatter bool
+}
+
+// Chart is a time series chart which renders itself as standalone SVG.
+type Chart struct {
+	Title  string
+	Slug   string
+	YLabel string
+
+	// Durations marks Y values as nanoseconds, to be labelled as durations.
+	Durations bool
+
+	// RunFor is the length of the X axis.
+	RunFor time.Duration
+	Series []Series
+}
+
+const (
+	chartWidth  = 800
+	chartHeight = 260
+	marginLeft  = 70
+	marginRight = 20
+	marginTop   = 30
+	marginBot   = 40
+)
+
+// SVG renders the chart as a standalone SVG document.
+func (c Chart) SVG() string {
+	plotWidth := float64(chartWidth - marginLeft - marginRight)
+	plotHeight := float64(chartHeight - marginTop - marginBot)
+
+	xMax := float64(c.RunFor)
+	yMax := 0.0
+	for _, s := range c.Series {
+		for _, p := range s.Points {
+			xMax = math.Max(xMax, float64(p.At))
+			yMax = math.Max(yMax, p.Value)
+		}
+	}
+	if xMax <= 0 {
+		xMax = float64(time.Second)
+	}
+	yStep := niceStep(yMax / 4)
+	if yMax == 0 {
+		yStep = 1
+	}
+	yMax = yStep * math.Ceil(yMax/yStep)
+	if yMax == 0 {
+		yMax = yStep
+	}
+
+	x := func(at float64) float64 { return marginLeft + at/xMax*plotWidth }
+	y := func(v float64) float64 { return marginTop + plotHeight - v/yMax*plotHeight }
+
+	svg := new(bytes.Buffer)
+	fmt.Fprintf(svg, `<svg xmlns="http://www.w3.org/2000/svg" width="%d" height="%d" viewBox="0 0 %d %d" font-family="sans-serif" font-size="11">`+"\n", chartWidth, chartHeight, chartWidth, chartHeight)
+	fmt.Fprintf(svg, `<rect width="%d" height="%d" fill="white"/>`+"\n", chartWidth, chartHeight)
+	fmt.Fprintf(svg, `<text x="%d" y="18" font-size="14" font-weight="bold">%s</text>`+"\n", marginLeft, html.EscapeString(c.Title))
+
+	for i := 0; float64(i)*yStep <= yMax+yStep/2; i++ {
+		v := float64(i) * yStep
+		fmt.Fprintf(svg, `<line x1="%d" x2="%.1f" y1="%.1f" y2="%.1f" stroke="#ddd"/>`+"\n", marginLeft, marginLeft+plotWidth, y(v), y(v))
+		fmt.Fprintf(svg, `<text x="%d" y="%.1f" text-anchor="end" dominant-baseline="middle">%s</text>`+"\n", marginLeft-6, y(v), c.formatY(v))
+	}
+
+	xStep := niceStep(xMax/float64(time.Second)/8) * float64(time.Second)
+	for i := 0; float64(i)*xStep <= xMax; i++ {
+		at := float64(i) * xStep
+		fmt.Fprintf(svg, `<line x1="%.1f" x2="%.1f" y1="%d" y2="%.1f" stroke="#ddd"/>`+"\n", x(at), x(at), marginTop, marginTop+plotHeight)
+		fmt.Fprintf(svg, `<text x="%.1f" y="%.1f" text-anchor="middle">%s</text>`+"\n", x(at), marginTop+plotHeight+16, time.Duration(math.Round(at)))
+	}
+	fmt.Fprintf(svg, `<text x="%.1f" y="%d" text-anchor="middle">simulated time</text>`+"\n", marginLeft+plotWidth/2, chartHeight-4)
+	fmt.Fprintf(svg, `<text x="14" y="%.1f" text-anchor="middle" transform="rotate(-90 14 %.1f)">%s</text>`+"\n", marginTop+plotHeight/2, marginTop+plotHeight/2, html.EscapeString(c.YLabel))
+
+	legendX := float64(chartWidth - marginRight)
+	for i := len(c.Series) - 1; i >= 0; i-- {
+		s := c.Series[i]
+		legendX -= float64(len(s.Name)*7 + 24)
+		fmt.Fprintf(svg, `<rect x="%.1f" y="10" width="10" height="10" fill="%s"/>`+"\n", legendX, s.Color)
+		fmt.Fprintf(svg, `<text x="%.1f" y="19">%s</text>`+"\n", legendX+14, html.EscapeString(s.Name))
+	}
+
+	for _, s := range c.Series {
+		if s.Scatter {
+			for _, p := range s.Points {
+				fmt.Fprintf(svg, `<circle cx="%.1f" cy="%.1f" r="1.5" fill="%s" fill-opacity="0.6"/>`+"\n", x(float64(p.At)), y(p.Value), s.Color)
+			}
+			continue
+		}
+		if len(s.Points) == 0 {
+			continue
+		}
+
+		coords := make([]string, 0, 2*len(s.Points))
+		for i, p := range s.Points {
+			if s.Step && i > 0 {
+				coords = append(coords, fmt.Sprintf("%.1f,%.1f", x(float64(p.At)), y(s.Points[i-1].Value)))
+			}
+			coords = append(coords, fmt.Sprintf("%.1f,%.1f", x(float64(p.At)), y(p.Value)))
+		}
+		fmt.Fprintf(svg, `<polyline fill="none" stroke="%s" stroke-width="1.5" points="%s"/>`+"\n", s.Color, strings.Join(coords, " "))
+	}
+
+	fmt.Fprintf(svg, `<rect x="%d" y="%d" width="%.1f" height="%.1f" fill="none" stroke="#999"/>`+"\n", marginLeft, marginTop, plotWidth, plotHeight)
+	svg.WriteString("</svg>\n")
+
+	return svg.String()
+}
+
+func (c Chart) formatY(v float64) string {
+	if c.Durations {
+		return time.Duration(math.Round(v)).String()
+	}
+	return strconv.FormatFloat(v, 'g', 4, 64)
+}
+
+// niceStep rounds a raw interval up to 1, 2 or 5 times a power of ten.
+func niceStep(raw float64) float64 {
+	if raw <= 0 {
+		return 1
+	}
+
+	magnitude := math.Pow(10, math.Floor(math.Log10(raw)))
+	for _, m := range []float64{1, 2, 5, 10} {
+		if raw <= m*magnitude {
+			return m * magnitude
+		}
+	}
+	return 10 * magnitude
+}
@@ -0,0 +1,326 @@
+/*
+ * Copyright (C) 2019-Present Pivotal Software, Inc. All rights reserved.
+ *
+ * This program and the accompanying materials are made available under the terms
+ * of the Apache License, Version 2.0 (the "License”); you may not use this file
+ * except in compliance with the License. You may obtain a copy of the License at:
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software distributed
+ * under the License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR
+ * CONDITIONS OF ANY KIND, either express or implied. See the License for the
+ * specific language governing permissions and limitations under the License.
+ */
+
+package report
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"html/template"
+	"io"
+	"sort"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/bvinc/go-sqlite-lite/sqlite3"
+
+	"skenario/pkg/data"
+)
+
+// Report gathers everything known about a stored run, to be rendered as a static document.
+type Report struct {
+	ScenarioRunId int64
+	RunFor        time.Duration
+	Summary       data.RunSummary
+	SLO           *data.SLOResult
+	Configuration []Setting
+	Charts        []Chart
+}
+
+type Setting struct {
+	Name  string
+	Value string
+}
+
+// Build reads a stored run and prepares its report. If the run was made with an SLO, the SLO
+// is evaluated against the run's summary.
+func Build(conn *sqlite3.Conn, scenarioRunId int64) (Report, error) {
+	report := Report{ScenarioRunId: scenarioRunId}
+
+	var err error
+	report.Summary, err = data.Summarize(conn, scenarioRunId)
+	if err != nil {
+		return report, err
+	}
+
+	configuration, err := data.RunConfiguration(conn, scenarioRunId)
+	if err != nil {
+		return report, err
+	}
+	for name, value := range configuration {
+		var unquoted string
+		if json.Unmarshal([]byte(value), &unquoted) == nil {
+			value = unquoted
+		}
+		report.Configuration = append(report.Configuration, Setting{Name: name, Value: value})
+	}
+	sort.Slice(report.Configuration, func(i, j int) bool {
+		return report.Configuration[i].Name < report.Configuration[j].Name
+	})
+
+	for _, s := range report.Configuration {
+		switch s.Name {
+		case "slo":
+			if s.Value != "" {
+				slo, err := data.EvaluateSLO(s.Value, report.Summary)
+				if err != nil {
+					return report, err
+				}
+				report.SLO = &slo
+			}
+		case "run_for", "simulated_duration":
+			var nanos int64
+			fmt.Sscan(s.Value, &nanos)
+			report.RunFor = time.Duration(nanos)
+		}
+	}
+
+	report.Charts, err = charts(conn, scenarioRunId, report.RunFor)
+	return report, err
+}
+
+func charts(conn *sqlite3.Conn, scenarioRunId int64, runFor time.Duration) ([]Chart, error) {
+	active, err := data.StockSteps(conn, scenarioRunId, "ReplicasActive")
+	if err != nil {
+		return nil, err
+	}
+	desired, err := data.StockSteps(conn, scenarioRunId, "ReplicasDesired")
+	if err != nil {
+		return nil, err
+	}
+	arrivals, err := data.ArrivalsPerSecond(conn, scenarioRunId)
+	if err != nil {
+		return nil, err
+	}
+	responseTimes, err := data.CompletedResponseTimes(conn, scenarioRunId)
+	if err != nil {
+		return nil, err
+	}
+	utilizations, err := data.CPUUtilizations(conn, scenarioRunId)
+	if err != nil {
+		return nil, err
+	}
+	failures, err := data.FailuresPerSecond(conn, scenarioRunId)
+	if err != nil {
+		return nil, err
+	}
+
+	latencies := make([]Point, len(responseTimes))
+	for i, rt := range responseTimes {
+		latencies[i] = Point{At: rt.ArrivedAt, Value: float64(rt.ResponseTime)}
+	}
+	sort.Slice(latencies, func(i, j int) bool { return latencies[i].At < latencies[j].At })
+
+	cpu := make([]Point, len(utilizations))
+	for i, cu := range utilizations {
+		cpu[i] = Point{At: cu.CalculatedAt, Value: cu.Utilization}
+	}
+
+	return []Chart{
+		{
+			Title:  "Replicas",
+			Slug:   "replicas",
+			YLabel: "replicas",
+			RunFor: runFor,
+			Series: []Series{
+				{Name: "desired", Color: "#e6a23c", Points: stepPoints(desired, runFor), Step: true},
+				{Name: "active", Color: "#409eff", Points: stepPoints(active, runFor), Step: true},
+			},
+		},
+		{
+			Title:  "Requests per second",
+			Slug:   "rps",
+			YLabel: "requests/s",
+			RunFor: runFor,
+			Series: []Series{{Name: "arrivals", Color: "#67c23a", Points: perSecond(arrivals, runFor), Step: true}},
+		},
+		{
+			Title:     "Response times",
+			Slug:      "latency",
+			YLabel:    "response time",
+			Durations: true,
+			RunFor:    runFor,
+			Series:    []Series{{Name: "completed requests", Color: "#409eff", Points: latencies, Scatter: true}},
+		},
+		{
+			Title:  "CPU utilization",
+			Slug:   "cpu",
+			YLabel: "% utilization",
+			RunFor: runFor,
+			Series: []Series{{Name: "highest replica", Color: "#909399", Points: cpu}},
+		},
+		{
+			Title:  "Failures per second",
+			Slug:   "failures",
+			YLabel: "failures/s",
+			RunFor: runFor,
+			Series: []Series{{Name: "failed requests", Color: "#f56c6c", Points: perSecond(failures, runFor), Step: true}},
+		},
+	}, nil
+}
+
+// stepPoints starts a stock at zero and holds its last count until the end of the run.
+func stepPoints(steps []data.StockStep, runFor time.Duration) []Point {
+	points := []Point{{At: 0, Value: 0}}
+	for _, s := range steps {
+		points = append(points, Point{At: s.OccursAt, Value: float64(s.Count)})
+	}
+	if last := points[len(points)-1]; last.At < int64(runFor) {
+		points = append(points, Point{At: int64(runFor), Value: last.Value})
+	}
+	return points
+}
+
+// perSecond fills in the seconds without any counts, so that they are drawn as zero.
+func perSecond(counts []data.SecondCount, runFor time.Duration) []Point {
+	seconds := int64(runFor / time.Second)
+	if len(counts) > 0 && counts[len(counts)-1].Second >= seconds {
+		seconds = counts[len(counts)-1].Second + 1
+	}
+
+	values := make([]float64, seconds)
+	for _, sc := range counts {
+		if sc.Second >= 0 {
+			values[sc.Second] = float64(sc.Count)
+		}
+	}
+
+	points := make([]Point, 0, seconds+1)
+	for s, v := range values {
+		points = append(points, Point{At: int64(s) * int64(time.Second), Value: v})
+	}
+	if seconds > 0 {
+		points = append(points, Point{At: seconds * int64(time.Second), Value: values[seconds-1]})
+	}
+	return points
+}
+
+// Metrics gives the summary metrics of the run, formatted for reading.
+func (r Report) Metrics() []Setting {
+	metrics := make([]Setting, 0)
+	for _, name := range r.Summary.MetricNames() {
+		value, _ := r.Summary.Metric(name)
+		metrics = append(metrics, Setting{Name: name, Value: data.FormatMetric(name, value)})
+	}
+	return metrics
+}
+
+var htmlTemplate = template.Must(template.New("report").Funcs(template.FuncMap{
+	"svg":    func(c Chart) template.HTML { return template.HTML(c.SVG()) },
+	"actual": actual,
+}).Parse(`<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>Skenario run {{.ScenarioRunId}}</title>
+<style>
+body { font-family: sans-serif; max-width: 840px; margin: 2em auto; color: #303133; }
+table { border-collapse: collapse; margin-bottom: 1.5em; }
+td, th { border: 1px solid #dcdfe6; padding: 4px 10px; text-align: left; }
+.pass { color: #67c23a; } .fail { color: #f56c6c; }
+</style>
+</head>
+<body>
+<h1>Skenario run {{.ScenarioRunId}}</h1>
+{{with .SLO}}
+<h2>SLO <span class="{{if .Passed}}pass">passed{{else}}fail">failed{{end}}</span></h2>
+<table>
+<tr><th>objective</th><th>actual</th><th></th></tr>
+{{range .Objectives}}<tr><td>{{.Objective.Expression}}</td><td>{{actual .}}</td><td class="{{if .Passed}}pass">pass{{else}}fail">fail{{end}}</td></tr>
+{{end}}</table>
+{{end}}
+<h2>Summary</h2>
+<table>
+{{range .Metrics}}<tr><td>{{.Name}}</td><td>{{.Value}}</td></tr>
+{{end}}</table>
+<h2>Charts</h2>
+{{range .Charts}}<figure>{{svg .}}</figure>
+{{end}}
+<h2>Configuration</h2>
+<table>
+{{range .Configuration}}<tr><td>{{.Name}}</td><td>{{.Value}}</td></tr>
+{{end}}</table>
+</body>
+</html>
+`))
+
+func actual(or data.ObjectiveResult) string {
+	return data.FormatMetric(or.Objective.Metric, or.Actual)
+}
+
+// WriteHTML writes the report as a single HTML page, with its charts inlined as SVG.
+func (r Report) WriteHTML(w io.Writer) error {
+	return htmlTemplate.Execute(w, r)
+}
+
+// DataURI gives a chart as a data URI, so that it can be embedded in a document on its own.
+func DataURI(c Chart) (string, error) {
+	return "data:image/svg+xml;base64," + base64.StdEncoding.EncodeToString([]byte(c.SVG())), nil
+}
+
+// WriteMarkdown writes the report as Markdown. Each chart becomes an image whose URL is given
+// by image, which might save the chart alongside the document or return its DataURI.
+func (r Report) WriteMarkdown(w io.Writer, image func(Chart) (string, error)) error {
+	md := new(strings.Builder)
+
+	fmt.Fprintf(md, "# Skenario run %d\n\n", r.ScenarioRunId)
+
+	if r.SLO != nil {
+		outcome := "passed"
+		if !r.SLO.Passed {
+			outcome = "failed"
+		}
+		fmt.Fprintf(md, "## SLO %s\n\n| objective | actual | |\n|---|---|---|\n", outcome)
+		for _, or := range r.SLO.Objectives {
+			status := "pass"
+			if !or.Passed {
+				status = "**fail**"
+			}
+			fmt.Fprintf(md, "| `%s` | %s | %s |\n", or.Objective.Expression, actual(or), status)
+		}
+		md.WriteString("\n")
+	}
+
+	md.WriteString("## Summary\n\n| metric | value |\n|---|---|\n")
+	for _, m := range r.Metrics() {
+		fmt.Fprintf(md, "| %s | %s |\n", m.Name, m.Value)
+	}
+
+	md.WriteString("\n## Charts\n\n")
+	for _, c := range r.Charts {
+		url, err := image(c)
+		if err != nil {
+			return err
+		}
+		fmt.Fprintf(md, "![%s](%s)\n\n", c.Title, url)
+	}
+
+	md.WriteString("## Configuration\n\n")
+	tw := tabwriter.NewWriter(md, 0, 4, 1, ' ', 0)
+	fmt.Fprintln(tw, "| setting\t| value\t|")
+	fmt.Fprintln(tw, "|---\t|---\t|")
+	for _, s := range r.Configuration {
+		fmt.Fprintf(tw, "| %s\t| `%s`\t|\n", s.Name, strings.Replace(s.Value, "|", "\\|", -1))
+	}
+	err := tw.Flush()
+	if err != nil {
+		return err
+	}
+
+	_, err = io.WriteString(w, md.String())
+	return err
+}
@@ -0,0 +1,175 @@
+/*
+ * Copyright (C) 2019-Present Pivotal Software, Inc. All rights reserved.
+ *
+ * This program and the accompanying materials are made available under the terms
+ * of the Apache License, Version 2.0 (the "License”); you may not use this file
+ * except in compliance with the License. You may obtain a copy of the License at:
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software distributed
+ * under the License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR
+ * CONDITIONS OF ANY KIND, either express or implied. See the License for the
+ * specific language governing permissions and limitations under the License.
+ */
+
+package report
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/bvinc/go-sqlite-lite/sqlite3"
+	"github.com/sclevine/spec"
+	"github.com/sclevine/spec/report"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"skenario/pkg/data"
+	"skenario/pkg/model"
+	"skenario/pkg/simulator"
+)
+
+func TestReport(t *testing.T) {
+	spec.Run(t, "Report", testReport, spec.Report(report.Terminal{}))
+}
+
+func testReport(t *testing.T, describe spec.G, it spec.S) {
+	var conn *sqlite3.Conn
+	var subject Report
+	var err error
+
+	it.Before(func() {
+		conn, err = sqlite3.Open(":memory:")
+		require.NoError(t, err)
+
+		store, err := data.NewStreamingRunStore(conn, model.ClusterConfig{}, model.KnativeAutoscalerConfig{}, "test_origin", "test_pattern", 10*time.Second)
+		require.NoError(t, err)
+		id := store.ScenarioRunId()
+
+		at := func(d time.Duration) time.Time { return time.Unix(0, 0).Add(d) }
+		routing := simulator.NewThroughStock("RequestsRouting", "Request")
+		complete := simulator.NewThroughStock("RequestsComplete [1]", "Request")
+		launching := simulator.NewThroughStock("ReplicasLaunching", "Replica")
+		active := simulator.NewThroughStock("ReplicasActive", "Replica")
+		request := simulator.NewEntity("request-1", "Request")
+
+		err = store.Flush([]simulator.CompletedMovement{
+			{Movement: simulator.NewMovement("finish_launching", at(time.Second), launching, active), Moved: simulator.NewEntity("replica-1", "Replica")},
+			{Movement: simulator.NewMovement("arrive_at_routing_stock", at(2*time.Second), routing, routing), Moved: request},
+			{Movement: simulator.NewMovement("complete_request", at(2500*time.Millisecond), routing, complete), Moved: request},
+		}, nil)
+		require.NoError(t, err)
+
+		err = data.StoreRunConfiguration(conn, id, `{"run_for": 10000000000, "traffic_pattern": "step", "slo": "p99 < 1s and peak_replicas > 1"}`)
+		require.NoError(t, err)
+
+		subject, err = Build(conn, id)
+		require.NoError(t, err)
+	})
+
+	describe("Build()", func() {
+		it("reads the run's configuration", func() {
+			assert.Equal(t, 10*time.Second, subject.RunFor)
+			assert.Contains(t, subject.Configuration, Setting{Name: "traffic_pattern", Value: "step"})
+		})
+
+		it("evaluates the run's SLO", func() {
+			require.NotNil(t, subject.SLO)
+			assert.False(t, subject.SLO.Passed)
+			assert.True(t, subject.SLO.Objectives[0].Passed)
+			assert.False(t, subject.SLO.Objectives[1].Passed)
+		})
+
+		it("charts replicas, requests, latency, CPU and failures", func() {
+			slugs := make([]string, 0)
+			for _, c := range subject.Charts {
+				slugs = append(slugs, c.Slug)
+			}
+			assert.Equal(t, []string{"replicas", "rps", "latency", "cpu", "failures"}, slugs)
+		})
+
+		it("holds the replica count until the end of the run", func() {
+			assert.Equal(t, []Point{{0, 0}, {int64(time.Second), 1}, {int64(10 * time.Second), 1}}, subject.Charts[0].Series[1].Points)
+		})
+
+		it("fills in seconds without arrivals", func() {
+			points := subject.Charts[1].Series[0].Points
+			assert.Len(t, points, 11)
+			assert.Equal(t, Point{int64(2 * time.Second), 1}, points[2])
+			assert.Equal(t, Point{int64(3 * time.Second), 0}, points[3])
+		})
+	})
+
+	describe("WriteHTML()", func() {
+		it("inlines the charts as SVG", func() {
+			buf := new(bytes.Buffer)
+			err = subject.WriteHTML(buf)
+			require.NoError(t, err)
+
+			assert.Equal(t, 5, strings.Count(buf.String(), "<svg"))
+			assert.Contains(t, buf.String(), "peak_replicas &gt; 1")
+		})
+	})
+
+	describe("WriteMarkdown()", func() {
+		it("links each chart by the URL it is given", func() {
+			buf := new(bytes.Buffer)
+			err = subject.WriteMarkdown(buf, func(c Chart) (string, error) { return c.Slug + ".svg", nil })
+			require.NoError(t, err)
+
+			assert.Contains(t, buf.String(), "## SLO failed")
+			assert.Contains(t, buf.String(), "| `peak_replicas > 1` | 1 | **fail** |")
+			assert.Contains(t, buf.String(), "![Replicas](replicas.svg)")
+		})
+	})
+}
+
+func TestChart(t *testing.T) {
+	spec.Run(t, "Chart", testChart, spec.Report(report.Terminal{}))
+}
+
+func testChart(t *testing.T, describe spec.G, it spec.S) {
+	describe("SVG()", func() {
+		var svg string
+
+		it.Before(func() {
+			svg = Chart{
+				Title:     "Response <times>",
+				Durations: true,
+				RunFor:    10 * time.Second,
+				Series: []Series{
+					{Name: "line", Color: "red", Points: []Point{{0, 0}, {int64(5 * time.Second), float64(time.Second)}}, Step: true},
+					{Name: "dots", Color: "blue", Points: []Point{{int64(time.Second), float64(time.Second)}}, Scatter: true},
+				},
+			}.SVG()
+		})
+
+		it("escapes the title", func() {
+			assert.Contains(t, svg, "Response &lt;times&gt;")
+		})
+
+		it("draws step series with horizontal then vertical segments", func() {
+			assert.Contains(t, svg, `points="70.0,220.0 425.0,220.0 425.0,30.0"`)
+		})
+
+		it("draws scatter series as dots", func() {
+			assert.Equal(t, 1, strings.Count(svg, "<circle"))
+		})
+
+		it("labels durations on the Y axis", func() {
+			assert.Contains(t, svg, ">1s</text>")
+		})
+	})
+
+	describe("niceStep()", func() {
+		it("rounds up to 1, 2 or 5 times a power of ten", func() {
+			assert.Equal(t, 1.0, niceStep(0.8))
+			assert.Equal(t, 2.0, niceStep(1.3))
+			assert.Equal(t, 50.0, niceStep(36))
+			assert.Equal(t, 0.5, niceStep(0.3))
+		})
+	})
+}
@@ -0,0 +1,130 @@
+/*
+ * Copyright (C) 2019-Present Pivotal Software, Inc. All rights reserved.
+ *
+ * This program and the accompanying materials are made available under the terms
+ * of the Apache License, Version 2.0 (the "License”); you may not use this file
+ * except in compliance with the License. You may obtain a copy of the License at:
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software distributed
+ * under the License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR
+ * CONDITIONS OF ANY KIND, either express or implied. See the License for the
+ * specific language governing permissions and limitations under the License.
+ */
+
+package serve
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strconv"
+	"text/tabwriter"
+	"time"
+
+	"github.com/bvinc/go-sqlite-lite/sqlite3"
+
+	"skenario/pkg/data"
+)
+
+// CompareHandler compares two stored runs, given as "?a={id}&b={id}". The replica timeline
+// is sampled every "interval" (a duration, 1s by default). The result is JSON, unless a table
+// is asked for with "format=table".
+func CompareHandler(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+
+	a, err := strconv.ParseInt(query.Get("a"), 10, 64)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("invalid run ID for 'a': %s", err.Error()), http.StatusBadRequest)
+		return
+	}
+	b, err := strconv.ParseInt(query.Get("b"), 10, 64)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("invalid run ID for 'b': %s", err.Error()), http.StatusBadRequest)
+		return
+	}
+
+	interval := time.Second
+	if query.Get("interval") != "" {
+		interval, err = time.ParseDuration(query.Get("interval"))
+		if err != nil || interval <= 0 {
+			http.Error(w, fmt.Sprintf("invalid interval '%s'", query.Get("interval")), http.StatusBadRequest)
+			return
+		}
+	}
+
+	dbFileName := databaseFileName(query.Get("inmemory") == "true")
+	conn, err := sqlite3.Open(dbFileName, sqlite3.OPEN_READONLY)
+	if err != nil {
+		panic(fmt.Errorf("could not open database file '%s': %s", dbFileName, err.Error()))
+	}
+	defer conn.Close()
+
+	comparison, err := data.CompareRuns(conn, a, b, interval)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+
+	if query.Get("format") == "table" {
+		w.Header().Set("Content-Type", "text/plain")
+		err = WriteComparisonTable(w, comparison)
+	} else {
+		w.Header().Set("Content-Type", "application/json")
+		err = json.NewEncoder(w).Encode(comparison)
+	}
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+	}
+}
+
+// WriteComparisonTable writes the headline deltas of a comparison, followed by its config diff.
+func WriteComparisonTable(w io.Writer, c data.RunComparison) error {
+	tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+
+	duration := func(v float64) string { return time.Duration(v).String() }
+	number := func(v float64) string { return strconv.FormatFloat(v, 'g', 4, 64) }
+	percent := func(v float64) string { return fmt.Sprintf("%.2f%%", v*100) }
+
+	row := func(name string, d data.Delta, format func(float64) string) {
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\n", name, format(d.A), format(d.B), format(d.Delta))
+	}
+
+	fmt.Fprintf(tw, "metric\trun %d\trun %d\tdelta\n", c.A, c.B)
+	row("p50", c.Latency.P50, duration)
+	row("p90", c.Latency.P90, duration)
+	row("p99", c.Latency.P99, duration)
+	row("p99.9", c.Latency.P999, duration)
+	row("failed", c.Failures.Failed, number)
+	row("failure_rate", c.Failures.Rate, percent)
+
+	reasons := make([]string, 0, len(c.Failures.ByReason))
+	for reason := range c.Failures.ByReason {
+		reasons = append(reasons, reason)
+	}
+	sort.Strings(reasons)
+	for _, reason := range reasons {
+		row("failures."+reason, c.Failures.ByReason[reason], number)
+	}
+
+	row("replica_seconds", c.ReplicaSeconds, number)
+	row("peak_replicas", c.PeakReplicas, number)
+	row("scale_ups", c.ScalingEvents.ScaleUps, number)
+	row("scale_downs", c.ScalingEvents.ScaleDowns, number)
+
+	fmt.Fprintf(tw, "\nlatency KS test\tD = %.4f\tp = %.4f\t\n", c.Latency.KS.Statistic, c.Latency.KS.PValue)
+
+	if len(c.ConfigDiff) > 0 {
+		fmt.Fprintf(tw, "\nparameter\trun %d\trun %d\t\n", c.A, c.B)
+		for _, d := range c.ConfigDiff {
+			fmt.Fprintf(tw, "%s\t%s\t%s\t\n", d.Parameter, d.A, d.B)
+		}
+	} else {
+		fmt.Fprintln(tw, "\nno configuration differences")
+	}
+
+	return tw.Flush()
+}
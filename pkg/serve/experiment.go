@@ -0,0 +1,427 @@
+/*
+ * Copyright (C) 2019-Present Pivotal Software, Inc. All rights reserved.
+ *
+ * This program and the accompanying materials are made available under the terms
+ * of the Apache License, Version 2.0 (the "License”); you may not use this file
+ * except in compliance with the License. You may obtain a copy of the License at:
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software distributed
+ * under the License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR
+ * CONDITIONS OF ANY KIND, either express or implied. See the License for the
+ * specific language governing permissions and limitations under the License.
+ */
+
+package serve
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"runtime"
+	"strings"
+	"sync"
+	"text/tabwriter"
+	"time"
+
+	"github.com/bvinc/go-sqlite-lite/sqlite3"
+
+	"skenario/pkg/data"
+)
+
+// Experiment runs a base scenario once for every combination of values along its axes.
+type Experiment struct {
+	Name        string             `json:"name"`
+	Base        SkenarioRunRequest `json:"base"`
+	Axes        []Axis             `json:"axes"`
+	Parallelism int                `json:"parallelism,omitempty"`
+}
+
+// Axis varies one field of the base SkenarioRunRequest. Field is the field's JSON name,
+// with nested fields separated by dots (eg. "uniform_config.number_of_requests").
+// Values may be listed, or given as an inclusive range. Durations may be written as
+// strings such as "30s".
+type Axis struct {
+	Field  string        `json:"field"`
+	Values []interface{} `json:"values,omitempty"`
+	Range  *AxisRange    `json:"range,omitempty"`
+}
+
+type AxisRange struct {
+	From interface{} `json:"from"`
+	To   interface{} `json:"to"`
+	Step interface{} `json:"step"`
+}
+
+// Parameter is the value taken along one axis by one combination.
+type Parameter struct {
+	Field string      `json:"field"`
+	Value interface{} `json:"value"`
+}
+
+type ExperimentRow struct {
+	Parameters    []Parameter     `json:"parameters"`
+	ScenarioRunId int64           `json:"scenario_run_id"`
+	Summary       data.RunSummary `json:"summary"`
+	SLO           *data.SLOResult `json:"slo,omitempty"`
+	Error         string          `json:"error,omitempty"`
+}
+
+type ExperimentResult struct {
+	ExperimentId int64           `json:"experiment_id"`
+	Name         string          `json:"name"`
+	Rows         []ExperimentRow `json:"rows"`
+}
+
+// Combinations expands the axes into their cartesian product, varying the last axis fastest.
+func (e *Experiment) Combinations() ([][]Parameter, error) {
+	combinations := [][]Parameter{{}}
+
+	for _, axis := range e.Axes {
+		values, err := axis.values()
+		if err != nil {
+			return nil, err
+		}
+
+		expanded := make([][]Parameter, 0, len(combinations)*len(values))
+		for _, combination := range combinations {
+			for _, v := range values {
+				next := make([]Parameter, len(combination), len(combination)+1)
+				copy(next, combination)
+				expanded = append(expanded, append(next, Parameter{Field: axis.Field, Value: v}))
+			}
+		}
+		combinations = expanded
+	}
+
+	return combinations, nil
+}
+
+// RunRequest applies a combination of parameters to a copy of the base request.
+func (e *Experiment) RunRequest(parameters []Parameter) (*SkenarioRunRequest, error) {
+	raw, err := json.Marshal(e.Base)
+	if err != nil {
+		return nil, err
+	}
+
+	fields := make(map[string]interface{})
+	baseDecoder := json.NewDecoder(bytes.NewReader(raw))
+	baseDecoder.UseNumber()
+	err = baseDecoder.Decode(&fields)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, p := range parameters {
+		setField(fields, strings.Split(p.Field, "."), requestValue(p.Value))
+	}
+
+	raw, err = json.Marshal(fields)
+	if err != nil {
+		return nil, err
+	}
+
+	runReq := &SkenarioRunRequest{}
+	decoder := json.NewDecoder(bytes.NewReader(raw))
+	decoder.DisallowUnknownFields()
+	err = decoder.Decode(runReq)
+	if err != nil {
+		return nil, fmt.Errorf("could not apply parameters %v: %s", parameters, err.Error())
+	}
+
+	return runReq, nil
+}
+
+// RunExperiment runs every combination of the experiment, several at a time, and records
+// them in the run store behind conn as a single experiment.
+func RunExperiment(ctx context.Context, conn *sqlite3.Conn, experiment *Experiment) (ExperimentResult, error) {
+	combinations, err := experiment.Combinations()
+	if err != nil {
+		return ExperimentResult{}, err
+	}
+
+	store, experimentId, err := beginExperiment(conn, experiment.Name, experiment)
+	if err != nil {
+		return ExperimentResult{}, err
+	}
+
+	rows, err := experiment.runBatch(ctx, conn, store, experimentId, combinations)
+
+	return ExperimentResult{
+		ExperimentId: experimentId,
+		Name:         experiment.Name,
+		Rows:         rows,
+	}, err
+}
+
+// beginExperiment records the definition of an experiment, which may be anything that
+// marshals to JSON.
+func beginExperiment(conn *sqlite3.Conn, name string, definition interface{}) (data.ExperimentStore, int64, error) {
+	raw, err := json.Marshal(definition)
+	if err != nil {
+		return nil, -1, err
+	}
+
+	store := data.NewExperimentStore(conn)
+	experimentId, err := store.Begin(name, string(raw))
+
+	return store, experimentId, err
+}
+
+// runBatch runs the given combinations, several at a time, and adds those that ran to
+// the experiment.
+func (e *Experiment) runBatch(ctx context.Context, conn *sqlite3.Conn, store data.ExperimentStore, experimentId int64, combinations [][]Parameter) ([]ExperimentRow, error) {
+	var err error
+
+	runReqs := make([]*SkenarioRunRequest, len(combinations))
+	for i, combination := range combinations {
+		runReqs[i], err = e.RunRequest(combination)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	rows := make([]ExperimentRow, len(combinations))
+
+	parallelism := e.Parallelism
+	if parallelism < 1 {
+		parallelism = runtime.NumCPU()
+	}
+
+	connLock := new(sync.Mutex)
+	indices := make(chan int)
+	wg := new(sync.WaitGroup)
+	for w := 0; w < parallelism; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range indices {
+				rows[i] = runCombination(ctx, conn, connLock, runReqs[i], combinations[i], e.Name)
+			}
+		}()
+	}
+
+	for i := range combinations {
+		indices <- i
+	}
+	close(indices)
+	wg.Wait()
+
+	for _, row := range rows {
+		if row.Error != "" {
+			continue
+		}
+
+		parameters, err := json.Marshal(row.Parameters)
+		if err != nil {
+			return rows, err
+		}
+
+		err = store.AddRun(experimentId, row.ScenarioRunId, string(parameters))
+		if err != nil {
+			return rows, err
+		}
+	}
+
+	return rows, nil
+}
+
+func runCombination(ctx context.Context, conn *sqlite3.Conn, connLock sync.Locker, runReq *SkenarioRunRequest, parameters []Parameter, origin string) (row ExperimentRow) {
+	row.Parameters = parameters
+
+	defer func() {
+		if r := recover(); r != nil {
+			row.Error = fmt.Sprintf("%v", r)
+		}
+	}()
+
+	sr := runScenario(ctx, conn, connLock, runReq, fmt.Sprintf("skenario_experiment: %s", origin))
+	row.ScenarioRunId = sr.scenarioRunId
+	row.Summary = sr.summary
+	row.SLO = sr.slo
+
+	return row
+}
+
+// WriteTable writes one line of summary metrics per combination, as aligned columns.
+func (er ExperimentResult) WriteTable(w io.Writer) error {
+	tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+
+	if len(er.Rows) == 0 {
+		return tw.Flush()
+	}
+
+	header := make([]string, 0)
+	for _, p := range er.Rows[0].Parameters {
+		header = append(header, p.Field)
+	}
+	header = append(header, "run", "p50", "p99", "failures", "replica_seconds", "peak_replicas", "mean_replicas", "under_provisioned", "over_provisioned", "slo")
+	fmt.Fprintln(tw, strings.Join(header, "\t"))
+
+	for _, row := range er.Rows {
+		columns := make([]string, 0, len(header))
+		for _, p := range row.Parameters {
+			columns = append(columns, fmt.Sprintf("%v", p.Value))
+		}
+
+		if row.Error != "" {
+			columns = append(columns, "error: "+row.Error)
+			fmt.Fprintln(tw, strings.Join(columns, "\t"))
+			continue
+		}
+
+		s := row.Summary
+		slo := "-"
+		if row.SLO != nil {
+			slo = "fail"
+			if row.SLO.Passed {
+				slo = "pass"
+			}
+		}
+		columns = append(columns,
+			fmt.Sprintf("%d", row.ScenarioRunId),
+			s.LatencyP50.String(),
+			s.LatencyP99.String(),
+			fmt.Sprintf("%.2f%%", s.FailureRate*100),
+			fmt.Sprintf("%.1f", s.ReplicaSeconds),
+			fmt.Sprintf("%d", s.PeakReplicas),
+			fmt.Sprintf("%.2f", s.MeanReplicas),
+			s.UnderProvisioned.String(),
+			s.OverProvisioned.String(),
+			slo,
+		)
+		fmt.Fprintln(tw, strings.Join(columns, "\t"))
+	}
+
+	return tw.Flush()
+}
+
+// ExperimentHandler runs the Experiment in the request body. The result is JSON, unless
+// a table is asked for with "?format=table".
+func ExperimentHandler(w http.ResponseWriter, r *http.Request) {
+	experiment := &Experiment{}
+	err := json.NewDecoder(r.Body).Decode(experiment)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	dbFileName := databaseFileName(experiment.Base.InMemoryDatabase)
+	conn, err := sqlite3.Open(dbFileName)
+	if err != nil {
+		panic(fmt.Errorf("could not open database file '%s': %s", dbFileName, err.Error()))
+	}
+	defer conn.Close()
+
+	result, err := RunExperiment(r.Context(), conn, experiment)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	if r.URL.Query().Get("format") == "table" {
+		w.Header().Set("Content-Type", "text/plain")
+		err = result.WriteTable(w)
+	} else {
+		w.Header().Set("Content-Type", "application/json")
+		err = json.NewEncoder(w).Encode(result)
+	}
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+	}
+}
+
+func (a Axis) values() ([]interface{}, error) {
+	if a.Field == "" {
+		return nil, fmt.Errorf("axis has no field")
+	}
+
+	if a.Range == nil {
+		if len(a.Values) == 0 {
+			return nil, fmt.Errorf("axis '%s' has neither values nor a range", a.Field)
+		}
+		return a.Values, nil
+	}
+
+	from, fromIsDuration, err := axisNumber(a.Range.From)
+	if err != nil {
+		return nil, fmt.Errorf("axis '%s' range 'from': %s", a.Field, err.Error())
+	}
+	to, toIsDuration, err := axisNumber(a.Range.To)
+	if err != nil {
+		return nil, fmt.Errorf("axis '%s' range 'to': %s", a.Field, err.Error())
+	}
+	step, stepIsDuration, err := axisNumber(a.Range.Step)
+	if err != nil {
+		return nil, fmt.Errorf("axis '%s' range 'step': %s", a.Field, err.Error())
+	}
+
+	if fromIsDuration != toIsDuration || fromIsDuration != stepIsDuration {
+		return nil, fmt.Errorf("axis '%s' range mixes durations and numbers", a.Field)
+	}
+	if step <= 0 {
+		return nil, fmt.Errorf("axis '%s' range step must be positive", a.Field)
+	}
+	if to < from {
+		return nil, fmt.Errorf("axis '%s' range ends before it starts", a.Field)
+	}
+
+	count := int(math.Floor((to-from)/step+1e-9)) + 1
+	values := make([]interface{}, 0, count)
+	for i := 0; i < count; i++ {
+		v := from + float64(i)*step
+		if fromIsDuration {
+			values = append(values, time.Duration(v).String())
+		} else {
+			values = append(values, v)
+		}
+	}
+
+	return values, nil
+}
+
+func axisNumber(v interface{}) (value float64, isDuration bool, err error) {
+	switch n := v.(type) {
+	case float64:
+		return n, false, nil
+	case int:
+		return float64(n), false, nil
+	case string:
+		d, err := time.ParseDuration(n)
+		if err != nil {
+			return 0, false, err
+		}
+		return float64(d), true, nil
+	default:
+		return 0, false, fmt.Errorf("expected a number or a duration, got '%v'", v)
+	}
+}
+
+// requestValue converts duration strings to the nanoseconds used by SkenarioRunRequest.
+func requestValue(v interface{}) interface{} {
+	if s, ok := v.(string); ok {
+		if d, err := time.ParseDuration(s); err == nil {
+			return d.Nanoseconds()
+		}
+	}
+	return v
+}
+
+func setField(fields map[string]interface{}, path []string, value interface{}) {
+	if len(path) == 1 {
+		fields[path[0]] = value
+		return
+	}
+
+	nested, ok := fields[path[0]].(map[string]interface{})
+	if !ok {
+		nested = make(map[string]interface{})
+		fields[path[0]] = nested
+	}
+	setField(nested, path[1:], value)
+}
@@ -0,0 +1,198 @@
+/*
+ * Copyright (C) 2019-Present Pivotal Software, Inc. All rights reserved.
+ *
+ * This program and the accompanying materials are made available under the terms
+ * of the Apache License, Version 2.0 (the "License”); you may not use this file
+ * except in compliance with the License. You may obtain a copy of the License at:
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software distributed
+ * under the License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR
+ * CONDITIONS OF ANY KIND, either express or implied. See the License for the
+ * specific language governing permissions and limitations under the License.
+ */
+
+package serve
+
+import (
+	"bytes"
+	"context"
+	"testing"
+	"time"
+
+	"github.com/bvinc/go-sqlite-lite/sqlite3"
+	"github.com/sclevine/spec"
+	"github.com/sclevine/spec/report"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"skenario/pkg/model/trafficpatterns"
+)
+
+func TestExperiment(t *testing.T) {
+	spec.Run(t, "Experiment", testExperiment, spec.Report(report.Terminal{}), spec.Sequential())
+}
+
+func testExperiment(t *testing.T, describe spec.G, it spec.S) {
+	var subject *Experiment
+
+	it.Before(func() {
+		subject = &Experiment{
+			Name: "test experiment",
+			Base: SkenarioRunRequest{
+				InMemoryDatabase:     true,
+				RunFor:               10 * time.Second,
+				TrafficPattern:       "golang_rand_uniform",
+				LaunchDelay:          time.Second,
+				TickInterval:         2 * time.Second,
+				RequestCPUTimeMillis: 100,
+				RequestIOTimeMillis:  50,
+				RequestTimeout:       5 * time.Second,
+				UniformConfig: trafficpatterns.UniformConfig{
+					NumberOfRequests: 20,
+					StartAt:          time.Unix(0, 0),
+					RunFor:           10 * time.Second,
+				},
+			},
+			Axes: []Axis{
+				{Field: "stable_window", Values: []interface{}{"30s", "60s"}},
+				{Field: "target_concurrency", Range: &AxisRange{From: 1.0, To: 2.0, Step: 0.5}},
+			},
+		}
+	})
+
+	describe("Combinations()", func() {
+		var combinations [][]Parameter
+		var err error
+
+		it.Before(func() {
+			combinations, err = subject.Combinations()
+			require.NoError(t, err)
+		})
+
+		it("expands the cartesian product of the axes", func() {
+			assert.Len(t, combinations, 6)
+		})
+
+		it("varies the last axis fastest", func() {
+			assert.Equal(t, []Parameter{{Field: "stable_window", Value: "30s"}, {Field: "target_concurrency", Value: 1.0}}, combinations[0])
+			assert.Equal(t, []Parameter{{Field: "stable_window", Value: "30s"}, {Field: "target_concurrency", Value: 1.5}}, combinations[1])
+			assert.Equal(t, []Parameter{{Field: "stable_window", Value: "60s"}, {Field: "target_concurrency", Value: 2.0}}, combinations[5])
+		})
+
+		describe("duration ranges", func() {
+			it.Before(func() {
+				subject.Axes = []Axis{{Field: "panic_window", Range: &AxisRange{From: "6s", To: "10s", Step: "2s"}}}
+				combinations, err = subject.Combinations()
+				require.NoError(t, err)
+			})
+
+			it("steps through durations", func() {
+				assert.Equal(t, []interface{}{"6s", "8s", "10s"}, []interface{}{combinations[0][0].Value, combinations[1][0].Value, combinations[2][0].Value})
+			})
+		})
+
+		describe("invalid axes", func() {
+			it("rejects axes without values or a range", func() {
+				subject.Axes = []Axis{{Field: "panic_window"}}
+				_, err = subject.Combinations()
+				assert.Error(t, err)
+			})
+
+			it("rejects ranges that mix durations and numbers", func() {
+				subject.Axes = []Axis{{Field: "panic_window", Range: &AxisRange{From: "6s", To: 10.0, Step: "2s"}}}
+				_, err = subject.Combinations()
+				assert.Error(t, err)
+			})
+		})
+	})
+
+	describe("RunRequest()", func() {
+		var runReq *SkenarioRunRequest
+		var err error
+
+		it.Before(func() {
+			runReq, err = subject.RunRequest([]Parameter{
+				{Field: "stable_window", Value: "45s"},
+				{Field: "target_concurrency", Value: 1.5},
+				{Field: "uniform_config.number_of_requests", Value: 99.0},
+			})
+			require.NoError(t, err)
+		})
+
+		it("applies duration parameters", func() {
+			assert.Equal(t, 45*time.Second, runReq.StableWindow)
+		})
+
+		it("applies numeric parameters", func() {
+			assert.Equal(t, 1.5, runReq.TargetConcurrency)
+		})
+
+		it("applies nested parameters", func() {
+			assert.Equal(t, 99, runReq.UniformConfig.NumberOfRequests)
+		})
+
+		it("leaves the rest of the base request alone", func() {
+			assert.Equal(t, subject.Base.LaunchDelay, runReq.LaunchDelay)
+			assert.Equal(t, 10*time.Second, subject.Base.RunFor)
+		})
+
+		it("rejects unknown fields", func() {
+			_, err = subject.RunRequest([]Parameter{{Field: "no_such_field", Value: 1.0}})
+			assert.Error(t, err)
+		})
+	})
+
+	describe("RunExperiment()", func() {
+		var result ExperimentResult
+		var conn *sqlite3.Conn
+		var err error
+
+		it.Before(func() {
+			subject.Parallelism = 3
+
+			conn, err = sqlite3.Open(databaseFileName(true))
+			require.NoError(t, err)
+
+			result, err = RunExperiment(context.Background(), conn, subject)
+			require.NoError(t, err)
+		})
+
+		it.After(func() {
+			conn.Close()
+		})
+
+		it("runs every combination", func() {
+			require.Len(t, result.Rows, 6)
+			for _, row := range result.Rows {
+				assert.Empty(t, row.Error)
+				assert.NotZero(t, row.ScenarioRunId)
+				assert.Equal(t, int64(20), row.Summary.Requests)
+			}
+		})
+
+		it("groups the runs under one experiment", func() {
+			stmt, err := conn.Prepare(`select count(1) from experiment_runs where experiment_id = ?`, result.ExperimentId)
+			require.NoError(t, err)
+			defer stmt.Close()
+
+			_, err = stmt.Step()
+			require.NoError(t, err)
+
+			var count int
+			err = stmt.Scan(&count)
+			require.NoError(t, err)
+			assert.Equal(t, 6, count)
+		})
+
+		it("writes a table with a line per combination", func() {
+			buf := new(bytes.Buffer)
+			err = result.WriteTable(buf)
+			require.NoError(t, err)
+
+			assert.Equal(t, 7, bytes.Count(buf.Bytes(), []byte("\n")))
+			assert.Contains(t, buf.String(), "stable_window")
+		})
+	})
+}
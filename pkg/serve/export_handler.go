@@ -0,0 +1,86 @@
+/*
+ * Copyright (C) 2019-Present Pivotal Software, Inc. All rights reserved.
+ *
+ * This program and the accompanying materials are made available under the terms
+ * of the Apache License, Version 2.0 (the "License”); you may not use this file
+ * except in compliance with the License. You may obtain a copy of the License at:
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software distributed
+ * under the License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR
+ * CONDITIONS OF ANY KIND, either express or implied. See the License for the
+ * specific language governing permissions and limitations under the License.
+ */
+
+package serve
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+
+	"github.com/bvinc/go-sqlite-lite/sqlite3"
+
+	"skenario/pkg/data"
+)
+
+// ExportHandler downloads one table of a stored run, given as "?run={id}&table={name}", as CSV
+// or, with "format=parquet", as Parquet.
+func ExportHandler(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+
+	scenarioRunId, err := strconv.ParseInt(query.Get("run"), 10, 64)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("invalid run ID: %s", err.Error()), http.StatusBadRequest)
+		return
+	}
+
+	format := query.Get("format")
+	if format == "" {
+		format = "csv"
+	}
+	write, err := ExportWriter(format)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	dbFileName := databaseFileName(query.Get("inmemory") == "true")
+	conn, err := sqlite3.Open(dbFileName, sqlite3.OPEN_READONLY)
+	if err != nil {
+		panic(fmt.Errorf("could not open database file '%s': %s", dbFileName, err.Error()))
+	}
+	defer conn.Close()
+
+	table, err := data.Export(conn, scenarioRunId, query.Get("table"))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+
+	if format == "parquet" {
+		w.Header().Set("Content-Type", "application/vnd.apache.parquet")
+	} else {
+		w.Header().Set("Content-Type", "text/csv")
+	}
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=\"run-%d-%s.%s\"", scenarioRunId, table.Name, format))
+
+	err = write(w, table)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+	}
+}
+
+// ExportWriter gives the function which writes tables in an export format, either "csv" or "parquet".
+func ExportWriter(format string) (func(io.Writer, data.Table) error, error) {
+	switch format {
+	case "csv":
+		return data.WriteCSV, nil
+	case "parquet":
+		return data.WriteParquet, nil
+	default:
+		return nil, fmt.Errorf("unknown export format '%s', expected 'csv' or 'parquet'", format)
+	}
+}
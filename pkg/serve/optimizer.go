@@ -0,0 +1,469 @@
+/*
+ * Copyright (C) 2019-Present Pivotal Software, Inc. All rights reserved.
+ *
+ * This program and the accompanying materials are made available under the terms
+ * of the Apache License, Version 2.0 (the "License”); you may not use this file
+ * except in compliance with the License. You may obtain a copy of the License at:
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software distributed
+ * under the License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR
+ * CONDITIONS OF ANY KIND, either express or implied. See the License for the
+ * specific language governing permissions and limitations under the License.
+ */
+
+package serve
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+	"math/rand"
+	"net/http"
+	"sort"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/bvinc/go-sqlite-lite/sqlite3"
+
+	"skenario/pkg/data"
+)
+
+// Optimization searches for the run request fields that give the best value of an objective
+// metric while meeting an SLO. Every evaluated point is recorded as a run of one experiment.
+type Optimization struct {
+	Name       string             `json:"name"`
+	Scenario   SkenarioRunRequest `json:"scenario"`
+	Parameters []SearchParameter  `json:"parameters"`
+
+	// Minimize or Maximize names the summary metric to optimize, as used in SLO expressions.
+	Minimize string `json:"minimize,omitempty"`
+	Maximize string `json:"maximize,omitempty"`
+
+	// Constraints is an SLO expression which candidates must meet, eg. "p99 < 2s and failures < 1%".
+	Constraints string `json:"constraints,omitempty"`
+
+	// Strategy is either "random" (the default) or "genetic".
+	Strategy    string `json:"strategy,omitempty"`
+	Budget      int    `json:"budget"`
+	Population  int    `json:"population,omitempty"`
+	Parallelism int    `json:"parallelism,omitempty"`
+	Top         int    `json:"top,omitempty"`
+
+	// Seed seeds the search. When the scenario has no seed of its own it is also used for
+	// every candidate's scenario, so that candidates face exactly the same traffic.
+	Seed int64 `json:"seed,omitempty"`
+}
+
+// SearchParameter is a run request field to search over, named as for an Axis. It ranges
+// between Min and Max, which may be numbers or durations, or takes one of Values.
+type SearchParameter struct {
+	Field   string        `json:"field"`
+	Min     interface{}   `json:"min,omitempty"`
+	Max     interface{}   `json:"max,omitempty"`
+	Integer bool          `json:"integer,omitempty"`
+	Values  []interface{} `json:"values,omitempty"`
+}
+
+type Candidate struct {
+	Parameters    []Parameter     `json:"parameters"`
+	ScenarioRunId int64           `json:"scenario_run_id"`
+	Objective     float64         `json:"objective"`
+	Feasible      bool            `json:"feasible"`
+	Constraints   *data.SLOResult `json:"constraints,omitempty"`
+	Summary       data.RunSummary `json:"summary"`
+	Error         string          `json:"error,omitempty"`
+
+	// genes are the position of the candidate in the search space, each scaled to [0, 1].
+	genes []float64
+}
+
+type OptimizationResult struct {
+	ExperimentId int64       `json:"experiment_id"`
+	Name         string      `json:"name"`
+	Objective    string      `json:"objective"`
+	Evaluations  int         `json:"evaluations"`
+	Best         []Candidate `json:"best"`
+}
+
+// RunOptimization evaluates up to Budget candidates and reports the best of them, feasible
+// candidates first.
+func RunOptimization(ctx context.Context, conn *sqlite3.Conn, optimization *Optimization) (OptimizationResult, error) {
+	o := *optimization
+	err := o.validate()
+	if err != nil {
+		return OptimizationResult{}, err
+	}
+
+	if o.Seed == 0 {
+		o.Seed = time.Now().UnixNano()
+	}
+	if o.Scenario.Seed == 0 {
+		o.Scenario.Seed = o.Seed
+	}
+	if o.Population < 2 {
+		o.Population = 8
+	}
+	if o.Top < 1 {
+		o.Top = 5
+	}
+
+	rng := rand.New(rand.NewSource(o.Seed))
+	experiment := &Experiment{Name: o.Name, Base: o.Scenario, Parallelism: o.Parallelism}
+
+	store, experimentId, err := beginExperiment(conn, o.Name, o)
+	if err != nil {
+		return OptimizationResult{}, err
+	}
+
+	evaluated := make([]Candidate, 0, o.Budget)
+	evaluate := func(genes [][]float64) error {
+		combinations := make([][]Parameter, len(genes))
+		for i, g := range genes {
+			combinations[i] = o.parameters(g)
+		}
+
+		rows, err := experiment.runBatch(ctx, conn, store, experimentId, combinations)
+		if err != nil {
+			return err
+		}
+
+		for i, row := range rows {
+			candidate, err := o.candidate(row)
+			if err != nil {
+				return err
+			}
+			candidate.genes = genes[i]
+			evaluated = append(evaluated, candidate)
+		}
+		return nil
+	}
+
+	switch o.Strategy {
+	case "", "random":
+		genes := make([][]float64, o.Budget)
+		for i := range genes {
+			genes[i] = o.randomGenes(rng)
+		}
+		err = evaluate(genes)
+	case "genetic":
+		err = o.evolve(rng, evaluate, &evaluated)
+	}
+	if err != nil {
+		return OptimizationResult{}, err
+	}
+
+	sort.SliceStable(evaluated, func(i, j int) bool { return better(evaluated[i], evaluated[j]) })
+	top := o.Top
+	if top > len(evaluated) {
+		top = len(evaluated)
+	}
+
+	return OptimizationResult{
+		ExperimentId: experimentId,
+		Name:         o.Name,
+		Objective:    o.objectiveDescription(),
+		Evaluations:  len(evaluated),
+		Best:         evaluated[:top],
+	}, nil
+}
+
+// evolve runs a genetic algorithm: each generation keeps the best candidate so far and breeds
+// the rest from parents chosen by tournament, with uniform crossover and gaussian mutation.
+func (o *Optimization) evolve(rng *rand.Rand, evaluate func([][]float64) error, evaluated *[]Candidate) error {
+	population := make([][]float64, 0, o.Population)
+	for i := 0; i < o.Population && i < o.Budget; i++ {
+		population = append(population, o.randomGenes(rng))
+	}
+
+	err := evaluate(population)
+	if err != nil {
+		return err
+	}
+
+	for len(*evaluated) < o.Budget {
+		ranked := make([]Candidate, len(*evaluated))
+		copy(ranked, *evaluated)
+		sort.SliceStable(ranked, func(i, j int) bool { return better(ranked[i], ranked[j]) })
+		if len(ranked) > o.Population {
+			ranked = ranked[:o.Population]
+		}
+
+		size := o.Population
+		if remaining := o.Budget - len(*evaluated); remaining < size {
+			size = remaining
+		}
+
+		children := make([][]float64, 0, size)
+		for len(children) < size {
+			a := tournament(rng, ranked)
+			b := tournament(rng, ranked)
+
+			child := make([]float64, len(a.genes))
+			for g := range child {
+				if rng.Float64() < 0.5 {
+					child[g] = a.genes[g]
+				} else {
+					child[g] = b.genes[g]
+				}
+				if rng.Float64() < 0.3 {
+					child[g] = math.Min(1, math.Max(0, child[g]+rng.NormFloat64()*0.1))
+				}
+			}
+			children = append(children, child)
+		}
+
+		err = evaluate(children)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func tournament(rng *rand.Rand, ranked []Candidate) Candidate {
+	a := ranked[rng.Intn(len(ranked))]
+	b := ranked[rng.Intn(len(ranked))]
+	if better(b, a) {
+		return b
+	}
+	return a
+}
+
+// better orders candidates that ran before those that didn't, feasible candidates before
+// infeasible ones, infeasible candidates by how many constraints they miss, then by objective.
+func better(a, b Candidate) bool {
+	if (a.Error == "") != (b.Error == "") {
+		return a.Error == ""
+	}
+	if a.Feasible != b.Feasible {
+		return a.Feasible
+	}
+	if !a.Feasible && a.Constraints != nil && b.Constraints != nil {
+		am, bm := missed(a.Constraints), missed(b.Constraints)
+		if am != bm {
+			return am < bm
+		}
+	}
+	return a.Objective < b.Objective
+}
+
+func missed(slo *data.SLOResult) int {
+	count := 0
+	for _, obj := range slo.Objectives {
+		if !obj.Passed {
+			count++
+		}
+	}
+	return count
+}
+
+func (o *Optimization) candidate(row ExperimentRow) (Candidate, error) {
+	candidate := Candidate{
+		Parameters:    row.Parameters,
+		ScenarioRunId: row.ScenarioRunId,
+		Summary:       row.Summary,
+		Error:         row.Error,
+		Feasible:      row.Error == "",
+	}
+	if row.Error != "" {
+		return candidate, nil
+	}
+
+	metric, sign := o.Minimize, 1.0
+	if metric == "" {
+		metric, sign = o.Maximize, -1.0
+	}
+	value, err := row.Summary.Metric(metric)
+	if err != nil {
+		return candidate, err
+	}
+	candidate.Objective = sign * value
+
+	if o.Constraints != "" {
+		slo, err := data.EvaluateSLO(o.Constraints, row.Summary)
+		if err != nil {
+			return candidate, err
+		}
+		candidate.Constraints = &slo
+		candidate.Feasible = slo.Passed
+	}
+
+	return candidate, nil
+}
+
+func (o *Optimization) validate() error {
+	if o.Budget < 1 {
+		return fmt.Errorf("budget must be at least 1")
+	}
+	if len(o.Parameters) == 0 {
+		return fmt.Errorf("at least one parameter to search over is needed")
+	}
+	if (o.Minimize == "") == (o.Maximize == "") {
+		return fmt.Errorf("exactly one of minimize or maximize must be given")
+	}
+	if err := data.ValidateMetric(o.Minimize + o.Maximize); err != nil {
+		return err
+	}
+	if o.Constraints != "" {
+		if _, err := data.ParseSLO(o.Constraints); err != nil {
+			return err
+		}
+	}
+	switch o.Strategy {
+	case "", "random", "genetic":
+	default:
+		return fmt.Errorf("unknown strategy '%s', expected 'random' or 'genetic'", o.Strategy)
+	}
+
+	for _, p := range o.Parameters {
+		if p.Field == "" {
+			return fmt.Errorf("search parameter has no field")
+		}
+		if len(p.Values) > 0 {
+			continue
+		}
+
+		min, minIsDuration, err := axisNumber(p.Min)
+		if err != nil {
+			return fmt.Errorf("search parameter '%s' min: %s", p.Field, err.Error())
+		}
+		max, maxIsDuration, err := axisNumber(p.Max)
+		if err != nil {
+			return fmt.Errorf("search parameter '%s' max: %s", p.Field, err.Error())
+		}
+		if minIsDuration != maxIsDuration {
+			return fmt.Errorf("search parameter '%s' mixes durations and numbers", p.Field)
+		}
+		if max < min {
+			return fmt.Errorf("search parameter '%s' max is less than min", p.Field)
+		}
+	}
+
+	return nil
+}
+
+func (o *Optimization) randomGenes(rng *rand.Rand) []float64 {
+	genes := make([]float64, len(o.Parameters))
+	for i := range genes {
+		genes[i] = rng.Float64()
+	}
+	return genes
+}
+
+// parameters maps genes in [0, 1] onto the values of each search parameter.
+func (o *Optimization) parameters(genes []float64) []Parameter {
+	parameters := make([]Parameter, len(o.Parameters))
+	for i, p := range o.Parameters {
+		parameters[i] = Parameter{Field: p.Field, Value: p.value(genes[i])}
+	}
+	return parameters
+}
+
+func (p SearchParameter) value(gene float64) interface{} {
+	if len(p.Values) > 0 {
+		i := int(gene * float64(len(p.Values)))
+		if i >= len(p.Values) {
+			i = len(p.Values) - 1
+		}
+		return p.Values[i]
+	}
+
+	// validate() has already checked these
+	min, isDuration, _ := axisNumber(p.Min)
+	max, _, _ := axisNumber(p.Max)
+
+	v := min + gene*(max-min)
+	if isDuration {
+		return time.Duration(v).Round(time.Millisecond).String()
+	}
+	if p.Integer {
+		return math.Round(v)
+	}
+	return v
+}
+
+func (o *Optimization) objectiveDescription() string {
+	if o.Minimize != "" {
+		return "minimize " + o.Minimize
+	}
+	return "maximize " + o.Maximize
+}
+
+// WriteTable writes the best candidates, one per line.
+func (opt OptimizationResult) WriteTable(w io.Writer) error {
+	tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+
+	metric := strings.TrimPrefix(strings.TrimPrefix(opt.Objective, "minimize "), "maximize ")
+	header := []string{"rank"}
+	if len(opt.Best) > 0 {
+		for _, p := range opt.Best[0].Parameters {
+			header = append(header, p.Field)
+		}
+	}
+	header = append(header, "run", metric, "feasible")
+	fmt.Fprintln(tw, strings.Join(header, "\t"))
+
+	for i, c := range opt.Best {
+		columns := []string{fmt.Sprintf("%d", i+1)}
+		for _, p := range c.Parameters {
+			columns = append(columns, fmt.Sprintf("%v", p.Value))
+		}
+
+		if c.Error != "" {
+			columns = append(columns, "error: "+c.Error)
+			fmt.Fprintln(tw, strings.Join(columns, "\t"))
+			continue
+		}
+
+		value, _ := c.Summary.Metric(metric)
+		formatted := fmt.Sprintf("%.4g", value)
+		if data.IsDurationMetric(metric) {
+			formatted = time.Duration(value).String()
+		}
+		columns = append(columns, fmt.Sprintf("%d", c.ScenarioRunId), formatted, fmt.Sprintf("%t", c.Feasible))
+		fmt.Fprintln(tw, strings.Join(columns, "\t"))
+	}
+
+	return tw.Flush()
+}
+
+// OptimizationHandler runs the Optimization in the request body. The result is JSON, unless
+// a table is asked for with "?format=table".
+func OptimizationHandler(w http.ResponseWriter, r *http.Request) {
+	optimization := &Optimization{}
+	err := json.NewDecoder(r.Body).Decode(optimization)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	dbFileName := databaseFileName(optimization.Scenario.InMemoryDatabase)
+	conn, err := sqlite3.Open(dbFileName)
+	if err != nil {
+		panic(fmt.Errorf("could not open database file '%s': %s", dbFileName, err.Error()))
+	}
+	defer conn.Close()
+
+	result, err := RunOptimization(r.Context(), conn, optimization)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	if r.URL.Query().Get("format") == "table" {
+		w.Header().Set("Content-Type", "text/plain")
+		err = result.WriteTable(w)
+	} else {
+		w.Header().Set("Content-Type", "application/json")
+		err = json.NewEncoder(w).Encode(result)
+	}
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+	}
+}
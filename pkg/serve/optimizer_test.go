@@ -0,0 +1,195 @@
+/*
+ * Copyright (C) 2019-Present Pivotal Software, Inc. All rights reserved.
+ *
+ * This program and the accompanying materials are made available under the terms
+ * of the Apache License, Version 2.0 (the "License”); you may not use this file
+ * except in compliance with the License. You may obtain a copy of the License at:
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software distributed
+ * under the License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR
+ * CONDITIONS OF ANY KIND, either express or implied. See the License for the
+ * specific language governing permissions and limitations under the License.
+ */
+
+package serve
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/bvinc/go-sqlite-lite/sqlite3"
+	"github.com/sclevine/spec"
+	"github.com/sclevine/spec/report"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"skenario/pkg/data"
+	"skenario/pkg/model/trafficpatterns"
+)
+
+func TestOptimizer(t *testing.T) {
+	spec.Run(t, "Optimizer", testOptimizer, spec.Report(report.Terminal{}), spec.Sequential())
+}
+
+func testOptimizer(t *testing.T, describe spec.G, it spec.S) {
+	var subject *Optimization
+
+	it.Before(func() {
+		subject = &Optimization{
+			Name:        "test optimization",
+			Budget:      5,
+			Population:  2,
+			Seed:        11,
+			Minimize:    "replica_seconds",
+			Constraints: "failures <= 100%",
+			Parameters: []SearchParameter{
+				{Field: "hpa_target_utilization", Min: 20.0, Max: 80.0, Integer: true},
+				{Field: "stable_window", Min: "10s", Max: "60s"},
+			},
+			Scenario: SkenarioRunRequest{
+				InMemoryDatabase:     true,
+				RunFor:               10 * time.Second,
+				TrafficPattern:       "golang_rand_uniform",
+				LaunchDelay:          time.Second,
+				TickInterval:         2 * time.Second,
+				RequestCPUTimeMillis: 100,
+				RequestIOTimeMillis:  50,
+				RequestTimeout:       5 * time.Second,
+				UniformConfig: trafficpatterns.UniformConfig{
+					NumberOfRequests: 20,
+					StartAt:          time.Unix(0, 0),
+					RunFor:           10 * time.Second,
+				},
+			},
+		}
+	})
+
+	describe("SearchParameter", func() {
+		it("maps genes onto numeric ranges", func() {
+			p := SearchParameter{Field: "target_concurrency", Min: 1.0, Max: 3.0}
+			assert.Equal(t, 1.0, p.value(0))
+			assert.Equal(t, 2.0, p.value(0.5))
+			assert.Equal(t, 3.0, p.value(1))
+		})
+
+		it("rounds integer parameters", func() {
+			p := SearchParameter{Field: "hpa_max_replicas", Min: 1.0, Max: 10.0, Integer: true}
+			assert.Equal(t, 5.0, p.value(0.45))
+		})
+
+		it("maps genes onto duration ranges", func() {
+			p := SearchParameter{Field: "stable_window", Min: "10s", Max: "20s"}
+			assert.Equal(t, "15s", p.value(0.5))
+		})
+
+		it("maps genes onto listed values", func() {
+			p := SearchParameter{Field: "traffic_pattern", Values: []interface{}{"step", "ramp"}}
+			assert.Equal(t, "step", p.value(0.2))
+			assert.Equal(t, "ramp", p.value(1))
+		})
+	})
+
+	describe("better()", func() {
+		feasible := func(objective float64) Candidate {
+			return Candidate{Feasible: true, Objective: objective}
+		}
+		infeasible := func(objective float64, missed int) Candidate {
+			slo := &data.SLOResult{}
+			for i := 0; i < missed; i++ {
+				slo.Objectives = append(slo.Objectives, data.ObjectiveResult{Passed: false})
+			}
+			return Candidate{Objective: objective, Constraints: slo}
+		}
+
+		it("prefers a lower objective", func() {
+			assert.True(t, better(feasible(1), feasible(2)))
+			assert.False(t, better(feasible(2), feasible(1)))
+		})
+
+		it("prefers feasible candidates", func() {
+			assert.True(t, better(feasible(10), infeasible(1, 1)))
+		})
+
+		it("prefers infeasible candidates which miss fewer constraints", func() {
+			assert.True(t, better(infeasible(10, 1), infeasible(1, 2)))
+		})
+
+		it("prefers candidates which ran", func() {
+			assert.True(t, better(infeasible(10, 2), Candidate{Error: "boom"}))
+		})
+	})
+
+	describe("RunOptimization()", func() {
+		var conn *sqlite3.Conn
+		var err error
+
+		it.Before(func() {
+			conn, err = sqlite3.Open(databaseFileName(true))
+			require.NoError(t, err)
+		})
+
+		it.After(func() {
+			conn.Close()
+		})
+
+		describe("with a genetic search", func() {
+			var result OptimizationResult
+
+			it.Before(func() {
+				subject.Strategy = "genetic"
+				result, err = RunOptimization(context.Background(), conn, subject)
+				require.NoError(t, err)
+			})
+
+			it("spends the whole budget", func() {
+				assert.Equal(t, 5, result.Evaluations)
+			})
+
+			it("reports the best candidates first", func() {
+				require.NotEmpty(t, result.Best)
+				for i := 1; i < len(result.Best); i++ {
+					assert.False(t, better(result.Best[i], result.Best[i-1]))
+				}
+			})
+
+			it("checks candidates against the constraints", func() {
+				assert.True(t, result.Best[0].Feasible)
+				assert.NotNil(t, result.Best[0].Constraints)
+			})
+
+			it("records every candidate as a run", func() {
+				assert.NotZero(t, result.Best[0].ScenarioRunId)
+				assert.Equal(t, "minimize replica_seconds", result.Objective)
+			})
+		})
+
+		describe("with invalid settings", func() {
+			it("needs a budget", func() {
+				subject.Budget = 0
+				_, err = RunOptimization(context.Background(), conn, subject)
+				assert.Error(t, err)
+			})
+
+			it("needs exactly one objective", func() {
+				subject.Maximize = "p99"
+				_, err = RunOptimization(context.Background(), conn, subject)
+				assert.Error(t, err)
+			})
+
+			it("rejects unknown strategies", func() {
+				subject.Strategy = "annealing"
+				_, err = RunOptimization(context.Background(), conn, subject)
+				assert.Error(t, err)
+			})
+
+			it("rejects ranges that mix durations and numbers", func() {
+				subject.Parameters = []SearchParameter{{Field: "stable_window", Min: "10s", Max: 60.0}}
+				_, err = RunOptimization(context.Background(), conn, subject)
+				assert.Error(t, err)
+			})
+		})
+	})
+}
@@ -0,0 +1,224 @@
+/*
+ * Copyright (C) 2019-Present Pivotal Software, Inc. All rights reserved.
+ *
+ * This program and the accompanying materials are made available under the terms
+ * of the Apache License, Version 2.0 (the "License”); you may not use this file
+ * except in compliance with the License. You may obtain a copy of the License at:
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software distributed
+ * under the License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR
+ * CONDITIONS OF ANY KIND, either express or implied. See the License for the
+ * specific language governing permissions and limitations under the License.
+ */
+
+package serve
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"text/tabwriter"
+	"time"
+
+	"github.com/bvinc/go-sqlite-lite/sqlite3"
+
+	"skenario/pkg/data"
+)
+
+// Replication runs the same scenario several times with different seeds.
+type Replication struct {
+	Name         string             `json:"name"`
+	Scenario     SkenarioRunRequest `json:"scenario"`
+	Replications int                `json:"replications"`
+	Parallelism  int                `json:"parallelism,omitempty"`
+
+	// Replication i is seeded with BaseSeed+i. When BaseSeed is 0 it is taken from the clock.
+	BaseSeed int64 `json:"base_seed,omitempty"`
+
+	// Confidence is the confidence level of the intervals around each mean. Defaults to 0.95.
+	Confidence float64 `json:"confidence,omitempty"`
+
+	// BandInterval is how often the banded time series are sampled. Defaults to 1s.
+	BandInterval time.Duration `json:"band_interval,omitempty"`
+}
+
+type ReplicationResult struct {
+	ExperimentId   int64                    `json:"experiment_id"`
+	Name           string                   `json:"name"`
+	Seeds          []int64                  `json:"seeds"`
+	ScenarioRunIds []int64                  `json:"scenario_run_ids"`
+	Errors         []string                 `json:"errors,omitempty"`
+	Metrics        map[string]data.Estimate `json:"metrics"`
+	ReplicaBands   []data.Band              `json:"replica_bands"`
+	LatencyBands   []data.Band              `json:"latency_bands"`
+}
+
+// replicatedMetrics are aggregated across replications. Durations are in nanoseconds.
+var replicatedMetrics = []string{
+	"p50",
+	"p90",
+	"p99",
+	"p99.9",
+	"failure_rate",
+	"replica_seconds",
+	"peak_replicas",
+	"mean_replicas",
+	"under_provisioned",
+	"over_provisioned",
+	"scale_up_reaction_time",
+}
+
+// RunReplication runs every replication as a single experiment, with the seed as its only axis,
+// then aggregates their summaries and time series.
+func RunReplication(ctx context.Context, conn *sqlite3.Conn, replication *Replication) (ReplicationResult, error) {
+	if replication.Replications < 1 {
+		return ReplicationResult{}, fmt.Errorf("at least one replication is needed")
+	}
+
+	confidence := replication.Confidence
+	if confidence == 0 {
+		confidence = 0.95
+	}
+	if confidence <= 0 || confidence >= 1 {
+		return ReplicationResult{}, fmt.Errorf("confidence must be between 0 and 1, was %f", confidence)
+	}
+
+	bandInterval := replication.BandInterval
+	if bandInterval == 0 {
+		bandInterval = time.Second
+	}
+
+	baseSeed := replication.BaseSeed
+	if baseSeed == 0 {
+		baseSeed = time.Now().UnixNano()
+	}
+
+	seeds := make([]interface{}, replication.Replications)
+	for i := range seeds {
+		seeds[i] = baseSeed + int64(i)
+	}
+
+	experiment := &Experiment{
+		Name:        replication.Name,
+		Base:        replication.Scenario,
+		Axes:        []Axis{{Field: "seed", Values: seeds}},
+		Parallelism: replication.Parallelism,
+	}
+
+	experimentResult, err := RunExperiment(ctx, conn, experiment)
+	if err != nil {
+		return ReplicationResult{}, err
+	}
+
+	result := ReplicationResult{
+		ExperimentId:   experimentResult.ExperimentId,
+		Name:           replication.Name,
+		Seeds:          make([]int64, 0, len(seeds)),
+		ScenarioRunIds: make([]int64, 0, len(seeds)),
+		Metrics:        make(map[string]data.Estimate),
+	}
+
+	samples := make(map[string][]float64)
+	for _, row := range experimentResult.Rows {
+		if row.Error != "" {
+			result.Errors = append(result.Errors, row.Error)
+			continue
+		}
+
+		result.Seeds = append(result.Seeds, row.Parameters[0].Value.(int64))
+		result.ScenarioRunIds = append(result.ScenarioRunIds, row.ScenarioRunId)
+
+		for _, name := range replicatedMetrics {
+			value, err := row.Summary.Metric(name)
+			if err != nil {
+				return result, err
+			}
+			samples[name] = append(samples[name], value)
+		}
+	}
+
+	for name, values := range samples {
+		result.Metrics[name] = data.EstimateMean(values, confidence)
+	}
+
+	result.ReplicaBands, err = data.ReplicaBands(conn, result.ScenarioRunIds, replication.Scenario.RunFor, bandInterval)
+	if err != nil {
+		return result, err
+	}
+
+	result.LatencyBands, err = data.LatencyBands(conn, result.ScenarioRunIds, replication.Scenario.RunFor, bandInterval)
+	if err != nil {
+		return result, err
+	}
+
+	return result, nil
+}
+
+// WriteTable writes the mean and confidence interval of each aggregated metric.
+func (rr ReplicationResult) WriteTable(w io.Writer) error {
+	tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+
+	fmt.Fprintln(tw, "metric\tn\tmean\tlower\tupper\tconfidence")
+
+	names := make([]string, 0, len(rr.Metrics))
+	for name := range rr.Metrics {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		est := rr.Metrics[name]
+		format := func(v float64) string { return fmt.Sprintf("%.4g", v) }
+		if data.IsDurationMetric(name) {
+			format = func(v float64) string { return time.Duration(v).Round(time.Microsecond).String() }
+		}
+
+		fmt.Fprintf(tw, "%s\t%d\t%s\t%s\t%s\t%.0f%%\n", name, est.N, format(est.Mean), format(est.Lower), format(est.Upper), est.Confidence*100)
+	}
+
+	for _, e := range rr.Errors {
+		fmt.Fprintf(tw, "error: %s\n", e)
+	}
+
+	return tw.Flush()
+}
+
+// ReplicationHandler runs the Replication in the request body. The result is JSON, unless
+// a table is asked for with "?format=table".
+func ReplicationHandler(w http.ResponseWriter, r *http.Request) {
+	replication := &Replication{}
+	err := json.NewDecoder(r.Body).Decode(replication)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	dbFileName := databaseFileName(replication.Scenario.InMemoryDatabase)
+	conn, err := sqlite3.Open(dbFileName)
+	if err != nil {
+		panic(fmt.Errorf("could not open database file '%s': %s", dbFileName, err.Error()))
+	}
+	defer conn.Close()
+
+	result, err := RunReplication(r.Context(), conn, replication)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	if r.URL.Query().Get("format") == "table" {
+		w.Header().Set("Content-Type", "text/plain")
+		err = result.WriteTable(w)
+	} else {
+		w.Header().Set("Content-Type", "application/json")
+		err = json.NewEncoder(w).Encode(result)
+	}
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+	}
+}
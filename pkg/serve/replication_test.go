@@ -0,0 +1,116 @@
+/*
+ * Copyright (C) 2019-Present Pivotal Software, Inc. All rights reserved.
+ *
+ * This program and the accompanying materials are made available under the terms
+ * of the Apache License, Version 2.0 (the "License”); you may not use this file
+ * except in compliance with the License. You may obtain a copy of the License at:
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software distributed
+ * under the License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR
+ * CONDITIONS OF ANY KIND, either express or implied. See the License for the
+ * specific language governing permissions and limitations under the License.
+ */
+
+package serve
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/bvinc/go-sqlite-lite/sqlite3"
+	"github.com/sclevine/spec"
+	"github.com/sclevine/spec/report"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"skenario/pkg/model/trafficpatterns"
+)
+
+func TestReplication(t *testing.T) {
+	spec.Run(t, "Replication", testReplication, spec.Report(report.Terminal{}), spec.Sequential())
+}
+
+func testReplication(t *testing.T, describe spec.G, it spec.S) {
+	var subject *Replication
+	var conn *sqlite3.Conn
+	var result ReplicationResult
+	var err error
+
+	it.Before(func() {
+		subject = &Replication{
+			Name:         "test replication",
+			Replications: 4,
+			BaseSeed:     1000,
+			BandInterval: 5 * time.Second,
+			Scenario: SkenarioRunRequest{
+				InMemoryDatabase:     true,
+				RunFor:               10 * time.Second,
+				TrafficPattern:       "golang_rand_uniform",
+				LaunchDelay:          time.Second,
+				TickInterval:         2 * time.Second,
+				RequestCPUTimeMillis: 100,
+				RequestIOTimeMillis:  50,
+				RequestTimeout:       5 * time.Second,
+				UniformConfig: trafficpatterns.UniformConfig{
+					NumberOfRequests: 50,
+					StartAt:          time.Unix(0, 0),
+					RunFor:           10 * time.Second,
+				},
+			},
+		}
+
+		conn, err = sqlite3.Open(databaseFileName(true))
+		require.NoError(t, err)
+
+		result, err = RunReplication(context.Background(), conn, subject)
+		require.NoError(t, err)
+	})
+
+	it.After(func() {
+		conn.Close()
+	})
+
+	it("runs each replication with its own seed", func() {
+		assert.Equal(t, []int64{1000, 1001, 1002, 1003}, result.Seeds)
+		assert.Len(t, result.ScenarioRunIds, 4)
+		assert.Empty(t, result.Errors)
+	})
+
+	it("estimates each metric across replications", func() {
+		p99 := result.Metrics["p99"]
+		assert.Equal(t, 4, p99.N)
+		assert.Equal(t, 0.95, p99.Confidence)
+		assert.True(t, p99.Lower <= p99.Mean && p99.Mean <= p99.Upper)
+		assert.Contains(t, result.Metrics, "replica_seconds")
+		assert.Contains(t, result.Metrics, "failure_rate")
+	})
+
+	it("gives banded time series", func() {
+		assert.Len(t, result.ReplicaBands, 3)
+		assert.NotEmpty(t, result.LatencyBands)
+	})
+
+	it("gives the same results for the same seeds", func() {
+		again, err := RunReplication(context.Background(), conn, subject)
+		require.NoError(t, err)
+
+		assert.Equal(t, result.Metrics, again.Metrics)
+	})
+
+	describe("invalid replications", func() {
+		it("needs at least one replication", func() {
+			subject.Replications = 0
+			_, err = RunReplication(context.Background(), conn, subject)
+			assert.Error(t, err)
+		})
+
+		it("needs a confidence level between 0 and 1", func() {
+			subject.Confidence = 1.5
+			_, err = RunReplication(context.Background(), conn, subject)
+			assert.Error(t, err)
+		})
+	})
+}
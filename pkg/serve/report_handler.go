@@ -0,0 +1,62 @@
+/*
+ * Copyright (C) 2019-Present Pivotal Software, Inc. All rights reserved.
+ *
+ * This program and the accompanying materials are made available under the terms
+ * of the Apache License, Version 2.0 (the "License”); you may not use this file
+ * except in compliance with the License. You may obtain a copy of the License at:
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software distributed
+ * under the License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR
+ * CONDITIONS OF ANY KIND, either express or implied. See the License for the
+ * specific language governing permissions and limitations under the License.
+ */
+
+package serve
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/bvinc/go-sqlite-lite/sqlite3"
+
+	"skenario/pkg/report"
+)
+
+// ReportHandler renders a static report of a stored run, given as "?run={id}". The report is
+// HTML unless "format=markdown" is asked for, in which case charts are embedded as data URIs.
+func ReportHandler(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+
+	scenarioRunId, err := strconv.ParseInt(query.Get("run"), 10, 64)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("invalid run ID: %s", err.Error()), http.StatusBadRequest)
+		return
+	}
+
+	dbFileName := databaseFileName(query.Get("inmemory") == "true")
+	conn, err := sqlite3.Open(dbFileName, sqlite3.OPEN_READONLY)
+	if err != nil {
+		panic(fmt.Errorf("could not open database file '%s': %s", dbFileName, err.Error()))
+	}
+	defer conn.Close()
+
+	rep, err := report.Build(conn, scenarioRunId)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+
+	if query.Get("format") == "markdown" {
+		w.Header().Set("Content-Type", "text/markdown")
+		err = rep.WriteMarkdown(w, report.DataURI)
+	} else {
+		w.Header().Set("Content-Type", "text/html")
+		err = rep.WriteHTML(w)
+	}
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+	}
+}
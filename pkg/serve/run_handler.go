@@ -16,10 +16,15 @@
 package serve
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
+	"io/ioutil"
 	"log"
 	"net/http"
+	"os"
+	"strings"
+	"sync"
 	"time"
 
 	"github.com/bvinc/go-sqlite-lite/sqlite3"
@@ -28,6 +33,7 @@ import (
 
 	"skenario/pkg/data"
 	"skenario/pkg/model"
+	"skenario/pkg/model/distributions"
 	"skenario/pkg/model/trafficpatterns"
 	"skenario/pkg/simulator"
 )
@@ -57,19 +63,36 @@ type CPUUtilizationMetric struct {
 	CalculatedAt   int64   `json:"calculated_at"`
 }
 
+type InvariantViolation struct {
+	OccursAt     int64  `json:"occurs_at"`
+	Invariant    string `json:"invariant"`
+	Reason       string `json:"reason"`
+	MovementKind string `json:"movement_kind"`
+	FromStock    string `json:"from_stock"`
+	ToStock      string `json:"to_stock"`
+	Moved        string `json:"moved"`
+}
+
 type SkenarioRunResponse struct {
-	RanFor            time.Duration          `json:"ran_for"`
-	TrafficPattern    string                 `json:"traffic_pattern"`
-	TallyLines        []TallyLine            `json:"tally_lines"`
-	ResponseTimes     []ResponseTime         `json:"response_times"`
-	RequestsPerSecond []RPS                  `json:"requests_per_second"`
-	CPUUtilizations   []CPUUtilizationMetric `json:"cpu_utilizations"`
+	RanFor              time.Duration          `json:"ran_for"`
+	TrafficPattern      string                 `json:"traffic_pattern"`
+	TallyLines          []TallyLine            `json:"tally_lines"`
+	ResponseTimes       []ResponseTime         `json:"response_times"`
+	RequestsPerSecond   []RPS                  `json:"requests_per_second"`
+	CPUUtilizations     []CPUUtilizationMetric `json:"cpu_utilizations"`
+	InvariantViolations []InvariantViolation   `json:"invariant_violations"`
+	Summary             data.RunSummary        `json:"summary"`
+	SLO                 *data.SLOResult        `json:"slo,omitempty"`
 }
 
 type SkenarioRunRequest struct {
 	RunFor           time.Duration `json:"run_for"`
 	TrafficPattern   string        `json:"traffic_pattern"`
 	InMemoryDatabase bool          `json:"in_memory_database,omitempty"`
+	StreamMovements  bool          `json:"stream_movements,omitempty"`
+	Invariants       []string      `json:"invariants,omitempty"`
+	SLO              string        `json:"slo,omitempty"`
+	Seed             int64         `json:"seed,omitempty"`
 
 	InitialNumberOfReplicas uint `json:"initial_number_of_replicas"`
 
@@ -83,9 +106,59 @@ type SkenarioRunRequest struct {
 	ReplicaMaxRPS          int64         `json:"replica_max_rps"`
 	MaxScaleUpRate         float64       `json:"max_scale_up_rate"`
 
-	RequestTimeout       time.Duration `json:"request_timeout_nanos"`
-	RequestCPUTimeMillis int           `json:"request_cpu_time_millis"`
-	RequestIOTimeMillis  int           `json:"request_io_time_millis"`
+	// When given, these replace the fixed launch_delay and terminate_delay.
+	LaunchPhases               []LaunchPhase         `json:"launch_phases,omitempty"`
+	TerminateDelayDistribution *distributions.Config `json:"terminate_delay_distribution,omitempty"`
+
+	Faults []model.Fault `json:"faults,omitempty"`
+
+	// Changes made to scaling during the run, at set times or on a cron schedule.
+	ScalingActions []model.ScalingAction `json:"scaling_actions,omitempty"`
+
+	// Nodes are only modelled when there are initial nodes or a maximum for the cluster autoscaler.
+	InitialNodes              uint          `json:"initial_nodes,omitempty"`
+	NodeCPUMillis             int64         `json:"node_cpu_millis,omitempty"`
+	NodeMemoryBytes           int64         `json:"node_memory_bytes,omitempty"`
+	MaxNodes                  uint          `json:"max_nodes,omitempty"`
+	NodeProvisioningDelay     time.Duration `json:"node_provisioning_delay,omitempty"`
+	ReplicaCPURequestMillis   int64         `json:"replica_cpu_request_millis,omitempty"`
+	ReplicaCPULimitMillis     int64         `json:"replica_cpu_limit_millis,omitempty"`
+	ReplicaMemoryRequestBytes int64         `json:"replica_memory_request_bytes,omitempty"`
+
+	// How the requests on a replica share its CPU. Without it, the approximate model is used.
+	ReplicaCPU *model.CPUConfig `json:"replica_cpu,omitempty"`
+
+	// The memory of each replica. Without it, memory is not modelled.
+	ReplicaMemory *model.MemoryConfig `json:"replica_memory,omitempty"`
+
+	// Resizes replicas to the CPU request recommended from their usage. Without it, replicas keep their size.
+	VerticalScaling *model.VerticalScalingConfig `json:"vertical_scaling,omitempty"`
+
+	HPAMinReplicas       int32 `json:"hpa_min_replicas,omitempty"`
+	HPAMaxReplicas       int32 `json:"hpa_max_replicas,omitempty"`
+	HPATargetUtilization int32 `json:"hpa_target_utilization,omitempty"`
+
+	RequestTimeout       time.Duration      `json:"request_timeout_nanos"`
+	RequestCPUTimeMillis int                `json:"request_cpu_time_millis"`
+	RequestIOTimeMillis  int                `json:"request_io_time_millis"`
+	RequestMemoryBytes   int64              `json:"request_memory_bytes,omitempty"`
+	RequestRetry         *model.RetryPolicy `json:"request_retry,omitempty"`
+
+	// When given, these replace the fixed request_cpu_time_millis and request_io_time_millis.
+	RequestCPUTimeDistribution *distributions.Config `json:"request_cpu_time_distribution,omitempty"`
+	RequestIOTimeDistribution  *distributions.Config `json:"request_io_time_distribution,omitempty"`
+
+	// When given, requests are drawn from this mix of classes rather than all being alike.
+	RequestClasses []RequestClass `json:"request_classes,omitempty"`
+
+	// When given, the service has these revisions, each with its own replicas and autoscaler,
+	// and requests are split between them as the traffic split says.
+	Revisions    []string             `json:"revisions,omitempty"`
+	TrafficSplit []model.TrafficSplit `json:"traffic_split,omitempty"`
+
+	// When given, requests pass through these services, each with its own replicas and
+	// autoscaler. Requests arrive at the first service, which calls the others.
+	Services []ServiceConfig `json:"services,omitempty"`
 
 	UniformConfig    trafficpatterns.UniformConfig    `json:"uniform_config,omitempty"`
 	RampConfig       trafficpatterns.RampConfig       `json:"ramp_config,omitempty"`
@@ -93,8 +166,48 @@ type SkenarioRunRequest struct {
 	SinusoidalConfig trafficpatterns.SinusoidalConfig `json:"sinusoidal_config,omitempty"`
 }
 
+// LaunchPhase is one step of launching a replica, such as "image_pull", "container_start" or
+// "readiness_probe".
+type LaunchPhase struct {
+	Name  string               `json:"name"`
+	Delay distributions.Config `json:"delay"`
+}
+
+// RequestClass is one kind of request in a workload mix, sent in proportion to its weight.
+// Its timeout defaults to request_timeout_nanos. Higher priorities are served first.
+type RequestClass struct {
+	Name                string                `json:"name"`
+	Weight              float64               `json:"weight"`
+	Priority            int                   `json:"priority,omitempty"`
+	CPUTimeMillis       int                   `json:"cpu_time_millis"`
+	IOTimeMillis        int                   `json:"io_time_millis"`
+	CPUTimeDistribution *distributions.Config `json:"cpu_time_distribution,omitempty"`
+	IOTimeDistribution  *distributions.Config `json:"io_time_distribution,omitempty"`
+	MemoryBytes         int64                 `json:"memory_bytes,omitempty"`
+	Timeout             time.Duration         `json:"timeout_nanos,omitempty"`
+}
+
+// ServiceConfig is one service of a topology, with the calls it makes to other services for each
+// request it handles. The first service handles the requests of the run, as given by
+// request_cpu_time_millis or request_classes. Every other service handles the calls made to it,
+// which take the CPU and IO time given here. A call's timeout defaults to request_timeout_nanos.
+type ServiceConfig struct {
+	Name                string                `json:"name"`
+	CPUTimeMillis       int                   `json:"cpu_time_millis,omitempty"`
+	IOTimeMillis        int                   `json:"io_time_millis,omitempty"`
+	CPUTimeDistribution *distributions.Config `json:"cpu_time_distribution,omitempty"`
+	IOTimeDistribution  *distributions.Config `json:"io_time_distribution,omitempty"`
+	MemoryBytes         int64                 `json:"memory_bytes,omitempty"`
+	Timeout             time.Duration         `json:"timeout_nanos,omitempty"`
+	Calls               []model.Call          `json:"calls,omitempty"`
+}
+
 var environmentSequence int32 = 0
 
+// movementFlushBatchSize is how many movements are buffered before being written to
+// the run store when streaming movements.
+const movementFlushBatchSize = 10000
+
 func RunHandler(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Content-Type", "application/json")
 
@@ -104,37 +217,247 @@ func RunHandler(w http.ResponseWriter, r *http.Request) {
 		panic(err.Error())
 	}
 
-	env := simulator.NewEnvironment(r.Context(), startAt, runReq.RunFor)
+	// Runs from the UI are always kept in memory, whatever in_memory_database says. Streamed
+	// runs are the exception: they go to a temporary file, so that flushed movements leave memory.
+	dbFileName := databaseFileName(true)
+	if runReq.StreamMovements {
+		dbFileName = temporaryDatabaseFileName()
+		defer removeDatabaseFile(dbFileName)
+	}
+	conn, err := sqlite3.Open(dbFileName)
+	if err != nil {
+		panic(fmt.Errorf("could not open database file '%s': %s", dbFileName, err.Error()))
+	}
+	defer conn.Close()
+
+	result := runScenario(r.Context(), conn, new(sync.Mutex), runReq, "skenario_web")
+
+	var vds = SkenarioRunResponse{
+		RanFor:            result.ranFor,
+		TrafficPattern:    result.trafficPattern,
+		TallyLines:        []TallyLine{},
+		ResponseTimes:     []ResponseTime{},
+		RequestsPerSecond: requestsPerSecond(dbFileName, result.scenarioRunId),
+		CPUUtilizations:   cpuUtilizations(dbFileName, result.scenarioRunId),
+
+		InvariantViolations: invariantViolations(result.invariantViolations),
+		Summary:             result.summary,
+		SLO:                 result.slo,
+	}
+	// Tally lines and response times grow with every movement, so streamed runs leave them out.
+	if !runReq.StreamMovements {
+		vds.TallyLines = tallyLines(dbFileName, result.scenarioRunId)
+		vds.ResponseTimes = responseTimes(dbFileName, result.scenarioRunId)
+	}
+
+	err = json.NewEncoder(w).Encode(vds)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+}
+
+func databaseFileName(inMemory bool) string {
+	if inMemory {
+		return "file::memory:?cache=shared"
+	}
+	return "skenario.db"
+}
+
+// temporaryDatabaseFileName creates an empty database file in the temporary directory.
+func temporaryDatabaseFileName() string {
+	f, err := ioutil.TempFile("", "skenario-*.db")
+	if err != nil {
+		panic(fmt.Errorf("could not create temporary database file: %s", err.Error()))
+	}
+	err = f.Close()
+	if err != nil {
+		panic(fmt.Errorf("could not create temporary database file: %s", err.Error()))
+	}
+	return f.Name()
+}
+
+// removeDatabaseFile removes a database file made by temporaryDatabaseFileName, along with
+// any journal SQLite left beside it.
+func removeDatabaseFile(name string) {
+	for _, file := range []string{name, name + "-journal"} {
+		err := os.Remove(file)
+		if err != nil && !os.IsNotExist(err) {
+			log.Printf("could not remove database file '%s': %s", file, err.Error())
+		}
+	}
+}
+
+// scenarioResult is what remains of a scenario run once it has been recorded in the run store.
+type scenarioResult struct {
+	scenarioRunId       int64
+	ranFor              time.Duration
+	trafficPattern      string
+	invariantViolations []simulator.InvariantViolation
+	summary             data.RunSummary
+	slo                 *data.SLOResult
+}
+
+// runScenario simulates a single scenario, records it in the run store behind conn and
+// summarizes it. connLock guards conn, so that several scenarios may be simulated in
+// parallel while sharing one database connection. Streamed runs write as they go and
+// so hold connLock for the whole simulation.
+func runScenario(ctx context.Context, conn *sqlite3.Conn, connLock sync.Locker, runReq *SkenarioRunRequest, origin string) scenarioResult {
+	var err error
 
 	clusterConf := buildClusterConfig(runReq)
 	kpaConf := buildKpaConfig(runReq)
+
+	if runReq.SLO != "" {
+		_, err = data.ParseSLO(runReq.SLO)
+		if err != nil {
+			panic(fmt.Errorf("could not parse SLO: %s", err.Error()))
+		}
+	}
+
+	for _, fault := range runReq.Faults {
+		err = fault.Validate()
+		if err != nil {
+			panic(fmt.Errorf("could not inject faults: %s", err.Error()))
+		}
+	}
+
+	err = kpaConf.HPA.Validate()
+	if err != nil {
+		panic(fmt.Errorf("could not bound replicas: %s", err.Error()))
+	}
+
+	if len(runReq.ScalingActions) > 0 {
+		err = validateScalingActions(runReq)
+		if err != nil {
+			panic(fmt.Errorf("could not schedule scaling actions: %s", err.Error()))
+		}
+	}
+
+	if runReq.ReplicaCPU != nil {
+		err = runReq.ReplicaCPU.Validate()
+		if err != nil {
+			panic(fmt.Errorf("could not model replica CPU: %s", err.Error()))
+		}
+	}
+
+	err = model.ReplicasConfig{CPURequestMillis: runReq.ReplicaCPURequestMillis, CPULimitMillis: runReq.ReplicaCPULimitMillis}.Validate()
+	if err != nil {
+		panic(fmt.Errorf("could not size replicas: %s", err.Error()))
+	}
+
+	if runReq.ReplicaMemory != nil {
+		err = runReq.ReplicaMemory.Validate()
+		if err != nil {
+			panic(fmt.Errorf("could not model replica memory: %s", err.Error()))
+		}
+	}
+
+	if len(runReq.Revisions) > 0 {
+		err = validateRevisions(runReq)
+		if err != nil {
+			panic(fmt.Errorf("could not split traffic: %s", err.Error()))
+		}
+	}
+
+	if len(runReq.Services) > 0 {
+		err = validateServices(runReq)
+		if err != nil {
+			panic(fmt.Errorf("could not connect services: %s", err.Error()))
+		}
+	}
+
+	if runReq.VerticalScaling != nil {
+		err = runReq.VerticalScaling.Validate()
+		if err != nil {
+			panic(fmt.Errorf("could not scale replicas vertically: %s", err.Error()))
+		}
+	}
+
+	if runReq.RequestRetry != nil {
+		err = runReq.RequestRetry.Validate()
+		if err != nil {
+			panic(fmt.Errorf("could not retry requests: %s", err.Error()))
+		}
+	}
+
+	envConfig := simulator.EnvironmentConfig{
+		StartAt: startAt,
+		RunFor:  runReq.RunFor,
+		Seed:    runReq.Seed,
+	}
+
+	var streamingStore data.StreamingRunStore
+	if runReq.StreamMovements {
+		connLock.Lock()
+		defer connLock.Unlock()
+
+		streamingStore, err = data.NewStreamingRunStore(conn, clusterConf, kpaConf, origin, runReq.TrafficPattern, runReq.RunFor)
+		if err != nil {
+			panic(fmt.Errorf("could not begin streaming scenario run: %s", err.Error()))
+		}
+
+		envConfig.MovementSink = streamingStore
+		envConfig.FlushEvery = movementFlushBatchSize
+	}
+	env := simulator.NewEnvironmentWithConfig(ctx, envConfig)
+
 	replicasConfig := model.ReplicasConfig{
 		LaunchDelay:    runReq.LaunchDelay,
 		TerminateDelay: runReq.TerminateDelay,
 		MaxRPS:         runReq.ReplicaMaxRPS,
+
+		CPURequestMillis:   runReq.ReplicaCPURequestMillis,
+		CPULimitMillis:     runReq.ReplicaCPULimitMillis,
+		MemoryRequestBytes: runReq.ReplicaMemoryRequestBytes,
+	}
+	replicasConfig.LaunchPhases, replicasConfig.TerminateDelayDistribution = buildDelayDistributions(runReq)
+	if runReq.ReplicaCPU != nil {
+		replicasConfig.CPU = *runReq.ReplicaCPU
 	}
+	if runReq.ReplicaMemory != nil {
+		replicasConfig.Memory = *runReq.ReplicaMemory
+	}
+
+	workloadMix := buildWorkloadMix(runReq)
 
-	requestConfig := model.RequestConfig{
-		CPUTimeMillis: runReq.RequestCPUTimeMillis,
-		IOTimeMillis:  runReq.RequestIOTimeMillis,
-		Timeout:       runReq.RequestTimeout,
+	clusters := buildClusters(env, runReq, clusterConf, replicasConfig)
+	routingStock := clusters[0].RoutingStock()
+	if len(runReq.Revisions) > 0 {
+		routingStock = model.NewTrafficSplit(env, startAt, clusters, runReq.TrafficSplit)
+	}
+	if len(runReq.Services) > 0 {
+		model.NewTopology(env, buildServices(runReq, clusters))
 	}
 
-	cluster := model.NewCluster(env, clusterConf, replicasConfig)
+	for _, invariant := range buildInvariants(runReq, clusters) {
+		env.AddInvariant(invariant)
+	}
 
-	model.NewAutoscaler(env, startAt, cluster, kpaConf)
-	trafficSource := model.NewTrafficSource(env, cluster.RoutingStock(), requestConfig)
+	for _, cluster := range clusters {
+		model.NewAutoscaler(env, startAt, cluster, kpaConf)
+		if runReq.VerticalScaling != nil {
+			model.NewVerticalScaling(env, startAt, cluster, *runReq.VerticalScaling, model.NewVPARecommender(*runReq.VerticalScaling))
+		}
+		if len(runReq.Faults) > 0 {
+			model.NewChaos(env, startAt, cluster, runReq.Faults)
+		}
+		if actions := scalingActionsFor(runReq, cluster); len(actions) > 0 {
+			model.NewScalingSchedule(env, startAt, cluster, actions)
+		}
+	}
+	trafficSource := model.NewWorkloadMix(env, routingStock, workloadMix)
 
 	var traffic trafficpatterns.Pattern
 	switch runReq.TrafficPattern {
 	case "golang_rand_uniform":
-		traffic = trafficpatterns.NewUniformRandom(env, trafficSource, cluster.RoutingStock(), runReq.UniformConfig)
+		traffic = trafficpatterns.NewUniformRandom(env, trafficSource, routingStock, runReq.UniformConfig)
 	case "step":
-		traffic = trafficpatterns.NewStep(env, trafficSource, cluster.RoutingStock(), runReq.StepConfig)
+		traffic = trafficpatterns.NewStep(env, trafficSource, routingStock, runReq.StepConfig)
 	case "ramp":
-		traffic = trafficpatterns.NewRamp(env, trafficSource, cluster.RoutingStock(), runReq.RampConfig)
+		traffic = trafficpatterns.NewRamp(env, trafficSource, routingStock, runReq.RampConfig)
 	case "sinusoidal":
-		traffic = trafficpatterns.NewSinusoidal(env, trafficSource, cluster.RoutingStock(), runReq.SinusoidalConfig)
+		traffic = trafficpatterns.NewSinusoidal(env, trafficSource, routingStock, runReq.SinusoidalConfig)
 	}
 
 	traffic.Generate()
@@ -144,45 +467,77 @@ func RunHandler(w http.ResponseWriter, r *http.Request) {
 		panic(err.Error())
 	}
 
-	var dbFileName string
-	//if runReq.InMemoryDatabase {
-	dbFileName = "file::memory:?cache=shared"
-	//} else {
-	//	dbFileName = "skenario.db"
-	//}
+	for _, cluster := range clusters {
+		err = cluster.Plugin().Event(startAt.UnixNano(), proto.EventType_DELETE, &skplug.Autoscaler{})
+		if err != nil {
+			panic(err)
+		}
+		log.Printf("Deleted autoscaler.")
+	}
 
-	conn, err := sqlite3.Open(dbFileName)
-	if err != nil {
-		panic(fmt.Errorf("could not open database file '%s': %s", dbFileName, err.Error()))
+	result := scenarioResult{
+		ranFor:              env.HaltTime().Sub(startAt),
+		trafficPattern:      traffic.Name(),
+		invariantViolations: env.InvariantViolations(),
 	}
-	defer conn.Close()
 
-	store := data.NewRunStore(conn)
-	scenarioRunId, err := store.Store(completed, ignored, clusterConf, kpaConf, "skenario_web", traffic.Name(), runReq.RunFor, env.CPUUtilizations())
+	if streamingStore != nil {
+		result.scenarioRunId = streamingStore.ScenarioRunId()
+		err = streamingStore.Finish(env.CPUUtilizations())
+	} else {
+		connLock.Lock()
+		defer connLock.Unlock()
+
+		store := data.NewRunStore(conn)
+		result.scenarioRunId, err = store.Store(completed, ignored, clusterConf, kpaConf, origin, traffic.Name(), runReq.RunFor, env.CPUUtilizations())
+	}
 	if err != nil {
 		fmt.Printf("there was an error saving data: %s", err.Error())
 	}
 
-	var vds = SkenarioRunResponse{
-		RanFor:            env.HaltTime().Sub(startAt),
-		TrafficPattern:    traffic.Name(),
-		TallyLines:        tallyLines(dbFileName, scenarioRunId),
-		ResponseTimes:     responseTimes(dbFileName, scenarioRunId),
-		RequestsPerSecond: requestsPerSecond(dbFileName, scenarioRunId),
-		CPUUtilizations:   cpuUtilizations(dbFileName, scenarioRunId),
+	configuration, err := json.Marshal(runReq)
+	if err != nil {
+		panic(fmt.Errorf("could not marshal run request: %s", err.Error()))
 	}
-
-	err = json.NewEncoder(w).Encode(vds)
+	err = data.StoreRunConfiguration(conn, result.scenarioRunId, string(configuration))
 	if err != nil {
-		w.WriteHeader(http.StatusInternalServerError)
-		return
+		fmt.Printf("there was an error saving the run configuration: %s", err.Error())
 	}
 
-	err = env.Plugin().Event(startAt.UnixNano(), proto.EventType_DELETE, &skplug.Autoscaler{})
+	result.summary, err = data.Summarize(conn, result.scenarioRunId)
 	if err != nil {
-		panic(err)
+		panic(fmt.Errorf("could not summarize scenario run: %s", err.Error()))
+	}
+
+	if runReq.SLO != "" {
+		slo, err := data.EvaluateSLO(runReq.SLO, result.summary)
+		if err != nil {
+			panic(fmt.Errorf("could not evaluate SLO: %s", err.Error()))
+		}
+		result.slo = &slo
+	}
+
+	return result
+}
+
+func invariantViolations(violations []simulator.InvariantViolation) []InvariantViolation {
+	lines := make([]InvariantViolation, 0, len(violations))
+	for _, v := range violations {
+		line := InvariantViolation{
+			OccursAt:     v.OccursAt.UnixNano(),
+			Invariant:    v.Invariant,
+			Reason:       v.Reason,
+			MovementKind: string(v.Movement.Kind()),
+			FromStock:    string(v.Movement.From().Name()),
+			ToStock:      string(v.Movement.To().Name()),
+		}
+		if v.Moved != nil {
+			line.Moved = string(v.Moved.Name())
+		}
+		lines = append(lines, line)
 	}
-	log.Printf("Deleted autoscaler.")
+
+	return lines
 }
 
 func cpuUtilizations(dbFileName string, scenarioRunId int64) []CPUUtilizationMetric {
@@ -352,6 +707,13 @@ func buildClusterConfig(srr *SkenarioRunRequest) model.ClusterConfig {
 		TerminateDelay:          srr.TerminateDelay,
 		NumberOfRequests:        uint(srr.UniformConfig.NumberOfRequests),
 		InitialNumberOfReplicas: srr.InitialNumberOfReplicas,
+		Nodes: model.NodeConfig{
+			InitialNodes:           srr.InitialNodes,
+			CPUAllocatableMillis:   srr.NodeCPUMillis,
+			MemoryAllocatableBytes: srr.NodeMemoryBytes,
+			MaxNodes:               srr.MaxNodes,
+			ProvisioningDelay:      srr.NodeProvisioningDelay,
+		},
 	}
 }
 
@@ -363,5 +725,263 @@ func buildKpaConfig(srr *SkenarioRunRequest) model.KnativeAutoscalerConfig {
 		ScaleToZeroGracePeriod: srr.ScaleToZeroGracePeriod,
 		TargetConcurrency:      srr.TargetConcurrency,
 		MaxScaleUpRate:         srr.MaxScaleUpRate,
+		HPA: model.HPAConfig{
+			MinReplicas:       srr.HPAMinReplicas,
+			MaxReplicas:       srr.HPAMaxReplicas,
+			TargetUtilization: srr.HPATargetUtilization,
+		},
+	}
+}
+
+func buildDelayDistributions(srr *SkenarioRunRequest) ([]model.Phase, distributions.Distribution) {
+	phases := make([]model.Phase, 0, len(srr.LaunchPhases))
+	for _, lp := range srr.LaunchPhases {
+		delay, err := distributions.New(lp.Delay)
+		if err != nil {
+			panic(fmt.Errorf("could not build launch phase '%s': %s", lp.Name, err.Error()))
+		}
+		phases = append(phases, model.Phase{Name: lp.Name, Delay: delay})
+	}
+
+	if srr.TerminateDelayDistribution == nil {
+		return phases, nil
+	}
+
+	terminateDelay, err := distributions.New(*srr.TerminateDelayDistribution)
+	if err != nil {
+		panic(fmt.Errorf("could not build terminate delay: %s", err.Error()))
+	}
+	return phases, terminateDelay
+}
+
+func buildWorkloadMix(srr *SkenarioRunRequest) []model.RequestClass {
+	var retry model.RetryPolicy
+	if srr.RequestRetry != nil {
+		retry = *srr.RequestRetry
+	}
+
+	if len(srr.RequestClasses) == 0 {
+		return []model.RequestClass{{Weight: 1, RequestConfig: model.RequestConfig{
+			CPUTimeMillis: srr.RequestCPUTimeMillis,
+			IOTimeMillis:  srr.RequestIOTimeMillis,
+			CPUTime:       buildServiceTime("request CPU time", srr.RequestCPUTimeDistribution),
+			IOTime:        buildServiceTime("request IO time", srr.RequestIOTimeDistribution),
+			MemoryBytes:   srr.RequestMemoryBytes,
+			Timeout:       srr.RequestTimeout,
+			Retry:         retry,
+		}}}
+	}
+
+	classes := make([]model.RequestClass, 0, len(srr.RequestClasses))
+	names := make(map[string]bool)
+	for _, rc := range srr.RequestClasses {
+		if rc.Name == "" || strings.ContainsAny(rc.Name, ":[]") {
+			panic(fmt.Errorf("request class name '%s' must not be empty or contain ':', '[' or ']'", rc.Name))
+		}
+		if names[rc.Name] {
+			panic(fmt.Errorf("request class '%s' is given more than once", rc.Name))
+		}
+		names[rc.Name] = true
+		if rc.Weight <= 0 {
+			panic(fmt.Errorf("request class '%s' needs a weight greater than zero", rc.Name))
+		}
+
+		timeout := rc.Timeout
+		if timeout == 0 {
+			timeout = srr.RequestTimeout
+		}
+
+		classes = append(classes, model.RequestClass{Weight: rc.Weight, RequestConfig: model.RequestConfig{
+			Class:         rc.Name,
+			Priority:      rc.Priority,
+			CPUTimeMillis: rc.CPUTimeMillis,
+			IOTimeMillis:  rc.IOTimeMillis,
+			CPUTime:       buildServiceTime(fmt.Sprintf("CPU time of request class '%s'", rc.Name), rc.CPUTimeDistribution),
+			IOTime:        buildServiceTime(fmt.Sprintf("IO time of request class '%s'", rc.Name), rc.IOTimeDistribution),
+			MemoryBytes:   rc.MemoryBytes,
+			Timeout:       timeout,
+			Retry:         retry,
+		}})
 	}
+
+	return classes
+}
+
+func buildServiceTime(what string, config *distributions.Config) distributions.Distribution {
+	if config == nil {
+		return nil
+	}
+
+	serviceTime, err := distributions.New(*config)
+	if err != nil {
+		panic(fmt.Errorf("could not build %s: %s", what, err.Error()))
+	}
+	return serviceTime
+}
+
+// validateRevisions checks the revisions of a run request and how traffic is split between
+// them. Nodes are not shared between revisions, so they cannot be modelled with revisions.
+func validateRevisions(srr *SkenarioRunRequest) error {
+	names := make(map[string]bool, len(srr.Revisions))
+	for _, name := range srr.Revisions {
+		if name == "" || strings.ContainsAny(name, ":[]") {
+			return fmt.Errorf("revision name '%s' must not be empty or contain ':', '[' or ']'", name)
+		}
+		if names[name] {
+			return fmt.Errorf("revision '%s' is given more than once", name)
+		}
+		names[name] = true
+	}
+
+	if buildClusterConfig(srr).Nodes.Enabled() {
+		return fmt.Errorf("nodes cannot be modelled for a service with several revisions")
+	}
+
+	return model.ValidateTrafficSplits(srr.Revisions, srr.TrafficSplit)
+}
+
+// validateServices checks the services of a run request and the calls between them. Like
+// revisions, services cannot share nodes, and they cannot be combined with revisions.
+func validateServices(srr *SkenarioRunRequest) error {
+	if len(srr.Revisions) > 0 {
+		return fmt.Errorf("services cannot be given together with revisions")
+	}
+	if buildClusterConfig(srr).Nodes.Enabled() {
+		return fmt.Errorf("nodes cannot be modelled for several services")
+	}
+
+	names := make([]string, 0, len(srr.Services))
+	calls := make(map[string][]model.Call, len(srr.Services))
+	for i, service := range srr.Services {
+		if service.Name == "" || strings.ContainsAny(service.Name, ":[]") {
+			return fmt.Errorf("service name '%s' must not be empty or contain ':', '[' or ']'", service.Name)
+		}
+		if _, ok := calls[service.Name]; ok {
+			return fmt.Errorf("service '%s' is given more than once", service.Name)
+		}
+		if i == 0 && (service.CPUTimeMillis != 0 || service.IOTimeMillis != 0 || service.CPUTimeDistribution != nil || service.IOTimeDistribution != nil) {
+			return fmt.Errorf("the requests of the first service, '%s', are those of the run, so it cannot be given its own CPU or IO time", service.Name)
+		}
+		for _, call := range service.Calls {
+			if call.Service == srr.Services[0].Name {
+				return fmt.Errorf("service '%s' calls the first service, '%s', which only handles the requests of the run", service.Name, call.Service)
+			}
+		}
+
+		names = append(names, service.Name)
+		calls[service.Name] = service.Calls
+	}
+
+	return model.ValidateTopology(names, calls)
+}
+
+// validateScalingActions checks the scaling actions of a run request, and that each targets a
+// revision or service of the run.
+func validateScalingActions(srr *SkenarioRunRequest) error {
+	targets := make(map[string]bool, len(srr.Revisions)+len(srr.Services))
+	for _, name := range srr.Revisions {
+		targets[name] = true
+	}
+	for _, service := range srr.Services {
+		targets[service.Name] = true
+	}
+
+	for _, action := range srr.ScalingActions {
+		err := action.Validate()
+		if err != nil {
+			return err
+		}
+		if action.Target != "" && !targets[action.Target] {
+			return fmt.Errorf("%s action targets '%s', which is not a revision or service of the run", action.Kind, action.Target)
+		}
+	}
+
+	return nil
+}
+
+// scalingActionsFor gives the scaling actions of a run request which apply to a cluster.
+func scalingActionsFor(srr *SkenarioRunRequest, cluster model.ClusterModel) []model.ScalingAction {
+	actions := make([]model.ScalingAction, 0)
+	for _, action := range srr.ScalingActions {
+		if action.Target == "" || action.Target == cluster.Revision() || action.Target == cluster.Service() {
+			actions = append(actions, action)
+		}
+	}
+	return actions
+}
+
+// buildClusters creates a cluster for each revision or service, alike but for their names.
+// Without either, there is a single unnamed cluster.
+func buildClusters(env simulator.Environment, srr *SkenarioRunRequest, clusterConf model.ClusterConfig, replicasConfig model.ReplicasConfig) []model.ClusterModel {
+	clusters := make([]model.ClusterModel, 0)
+	for _, name := range srr.Revisions {
+		revisionConf := clusterConf
+		revisionConf.Revision = name
+		clusters = append(clusters, model.NewCluster(env, revisionConf, replicasConfig))
+	}
+	for _, service := range srr.Services {
+		serviceConf := clusterConf
+		serviceConf.Service = service.Name
+		clusters = append(clusters, model.NewCluster(env, serviceConf, replicasConfig))
+	}
+
+	if len(clusters) == 0 {
+		clusters = append(clusters, model.NewCluster(env, clusterConf, replicasConfig))
+	}
+	return clusters
+}
+
+// buildServices builds the services of a topology, given a cluster for each.
+func buildServices(srr *SkenarioRunRequest, clusters []model.ClusterModel) []model.Service {
+	services := make([]model.Service, 0, len(srr.Services))
+	for i, sc := range srr.Services {
+		timeout := sc.Timeout
+		if timeout == 0 {
+			timeout = srr.RequestTimeout
+		}
+
+		services = append(services, model.Service{
+			Cluster: clusters[i],
+			Request: model.RequestConfig{
+				CPUTimeMillis: sc.CPUTimeMillis,
+				IOTimeMillis:  sc.IOTimeMillis,
+				CPUTime:       buildServiceTime(fmt.Sprintf("CPU time of service '%s'", sc.Name), sc.CPUTimeDistribution),
+				IOTime:        buildServiceTime(fmt.Sprintf("IO time of service '%s'", sc.Name), sc.IOTimeDistribution),
+				MemoryBytes:   sc.MemoryBytes,
+				Timeout:       timeout,
+			},
+			Calls: sc.Calls,
+		})
+	}
+	return services
+}
+
+// buildInvariants gives the invariants named in a run request. Those which check a cluster
+// check the cluster of each revision.
+func buildInvariants(srr *SkenarioRunRequest, clusters []model.ClusterModel) []simulator.Invariant {
+	invariants := make([]simulator.Invariant, 0, len(srr.Invariants))
+	for _, name := range srr.Invariants {
+		switch name {
+		case "stock_conservation":
+			invariants = append(invariants, simulator.NewStockConservationInvariant())
+		case "request_outcome":
+			invariants = append(invariants, model.NewRequestOutcomeInvariant())
+		case "replica_cpu_capacity":
+			for _, cluster := range clusters {
+				invariants = append(invariants, model.NewReplicaCPUCapacityInvariant(cluster))
+			}
+		case "node_capacity":
+			for _, cluster := range clusters {
+				invariants = append(invariants, model.NewNodeCapacityInvariant(cluster))
+			}
+		case "desired_count":
+			for _, cluster := range clusters {
+				invariants = append(invariants, model.NewDesiredCountInvariant(cluster))
+			}
+		default:
+			panic(fmt.Errorf("unknown invariant '%s'", name))
+		}
+	}
+
+	return invariants
 }
@@ -17,16 +17,22 @@ package serve
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
 	"fmt"
 	"net/http"
 	"net/http/httptest"
+	"sync"
 	"testing"
 	"time"
 
+	"github.com/bvinc/go-sqlite-lite/sqlite3"
 	"github.com/sclevine/spec"
+	"github.com/sclevine/spec/report"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 
+	"skenario/pkg/data"
 	"skenario/pkg/model"
 	"skenario/pkg/model/trafficpatterns"
 )
@@ -206,6 +212,73 @@ func testRunHandler(t *testing.T, describe spec.G, it spec.S) {
 	})
 }
 
+func TestRunScenario(t *testing.T) {
+	spec.Run(t, "runScenario()", testRunScenario, spec.Report(report.Terminal{}), spec.Sequential())
+}
+
+func testRunScenario(t *testing.T, describe spec.G, it spec.S) {
+	var runReq *SkenarioRunRequest
+	var conn *sqlite3.Conn
+	var err error
+
+	it.Before(func() {
+		runReq = &SkenarioRunRequest{
+			RunFor:                  10 * time.Second,
+			TrafficPattern:          "golang_rand_uniform",
+			Seed:                    1,
+			InitialNumberOfReplicas: 1,
+			LaunchDelay:             time.Second,
+			TickInterval:            2 * time.Second,
+			RequestCPUTimeMillis:    100,
+			RequestIOTimeMillis:     50,
+			RequestTimeout:          5 * time.Second,
+			UniformConfig: trafficpatterns.UniformConfig{
+				NumberOfRequests: 50,
+				StartAt:          time.Unix(0, 0),
+				RunFor:           10 * time.Second,
+			},
+		}
+
+		conn, err = sqlite3.Open(databaseFileName(true))
+		require.NoError(t, err)
+	})
+
+	it.After(func() {
+		conn.Close()
+	})
+
+	describe("with a kill fault", func() {
+		var summary data.RunSummary
+
+		it.Before(func() {
+			runReq.Faults = []model.Fault{{Kind: model.KillFault, At: 3 * time.Second}}
+			summary = runScenario(context.Background(), conn, new(sync.Mutex), runReq, "test").summary
+		})
+
+		it("reports the requests the killed replica was processing as failed because it was killed", func() {
+			killed, err := summary.Metric("failures.replica_killed")
+			require.NoError(t, err)
+			assert.Greater(t, killed, 0.0)
+		})
+	})
+
+	describe("with revisions and retries", func() {
+		var summary data.RunSummary
+
+		it.Before(func() {
+			runReq.Revisions = []string{"stable", "canary"}
+			runReq.TrafficSplit = []model.TrafficSplit{{At: 0, Percent: map[string]float64{"stable": 50, "canary": 50}}}
+			runReq.RequestRetry = &model.RetryPolicy{MaxAttempts: 2, InitialBackoff: 100 * time.Millisecond, Budget: 0.1}
+			summary = runScenario(context.Background(), conn, new(sync.Mutex), runReq, "test").summary
+		})
+
+		it("retries failed requests through the traffic split", func() {
+			assert.Greater(t, summary.Retries, int64(0))
+			assert.Len(t, summary.Revisions, 2)
+		})
+	})
+}
+
 func trafficPatternBefore(t *testing.T, pattern string) *SkenarioRunResponse {
 	skenarioRunRequest := &SkenarioRunRequest{
 		InMemoryDatabase: true,
@@ -42,6 +42,12 @@ func (ss *SkenarioServer) Serve() {
 	router.Mount("/debug", middleware.Profiler())
 	router.Mount("/", http.FileServer(http.Dir(ss.IndexRoot)))
 	router.HandleFunc("/run", RunHandler)
+	router.HandleFunc("/experiment", ExperimentHandler)
+	router.HandleFunc("/replicate", ReplicationHandler)
+	router.HandleFunc("/optimize", OptimizationHandler)
+	router.HandleFunc("/compare", CompareHandler)
+	router.HandleFunc("/export", ExportHandler)
+	router.HandleFunc("/report", ReportHandler)
 
 	ss.srv = &http.Server{
 		Addr:    "0.0.0.0:3000",
@@ -0,0 +1,228 @@
+/*
+ * Copyright (C) 2019-Present Pivotal Software, Inc. All rights reserved.
+ *
+ * This program and the accompanying materials are made available under the terms
+ * of the Apache License, Version 2.0 (the "License”); you may not use this file
+ * except in compliance with the License. You may obtain a copy of the License at:
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software distributed
+ * under the License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR
+ * CONDITIONS OF ANY KIND, either express or implied. See the License for the
+ * specific language governing permissions and limitations under the License.
+ */
+
+package serve
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"sync"
+	"time"
+
+	"github.com/bvinc/go-sqlite-lite/sqlite3"
+
+	"skenario/pkg/data"
+)
+
+// ScenarioFile is a scenario together with the expectations a run of it must meet.
+type ScenarioFile struct {
+	Name         string             `json:"name"`
+	Scenario     SkenarioRunRequest `json:"scenario"`
+	Expectations []Expectation      `json:"expectations"`
+}
+
+// Expectation is an SLO expression which must hold for a run, or for the part of it between
+// After and Before. A zero Before means the end of the run.
+type Expectation struct {
+	Description string        `json:"description,omitempty"`
+	SLO         string        `json:"slo"`
+	After       time.Duration `json:"after,omitempty"`
+	Before      time.Duration `json:"before,omitempty"`
+}
+
+// UnmarshalJSON accepts either a bare SLO expression or an object. Durations in the object
+// may be given as strings like "2m" or as nanoseconds.
+func (e *Expectation) UnmarshalJSON(b []byte) error {
+	var expression string
+	if err := json.Unmarshal(b, &expression); err == nil {
+		*e = Expectation{SLO: expression}
+		return nil
+	}
+
+	var raw struct {
+		Description string          `json:"description"`
+		SLO         string          `json:"slo"`
+		After       json.RawMessage `json:"after"`
+		Before      json.RawMessage `json:"before"`
+	}
+	err := json.Unmarshal(b, &raw)
+	if err != nil {
+		return err
+	}
+
+	after, err := jsonDuration(raw.After)
+	if err != nil {
+		return fmt.Errorf("could not parse 'after': %s", err.Error())
+	}
+	before, err := jsonDuration(raw.Before)
+	if err != nil {
+		return fmt.Errorf("could not parse 'before': %s", err.Error())
+	}
+
+	*e = Expectation{Description: raw.Description, SLO: raw.SLO, After: after, Before: before}
+	return nil
+}
+
+func jsonDuration(raw json.RawMessage) (time.Duration, error) {
+	if len(raw) == 0 {
+		return 0, nil
+	}
+
+	var s string
+	if err := json.Unmarshal(raw, &s); err == nil {
+		return time.ParseDuration(s)
+	}
+
+	var nanos int64
+	err := json.Unmarshal(raw, &nanos)
+	return time.Duration(nanos), err
+}
+
+func (e Expectation) String() string {
+	s := e.SLO
+	if e.After > 0 {
+		s += fmt.Sprintf(" after %s", e.After)
+	}
+	if e.Before > 0 {
+		s += fmt.Sprintf(" before %s", e.Before)
+	}
+	if e.Description != "" {
+		s = fmt.Sprintf("%s: %s", e.Description, s)
+	}
+	return s
+}
+
+type ExpectationResult struct {
+	Expectation Expectation     `json:"expectation"`
+	SLO         *data.SLOResult `json:"slo,omitempty"`
+	Error       string          `json:"error,omitempty"`
+}
+
+func (er ExpectationResult) Passed() bool {
+	return er.Error == "" && er.SLO != nil && er.SLO.Passed
+}
+
+type VerifyResult struct {
+	Name          string              `json:"name"`
+	ScenarioRunId int64               `json:"scenario_run_id"`
+	Passed        bool                `json:"passed"`
+	Error         string              `json:"error,omitempty"`
+	Expectations  []ExpectationResult `json:"expectations"`
+}
+
+// Verify runs the scenario in a ScenarioFile and checks each of its expectations against the run.
+// Expectations which cannot be parsed are reported before anything is simulated.
+func Verify(ctx context.Context, conn *sqlite3.Conn, file *ScenarioFile) (result VerifyResult, err error) {
+	result.Name = file.Name
+
+	if len(file.Expectations) == 0 {
+		return result, fmt.Errorf("scenario '%s' has no expectations", file.Name)
+	}
+	for _, e := range file.Expectations {
+		_, err = data.ParseSLO(e.SLO)
+		if err != nil {
+			return result, fmt.Errorf("could not parse expectation '%s': %s", e, err.Error())
+		}
+		if e.Before > 0 && e.Before < e.After {
+			return result, fmt.Errorf("expectation '%s' ends before it starts", e)
+		}
+	}
+
+	defer func() {
+		if r := recover(); r != nil {
+			result.Passed = false
+			result.Error = fmt.Sprintf("%v", r)
+		}
+	}()
+
+	sr := runScenario(ctx, conn, new(sync.Mutex), &file.Scenario, fmt.Sprintf("skenario_verify: %s", file.Name))
+	result.ScenarioRunId = sr.scenarioRunId
+	result.Passed = true
+
+	for _, e := range file.Expectations {
+		er := ExpectationResult{Expectation: e}
+
+		summary, err := data.SummarizeWindow(conn, sr.scenarioRunId, e.After, e.Before)
+		if err == nil {
+			var slo data.SLOResult
+			slo, err = data.EvaluateSLO(e.SLO, summary)
+			er.SLO = &slo
+		}
+		if err != nil {
+			er.Error = err.Error()
+		}
+
+		result.Passed = result.Passed && er.Passed()
+		result.Expectations = append(result.Expectations, er)
+	}
+
+	return result, nil
+}
+
+// WriteReport writes one PASS or FAIL line per expectation, with the actual value of every
+// objective that was missed.
+func (vr VerifyResult) WriteReport(w io.Writer) error {
+	status := "PASS"
+	if !vr.Passed {
+		status = "FAIL"
+	}
+	_, err := fmt.Fprintf(w, "%s  %s (run %d)\n", status, vr.Name, vr.ScenarioRunId)
+	if err != nil {
+		return err
+	}
+
+	if vr.Error != "" {
+		_, err = fmt.Fprintf(w, "      error: %s\n", vr.Error)
+		return err
+	}
+
+	for _, er := range vr.Expectations {
+		status = "PASS"
+		if !er.Passed() {
+			status = "FAIL"
+		}
+		_, err = fmt.Fprintf(w, "  %s  %s\n", status, er.Expectation)
+		if err != nil {
+			return err
+		}
+
+		if er.Error != "" {
+			_, err = fmt.Fprintf(w, "          error: %s\n", er.Error)
+			if err != nil {
+				return err
+			}
+			continue
+		}
+
+		for _, obj := range er.SLO.Objectives {
+			if obj.Passed {
+				continue
+			}
+
+			actual := fmt.Sprintf("%.4g", obj.Actual)
+			if data.IsDurationMetric(obj.Objective.Metric) {
+				actual = time.Duration(obj.Actual).String()
+			}
+			_, err = fmt.Fprintf(w, "          %s was %s\n", obj.Objective.Metric, actual)
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,149 @@
+/*
+ * Copyright (C) 2019-Present Pivotal Software, Inc. All rights reserved.
+ *
+ * This program and the accompanying materials are made available under the terms
+ * of the Apache License, Version 2.0 (the "License”); you may not use this file
+ * except in compliance with the License. You may obtain a copy of the License at:
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software distributed
+ * under the License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR
+ * CONDITIONS OF ANY KIND, either express or implied. See the License for the
+ * specific language governing permissions and limitations under the License.
+ */
+
+package serve
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/bvinc/go-sqlite-lite/sqlite3"
+	"github.com/sclevine/spec"
+	"github.com/sclevine/spec/report"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"skenario/pkg/model/trafficpatterns"
+)
+
+func TestVerify(t *testing.T) {
+	spec.Run(t, "Verify()", testVerify, spec.Report(report.Terminal{}), spec.Sequential())
+}
+
+func testVerify(t *testing.T, describe spec.G, it spec.S) {
+	var subject *ScenarioFile
+	var conn *sqlite3.Conn
+	var result VerifyResult
+	var err error
+
+	it.Before(func() {
+		subject = &ScenarioFile{
+			Name: "test scenario",
+			Scenario: SkenarioRunRequest{
+				RunFor:               10 * time.Second,
+				TrafficPattern:       "golang_rand_uniform",
+				Seed:                 1,
+				LaunchDelay:          time.Second,
+				TickInterval:         2 * time.Second,
+				RequestCPUTimeMillis: 100,
+				RequestIOTimeMillis:  50,
+				RequestTimeout:       5 * time.Second,
+				UniformConfig: trafficpatterns.UniformConfig{
+					NumberOfRequests: 50,
+					StartAt:          time.Unix(0, 0),
+					RunFor:           10 * time.Second,
+				},
+			},
+		}
+
+		conn, err = sqlite3.Open(databaseFileName(true))
+		require.NoError(t, err)
+	})
+
+	it.After(func() {
+		conn.Close()
+	})
+
+	describe("when every expectation is met", func() {
+		it.Before(func() {
+			subject.Expectations = []Expectation{
+				{SLO: "requests == 50"},
+				{SLO: "requests < 50", After: 5 * time.Second},
+			}
+			result, err = Verify(context.Background(), conn, subject)
+			require.NoError(t, err)
+		})
+
+		it("passes", func() {
+			assert.True(t, result.Passed)
+			assert.NotZero(t, result.ScenarioRunId)
+			assert.Len(t, result.Expectations, 2)
+		})
+	})
+
+	describe("when an expectation is missed", func() {
+		var report *bytes.Buffer
+
+		it.Before(func() {
+			subject.Expectations = []Expectation{
+				{SLO: "requests == 50"},
+				{Description: "nobody waits", SLO: "p50 < 1ns"},
+			}
+			result, err = Verify(context.Background(), conn, subject)
+			require.NoError(t, err)
+
+			report = new(bytes.Buffer)
+			err = result.WriteReport(report)
+			require.NoError(t, err)
+		})
+
+		it("fails", func() {
+			assert.False(t, result.Passed)
+			assert.True(t, result.Expectations[0].Passed())
+			assert.False(t, result.Expectations[1].Passed())
+		})
+
+		it("reports the actual value", func() {
+			assert.Contains(t, report.String(), "FAIL  nobody waits: p50 < 1ns")
+			assert.Contains(t, report.String(), "p50 was ")
+		})
+	})
+
+	describe("when an expectation cannot be parsed", func() {
+		it("returns an error without running the scenario", func() {
+			subject.Expectations = []Expectation{{SLO: "p99 about 2s"}}
+			_, err = Verify(context.Background(), conn, subject)
+			assert.Error(t, err)
+		})
+	})
+}
+
+func TestExpectationUnmarshal(t *testing.T) {
+	spec.Run(t, "Expectation.UnmarshalJSON()", testExpectationUnmarshal, spec.Report(report.Terminal{}))
+}
+
+func testExpectationUnmarshal(t *testing.T, describe spec.G, it spec.S) {
+	var subject []Expectation
+
+	it("accepts a bare SLO expression", func() {
+		err := json.Unmarshal([]byte(`["p99 < 2s"]`), &subject)
+		require.NoError(t, err)
+		assert.Equal(t, []Expectation{{SLO: "p99 < 2s"}}, subject)
+	})
+
+	it("accepts durations as strings or nanoseconds", func() {
+		err := json.Unmarshal([]byte(`[{"slo": "failed == 0", "after": "2m", "before": 300000000000}]`), &subject)
+		require.NoError(t, err)
+		assert.Equal(t, []Expectation{{SLO: "failed == 0", After: 2 * time.Minute, Before: 5 * time.Minute}}, subject)
+	})
+
+	it("rejects durations it cannot parse", func() {
+		err := json.Unmarshal([]byte(`[{"slo": "failed == 0", "after": "soon"}]`), &subject)
+		assert.Error(t, err)
+	})
+}
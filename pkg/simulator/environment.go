@@ -18,26 +18,32 @@ package simulator
 import (
 	"context"
 	"fmt"
+	"math/rand"
 	"time"
 
 	"skenario/pkg/plugin"
 )
 
 const (
-	OccursInPast     = "ScheduledToOccurInPast"
-	OccursAfterHalt  = "ScheduledToOccurAfterHalt"
-	FromStockIsEmpty = "FromStockEmptyAtMovementTime"
+	OccursInPast      = "ScheduledToOccurInPast"
+	OccursAfterHalt   = "ScheduledToOccurAfterHalt"
+	FromStockIsEmpty  = "FromStockEmptyAtMovementTime"
+	MovementCancelled = "CancelledBeforeOccurring"
 )
 
 type Environment interface {
 	Plugin() *plugin.PluginPartition
 	AddToSchedule(movement Movement) (added bool)
+	ScheduleMovement(movement Movement) (scheduled ScheduledMovement, added bool)
 	Run() (completed []CompletedMovement, ignored []IgnoredMovement, err error)
 	CurrentMovementTime() time.Time
 	HaltTime() time.Time
 	Context() context.Context
 	CPUUtilizations() []*CPUUtilization
 	AppendCPUUtilization(cpuUtilization *CPUUtilization)
+	AddInvariant(invariant Invariant)
+	InvariantViolations() []InvariantViolation
+	Rand() *rand.Rand
 }
 
 type CompletedMovement struct {
@@ -51,6 +57,26 @@ type IgnoredMovement struct {
 	Moved    Entity
 }
 
+// MovementSink receives completed and ignored movements in batches while an Environment
+// runs, so that they need not all be held in memory until Run() returns.
+type MovementSink interface {
+	Flush(completed []CompletedMovement, ignored []IgnoredMovement) error
+}
+
+type EnvironmentConfig struct {
+	StartAt time.Time
+	RunFor  time.Duration
+
+	// When MovementSink is set, movements are flushed to it every FlushEvery movements
+	// and Run() returns no completed or ignored movements of its own.
+	MovementSink MovementSink
+	FlushEvery   int
+
+	// Seed seeds Rand(), so that a scenario can be replayed exactly. When it is 0 the
+	// environment is seeded from the clock.
+	Seed int64
+}
+
 type CPUUtilization struct {
 	CPUUtilization float64
 	CalculatedAt   time.Time
@@ -72,6 +98,15 @@ type environment struct {
 	completed       []CompletedMovement
 	ignored         []IgnoredMovement
 	cpuUtilizations []*CPUUtilization
+
+	movementSink MovementSink
+	flushEvery   int
+	flushErr     error
+
+	invariants          []Invariant
+	invariantViolations []InvariantViolation
+
+	rng *rand.Rand
 }
 
 func (env *environment) Plugin() *plugin.PluginPartition {
@@ -79,22 +114,33 @@ func (env *environment) Plugin() *plugin.PluginPartition {
 }
 
 func (env *environment) AddToSchedule(movement Movement) (added bool) {
+	return env.schedule(movement)
+}
+
+// ScheduleMovement adds a movement to the schedule like AddToSchedule(), but also returns a
+// handle through which the movement can be cancelled or rescheduled before it occurs.
+func (env *environment) ScheduleMovement(movement Movement) (scheduled ScheduledMovement, added bool) {
+	added = env.schedule(movement)
+	return &scheduledMovement{env: env, movement: movement}, added
+}
+
+func (env *environment) schedule(movement Movement) (added bool) {
 	occursAfterCurrent := movement.OccursAt().After(env.current)
 	occursBeforeHalt := movement.OccursAt().Before(env.haltAt)
 
 	schedulable := occursAfterCurrent && occursBeforeHalt
 	if schedulable {
-		_, _, err := env.futureMovements.EnqueueMovement(movement)
+		err := env.futureMovements.EnqueueMovement(movement)
 		if err != nil {
 			panic(fmt.Errorf("unknown error meant '%#v' was not added future movements: %s", movement, err.Error()))
 		}
 	} else if !occursAfterCurrent {
-		env.ignored = append(env.ignored, IgnoredMovement{
+		env.ignore(IgnoredMovement{
 			Reason:   OccursInPast,
 			Movement: movement,
 		})
 	} else if !occursBeforeHalt {
-		env.ignored = append(env.ignored, IgnoredMovement{
+		env.ignore(IgnoredMovement{
 			Reason:   OccursAfterHalt,
 			Movement: movement,
 		})
@@ -118,18 +164,104 @@ func (env *environment) Run() ([]CompletedMovement, []IgnoredMovement, error) {
 
 		env.current = movement.OccursAt()
 
+		for _, inv := range env.invariants {
+			if observer, ok := inv.(BeforeMovementObserver); ok {
+				observer.BeforeMovement(movement)
+			}
+		}
+
 		moved := movement.From().Remove()
 		if moved == nil {
-			env.ignored = append(env.ignored, IgnoredMovement{Movement: movement, Reason: FromStockIsEmpty})
+			env.ignore(IgnoredMovement{Movement: movement, Reason: FromStockIsEmpty})
+			env.checkIgnoredMovement(movement)
 		} else {
 			movement.To().Add(moved)
-			env.completed = append(env.completed, CompletedMovement{Movement: movement, Moved: moved})
+			env.complete(CompletedMovement{Movement: movement, Moved: moved})
+			env.checkInvariants(movement, moved)
+		}
+
+		if env.flushErr != nil {
+			return nil, nil, env.flushErr
+		}
+	}
+
+	if env.movementSink != nil {
+		err := env.flush()
+		if err != nil {
+			return nil, nil, err
 		}
 	}
 
 	return env.completed, env.ignored, nil
 }
 
+func (env *environment) checkInvariants(movement Movement, moved Entity) {
+	for _, inv := range env.invariants {
+		err := inv.Check(movement, moved)
+		if err != nil {
+			env.invariantViolations = append(env.invariantViolations, InvariantViolation{
+				Invariant: inv.Name(),
+				Reason:    err.Error(),
+				OccursAt:  movement.OccursAt(),
+				Movement:  movement,
+				Moved:     moved,
+			})
+		}
+	}
+}
+
+func (env *environment) checkIgnoredMovement(movement Movement) {
+	for _, inv := range env.invariants {
+		checker, ok := inv.(IgnoredMovementChecker)
+		if !ok {
+			continue
+		}
+
+		err := checker.CheckIgnored(movement)
+		if err != nil {
+			env.invariantViolations = append(env.invariantViolations, InvariantViolation{
+				Invariant: inv.Name(),
+				Reason:    err.Error(),
+				OccursAt:  movement.OccursAt(),
+				Movement:  movement,
+			})
+		}
+	}
+}
+
+func (env *environment) complete(completed CompletedMovement) {
+	env.completed = append(env.completed, completed)
+	env.flushIfFull()
+}
+
+func (env *environment) ignore(ignored IgnoredMovement) {
+	env.ignored = append(env.ignored, ignored)
+	env.flushIfFull()
+}
+
+func (env *environment) flushIfFull() {
+	if env.movementSink == nil || env.flushErr != nil {
+		return
+	}
+
+	if len(env.completed)+len(env.ignored) >= env.flushEvery {
+		env.flushErr = env.flush()
+	}
+}
+
+func (env *environment) flush() error {
+	err := env.movementSink.Flush(env.completed, env.ignored)
+	if err != nil {
+		return fmt.Errorf("could not flush movements to sink: %s", err.Error())
+	}
+
+	// fresh slices, as the sink may have retained the old ones
+	env.completed = make([]CompletedMovement, 0, env.flushEvery)
+	env.ignored = make([]IgnoredMovement, 0)
+
+	return nil
+}
+
 func (env *environment) CurrentMovementTime() time.Time {
 	return env.current
 }
@@ -152,9 +284,40 @@ func (env *environment) AppendCPUUtilization(cpuUtilization *CPUUtilization) {
 	env.cpuUtilizations = append(env.cpuUtilizations, cpuUtilization)
 }
 
+func (env *environment) AddInvariant(invariant Invariant) {
+	env.invariants = append(env.invariants, invariant)
+}
+
+func (env *environment) InvariantViolations() []InvariantViolation {
+	return env.invariantViolations
+}
+
+// Rand is the source of randomness for everything taking part in the scenario.
+func (env *environment) Rand() *rand.Rand {
+	return env.rng
+}
+
 func NewEnvironment(ctx context.Context, startAt time.Time, runFor time.Duration) Environment {
+	return NewEnvironmentWithConfig(ctx, EnvironmentConfig{StartAt: startAt, RunFor: runFor})
+}
+
+func NewEnvironmentWithConfig(ctx context.Context, config EnvironmentConfig) Environment {
 	pqueue := NewMovementPriorityQueue()
-	return newEnvironment(ctx, startAt, runFor, pqueue)
+	env := newEnvironment(ctx, config.StartAt, config.RunFor, pqueue)
+
+	if config.Seed != 0 {
+		env.rng = rand.New(rand.NewSource(config.Seed))
+	}
+
+	if config.MovementSink != nil {
+		env.movementSink = config.MovementSink
+		env.flushEvery = config.FlushEvery
+		if env.flushEvery < 1 {
+			env.flushEvery = 1
+		}
+	}
+
+	return env
 }
 
 func newEnvironment(ctx context.Context, startAt time.Time, runFor time.Duration, pqueue MovementPriorityQueue) *environment {
@@ -176,6 +339,11 @@ func newEnvironment(ctx context.Context, startAt time.Time, runFor time.Duration
 		completed:       make([]CompletedMovement, 0),
 		ignored:         make([]IgnoredMovement, 0),
 		cpuUtilizations: make([]*CPUUtilization, 0),
+
+		invariants:          make([]Invariant, 0),
+		invariantViolations: make([]InvariantViolation, 0),
+
+		rng: rand.New(rand.NewSource(time.Now().UnixNano())),
 	}
 
 	env = setupScenarioMovements(env, startAt, env.haltAt.Add(-1*time.Nanosecond), env.beforeScenario, env.runningScenario, env.haltedScenario)
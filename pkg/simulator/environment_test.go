@@ -256,6 +256,70 @@ func testEnvironment(t *testing.T, describe spec.G, it spec.S) {
 		})
 	}, spec.Nested())
 
+	describe("NewEnvironmentWithConfig()", func() {
+		describe("when a MovementSink is configured", func() {
+			var sink *FakeMovementSink
+			var completed []CompletedMovement
+			var ignored []IgnoredMovement
+			var err error
+
+			it.Before(func() {
+				sink = new(FakeMovementSink)
+				subject = NewEnvironmentWithConfig(ctx, EnvironmentConfig{
+					StartAt:      startTime,
+					RunFor:       runFor,
+					MovementSink: sink,
+					FlushEvery:   2,
+				})
+				assert.NotNil(t, subject)
+
+				subject.AddToSchedule(NewMovement("test movement kind", time.Unix(111111, 0), fromStock, toStock))
+				subject.AddToSchedule(NewMovement("test movement kind", time.Unix(333333, 0), fromStock, toStock))
+				subject.AddToSchedule(NewMovement("test movement kind", time.Unix(444444, 0), fromStock, toStock))
+
+				completed, ignored, err = subject.Run()
+				assert.NoError(t, err)
+			})
+
+			it("flushes movements to the sink in batches", func() {
+				assert.Equal(t, 3, sink.Flushes)
+			})
+
+			it("flushes every completed movement", func() {
+				assert.Len(t, sink.Completed, 4) // start scenario, halt scenario and two test movements
+			})
+
+			it("flushes every ignored movement", func() {
+				assert.Len(t, sink.Ignored, 1)
+			})
+
+			it("does not retain movements for Run() to return", func() {
+				assert.Empty(t, completed)
+				assert.Empty(t, ignored)
+			})
+		})
+
+		describe("when the MovementSink fails", func() {
+			var err error
+
+			it.Before(func() {
+				subject = NewEnvironmentWithConfig(ctx, EnvironmentConfig{
+					StartAt:      startTime,
+					RunFor:       runFor,
+					MovementSink: &FakeMovementSink{FlushErr: fmt.Errorf("sink failure")},
+					FlushEvery:   1,
+				})
+
+				_, _, err = subject.Run()
+			})
+
+			it("returns the error from Run()", func() {
+				assert.Error(t, err)
+				assert.Contains(t, err.Error(), "sink failure")
+			})
+		})
+	}, spec.Nested())
+
 	describe("CurrentMovementTime()", func() {
 		it.Before(func() {
 			subject = NewEnvironment(ctx, startTime, runFor)
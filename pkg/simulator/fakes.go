@@ -84,3 +84,17 @@ func (es *EchoSourceStockType) Remove() Entity {
 	es.series++
 	return NewEntity(name, es.kind)
 }
+
+type FakeMovementSink struct {
+	Flushes   int
+	Completed []CompletedMovement
+	Ignored   []IgnoredMovement
+	FlushErr  error
+}
+
+func (fms *FakeMovementSink) Flush(completed []CompletedMovement, ignored []IgnoredMovement) error {
+	fms.Flushes++
+	fms.Completed = append(fms.Completed, completed...)
+	fms.Ignored = append(fms.Ignored, ignored...)
+	return fms.FlushErr
+}
@@ -0,0 +1,91 @@
+/*
+ * Copyright (C) 2019-Present Pivotal Software, Inc. All rights reserved.
+ *
+ * This program and the accompanying materials are made available under the terms
+ * of the Apache License, Version 2.0 (the "License”); you may not use this file
+ * except in compliance with the License. You may obtain a copy of the License at:
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software distributed
+ * under the License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR
+ * CONDITIONS OF ANY KIND, either express or implied. See the License for the
+ * specific language governing permissions and limitations under the License.
+ */
+
+package simulator
+
+import (
+	"fmt"
+	"time"
+)
+
+// Invariant is a rule that should hold after every completed Movement. Invariants are
+// checked by the Environment once they have been added with AddInvariant().
+type Invariant interface {
+	Name() string
+	Check(movement Movement, moved Entity) error
+}
+
+// BeforeMovementObserver may be implemented by an Invariant that needs to see the world
+// before a Movement occurs, for example to compare Stock counts before and after.
+type BeforeMovementObserver interface {
+	BeforeMovement(movement Movement)
+}
+
+// IgnoredMovementChecker may be implemented by an Invariant that also checks the Movements
+// which were ignored because there was nothing in their From() stock to move. Violations
+// found this way have no moved Entity.
+type IgnoredMovementChecker interface {
+	CheckIgnored(movement Movement) error
+}
+
+type InvariantViolation struct {
+	Invariant string
+	Reason    string
+	OccursAt  time.Time
+	Movement  Movement
+	Moved     Entity
+}
+
+type stockConservationInvariant struct {
+	fromBefore uint64
+	toBefore   uint64
+}
+
+func (sci *stockConservationInvariant) Name() string {
+	return "stock_conservation"
+}
+
+func (sci *stockConservationInvariant) BeforeMovement(movement Movement) {
+	sci.fromBefore = movement.From().Count()
+	sci.toBefore = movement.To().Count()
+}
+
+// Check ensures that a Movement took exactly one Entity out of its From() stock and put
+// exactly one Entity into its To() stock, so that Entities neither vanish nor multiply.
+// Source stocks that conjure Entities on demand always have a count of zero and are
+// exempt from the first half of the check.
+func (sci *stockConservationInvariant) Check(movement Movement, moved Entity) error {
+	if baseStock(movement.From()) == baseStock(movement.To()) {
+		return nil
+	}
+
+	fromAfter := movement.From().Count()
+	toAfter := movement.To().Count()
+
+	isSource := sci.fromBefore == 0 && fromAfter == 0
+	if !isSource && fromAfter+1 != sci.fromBefore {
+		return fmt.Errorf("stock '%s' went from %d to %d entities, but should have lost exactly 1", movement.From().Name(), sci.fromBefore, fromAfter)
+	}
+
+	if toAfter != sci.toBefore+1 {
+		return fmt.Errorf("stock '%s' went from %d to %d entities, but should have gained exactly 1", movement.To().Name(), sci.toBefore, toAfter)
+	}
+
+	return nil
+}
+
+func NewStockConservationInvariant() Invariant {
+	return &stockConservationInvariant{}
+}
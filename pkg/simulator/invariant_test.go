@@ -0,0 +1,199 @@
+/*
+ * Copyright (C) 2019-Present Pivotal Software, Inc. All rights reserved.
+ *
+ * This program and the accompanying materials are made available under the terms
+ * of the Apache License, Version 2.0 (the "License”); you may not use this file
+ * except in compliance with the License. You may obtain a copy of the License at:
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software distributed
+ * under the License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR
+ * CONDITIONS OF ANY KIND, either express or implied. See the License for the
+ * specific language governing permissions and limitations under the License.
+ */
+
+package simulator
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/sclevine/spec"
+	"github.com/sclevine/spec/report"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestInvariant(t *testing.T) {
+	spec.Run(t, "Invariants", testInvariant, spec.Report(report.Terminal{}))
+}
+
+type alwaysViolatedInvariant struct {
+	before int
+}
+
+func (avi *alwaysViolatedInvariant) Name() string {
+	return "always_violated"
+}
+
+func (avi *alwaysViolatedInvariant) BeforeMovement(movement Movement) {
+	avi.before++
+}
+
+func (avi *alwaysViolatedInvariant) Check(movement Movement, moved Entity) error {
+	return fmt.Errorf("'%s' was moved", moved.Name())
+}
+
+type emptyFromInvariant struct{}
+
+func (efi *emptyFromInvariant) Name() string {
+	return "empty_from"
+}
+
+func (efi *emptyFromInvariant) Check(movement Movement, moved Entity) error {
+	return nil
+}
+
+func (efi *emptyFromInvariant) CheckIgnored(movement Movement) error {
+	return fmt.Errorf("'%s' was empty", movement.From().Name())
+}
+
+func testInvariant(t *testing.T, describe spec.G, it spec.S) {
+	var env Environment
+	var startTime time.Time
+	var fromStock SourceStock
+	var toStock SinkStock
+
+	it.Before(func() {
+		startTime = time.Unix(222222, 0)
+		env = NewEnvironment(context.Background(), startTime, 555555*time.Second)
+		fromStock = &EchoSourceStockType{
+			name: "from stock",
+			kind: "test entity kind",
+		}
+		toStock = NewSinkStock("to stock", "test entity kind")
+	})
+
+	describe("Environment.AddInvariant()", func() {
+		var invariant *alwaysViolatedInvariant
+		var violations []InvariantViolation
+
+		it.Before(func() {
+			invariant = new(alwaysViolatedInvariant)
+			env.AddInvariant(invariant)
+			env.AddToSchedule(NewMovement("test movement kind", time.Unix(333333, 0), fromStock, toStock))
+			env.AddToSchedule(NewMovement("empty movement kind", time.Unix(444444, 0), NewThroughStock("empty", "test entity kind"), toStock))
+
+			_, _, err := env.Run()
+			require.NoError(t, err)
+
+			violations = env.InvariantViolations()
+		})
+
+		it("lets the invariant observe each movement before it occurs", func() {
+			assert.Equal(t, 4, invariant.before) // start, halt, test movement and empty movement
+		})
+
+		it("checks the invariant after each completed movement", func() {
+			assert.Len(t, violations, 3) // start, halt and test movement
+		})
+
+		it("records the offending movement and entity", func() {
+			violation := violations[1]
+			assert.Equal(t, "always_violated", violation.Invariant)
+			assert.Equal(t, MovementKind("test movement kind"), violation.Movement.Kind())
+			assert.Equal(t, EntityName("entity-0"), violation.Moved.Name())
+			assert.Equal(t, time.Unix(333333, 0), violation.OccursAt)
+			assert.Equal(t, "'entity-0' was moved", violation.Reason)
+		})
+	})
+
+	describe("an invariant which also checks ignored movements", func() {
+		var violations []InvariantViolation
+
+		it.Before(func() {
+			env.AddInvariant(new(emptyFromInvariant))
+			env.AddToSchedule(NewMovement("test movement kind", time.Unix(333333, 0), fromStock, toStock))
+			env.AddToSchedule(NewMovement("empty movement kind", time.Unix(444444, 0), NewThroughStock("empty", "test entity kind"), toStock))
+
+			_, _, err := env.Run()
+			require.NoError(t, err)
+
+			violations = env.InvariantViolations()
+		})
+
+		it("records the movements it finds wrong, with nothing moved", func() {
+			require.Len(t, violations, 1)
+			assert.Equal(t, MovementKind("empty movement kind"), violations[0].Movement.Kind())
+			assert.Nil(t, violations[0].Moved)
+			assert.Equal(t, "'empty' was empty", violations[0].Reason)
+		})
+	})
+
+	describe("NewStockConservationInvariant()", func() {
+		var subject Invariant
+		var movement Movement
+		var entity Entity
+
+		it.Before(func() {
+			subject = NewStockConservationInvariant()
+		})
+
+		it("is called stock_conservation", func() {
+			assert.Equal(t, "stock_conservation", subject.Name())
+		})
+
+		describe("when an entity moves from one stock to another", func() {
+			it.Before(func() {
+				from := NewThroughStock("from", "test entity kind")
+				require.NoError(t, from.Add(NewEntity("test entity", "test entity kind")))
+				movement = NewMovement("test movement kind", time.Unix(333333, 0), from, toStock)
+
+				subject.(BeforeMovementObserver).BeforeMovement(movement)
+				entity = from.Remove()
+				require.NoError(t, toStock.Add(entity))
+			})
+
+			it("is not violated", func() {
+				assert.NoError(t, subject.Check(movement, entity))
+			})
+		})
+
+		describe("when an entity is conjured by a source stock", func() {
+			it.Before(func() {
+				movement = NewMovement("test movement kind", time.Unix(333333, 0), fromStock, toStock)
+
+				subject.(BeforeMovementObserver).BeforeMovement(movement)
+				entity = fromStock.Remove()
+				require.NoError(t, toStock.Add(entity))
+			})
+
+			it("is not violated", func() {
+				assert.NoError(t, subject.Check(movement, entity))
+			})
+		})
+
+		describe("when an entity disappears", func() {
+			var swallowing *MockStockType
+
+			it.Before(func() {
+				swallowing = new(MockStockType)
+				swallowing.On("Name").Return()
+				swallowing.On("Count").Return()
+				movement = NewMovement("test movement kind", time.Unix(333333, 0), fromStock, swallowing)
+
+				subject.(BeforeMovementObserver).BeforeMovement(movement)
+				entity = fromStock.Remove()
+			})
+
+			it("is violated", func() {
+				err := subject.Check(movement, entity)
+				assert.Error(t, err)
+				assert.Contains(t, err.Error(), "should have gained exactly 1")
+			})
+		})
+	})
+}
@@ -16,99 +16,147 @@
 package simulator
 
 import (
-	"strconv"
-	"strings"
-	"time"
-
-	"k8s.io/client-go/tools/cache"
+	"container/heap"
+	"fmt"
 )
 
 type MovementPriorityQueue interface {
-	EnqueueMovement(movement Movement) (wasShifted bool, scheduledAt time.Time, err error)
+	EnqueueMovement(movement Movement) error
 	DequeueMovement() (movement Movement, err error, closed bool)
+	RemoveMovement(movement Movement) (removed bool)
+	Contains(movement Movement) bool
 	Close()
 	IsClosed() bool
 }
 
+// movementPQ orders movements by the time they occur. Movements scheduled for the
+// same instant are dequeued in the order they were enqueued, so that simultaneous
+// movements are never time-shifted and runs are deterministic.
+//
+// It is not safe for concurrent use; an Environment runs its movements one at a time.
 type movementPQ struct {
-	heap *cache.Heap
+	items    movementHeap
+	queued   map[Movement]*movementHeapItem
+	sequence uint64
+	closed   bool
+}
+
+type movementHeapItem struct {
+	movement Movement
+	occursAt int64
+	sequence uint64
+	index    int
 }
 
-func (mpq *movementPQ) EnqueueMovement(movement Movement) (wasShifted bool, scheduledAt time.Time, err error) {
-	wasShifted = false
-	i := 0 * time.Nanosecond
-	for {
-		key := occursAtToStr(movement.OccursAt().Add(i))
-
-		_, exists, err := mpq.heap.GetByKey(key)
-		if err != nil {
-			return false, time.Unix(0, -1), err
-		}
-
-		if exists {
-			i++
-			wasShifted = true
-		} else {
-			break
-		}
+func (mpq *movementPQ) EnqueueMovement(movement Movement) error {
+	if mpq.closed {
+		return fmt.Errorf("could not enqueue movement '%s', the queue is closed", movement.Kind())
 	}
 
-	if wasShifted {
-		shiftedMovement := NewMovement(movement.Kind(), movement.OccursAt().Add(i), movement.From(), movement.To())
-		return true, shiftedMovement.OccursAt(), mpq.heap.Add(shiftedMovement)
+	if mpq.Contains(movement) {
+		return fmt.Errorf("could not enqueue movement '%s', it is already enqueued", movement.Kind())
 	}
 
-	return false, movement.OccursAt(), mpq.heap.Add(movement)
+	mpq.sequence++
+	item := &movementHeapItem{
+		movement: movement,
+		occursAt: movement.OccursAt().UnixNano(),
+		sequence: mpq.sequence,
+	}
+	heap.Push(&mpq.items, item)
+	mpq.queued[movement] = item
+
+	return nil
 }
 
 // DequeueMovement picks the next earliest movement from the queue.
-// It will block until there is a Movement to retrieve
 // Returns:
 // 	movement - the next Movement, if available
 // 	err - any errors
 // 	closed - whether the underlying queue has "closed", meaning no further
 // 	movements can be dequeued.
 func (mpq *movementPQ) DequeueMovement() (movement Movement, err error, closed bool) {
-	n, err := mpq.heap.Pop()
-
-	if err != nil && strings.Contains(err.Error(), "heap is closed") {
+	if mpq.closed {
 		return nil, nil, true
-	} else if err != nil {
-		return nil, err, false
 	}
 
-	next := n.(Movement)
-	return next, nil, false
+	if mpq.items.Len() == 0 {
+		return nil, fmt.Errorf("there are no movements to dequeue, but the queue has not been closed"), false
+	}
+
+	next := heap.Pop(&mpq.items).(*movementHeapItem)
+	delete(mpq.queued, next.movement)
+
+	return next.movement, nil, false
+}
+
+// RemoveMovement takes a movement out of the queue before it can be dequeued.
+// It returns false if the movement was not in the queue.
+func (mpq *movementPQ) RemoveMovement(movement Movement) (removed bool) {
+	item, ok := mpq.queued[movement]
+	if !ok {
+		return false
+	}
+
+	heap.Remove(&mpq.items, item.index)
+	delete(mpq.queued, movement)
+
+	return true
+}
+
+func (mpq *movementPQ) Contains(movement Movement) bool {
+	_, ok := mpq.queued[movement]
+	return ok
 }
 
 func (mpq *movementPQ) Close() {
-	mpq.heap.Close()
+	mpq.closed = true
 }
 
 func (mpq *movementPQ) IsClosed() bool {
-	return mpq.heap.IsClosed()
+	return mpq.closed
 }
 
 func NewMovementPriorityQueue() MovementPriorityQueue {
-	heap := cache.NewHeap(movementToKey, leftMovementIsEarlier)
-
 	return &movementPQ{
-		heap: heap,
+		items:  make(movementHeap, 0),
+		queued: make(map[Movement]*movementHeapItem),
 	}
 }
 
-func movementToKey(movement interface{}) (key string, err error) {
-	mv := movement.(Movement)
-	return occursAtToStr(mv.OccursAt()), nil
+// movementHeap implements heap.Interface.
+type movementHeap []*movementHeapItem
+
+func (mh movementHeap) Len() int {
+	return len(mh)
 }
 
-func occursAtToStr(occursAt time.Time) string {
-	return strconv.FormatInt(occursAt.UnixNano(), 10)
+func (mh movementHeap) Less(i, j int) bool {
+	if mh[i].occursAt == mh[j].occursAt {
+		return mh[i].sequence < mh[j].sequence
+	}
+
+	return mh[i].occursAt < mh[j].occursAt
 }
 
-func leftMovementIsEarlier(left interface{}, right interface{}) bool {
-	l := left.(Movement)
-	r := right.(Movement)
+func (mh movementHeap) Swap(i, j int) {
+	mh[i], mh[j] = mh[j], mh[i]
+	mh[i].index = i
+	mh[j].index = j
+}
+
+func (mh *movementHeap) Push(x interface{}) {
+	item := x.(*movementHeapItem)
+	item.index = len(*mh)
+	*mh = append(*mh, item)
+}
 
-	return l.OccursAt().Before(r.OccursAt())
+func (mh *movementHeap) Pop() interface{} {
+	old := *mh
+	n := len(old)
+	item := old[n-1]
+	old[n-1] = nil // don't hold on to the popped item
+	item.index = -1
+	*mh = old[:n-1]
+	return item
 }
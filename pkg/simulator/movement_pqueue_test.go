@@ -16,6 +16,7 @@
 package simulator
 
 import (
+	"math/rand"
 	"testing"
 	"time"
 
@@ -31,8 +32,7 @@ func TestMovementPQ(t *testing.T) {
 func testMovementPQ(t *testing.T, describe spec.G, it spec.S) {
 	var subject MovementPriorityQueue
 	var movement Movement
-	var theTime, scheduledAt time.Time
-	var shifted bool
+	var theTime time.Time
 	var err error
 
 	describe("EnqueueMovement()", func() {
@@ -42,39 +42,52 @@ func testMovementPQ(t *testing.T, describe spec.G, it spec.S) {
 		})
 
 		describe("when there is an existing Movement scheduled at the same time", func() {
+			var first, second Movement
+
 			it.Before(func() {
 				subject = NewMovementPriorityQueue()
 
-				_, _, err = subject.EnqueueMovement(movement)
+				first = NewMovement("first movement kind", theTime, nil, nil)
+				second = NewMovement("second movement kind", theTime, nil, nil)
+				second.AddNote("second note")
+
+				err = subject.EnqueueMovement(first)
 				assert.NoError(t, err)
 
-				shifted, scheduledAt, err = subject.EnqueueMovement(movement)
+				err = subject.EnqueueMovement(second)
 				assert.NoError(t, err)
+			})
 
+			it("does not time-shift the Movement", func() {
+				_, _, _ = subject.DequeueMovement()
+				dqmv, err, _ := subject.DequeueMovement()
+				assert.NoError(t, err)
+				assert.Equal(t, theTime, dqmv.OccursAt())
 			})
-			it("time-shifts the Movement to the next free time", func() {
-				assert.Equal(t, theTime.Add(1*time.Nanosecond), scheduledAt)
+
+			it("dequeues Movements in the order they were enqueued", func() {
+				firstOut, _, _ := subject.DequeueMovement()
+				secondOut, _, _ := subject.DequeueMovement()
+
+				assert.Equal(t, first, firstOut)
+				assert.Equal(t, second, secondOut)
 			})
 
-			it("indicates that time-shifting occurred", func() {
-				assert.True(t, shifted)
+			it("keeps the Movement's notes", func() {
+				_, _, _ = subject.DequeueMovement()
+				secondOut, _, _ := subject.DequeueMovement()
+				assert.Equal(t, []string{"second note"}, secondOut.Notes())
 			})
 		})
 
-		describe("when no other Movement has been scheduled at the same time", func() {
+		describe("when the queue is closed", func() {
 			it.Before(func() {
 				subject = NewMovementPriorityQueue()
-
-				shifted, scheduledAt, err = subject.EnqueueMovement(movement)
-				assert.NoError(t, err)
+				subject.Close()
 			})
 
-			it("does not time-shift the Movement", func() {
-				assert.Equal(t, theTime, scheduledAt)
-			})
-
-			it("indicates that time-shifting did not occur", func() {
-				assert.False(t, shifted)
+			it("returns an error", func() {
+				assert.Error(t, subject.EnqueueMovement(movement))
 			})
 		})
 	})
@@ -88,7 +101,7 @@ func testMovementPQ(t *testing.T, describe spec.G, it spec.S) {
 		it("returns Movements", func() {
 			var dqmv Movement
 			var err error
-			_, _, err = subject.EnqueueMovement(movement)
+			err = subject.EnqueueMovement(movement)
 			assert.NoError(t, err)
 
 			dqmv, err, _ = subject.DequeueMovement()
@@ -111,6 +124,77 @@ func testMovementPQ(t *testing.T, describe spec.G, it spec.S) {
 			assert.True(t, closed)
 
 		})
+
+		it("returns Movements in time order", func() {
+			later := NewMovement("test movement kind", time.Unix(999, 0), nil, nil)
+			earlier := NewMovement("test movement kind", time.Unix(111, 0), nil, nil)
+
+			assert.NoError(t, subject.EnqueueMovement(later))
+			assert.NoError(t, subject.EnqueueMovement(earlier))
+
+			first, _, _ := subject.DequeueMovement()
+			second, _, _ := subject.DequeueMovement()
+
+			assert.Equal(t, earlier, first)
+			assert.Equal(t, later, second)
+		})
+
+		it("returns an error if the queue is empty but has not closed", func() {
+			mv, err, closed := subject.DequeueMovement()
+
+			assert.Nil(t, mv)
+			assert.Error(t, err)
+			assert.False(t, closed)
+		})
+	})
+
+	describe("RemoveMovement()", func() {
+		it.Before(func() {
+			subject = NewMovementPriorityQueue()
+			movement = NewMovement("test movement kind", time.Unix(111, 0), nil, nil)
+		})
+
+		describe("when the Movement is enqueued", func() {
+			it.Before(func() {
+				assert.NoError(t, subject.EnqueueMovement(movement))
+				assert.NoError(t, subject.EnqueueMovement(NewMovement("other movement kind", time.Unix(999, 0), nil, nil)))
+			})
+
+			it("returns true", func() {
+				assert.True(t, subject.RemoveMovement(movement))
+			})
+
+			it("removes the Movement from the queue", func() {
+				subject.RemoveMovement(movement)
+				assert.False(t, subject.Contains(movement))
+
+				next, _, _ := subject.DequeueMovement()
+				assert.Equal(t, MovementKind("other movement kind"), next.Kind())
+			})
+		})
+
+		describe("when the Movement is not enqueued", func() {
+			it("returns false", func() {
+				assert.False(t, subject.RemoveMovement(movement))
+			})
+		})
+	})
+
+	describe("Contains()", func() {
+		it.Before(func() {
+			subject = NewMovementPriorityQueue()
+			movement = NewMovement("test movement kind", time.Unix(111, 0), nil, nil)
+		})
+
+		it("is true while the Movement is enqueued", func() {
+			assert.False(t, subject.Contains(movement))
+
+			assert.NoError(t, subject.EnqueueMovement(movement))
+			assert.True(t, subject.Contains(movement))
+
+			_, _, _ = subject.DequeueMovement()
+			assert.False(t, subject.Contains(movement))
+		})
 	})
 
 	describe("Close()", func() {
@@ -135,39 +219,34 @@ func testMovementPQ(t *testing.T, describe spec.G, it spec.S) {
 			assert.False(t, subject.IsClosed())
 		})
 	})
+}
 
-	describe("helpers", func() {
-		describe("movementToKey()", func() {
-			it.Before(func() {
-				movement = NewMovement("test movement kind", time.Unix(0, 111000111), nil, nil)
-			})
-
-			it("returns the OccursAt() as a string", func() {
-				key, err := movementToKey(movement)
-				assert.NoError(t, err)
-				assert.Equal(t, "111000111", key)
-			})
-		})
-
-		describe("leftMovementIsEarlier()", func() {
-			var earlier, later Movement
-
-			it.Before(func() {
-				earlier = NewMovement("test movement kind", time.Unix(111, 0), nil, nil)
-				later = NewMovement("test movement kind", time.Unix(999, 0), nil, nil)
-			})
+func benchmarkDenseTraffic(b *testing.B, movementsPerSecond int) {
+	rng := rand.New(rand.NewSource(1))
+	startAt := time.Unix(0, 0)
+	movements := make([]Movement, movementsPerSecond)
+	for i := range movements {
+		// millisecond resolution, so that many movements occur at the same instant
+		occursAt := startAt.Add(time.Duration(rng.Int63n(1000)) * time.Millisecond)
+		movements[i] = NewMovement("benchmark movement kind", occursAt, nil, nil)
+	}
+
+	b.ResetTimer()
+	for n := 0; n < b.N; n++ {
+		subject := NewMovementPriorityQueue()
+		for _, mv := range movements {
+			subject.EnqueueMovement(mv)
+		}
+		for range movements {
+			subject.DequeueMovement()
+		}
+	}
+}
 
-			describe("when the first argument is earlier", func() {
-				it("returns true", func() {
-					assert.True(t, leftMovementIsEarlier(earlier, later))
-				})
-			})
+func BenchmarkMovementPQ1000PerSecond(b *testing.B) {
+	benchmarkDenseTraffic(b, 1000)
+}
 
-			describe("when the second argument is earlier", func() {
-				it("returns false", func() {
-					assert.False(t, leftMovementIsEarlier(later, earlier))
-				})
-			})
-		})
-	})
+func BenchmarkMovementPQ10000PerSecond(b *testing.B) {
+	benchmarkDenseTraffic(b, 10000)
 }
@@ -0,0 +1,74 @@
+/*
+ * Copyright (C) 2019-Present Pivotal Software, Inc. All rights reserved.
+ *
+ * This program and the accompanying materials are made available under the terms
+ * of the Apache License, Version 2.0 (the "License”); you may not use this file
+ * except in compliance with the License. You may obtain a copy of the License at:
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software distributed
+ * under the License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR
+ * CONDITIONS OF ANY KIND, either express or implied. See the License for the
+ * specific language governing permissions and limitations under the License.
+ */
+
+package simulator
+
+import "time"
+
+// ScheduledMovement is a handle on a Movement that has been added to an Environment's schedule.
+// While the movement is pending it can be withdrawn with Cancel() or moved with Reschedule().
+type ScheduledMovement interface {
+	Movement() Movement
+	IsPending() bool
+	Cancel() (cancelled bool)
+	Reschedule(occursAt time.Time) (rescheduled bool)
+}
+
+type scheduledMovement struct {
+	env      *environment
+	movement Movement
+}
+
+func (sm *scheduledMovement) Movement() Movement {
+	return sm.movement
+}
+
+func (sm *scheduledMovement) IsPending() bool {
+	return sm.env.futureMovements.Contains(sm.movement)
+}
+
+// Cancel withdraws the movement from the schedule. The movement is recorded as ignored.
+// It returns false if the movement has already occurred or was never scheduled.
+func (sm *scheduledMovement) Cancel() (cancelled bool) {
+	if !sm.env.futureMovements.RemoveMovement(sm.movement) {
+		return false
+	}
+
+	sm.env.ignore(IgnoredMovement{
+		Reason:   MovementCancelled,
+		Movement: sm.movement,
+	})
+
+	return true
+}
+
+// Reschedule moves a pending movement to occur at a different time. The same scheduling rules
+// as Environment.AddToSchedule() apply, so a movement rescheduled into the past or past the
+// halt is recorded as ignored and no longer pending.
+// It returns false if the movement was not pending or could not be rescheduled.
+func (sm *scheduledMovement) Reschedule(occursAt time.Time) (rescheduled bool) {
+	if !sm.env.futureMovements.RemoveMovement(sm.movement) {
+		return false
+	}
+
+	moved := NewMovement(sm.movement.Kind(), occursAt, sm.movement.From(), sm.movement.To())
+	for _, note := range sm.movement.Notes() {
+		moved.AddNote(note)
+	}
+
+	sm.movement = moved
+
+	return sm.env.schedule(moved)
+}
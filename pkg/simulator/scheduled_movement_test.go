@@ -0,0 +1,181 @@
+/*
+ * Copyright (C) 2019-Present Pivotal Software, Inc. All rights reserved.
+ *
+ * This program and the accompanying materials are made available under the terms
+ * of the Apache License, Version 2.0 (the "License”); you may not use this file
+ * except in compliance with the License. You may obtain a copy of the License at:
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software distributed
+ * under the License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR
+ * CONDITIONS OF ANY KIND, either express or implied. See the License for the
+ * specific language governing permissions and limitations under the License.
+ */
+
+package simulator
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/sclevine/spec"
+	"github.com/sclevine/spec/report"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestScheduledMovement(t *testing.T) {
+	spec.Run(t, "ScheduledMovement", testScheduledMovement, spec.Report(report.Terminal{}))
+}
+
+func testScheduledMovement(t *testing.T, describe spec.G, it spec.S) {
+	var env Environment
+	var subject ScheduledMovement
+	var added bool
+	var fromStock SourceStock
+	var toStock SinkStock
+	var startTime time.Time
+
+	it.Before(func() {
+		startTime = time.Unix(222222, 0)
+		env = NewEnvironment(context.Background(), startTime, 555555*time.Second)
+		fromStock = &EchoSourceStockType{
+			name: "from stock",
+			kind: "test entity kind",
+		}
+		toStock = NewSinkStock("to stock", "test entity kind")
+	})
+
+	describe("ScheduleMovement()", func() {
+		describe("when the movement can be scheduled", func() {
+			it.Before(func() {
+				subject, added = env.ScheduleMovement(NewMovement("test movement kind", time.Unix(333333, 0), fromStock, toStock))
+			})
+
+			it("returns true", func() {
+				assert.True(t, added)
+			})
+
+			it("returns a pending handle", func() {
+				assert.True(t, subject.IsPending())
+			})
+		})
+
+		describe("when the movement can't be scheduled", func() {
+			it.Before(func() {
+				subject, added = env.ScheduleMovement(NewMovement("test movement kind", time.Unix(111111, 0), fromStock, toStock))
+			})
+
+			it("returns false", func() {
+				assert.False(t, added)
+			})
+
+			it("returns a handle that is not pending", func() {
+				assert.False(t, subject.IsPending())
+			})
+		})
+	})
+
+	describe("Cancel()", func() {
+		var cancelled bool
+		var completed []CompletedMovement
+		var ignored []IgnoredMovement
+
+		describe("when the movement is pending", func() {
+			it.Before(func() {
+				subject, _ = env.ScheduleMovement(NewMovement("test movement kind", time.Unix(333333, 0), fromStock, toStock))
+				cancelled = subject.Cancel()
+
+				completed, ignored, _ = env.Run()
+			})
+
+			it("returns true", func() {
+				assert.True(t, cancelled)
+			})
+
+			it("is no longer pending", func() {
+				assert.False(t, subject.IsPending())
+			})
+
+			it("does not complete the movement", func() {
+				assert.Len(t, completed, 2) // start and halt scenario only
+			})
+
+			it("records the movement as ignored", func() {
+				assert.Contains(t, ignored, IgnoredMovement{Reason: MovementCancelled, Movement: subject.Movement()})
+			})
+
+			it("can't be cancelled twice", func() {
+				assert.False(t, subject.Cancel())
+			})
+		})
+
+		describe("when the movement has already occurred", func() {
+			it.Before(func() {
+				subject, _ = env.ScheduleMovement(NewMovement("test movement kind", time.Unix(333333, 0), fromStock, toStock))
+				_, _, _ = env.Run()
+				cancelled = subject.Cancel()
+			})
+
+			it("returns false", func() {
+				assert.False(t, cancelled)
+			})
+		})
+	})
+
+	describe("Reschedule()", func() {
+		var original Movement
+		var rescheduled bool
+		var completed []CompletedMovement
+		var ignored []IgnoredMovement
+
+		describe("to a time during the simulation", func() {
+			it.Before(func() {
+				original = NewMovement("test movement kind", time.Unix(333333, 0), fromStock, toStock)
+				original.AddNote("original note")
+				subject, _ = env.ScheduleMovement(original)
+				rescheduled = subject.Reschedule(time.Unix(444444, 0))
+
+				completed, _, _ = env.Run()
+			})
+
+			it("returns true", func() {
+				assert.True(t, rescheduled)
+			})
+
+			it("moves the movement to the new time", func() {
+				assert.Equal(t, time.Unix(444444, 0), subject.Movement().OccursAt())
+				assert.Equal(t, time.Unix(444444, 0), completed[1].Movement.OccursAt())
+			})
+
+			it("keeps the kind, stocks and notes", func() {
+				assert.Equal(t, original.Kind(), subject.Movement().Kind())
+				assert.Equal(t, original.From(), subject.Movement().From())
+				assert.Equal(t, original.To(), subject.Movement().To())
+				assert.Equal(t, []string{"original note"}, subject.Movement().Notes())
+			})
+
+			it("only occurs once", func() {
+				assert.Len(t, completed, 3)
+			})
+		})
+
+		describe("to a time after the simulation halts", func() {
+			it.Before(func() {
+				subject, _ = env.ScheduleMovement(NewMovement("test movement kind", time.Unix(333333, 0), fromStock, toStock))
+				rescheduled = subject.Reschedule(time.Unix(999999, 0))
+
+				completed, ignored, _ = env.Run()
+			})
+
+			it("returns false", func() {
+				assert.False(t, rescheduled)
+			})
+
+			it("records the movement as ignored", func() {
+				assert.Contains(t, ignored, IgnoredMovement{Reason: OccursAfterHalt, Movement: subject.Movement()})
+			})
+		})
+	})
+}